@@ -5,7 +5,7 @@ options {
 }
 
 program
-    :   declaration* (main) EOF
+    :   declaration* (main | contract) EOF
     ;
 
 module
@@ -35,17 +35,69 @@ main
     : FUNC MAINFUNC LEFTPARA RIGHTPARA block NEWLINE*
     ;
 
+contract
+    :   CONTRACT IDENT LEFTFIGURE (NEWLINE|SEMICOLON)* (contractMember (NEWLINE|SEMICOLON)*)* RIGHTFIGURE NEWLINE*
+    ;
+
+contractMember
+    :   ABI METHOD IDENT LEFTPARA (abiParam (COMMA abiParam)* )? RIGHTPARA (RETURNS LEFTPARA abiType RIGHTPARA)? block   # AbiMethod
+    |   BARE IDENT (COMMA IDENT)* block                                                                                # BareCall
+    ;
+
+abiParam
+    :   IDENT COLON abiType
+    ;
+
+abiType
+    :   (IDENT | LEFTPARA abiType (COMMA abiType)* RIGHTPARA) abiArray*
+    ;
+
+abiArray
+    :   LEFTSQUARE NUMBER? RIGHTSQUARE
+    ;
+
 declaration
     :   decl (NEWLINE|SEMICOLON)
     |   IMPORT MODULENAME MODULENAMEEND
-    |   INLINE? FUNC IDENT LEFTPARA (IDENT (COMMA IDENT)* )? RIGHTPARA block NEWLINE
+    |   INLINE? FUNC IDENT LEFTPARA (funParam (COMMA funParam)* )? RIGHTPARA (COLON typeName (COMMA typeName)*)? block NEWLINE
+    |   structDef NEWLINE
     |   NEWLINE|SEMICOLON
     ;
 
+funParam
+    :   IDENT (COLON typeName)?
+    ;
+
+typeName
+    :   IDENT (LEFTSQUARE RIGHTSQUARE)?
+    ;
+
+structDef
+    :   STRUCT IDENT LEFTFIGURE (NEWLINE|SEMICOLON)* structField ((NEWLINE|SEMICOLON)+ structField)* (NEWLINE|SEMICOLON)* RIGHTFIGURE
+    ;
+
+structField
+    :   IDENT IDENT (LEFTSQUARE NUMBER RIGHTSQUARE)?
+    ;
+
 // named rules for tree-walking only
 condition
     :   IF condIfExpr condTrueBlock (NEWLINE? ELSE condFalseBlock)?   # IfStatement
-    |   FOR condForExpr condTrueBlock   # ForStatement
+    |   FOR (forInit? SEMICOLON condForExpr SEMICOLON forStep? | condForExpr) condTrueBlock   # ForStatement
+    |   SWITCH expr LEFTFIGURE NEWLINE* switchCase* (DEFAULT COLON block NEWLINE*)? RIGHTFIGURE  # SwitchStatement
+    ;
+
+switchCase
+    :   CASE expr (COMMA expr)* COLON block NEWLINE*
+    ;
+
+forInit
+    :   decl
+    |   assignment
+    ;
+
+forStep
+    :   assignment
     ;
 
 condTrueBlock
@@ -64,23 +116,23 @@ innertxn
 
 termination
     :   ERR (NEWLINE|SEMICOLON)                     # TermError
-    |   RET expr (NEWLINE|SEMICOLON)                # TermReturn
+    |   RET (expr (COMMA expr)*)? (NEWLINE|SEMICOLON) # TermReturn
     |   ASSERT LEFTPARA expr RIGHTPARA              # TermAssert
     |   BREAK (NEWLINE|SEMICOLON)                   # Break
+    |   CONTINUE (NEWLINE|SEMICOLON)                # Continue
     ;
 
 decl
-    :   LET IDENT EQ expr                          # DeclareVar
-    |   LET IDENT COMMA IDENT EQ tupleExpr         # DeclareVarTupleExpr
-    |   LET IDENT COMMA IDENT COMMA IDENT COMMA IDENT EQ tupleExpr # DeclareQuadrupleExpr
-    |   CONST IDENT EQ NUMBER                      # DeclareNumberConst
-    |   CONST IDENT EQ STRING                      # DeclareStringConst
+    :   LET IDENT (COLON typeName)? (AT NUMBER)? EQ expr   # DeclareVar
+    |   LET IDENT (COMMA IDENT)+ EQ tupleExpr              # DeclareVarTupleExpr
+    |   CONST IDENT EQ NUMBER                              # DeclareNumberConst
+    |   CONST IDENT EQ STRING                              # DeclareStringConst
     ;
 
 assignment
     :   IDENT EQ expr                              # Assign
-    |   IDENT COMMA IDENT EQ tupleExpr             # AssignTuple
-    |   IDENT COMMA IDENT COMMA IDENT COMMA IDENT EQ tupleExpr      # AssignQuadruple
+    |   IDENT (COMMA IDENT)+ EQ tupleExpr          # AssignTuple
+    |   IDENT DOT IDENT EQ expr                    # AssignStructField
     ;
 
 expr
@@ -90,6 +142,7 @@ expr
     |	LEFTPARA expr RIGHTPARA                     # Group
     |   functionCall                                # FunctionCallExpr
     |   builtinVarExpr                              # BuiltinObject
+    |   expr DOT IDENT                              # StructFieldExpr
     |   op=LNOT expr                                # Not
     |   op=BNOT expr                                # BitNot
     |	expr op=(MUL|DIV|MOD) expr                  # MulDivMod
@@ -98,6 +151,7 @@ expr
     |   expr op=(BOR|BXOR|BAND) expr                # BitOp
     |   expr op=(LAND|LOR) expr                     # AndOr
     |   condExpr                                    # IfExpr
+    |   switchCondExpr                              # SwitchExpr
     |   (TOINT|TOBYTE) LEFTPARA (expr) RIGHTPARA    # TypeCastExpr
     ;
 
@@ -109,6 +163,7 @@ tupleExpr
     |   ECDSADECOMPRESS LEFTPARA ( ECDSACURVE COMMA expr ) RIGHTPARA
     |   ECDSARECOVER LEFTPARA ( ECDSACURVE COMMA expr COMMA expr COMMA expr COMMA expr ) RIGHTPARA
     |   builtinVarTupleExpr
+    |   functionCall
     ;
 
 builtinVarTupleExpr
@@ -183,6 +238,14 @@ condExpr
     : IF condIfExpr LEFTFIGURE condTrueExpr RIGHTFIGURE ELSE LEFTFIGURE condFalseExpr RIGHTFIGURE
     ;
 
+switchCondExpr
+    : SWITCH expr LEFTFIGURE NEWLINE* switchExprCase* DEFAULT COLON LEFTFIGURE expr RIGHTFIGURE NEWLINE* RIGHTFIGURE
+    ;
+
+switchExprCase
+    : CASE expr (COMMA expr)* COLON LEFTFIGURE expr RIGHTFIGURE NEWLINE*
+    ;
+
 condTrueExpr
     : expr                                          # IfExprTrue
     ;
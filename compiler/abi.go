@@ -0,0 +1,364 @@
+//--------------------------------------------------------------------------------------------------
+//
+// ARC-4 ABI types, method selectors and values encoding
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// abiReturnPrefix is logged along with the return value of ARC-4 method
+var abiReturnPrefix = []byte{0x15, 0x1f, 0x7c, 0x75}
+
+// maxAbiArgs is the number of method arguments ARC-4 passes in separate application args,
+// the rest are packed into a tuple in the last arg and such methods are not supported
+const maxAbiArgs = 15
+
+// abiBareActions maps bare call actions to OnCompletion values, create is a NoOp call creating the application
+var abiBareActions = map[string]uint64{
+	"create":   0,
+	"optin":    1,
+	"closeout": 2,
+	"update":   4,
+	"delete":   5,
+}
+
+// abiBareActionNames lists bare call actions in OnCompletion order
+var abiBareActionNames = []string{"create", "optin", "closeout", "update", "delete"}
+
+type abiKind int
+
+const (
+	abiUint abiKind = iota
+	abiByte
+	abiBool
+	abiAddress
+	abiString
+	abiStaticArray
+	abiDynamicArray
+	abiTuple
+	abiAccount
+	abiAsset
+	abiApplication
+)
+
+// abiType is ARC-4 type of a method argument or return value
+type abiType struct {
+	kind   abiKind
+	bits   uint       // size of uintN and byte in bits
+	length uint       // static array length
+	elem   *abiType   // array element type
+	fields []*abiType // tuple fields types
+
+	// struct the tuple is decoded to, nil for other tuples
+	def *structDefNode
+}
+
+// abiTypeFromName returns ARC-4 type by the name of non-composite type, nil if there is no such type
+func abiTypeFromName(name string) *abiType {
+	switch name {
+	case "byte":
+		return &abiType{kind: abiByte, bits: 8}
+	case "bool":
+		return &abiType{kind: abiBool}
+	case "address":
+		return &abiType{kind: abiAddress}
+	case "string":
+		return &abiType{kind: abiString}
+	case "account":
+		return &abiType{kind: abiAccount}
+	case "asset":
+		return &abiType{kind: abiAsset}
+	case "application":
+		return &abiType{kind: abiApplication}
+	}
+	if strings.HasPrefix(name, "uint") {
+		bits, err := strconv.ParseUint(name[len("uint"):], 10, 64)
+		if err == nil && bits >= 8 && bits <= 512 && bits%8 == 0 && name == fmt.Sprintf("uint%d", bits) {
+			return &abiType{kind: abiUint, bits: uint(bits)}
+		}
+	}
+	return nil
+}
+
+// abiStructType returns static tuple type the struct is encoded as
+func abiStructType(ctx *context, def *structDefNode) *abiType {
+	t := &abiType{kind: abiTuple, def: def}
+	for _, field := range def.fields {
+		switch field.theType {
+		case intType:
+			t.fields = append(t.fields, &abiType{kind: abiUint, bits: 64})
+		case bytesType:
+			t.fields = append(t.fields, &abiType{kind: abiStaticArray, length: field.size, elem: &abiType{kind: abiByte, bits: 8}})
+		default:
+			nested, _ := ctx.lookupStruct(field.theType)
+			t.fields = append(t.fields, abiStructType(ctx, nested))
+		}
+	}
+	return t
+}
+
+func (t *abiType) String() string {
+	switch t.kind {
+	case abiUint:
+		return fmt.Sprintf("uint%d", t.bits)
+	case abiByte:
+		return "byte"
+	case abiBool:
+		return "bool"
+	case abiAddress:
+		return "address"
+	case abiString:
+		return "string"
+	case abiStaticArray:
+		return fmt.Sprintf("%s[%d]", t.elem, t.length)
+	case abiDynamicArray:
+		return fmt.Sprintf("%s[]", t.elem)
+	case abiTuple:
+		fields := make([]string, len(t.fields))
+		for i, field := range t.fields {
+			fields[i] = field.String()
+		}
+		return fmt.Sprintf("(%s)", strings.Join(fields, ","))
+	case abiAccount:
+		return "account"
+	case abiAsset:
+		return "asset"
+	case abiApplication:
+		return "application"
+	}
+	return "unknown"
+}
+
+// reference reports if the type is an index into the transaction accounts, assets or applications arrays
+func (t *abiType) reference() bool {
+	return t.kind == abiAccount || t.kind == abiAsset || t.kind == abiApplication
+}
+
+// static reports if the type has fixed encoded size
+func (t *abiType) static() bool {
+	switch t.kind {
+	case abiString, abiDynamicArray:
+		return false
+	case abiStaticArray:
+		return t.elem.static()
+	case abiTuple:
+		for _, field := range t.fields {
+			if !field.static() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// size returns encoded size of the static type, sequential bools are packed into bytes
+func (t *abiType) size() uint {
+	switch t.kind {
+	case abiUint, abiByte:
+		return t.bits / 8
+	case abiAddress:
+		return 32
+	case abiStaticArray:
+		if t.elem.kind == abiBool {
+			return (t.length + 7) / 8
+		}
+		return t.length * t.elem.size()
+	case abiTuple:
+		size := uint(0)
+		bools := uint(0)
+		for _, field := range t.fields {
+			if field.kind == abiBool {
+				bools++
+				continue
+			}
+			size += (bools+7)/8 + field.size()
+			bools = 0
+		}
+		return size + (bools+7)/8
+	}
+	return 1
+}
+
+// unprefixed reports if the value is decoded to its content without the length prefix.
+// It is the case for strings and dynamic arrays of static elements except bools,
+// other dynamic types are passed as encoded.
+func (t *abiType) unprefixed() bool {
+	return t.kind == abiString || (t.kind == abiDynamicArray && t.elem.kind != abiBool && t.elem.static())
+}
+
+// elemSize returns size of the unprefixed type element
+func (t *abiType) elemSize() uint {
+	if t.kind == abiString {
+		return 1
+	}
+	return t.elem.size()
+}
+
+// integer reports if the value is decoded to uint64
+func (t *abiType) integer() bool {
+	switch t.kind {
+	case abiUint, abiByte:
+		return t.bits <= 64
+	case abiBool, abiAsset, abiApplication:
+		return true
+	}
+	return false
+}
+
+// valueType returns type of the decoded value
+func (t *abiType) valueType() exprType {
+	if t.integer() {
+		return intType
+	}
+	if t.def != nil {
+		return structType(t.def.name)
+	}
+	return bytesType
+}
+
+// decodeLiterals returns integer literals used by decoding of the type
+func (t *abiType) decodeLiterals() []uint {
+	if t.unprefixed() {
+		return []uint{0, 2, t.elemSize()}
+	}
+	if t.static() {
+		return []uint{t.size()}
+	}
+	return nil
+}
+
+// encodeLiterals returns integer literals used by encoding of the type
+func (t *abiType) encodeLiterals() []uint {
+	switch {
+	case t.kind == abiBool:
+		return []uint{7}
+	case t.integer():
+		if t.bits < 64 {
+			return []uint{1 << t.bits}
+		}
+		return nil
+	case t.unprefixed():
+		return []uint{t.elemSize()}
+	case t.static() && t.def == nil:
+		return []uint{t.size()}
+	}
+	return nil
+}
+
+// codegenDecode converts ARC-4 encoded value on top of the stack to the value of valueType
+func (t *abiType) codegenDecode(ostream io.Writer, ctx *context) {
+	if t.unprefixed() {
+		// the length prefix must match the content length
+		fmt.Fprintf(ostream, "dup\n")
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(0))
+		fmt.Fprintf(ostream, "extract_uint16\n")
+		if size := t.elemSize(); size > 1 {
+			fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(size))
+			fmt.Fprintf(ostream, "*\n")
+		}
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(2))
+		fmt.Fprintf(ostream, "+\n")
+		fmt.Fprintf(ostream, "dig 1\n")
+		fmt.Fprintf(ostream, "len\n")
+		fmt.Fprintf(ostream, "==\n")
+		fmt.Fprintf(ostream, "assert\n")
+		fmt.Fprintf(ostream, "extract 2 0\n")
+		return
+	}
+	if !t.static() {
+		return
+	}
+
+	checkLength(ostream, ctx, t.size())
+	switch t.kind {
+	case abiBool:
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(0))
+		fmt.Fprintf(ostream, "getbit\n")
+	case abiAccount:
+		fmt.Fprintf(ostream, "btoi\n")
+		fmt.Fprintf(ostream, "txnas Accounts\n")
+	case abiAsset:
+		fmt.Fprintf(ostream, "btoi\n")
+		fmt.Fprintf(ostream, "txnas Assets\n")
+	case abiApplication:
+		fmt.Fprintf(ostream, "btoi\n")
+		fmt.Fprintf(ostream, "txnas Applications\n")
+	default:
+		if t.integer() {
+			fmt.Fprintf(ostream, "btoi\n")
+		}
+	}
+}
+
+// codegenEncode converts the value of valueType on top of the stack to ARC-4 encoding
+func (t *abiType) codegenEncode(ostream io.Writer, ctx *context) {
+	switch {
+	case t.kind == abiBool:
+		fmt.Fprintf(ostream, "!\n")
+		fmt.Fprintf(ostream, "!\n")
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(7))
+		fmt.Fprintf(ostream, "shl\n")
+		fmt.Fprintf(ostream, "itob\n")
+		fmt.Fprintf(ostream, "extract 7 1\n")
+	case t.integer():
+		size := t.bits / 8
+		if size < 8 {
+			// the value must fit into the type
+			fmt.Fprintf(ostream, "dup\n")
+			fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(1<<t.bits))
+			fmt.Fprintf(ostream, "<\n")
+			fmt.Fprintf(ostream, "assert\n")
+		}
+		fmt.Fprintf(ostream, "itob\n")
+		if size < 8 {
+			fmt.Fprintf(ostream, "extract %d %d\n", 8-size, size)
+		}
+	case t.unprefixed():
+		fmt.Fprintf(ostream, "dup\n")
+		fmt.Fprintf(ostream, "len\n")
+		if size := t.elemSize(); size > 1 {
+			fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(size))
+			fmt.Fprintf(ostream, "/\n")
+		}
+		fmt.Fprintf(ostream, "itob\n")
+		fmt.Fprintf(ostream, "extract 6 2\n")
+		fmt.Fprintf(ostream, "swap\n")
+		fmt.Fprintf(ostream, "concat\n")
+	case t.static() && t.def == nil:
+		checkLength(ostream, ctx, t.size())
+	}
+}
+
+// abiMethod is ARC-4 signature of a contract method
+type abiMethod struct {
+	name    string
+	args    []*abiType
+	returns *abiType // nil for void methods
+}
+
+// signature returns the method signature selector is computed from, like add(uint64,uint64)uint64
+func (m *abiMethod) signature() string {
+	args := make([]string, len(m.args))
+	for i, arg := range m.args {
+		args[i] = arg.String()
+	}
+	returns := "void"
+	if m.returns != nil {
+		returns = m.returns.String()
+	}
+	return fmt.Sprintf("%s(%s)%s", m.name, strings.Join(args, ","), returns)
+}
+
+// selector returns the first 4 bytes of SHA-512/256 hash of the method signature
+func (m *abiMethod) selector() []byte {
+	hash := sha512.Sum512_256([]byte(m.signature()))
+	return hash[:4]
+}
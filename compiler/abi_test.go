@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbiTypes(t *testing.T) {
+	a := require.New(t)
+
+	uint64Type := abiTypeFromName("uint64")
+	boolType := abiTypeFromName("bool")
+	tests := []struct {
+		theType   *abiType
+		name      string
+		static    bool
+		size      uint
+		valueType exprType
+	}{
+		{uint64Type, "uint64", true, 8, intType},
+		{abiTypeFromName("uint16"), "uint16", true, 2, intType},
+		{abiTypeFromName("uint256"), "uint256", true, 32, bytesType},
+		{abiTypeFromName("byte"), "byte", true, 1, intType},
+		{boolType, "bool", true, 1, intType},
+		{abiTypeFromName("address"), "address", true, 32, bytesType},
+		{abiTypeFromName("string"), "string", false, 0, bytesType},
+		{abiTypeFromName("asset"), "asset", true, 1, intType},
+		{abiTypeFromName("account"), "account", true, 1, bytesType},
+		{&abiType{kind: abiStaticArray, elem: uint64Type, length: 3}, "uint64[3]", true, 24, bytesType},
+		{&abiType{kind: abiStaticArray, elem: boolType, length: 9}, "bool[9]", true, 2, bytesType},
+		{&abiType{kind: abiDynamicArray, elem: uint64Type}, "uint64[]", false, 0, bytesType},
+		{&abiType{kind: abiTuple, fields: []*abiType{boolType, boolType, uint64Type, boolType}}, "(bool,bool,uint64,bool)", true, 10, bytesType},
+		{&abiType{kind: abiTuple, fields: []*abiType{uint64Type, abiTypeFromName("string")}}, "(uint64,string)", false, 0, bytesType},
+	}
+	for _, test := range tests {
+		a.Equal(test.name, test.theType.String())
+		a.Equal(test.static, test.theType.static(), test.name)
+		if test.static {
+			a.Equal(test.size, test.theType.size(), test.name)
+		}
+		a.Equal(test.valueType, test.theType.valueType(), test.name)
+	}
+
+	for _, name := range []string{"uint", "uint7", "uint0", "uint520", "uint064", "int64", "bytes"} {
+		a.Nil(abiTypeFromName(name), name)
+	}
+}
+
+func TestAbiSelector(t *testing.T) {
+	a := require.New(t)
+
+	uint64Type := abiTypeFromName("uint64")
+	method := abiMethod{name: "add", args: []*abiType{uint64Type, uint64Type}, returns: uint64Type}
+	a.Equal("add(uint64,uint64)uint64", method.signature())
+	a.Equal([]byte{0xfe, 0x6b, 0xdf, 0x69}, method.selector())
+
+	method = abiMethod{name: "transfer", args: []*abiType{abiTypeFromName("account"), abiTypeFromName("asset"), uint64Type}}
+	a.Equal("transfer(account,asset,uint64)void", method.signature())
+	a.Equal([]byte{0xee, 0x30, 0x7e, 0xba}, method.selector())
+}
+
+func TestAbiCodegen(t *testing.T) {
+	a := require.New(t)
+
+	ctx := newContext("root", nil)
+	codegen := func(theType *abiType, encode bool) string {
+		literals := theType.decodeLiterals()
+		if encode {
+			literals = theType.encodeLiterals()
+		}
+		for _, value := range literals {
+			ctx.addUintLiteral(value)
+		}
+		buf := new(bytes.Buffer)
+		if encode {
+			theType.codegenEncode(buf, ctx)
+		} else {
+			theType.codegenDecode(buf, ctx)
+		}
+		return buf.String()
+	}
+
+	uint64Type := abiTypeFromName("uint64")
+	CompareTEAL(a, "dup\nlen\nintc *\n==\nassert\nbtoi\n", codegen(uint64Type, false))
+	CompareTEAL(a, "itob\n", codegen(uint64Type, true))
+
+	uint16Type := abiTypeFromName("uint16")
+	CompareTEAL(a, "dup\nintc *\n<\nassert\nitob\nextract 6 2\n", codegen(uint16Type, true))
+
+	CompareTEAL(a, "dup\nlen\nintc *\n==\nassert\nintc *\ngetbit\n", codegen(abiTypeFromName("bool"), false))
+	CompareTEAL(a, "!\n!\nintc *\nshl\nitob\nextract 7 1\n", codegen(abiTypeFromName("bool"), true))
+
+	stringType := abiTypeFromName("string")
+	CompareTEAL(a, "dup\nintc *\nextract_uint16\nintc *\n+\ndig 1\nlen\n==\nassert\nextract 2 0\n", codegen(stringType, false))
+	CompareTEAL(a, "dup\nlen\nitob\nextract 6 2\nswap\nconcat\n", codegen(stringType, true))
+
+	arrayType := &abiType{kind: abiDynamicArray, elem: uint64Type}
+	CompareTEAL(a, "dup\nintc *\nextract_uint16\nintc *\n*\nintc *\n+\ndig 1\nlen\n==\nassert\nextract 2 0\n", codegen(arrayType, false))
+	CompareTEAL(a, "dup\nlen\nintc *\n/\nitob\nextract 6 2\nswap\nconcat\n", codegen(arrayType, true))
+
+	// arrays of dynamic elements are passed as encoded
+	nestedType := &abiType{kind: abiDynamicArray, elem: stringType}
+	a.Empty(codegen(nestedType, false))
+	a.Empty(codegen(nestedType, true))
+
+	CompareTEAL(a, "dup\nlen\nintc *\n==\nassert\nbtoi\ntxnas Accounts\n", codegen(abiTypeFromName("account"), false))
+
+	// bare return of a void method only approves the call
+	def := newFunDefNode(ctx, nil)
+	def.method = &abiMethod{name: "stop"}
+	ret := newReturnNode(ctx, def)
+	ret.definition = def
+	buf := new(bytes.Buffer)
+	ret.Codegen(buf)
+	CompareTEAL(a, "intc 1\nreturn\n", buf.String())
+}
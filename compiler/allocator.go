@@ -0,0 +1,440 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Scratch space allocation
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	"fmt"
+	"sort"
+)
+
+const maxScratchSlots = 256
+
+// varKey identifies a variable by the context it is declared in
+type varKey struct {
+	ctx  *context
+	name string
+}
+
+// varLifetime describes when a variable is live.
+// Points are numbers of variable references in code generation order.
+type varLifetime struct {
+	key   varKey
+	scope *funDefNode // non-inline function the variable belongs to, nil for main and globals
+	start int
+	end   int
+	refs  []int
+	pos   sourcePos
+	// last is the position of the last reference in the declaration file
+	last sourcePos
+
+	// pinned variables are used by several functions and are live for the whole program
+	pinned   bool
+	reserved bool
+	address  uint
+
+	// non-inline functions called while the variable is live
+	across map[*funDefNode]bool
+}
+
+type loopRange struct {
+	scope *funDefNode
+	start int
+	end   int
+}
+
+type callSite struct {
+	point  int
+	callee *funDefNode
+}
+
+type allocator struct {
+	point  int
+	scope  *funDefNode
+	vars   map[varKey]*varLifetime
+	order  []*varLifetime
+	loops  []loopRange
+	calls  map[*funDefNode][]callSite
+	scopes []*funDefNode
+}
+
+func newAllocator() (a *allocator) {
+	a = new(allocator)
+	a.vars = make(map[varKey]*varLifetime)
+	a.order = make([]*varLifetime, 0, 64)
+	a.loops = make([]loopRange, 0, 8)
+	a.calls = make(map[*funDefNode][]callSite)
+	a.scopes = []*funDefNode{nil}
+	return
+}
+
+// allocateScratch assigns scratch slots to all variables of the program.
+// Slots of variables that are not live anymore are reused.
+func allocateScratch(prog TreeNodeIf) []ParserError {
+	a := newAllocator()
+	a.walk(prog)
+	if root, ok := prog.(*programNode); ok {
+		for _, fun := range root.nonInlineFunc {
+			a.scope = fun
+			a.scopes = append(a.scopes, fun)
+			a.walk(fun)
+		}
+	}
+	a.extendLoops()
+	a.markCalls()
+	if errors := a.assign(); len(errors) > 0 {
+		return errors
+	}
+	if root, ok := prog.(*programNode); ok {
+		root.variables = a.variables()
+		for _, v := range a.order {
+			if v.reserved {
+				root.reserved = append(root.reserved, v.address)
+			}
+		}
+	}
+	return nil
+}
+
+// ReservedSlots returns scratch slots of variables declared with explicit slots,
+// other programs of the group might read them with gload
+func ReservedSlots(prog TreeNodeIf) []uint {
+	if root, ok := prog.(*programNode); ok {
+		return root.reserved
+	}
+	return nil
+}
+
+func (a *allocator) next() int {
+	p := a.point
+	a.point++
+	return p
+}
+
+// declarationContext returns context the variable is declared in
+func declarationContext(ctx *context, name string) *context {
+	for current := ctx; current != nil; current = current.parent {
+		if _, ok := current.vars[name]; ok {
+			return current
+		}
+	}
+	return nil
+}
+
+func (a *allocator) lifetime(ctx *context, name string, pos sourcePos) *varLifetime {
+	declCtx := declarationContext(ctx, name)
+	if declCtx == nil {
+		return nil
+	}
+	info := declCtx.vars[name]
+	if info.constant() || info.function() {
+		return nil
+	}
+	key := varKey{declCtx, name}
+	v, ok := a.vars[key]
+	if !ok {
+		v = &varLifetime{key: key, scope: a.scope, start: a.point, end: a.point, pos: pos, last: pos}
+		v.reserved = info.reserved
+		v.address = info.address
+		v.across = make(map[*funDefNode]bool)
+		a.vars[key] = v
+		a.order = append(a.order, v)
+	}
+	if v.scope != a.scope {
+		v.pinned = true
+	}
+	if pos.file == v.pos.file && pos.line > v.last.line {
+		v.last = pos
+	}
+	return v
+}
+
+// def records variable store
+func (a *allocator) def(ctx *context, name string, pos sourcePos) {
+	if v := a.lifetime(ctx, name, pos); v != nil {
+		p := a.next()
+		v.end = p
+		v.refs = append(v.refs, p)
+	}
+}
+
+// ref records variable load or assignment
+func (a *allocator) ref(ctx *context, name string, pos sourcePos) {
+	v := a.lifetime(ctx, name, pos)
+	if v == nil {
+		return
+	}
+	if len(v.refs) == 0 {
+		// referenced before declaration can be seen,
+		// happens when a function uses variables of its caller
+		v.pinned = true
+	}
+	p := a.next()
+	v.end = p
+	v.refs = append(v.refs, p)
+}
+
+func (a *allocator) walk(node TreeNodeIf) {
+	if node == nil {
+		return
+	}
+
+	switch tt := node.(type) {
+	case *funDefNode:
+		if tt.method != nil {
+			// method arguments are decoded and stored in order
+			for _, arg := range tt.args {
+				a.def(tt.ctx, arg.n, tt.pos)
+			}
+		} else if !tt.inline {
+			// arguments are popped from the stack in reverse order
+			for i := len(tt.args) - 1; i >= 0; i-- {
+				a.def(tt.ctx, tt.args[i].n, tt.pos)
+			}
+		}
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+	case *varDeclNode:
+		a.walk(tt.value)
+		a.def(tt.ctx, tt.name, tt.pos)
+	case *destructuringNode:
+		a.walk(tt.value)
+		// values are stored from the top of the stack
+		for i := len(tt.names) - 1; i >= 0; i-- {
+			if tt.declare {
+				a.def(tt.ctx, tt.names[i], tt.pos)
+			} else {
+				a.ref(tt.ctx, tt.names[i], tt.pos)
+			}
+		}
+	case *assignNode:
+		a.walk(tt.value)
+		a.ref(tt.ctx, tt.name, tt.pos)
+	case *assignInnerTxnNode:
+		a.walk(tt.value)
+	case *assignStructFieldNode:
+		// the struct is loaded before and after the value evaluation
+		a.ref(tt.ctx, tt.name, tt.pos)
+		a.walk(tt.value)
+		a.ref(tt.ctx, tt.name, tt.pos)
+	case *structFieldNode:
+		a.walk(tt.value)
+	case *returnNode:
+		for _, value := range tt.values {
+			a.walk(value)
+		}
+	case *exprIdentNode:
+		a.ref(tt.ctx, tt.name, tt.pos)
+	case *exprGroupNode:
+		a.walk(tt.value)
+	case *exprBinOpNode:
+		a.walk(tt.lhs)
+		a.walk(tt.rhs)
+	case *exprUnOpNode:
+		a.walk(tt.value)
+	case *typeCastNode:
+		a.walk(tt.expr)
+	case *ifExprNode:
+		a.walk(tt.condExpr)
+		a.walk(tt.condTrueExpr)
+		a.walk(tt.condFalseExpr)
+	case *ifStatementNode:
+		a.walk(tt.condExpr)
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+	case *switchStatementNode:
+		a.walk(tt.value)
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+	case *switchExprNode:
+		a.walk(tt.value)
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+	case *contractNode:
+		// methods are generated before the bare calls
+		a.walk(tt.value)
+		for _, method := range tt.methods {
+			a.walk(method)
+		}
+		for _, call := range tt.bare {
+			a.walk(call.body)
+		}
+	case *forStatementNode:
+		a.walk(tt.init)
+		start := a.next()
+		a.walk(tt.condExpr)
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+		a.walk(tt.step)
+		a.loops = append(a.loops, loopRange{a.scope, start, a.next()})
+	case *funCallNode:
+		if tt.definition != nil && tt.definition.inline {
+			// every argument is stored right after evaluation
+			for idx, ch := range tt.children() {
+				a.walk(ch)
+				a.def(tt.definition.ctx, tt.definition.args[idx].n, tt.pos)
+			}
+			for _, ch := range tt.definition.children() {
+				a.walk(ch)
+			}
+			return
+		}
+		for _, ch := range tt.children() {
+			a.walk(ch)
+		}
+		if tt.definition != nil {
+			a.calls[a.scope] = append(a.calls[a.scope], callSite{a.next(), tt.definition})
+		}
+	default:
+		for _, ch := range node.children() {
+			a.walk(ch)
+		}
+	}
+}
+
+// extendLoops makes variables declared before a loop and used in it live until the loop end
+func (a *allocator) extendLoops() {
+	for _, v := range a.order {
+		for _, loop := range a.loops {
+			if loop.scope != v.scope || v.start >= loop.start || v.end >= loop.end {
+				continue
+			}
+			for _, p := range v.refs {
+				if p > loop.start && p < loop.end {
+					v.end = loop.end
+					break
+				}
+			}
+		}
+	}
+}
+
+// callees returns the function and all functions it calls directly or indirectly
+func (a *allocator) callees(fun *funDefNode, result map[*funDefNode]bool) {
+	if result[fun] {
+		return
+	}
+	result[fun] = true
+	for _, call := range a.calls[fun] {
+		a.callees(call.callee, result)
+	}
+}
+
+// markCalls records functions called while a variable is live
+func (a *allocator) markCalls() {
+	for _, v := range a.order {
+		for _, call := range a.calls[v.scope] {
+			if v.start < call.point && call.point < v.end {
+				a.callees(call.callee, v.across)
+			}
+		}
+	}
+}
+
+func (a *allocator) interfere(v, u *varLifetime) bool {
+	if v.pinned || u.pinned || v.reserved || u.reserved {
+		return true
+	}
+	if v.scope == u.scope {
+		return v.start <= u.end && u.start <= v.end
+	}
+	return v.across[u.scope] || u.across[v.scope]
+}
+
+// assign colors variables by scratch slots greedily in order of their appearance
+func (a *allocator) assign() []ParserError {
+	scopeIndex := make(map[*funDefNode]int, len(a.scopes))
+	for idx, scope := range a.scopes {
+		scopeIndex[scope] = idx
+	}
+
+	reserved := make(map[uint]bool)
+	assigned := make([]*varLifetime, 0, len(a.order))
+	for _, v := range a.order {
+		if v.reserved {
+			reserved[v.address] = true
+			assigned = append(assigned, v)
+		}
+	}
+
+	vars := make([]*varLifetime, 0, len(a.order))
+	for _, v := range a.order {
+		if !v.reserved {
+			vars = append(vars, v)
+		}
+	}
+	sort.SliceStable(vars, func(i, j int) bool {
+		if vars[i].pinned != vars[j].pinned {
+			return vars[i].pinned
+		}
+		if vars[i].scope != vars[j].scope {
+			return scopeIndex[vars[i].scope] < scopeIndex[vars[j].scope]
+		}
+		return vars[i].start < vars[j].start
+	})
+
+	for _, v := range vars {
+		used := make(map[uint]bool)
+		for _, u := range assigned {
+			if a.interfere(v, u) {
+				used[u.address] = true
+			}
+		}
+		var slot uint
+		for used[slot] || reserved[slot] {
+			slot++
+		}
+		if slot >= maxScratchSlots {
+			msg := fmt.Sprintf("too many live variables: '%s' does not fit into %d scratch slots", v.key.name, maxScratchSlots)
+			return []ParserError{newNodeError(CodeScratch, v.pos, msg)}
+		}
+		v.address = slot
+		assigned = append(assigned, v)
+
+		info := v.key.ctx.vars[v.key.name]
+		info.address = slot
+		v.key.ctx.vars[v.key.name] = info
+	}
+	return nil
+}
+
+// variables describes assigned slots for debuggers
+func (a *allocator) variables() []Variable {
+	result := make([]Variable, 0, len(a.order))
+	for _, v := range a.order {
+		info := v.key.ctx.vars[v.key.name]
+		variable := Variable{
+			Name:     v.key.name,
+			Function: functionName(v.key.ctx),
+			Type:     info.theType.String(),
+			Slot:     v.address,
+			Line:     v.pos.line,
+			EndLine:  v.last.line,
+		}
+		if v.pos.file != nil {
+			variable.File = v.pos.file.name
+		}
+		result = append(result, variable)
+	}
+	return result
+}
+
+// functionName returns name of the function the context belongs to, root for globals
+func functionName(ctx *context) string {
+	for current := ctx; current != nil; current = current.parent {
+		switch current.name {
+		case "if", "else", "for":
+			continue
+		}
+		return current.name
+	}
+	return ""
+}
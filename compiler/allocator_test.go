@@ -0,0 +1,177 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratchReuse(t *testing.T) {
+	a := require.New(t)
+
+	// t is declared in the loop and must not reuse slot of a that is used in the loop condition
+	source := `
+function logic() {
+	let a = 1
+	let i = 0
+	for i < a {
+		let t = i + 1
+		i = t
+	}
+	let b = 2
+	return b
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 2
+fun_main:
+intc 1
+store 0
+intc 0
+store 1
+loop_start_main_5_0:
+load 1
+load 0
+<
+bz loop_end_main_5_0
+load 1
+intc 1
++
+store 2
+load 2
+store 1
+b loop_start_main_5_0
+loop_end_main_5_0:
+intc 2
+store 0
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// x and y must not reuse slot of a that is live while double is executing
+	source = `
+function double(x) {
+	let y = x + x
+	return y
+}
+function logic() {
+	let a = 2
+	let b = double(a)
+	return a + b
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 2
+fun_main:
+intc 2
+store 0
+load 0
+callsub fun_double
+store 1
+load 0
+load 1
++
+return
+end_main:
+fun_double:
+store 1
+load 1
+load 1
++
+store 1
+load 1
+retsub
+end_double:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestScratchReserved(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+let shared @ 0 = 7
+function logic() {
+	let a = 1
+	return a
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 7
+intc 2
+store 0
+fun_main:
+intc 1
+store 1
+load 1
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// stores to reserved slots survive peephole optimizations
+	source = `
+let x @ 3 = 0
+function logic() {
+	x = txn.Amount
+	return x
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	a.Equal([]uint{3}, ReservedSlots(result))
+	actual = OptimizeTEAL(Codegen(result), ReservedSlots(result))
+	a.Contains(actual, "txn Amount\nstore 3\nload 3\nreturn\n")
+}
+
+func TestScratchErrors(t *testing.T) {
+	a := require.New(t)
+
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{`function logic() { let a @ 1 = 1; return a; }`, "scratch slot can be reserved only for global variables"},
+		{`let a @ 1 = 1; let b @ 1 = 2; function logic() { return 1; }`, "scratch slot 1 already reserved by 'a'"},
+		{`let a @ 256 = 1; function logic() { return 1; }`, "scratch slot must be in range [0, 256)"},
+	}
+	for _, test := range tests {
+		result, errors := Parse(test.source)
+		a.Empty(result, test.source)
+		a.NotEmpty(errors, test.source)
+		a.Contains(errors[0].msg, test.msg, test.source)
+	}
+
+	// 257 variables live at the same time
+	var sb strings.Builder
+	names := make([]string, 257)
+	sb.WriteString("function logic() {\n")
+	for i := range names {
+		names[i] = fmt.Sprintf("v%d", i)
+		sb.WriteString(fmt.Sprintf("let %s = %d\n", names[i], i))
+	}
+	sb.WriteString(fmt.Sprintf("return %s\n}\n", strings.Join(names, " + ")))
+	result, errors := Parse(sb.String())
+	a.Empty(result)
+	a.Equal(1, len(errors), errors)
+	a.Equal(semanticError, errors[0].errorType)
+	a.Equal(258, errors[0].line)
+	a.Contains(errors[0].msg, "too many live variables: 'v256' does not fit into 256 scratch slots")
+}
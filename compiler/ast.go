@@ -3,7 +3,7 @@ package compiler
 import (
 	"fmt"
 	"io"
-	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -17,16 +17,28 @@ type literalInfo struct {
 
 	intc  []string
 	bytec [][]byte
+
+	// literals referenced by generated code, collected only while pruning
+	used map[string]bool
+}
+
+// labelInfo holds label counter shared by all contexts of a program
+type labelInfo struct {
+	next uint
 }
 
 type context struct {
-	name         string
-	literals     *literalInfo
-	parent       *context
-	vars         map[string]varInfo
-	functions    map[string]*funCallNode
-	addressEntry uint // first address to use on the context creation
-	addressNext  uint // next address to use
+	name      string
+	literals  *literalInfo
+	labels    *labelInfo
+	parent    *context
+	vars      map[string]varInfo
+	functions map[string]*funCallNode
+	symbols   *Symbols
+	warnings  *warningCollector
+
+	// target TEAL version of the program, set on the root context, 0 means the language spec version
+	version int
 }
 
 type varKind int
@@ -34,6 +46,7 @@ type varKind int
 const (
 	constantKind varKind = 1
 	functionKind varKind = 2
+	structKind   varKind = 3
 )
 
 type callDefParser func(context *context, callNode *funCallNode, varInfo *varInfo) *funDefNode
@@ -44,15 +57,20 @@ type varInfo struct {
 	kind    varKind
 
 	// for variables specifies allocated memory scratch space
-	// for constants sets index in intc/bytec arrays
+	// for constants sets index in intc/bytec arrays at declaration,
+	// code generation looks it up by value since unused literals might be pruned
 	address uint
 
+	// variable address is set explicitly and must not be reused
+	reserved bool
+
 	// constants have value
 	value *string
 
 	// function has reference lazy parser
 	parser callDefParser
-	node   TreeNodeIf
+	// function or struct definition
+	node TreeNodeIf
 }
 
 func (v varInfo) constant() bool {
@@ -63,6 +81,10 @@ func (v varInfo) function() bool {
 	return v.kind == functionKind
 }
 
+func (v varInfo) structure() bool {
+	return v.kind == structKind
+}
+
 func newLiteralInfo() (literals *literalInfo) {
 	literals = new(literalInfo)
 	literals.literals = make(map[string]literalDesc)
@@ -71,6 +93,17 @@ func newLiteralInfo() (literals *literalInfo) {
 	return
 }
 
+// copy returns literals that can be pruned without affecting the original ones
+func (literals *literalInfo) copy() *literalInfo {
+	result := newLiteralInfo()
+	for value, desc := range literals.literals {
+		result.literals[value] = desc
+	}
+	result.intc = append(result.intc, literals.intc...)
+	result.bytec = append(result.bytec, literals.bytec...)
+	return result
+}
+
 func newContext(name string, parent *context) (ctx *context) {
 	ctx = new(context)
 	ctx.name = name
@@ -79,12 +112,12 @@ func newContext(name string, parent *context) (ctx *context) {
 	ctx.functions = make(map[string]*funCallNode)
 	if parent != nil {
 		ctx.literals = parent.literals
-		ctx.addressEntry = parent.addressNext
-		ctx.addressNext = ctx.addressEntry
+		ctx.labels = parent.labels
+		ctx.symbols = parent.symbols
+		ctx.warnings = parent.warnings
 	} else {
 		ctx.literals = newLiteralInfo()
-		ctx.addressEntry = 0
-		ctx.addressNext = 0
+		ctx.labels = new(labelInfo)
 
 		// global context, add internal literals
 		ctx.addLiteral(falseConstValue, intType)
@@ -102,7 +135,7 @@ func (ctx *context) lookup(name string) (varable varInfo, err error) {
 		}
 		current = current.parent
 	}
-	return varInfo{}, fmt.Errorf("ident '%s' not defined", name)
+	return varInfo{}, errorf(CodeUndefined, "ident '%s' not defined", name)
 }
 
 func (ctx *context) update(name string, info varInfo) (err error) {
@@ -115,55 +148,73 @@ func (ctx *context) update(name string, info varInfo) (err error) {
 		}
 		current = current.parent
 	}
-	return fmt.Errorf("failed to update ident %s", name)
+	return errorf(CodeUndefined, "failed to update ident %s", name)
 }
 
-// remapTo remaps this context variable addresses by using newBase as a new entry address
-func (ctx *context) remapTo(newBase uint) {
-	vars := make([]varInfo, 0, len(ctx.vars))
-	for _, info := range ctx.vars {
-		vars = append(vars, info)
-	}
-	sort.Slice(vars, func(i, j int) bool { return vars[i].address < vars[j].address })
-	ctx.addressEntry = newBase
-	for _, info := range vars {
-		info.address = newBase
-		ctx.update(info.name, info)
-		newBase++
+func (ctx *context) newVar(name string, theType exprType) error {
+	if _, ok := ctx.vars[name]; ok {
+		return errorf(CodeRedeclared, "variable '%s' already declared", name)
 	}
-	ctx.addressNext = newBase
+	// address is assigned by scratch allocator after parsing
+	ctx.vars[name] = varInfo{name, theType, 0, 0, false, nil, nil, nil}
+	return nil
 }
 
-func (ctx *context) newVar(name string, theType exprType) error {
+func (ctx *context) newReservedVar(name string, theType exprType, address uint) error {
 	if _, ok := ctx.vars[name]; ok {
-		return fmt.Errorf("variable '%s' already declared", name)
+		return errorf(CodeRedeclared, "variable '%s' already declared", name)
+	}
+	for _, info := range ctx.vars {
+		if info.reserved && info.address == address {
+			return errorf(CodeScratch, "scratch slot %d already reserved by '%s'", address, info.name)
+		}
 	}
-	ctx.vars[name] = varInfo{name, theType, 0, ctx.addressNext, nil, nil, nil}
-	ctx.addressNext++
+	ctx.vars[name] = varInfo{name, theType, 0, address, true, nil, nil, nil}
 	return nil
 }
 
 func (ctx *context) newConst(name string, theType exprType, value *string) error {
 	if _, ok := ctx.vars[name]; ok {
-		return fmt.Errorf("const '%s' already declared", name)
+		return errorf(CodeRedeclared, "const '%s' already declared", name)
 	}
 	offset, err := ctx.addLiteral(*value, theType)
 	if err != nil {
 		return err
 	}
-	ctx.vars[name] = varInfo{name, theType, constantKind, offset, value, nil, nil}
+	ctx.vars[name] = varInfo{name, theType, constantKind, offset, false, value, nil, nil}
 	return nil
 }
 
 func (ctx *context) newFunc(name string, theType exprType, parser callDefParser) error {
 	if _, ok := ctx.vars[name]; ok {
-		return fmt.Errorf("function '%s' already defined", name)
+		return errorf(CodeRedeclared, "function '%s' already defined", name)
 	}
 
-	ctx.vars[name] = varInfo{name, theType, functionKind, 0, nil, parser, nil}
+	ctx.vars[name] = varInfo{name, theType, functionKind, 0, false, nil, parser, nil}
 	return nil
 }
 
+func (ctx *context) newStruct(def *structDefNode) error {
+	if _, ok := ctx.vars[def.name]; ok {
+		return errorf(CodeRedeclared, "struct '%s' already declared", def.name)
+	}
+	ctx.vars[def.name] = varInfo{def.name, structType(def.name), structKind, 0, false, nil, nil, def}
+	return nil
+}
+
+// lookupStruct returns definition of the struct type, structs are declared in the global context only
+func (ctx *context) lookupStruct(theType exprType) (*structDefNode, error) {
+	root := ctx
+	for root.parent != nil {
+		root = root.parent
+	}
+	info, ok := root.vars[string(theType)]
+	if !ok || !info.structure() {
+		return nil, errorf(CodeType, "type %s is not a struct", theType)
+	}
+	return info.node.(*structDefNode), nil
+}
+
 func (ctx *context) addLiteral(value string, theType exprType) (offset uint, err error) {
 	info, exists := ctx.literals.literals[value]
 	if !exists {
@@ -180,7 +231,7 @@ func (ctx *context) addLiteral(value string, theType exprType) (offset uint, err
 			ctx.literals.bytec = append(ctx.literals.bytec, parsed)
 			ctx.literals.literals[value] = literalDesc{offset, bytesType}
 		} else {
-			return 0, fmt.Errorf("unknown literal type %s (%s)", theType, value)
+			return 0, errorf(CodeType, "unknown literal type %s (%s)", theType, value)
 		}
 	} else {
 		offset = info.offset
@@ -189,39 +240,55 @@ func (ctx *context) addLiteral(value string, theType exprType) (offset uint, err
 	return offset, err
 }
 
-func (ctx *context) Print() {
-	for name, value := range ctx.vars {
-		fmt.Printf("%v %v\n", name, value)
-	}
+// addUintLiteral registers integer literal used by generated code
+func (ctx *context) addUintLiteral(value uint) {
+	ctx.addLiteral(strconv.FormatUint(uint64(value), 10), intType)
 }
 
-func (ctx *context) EntryAddress() uint {
-	return ctx.addressEntry
+// addRangeLiterals registers literals needed to extract the range of a byte array,
+// ranges fitting into extract immediates need none
+func (ctx *context) addRangeLiterals(offset uint, size uint) {
+	if offset > maxImmediate || size > maxImmediate {
+		ctx.addUintLiteral(offset)
+		ctx.addUintLiteral(size)
+	}
 }
 
-func (ctx *context) LastAddress() uint {
-	return ctx.addressNext
+func (ctx *context) Print() {
+	for name, value := range ctx.vars {
+		fmt.Printf("%v %v\n", name, value)
+	}
 }
 
-type exprType int
+// exprType is a type name, struct types are named by their declarations
+type exprType string
 
 const (
-	unknownType exprType = 0
-	intType     exprType = 1
-	bytesType   exprType = 2
-	invalidType exprType = 99
+	unknownType exprType = ""
+	intType     exprType = "uint64"
+	bytesType   exprType = "byte[]"
+	invalidType exprType = "invalid"
 )
 
 func (n exprType) String() string {
+	if n == unknownType {
+		return "unknown"
+	}
+	return string(n)
+}
+
+// structType returns type of values of the named struct
+func structType(name string) exprType {
+	return exprType(name)
+}
+
+// structure reports if values of the type are structs packed into byte arrays
+func (n exprType) structure() bool {
 	switch n {
-	case intType:
-		return "uint64"
-	case bytesType:
-		return "byte[]"
-	case invalidType:
-		return "invalid"
+	case unknownType, intType, bytesType, invalidType:
+		return false
 	}
-	return "unknown"
+	return true
 }
 
 // TreeNodeIf represents a node in AST
@@ -229,6 +296,7 @@ type TreeNodeIf interface {
 	append(ch TreeNodeIf)
 	children() []TreeNodeIf
 	parent() TreeNodeIf
+	position() sourcePos
 	String() string
 	Print()
 	Codegen(ostream io.Writer)
@@ -240,9 +308,26 @@ type ExprNodeIf interface {
 	getType() (exprType, error)
 }
 
+// sourceFile is a source text the AST nodes are parsed from
+type sourceFile struct {
+	name string
+	text string
+}
+
+// sourcePos is a location of AST node in a source file
+type sourcePos struct {
+	file   *sourceFile
+	line   int
+	column int
+	start  int
+	end    int
+	token  string
+}
+
 // TreeNode contains base info about an AST node
 type TreeNode struct {
 	ctx *context
+	pos sourcePos
 
 	nodeName      string
 	parentNode    TreeNodeIf
@@ -252,11 +337,25 @@ type TreeNode struct {
 type programNode struct {
 	*TreeNode
 	nonInlineFunc []*funDefNode
+	variables     []Variable
+	reserved      []uint
+	// mode is the main function name: logic, approval or clearstate
+	mode string
+	// drop literals unused by the code at code generation, set by Optimize
+	prune bool
+	// all literals of the program, every code generation prunes them anew
+	parsedLiterals *literalInfo
+
+	// type casts of annotated values of unknown type
+	annotations []*typeCastNode
 }
 
 type funArg struct {
 	n string
 	t exprType
+
+	// type is annotated and checked at every call
+	declared bool
 }
 
 type funDefNode struct {
@@ -264,6 +363,15 @@ type funDefNode struct {
 	name   string
 	args   []funArg
 	inline bool
+
+	// annotated return types, nil if not annotated
+	returns []exprType
+
+	// ARC-4 signature of a contract method, nil for functions
+	method *abiMethod
+
+	// end label of inline function body, set at call site code generation
+	endLabel string
 }
 
 type blockNode struct {
@@ -272,7 +380,7 @@ type blockNode struct {
 
 type returnNode struct {
 	*TreeNode
-	value      ExprNodeIf
+	values     []ExprNodeIf
 	definition *funDefNode
 }
 
@@ -298,31 +406,28 @@ type assignInnerTxnNode struct {
 type breakNode struct {
 	*TreeNode
 	value ExprNodeIf
+	loop  *forStatementNode
 }
 
-type assignNode struct {
+type continueNode struct {
 	*TreeNode
-	name     string
-	exprType exprType
-	value    ExprNodeIf
+	loop *forStatementNode
 }
 
-type assignTupleNode struct {
+type assignNode struct {
 	*TreeNode
-	low      string
-	high     string
+	name     string
 	exprType exprType
 	value    ExprNodeIf
 }
 
-type assignQuadrupleNode struct {
+// destructuringNode declares or assigns variables from values returned by a function,
+// the first name receives the value deepest in the stack
+type destructuringNode struct {
 	*TreeNode
-	low      string
-	high     string
-	rlow     string
-	rhigh    string
-	exprType exprType
-	value    ExprNodeIf
+	names   []string
+	declare bool
+	value   ExprNodeIf
 }
 
 type varDeclNode struct {
@@ -332,24 +437,6 @@ type varDeclNode struct {
 	value    ExprNodeIf
 }
 
-type varDeclTupleNode struct {
-	*TreeNode
-	low      string
-	high     string
-	exprType exprType
-	value    ExprNodeIf
-}
-
-type varDeclQuadrupleNode struct {
-	*TreeNode
-	low      string
-	high     string
-	rlow     string
-	rhigh    string
-	exprType exprType
-	value    ExprNodeIf
-}
-
 type constNode struct {
 	*TreeNode
 	name     string
@@ -397,8 +484,13 @@ type ifExprNode struct {
 
 type forStatementNode struct {
 	*TreeNode
+	init         TreeNodeIf
 	condExpr     ExprNodeIf
 	condTrueExpr ExprNodeIf
+	step         TreeNodeIf
+
+	// labels suffix, set at code generation
+	id string
 }
 
 type ifStatementNode struct {
@@ -406,10 +498,55 @@ type ifStatementNode struct {
 	condExpr ExprNodeIf
 }
 
+// switchCases holds the switch value and constant values of the cases,
+// case i is taken if the switch value equals one of values[i]
+type switchCases struct {
+	value      ExprNodeIf
+	cases      [][]ExprNodeIf
+	hasDefault bool
+
+	caseType exprType
+	seen     map[string]bool
+}
+
+// switchStatementNode has blocks of the cases followed by the default block as children
+type switchStatementNode struct {
+	*TreeNode
+	switchCases
+}
+
+// switchExprNode has expressions of the cases followed by the default expression as children
+type switchExprNode struct {
+	*TreeNode
+	switchCases
+}
+
+// contractNode dispatches application calls with arguments to the methods by selectors
+// and calls without arguments to the bare call handlers by OnCompletion.
+// Selectors are the cases of the first application argument,
+// children are the methods definitions and the bare calls blocks.
+type contractNode struct {
+	*TreeNode
+	switchCases
+	name    string
+	methods []*funDefNode
+	bare    []bareCall
+}
+
+// bareCall is a handler of the application calls without arguments
+type bareCall struct {
+	actions []string
+	body    TreeNodeIf
+	pos     sourcePos
+}
+
 type typeCastNode struct {
 	*TreeNode
 	expr       ExprNodeIf
 	targetType exprType
+
+	// the value type is asserted at runtime
+	assert bool
 }
 
 type funCallNode struct {
@@ -438,6 +575,43 @@ type runtimeArgNode struct {
 	exprType exprType
 }
 
+// structField is a field of a struct packed at a fixed offset
+type structField struct {
+	name    string
+	theType exprType
+	offset  uint
+	size    uint
+}
+
+type structDefNode struct {
+	*TreeNode
+	name   string
+	fields []structField
+	size   uint
+}
+
+// structNewNode packs values of its children into a struct
+// or converts packed bytes to the struct if convert is set
+type structNewNode struct {
+	*TreeNode
+	def     *structDefNode
+	convert bool
+}
+
+type structFieldNode struct {
+	*TreeNode
+	value ExprNodeIf
+	field structField
+}
+
+type assignStructFieldNode struct {
+	*TreeNode
+	name  string
+	def   *structDefNode
+	field structField
+	value ExprNodeIf
+}
+
 //--------------------------------------------------------------------------------------------------
 //
 // AST nodes constructors
@@ -470,7 +644,6 @@ func newReturnNode(ctx *context, parent TreeNodeIf) (node *returnNode) {
 	node = new(returnNode)
 	node.TreeNode = newNode(ctx, parent)
 	node.nodeName = "ret"
-	node.value = nil
 	return
 }
 
@@ -512,6 +685,13 @@ func newBreakNode(ctx *context, parent TreeNodeIf) (node *breakNode) {
 	return
 }
 
+func newContinueNode(ctx *context, parent TreeNodeIf) (node *continueNode) {
+	node = new(continueNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "continue"
+	return
+}
+
 func newAssignNode(ctx *context, parent TreeNodeIf, ident string) (node *assignNode) {
 	node = new(assignNode)
 	node.TreeNode = newNode(ctx, parent)
@@ -521,24 +701,15 @@ func newAssignNode(ctx *context, parent TreeNodeIf, ident string) (node *assignN
 	return
 }
 
-func newAssignTupleNode(ctx *context, parent TreeNodeIf, identLow string, identHigh string) (node *assignTupleNode) {
-	node = new(assignTupleNode)
+func newDestructuringNode(ctx *context, parent TreeNodeIf, names []string, declare bool) (node *destructuringNode) {
+	node = new(destructuringNode)
 	node.TreeNode = newNode(ctx, parent)
 	node.nodeName = "assign tuple"
-	node.low = identLow
-	node.high = identHigh
-	node.value = nil
-	return
-}
-
-func newAssignQuadrupleNode(ctx *context, parent TreeNodeIf, identLow string, identHigh string, remLow string, remHigh string) (node *assignQuadrupleNode) {
-	node = new(assignQuadrupleNode)
-	node.TreeNode = newNode(ctx, parent)
-	node.nodeName = "assign quadruple"
-	node.low = identLow
-	node.high = identHigh
-	node.rlow = remLow
-	node.rhigh = remHigh
+	if declare {
+		node.nodeName = "var tuple"
+	}
+	node.names = names
+	node.declare = declare
 	node.value = nil
 	return
 }
@@ -561,32 +732,6 @@ func newVarDeclNode(ctx *context, parent TreeNodeIf, ident string, value ExprNod
 	return
 }
 
-func newVarDeclTupleNode(ctx *context, parent TreeNodeIf, identLow string, identHigh string, value ExprNodeIf) (node *varDeclTupleNode) {
-	node = new(varDeclTupleNode)
-	node.TreeNode = newNode(ctx, parent)
-	node.nodeName = "var, var"
-	node.low = identLow
-	node.high = identHigh
-	node.value = value
-	tp, _ := value.getType()
-	node.exprType = tp
-	return
-}
-
-func newVarDeclDivmodwTupleNode(ctx *context, parent TreeNodeIf, identLow string, identHigh string, remLow string, remHigh string, value ExprNodeIf) (node *varDeclQuadrupleNode) {
-	node = new(varDeclQuadrupleNode)
-	node.TreeNode = newNode(ctx, parent)
-	node.nodeName = "divmodw"
-	node.low = identLow
-	node.high = identHigh
-	node.rlow = remLow
-	node.rhigh = remHigh
-	node.value = value
-	tp, _ := value.getType()
-	node.exprType = tp
-	return
-}
-
 func newConstNode(ctx *context, parent TreeNodeIf, ident string, value string, exprType exprType) (node *constNode) {
 	node = new(constNode)
 	node.TreeNode = newNode(ctx, parent)
@@ -654,6 +799,31 @@ func newIfStatementNode(ctx *context, parent TreeNodeIf) (node *ifStatementNode)
 	return
 }
 
+func newSwitchStatementNode(ctx *context, parent TreeNodeIf) (node *switchStatementNode) {
+	node = new(switchStatementNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "switch stmt"
+	node.seen = make(map[string]bool)
+	return
+}
+
+func newSwitchExprNode(ctx *context, parent TreeNodeIf) (node *switchExprNode) {
+	node = new(switchExprNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "switch expr"
+	node.seen = make(map[string]bool)
+	return
+}
+
+func newContractNode(ctx *context, parent TreeNodeIf, name string) (node *contractNode) {
+	node = new(contractNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "contract"
+	node.name = name
+	node.seen = make(map[string]bool)
+	return
+}
+
 func newForStatementNode(ctx *context, parent TreeNodeIf) (node *forStatementNode) {
 	node = new(forStatementNode)
 	node.TreeNode = newNode(ctx, parent)
@@ -707,6 +877,42 @@ func newRuntimeArgNode(ctx *context, parent TreeNodeIf, op string, number string
 	return
 }
 
+func newStructDefNode(ctx *context, parent TreeNodeIf, name string) (node *structDefNode) {
+	node = new(structDefNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "struct"
+	node.name = name
+	return
+}
+
+func newStructNewNode(ctx *context, parent TreeNodeIf, def *structDefNode) (node *structNewNode) {
+	node = new(structNewNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "new struct"
+	node.def = def
+	return
+}
+
+func newStructFieldNode(ctx *context, parent TreeNodeIf, value ExprNodeIf, field structField) (node *structFieldNode) {
+	node = new(structFieldNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "struct field"
+	node.value = value
+	node.field = field
+	return
+}
+
+func newAssignStructFieldNode(ctx *context, parent TreeNodeIf, name string, def *structDefNode, field structField) (node *assignStructFieldNode) {
+	node = new(assignStructFieldNode)
+	node.TreeNode = newNode(ctx, parent)
+	node.nodeName = "assign struct field"
+	node.name = name
+	node.def = def
+	node.field = field
+	node.value = nil
+	return
+}
+
 //--------------------------------------------------------------------------------------------------
 //
 // Type checks
@@ -721,7 +927,7 @@ func (n *exprIdentNode) getType() (exprType, error) {
 	if n.exprType == unknownType {
 		info, err := n.ctx.lookup(n.name)
 		if err != nil || info.theType == invalidType {
-			return invalidType, fmt.Errorf("ident lookup for %s failed: %s", n.name, err.Error())
+			return invalidType, errorf(CodeUndefined, "ident lookup for %s failed: %s", n.name, err.Error())
 		}
 		n.exprType = info.theType
 	}
@@ -731,16 +937,16 @@ func (n *exprIdentNode) getType() (exprType, error) {
 func (n *exprBinOpNode) getType() (exprType, error) {
 	tp, err := opTypeFromSpec(n.op, 0)
 	if err != nil {
-		return invalidType, fmt.Errorf("bin op '%s' not it the language: %s", n.op, err.Error())
+		return invalidType, errorf(CodeSemantic, "bin op '%s' not it the language: %s", n.op, err.Error())
 	}
 
 	lhs, err := n.lhs.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("left operand '%s' has invalid type: %s", n.lhs.String(), err.Error())
+		return invalidType, errorf(CodeType, "left operand '%s' has invalid type: %s", n.lhs.String(), err.Error())
 	}
 	rhs, err := n.rhs.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("right operand '%s' has invalid type: %s", n.rhs.String(), err.Error())
+		return invalidType, errorf(CodeType, "right operand '%s' has invalid type: %s", n.rhs.String(), err.Error())
 	}
 
 	opLHS, err := argOpTypeFromSpec(n.op, 0)
@@ -748,7 +954,7 @@ func (n *exprBinOpNode) getType() (exprType, error) {
 		return invalidType, err
 	}
 	if opLHS != unknownType && lhs != opLHS {
-		return invalidType, fmt.Errorf("incompatible left operand type: '%s' vs '%s' in expr '%s'", opLHS, lhs, n)
+		return invalidType, errorf(CodeType, "incompatible left operand type: '%s' vs '%s' in expr '%s'", opLHS, lhs, n)
 	}
 
 	opRHS, err := argOpTypeFromSpec(n.op, 1)
@@ -756,10 +962,10 @@ func (n *exprBinOpNode) getType() (exprType, error) {
 		return invalidType, err
 	}
 	if opRHS != unknownType && rhs != opRHS {
-		return invalidType, fmt.Errorf("incompatible right operand type: '%s' vs '%s' in expr '%s'", opRHS, rhs, n)
+		return invalidType, errorf(CodeType, "incompatible right operand type: '%s' vs '%s' in expr '%s'", opRHS, rhs, n)
 	}
 	if lhs != rhs {
-		return invalidType, fmt.Errorf("incompatible types: '%s' vs '%s' in expr '%s'", lhs, rhs, n)
+		return invalidType, errorf(CodeType, "incompatible types: '%s' vs '%s' in expr '%s'", lhs, rhs, n)
 	}
 
 	return tp, nil
@@ -768,12 +974,12 @@ func (n *exprBinOpNode) getType() (exprType, error) {
 func (n *exprUnOpNode) getType() (exprType, error) {
 	tp, err := opTypeFromSpec(n.op, 0)
 	if err != nil {
-		return invalidType, fmt.Errorf("un op '%s' not it the language: %s", n.op, err.Error())
+		return invalidType, errorf(CodeSemantic, "un op '%s' not it the language: %s", n.op, err.Error())
 	}
 
 	valType, err := n.value.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("operand '%s' has invalid type: %s", n.String(), err.Error())
+		return invalidType, errorf(CodeType, "operand '%s' has invalid type: %s", n.String(), err.Error())
 	}
 
 	operandType, err := argOpTypeFromSpec(n.op, 0)
@@ -781,11 +987,11 @@ func (n *exprUnOpNode) getType() (exprType, error) {
 		return invalidType, err
 	}
 	if operandType != unknownType && valType != operandType {
-		return invalidType, fmt.Errorf("incompatible operand type: '%s' vs %s in expr '%s'", operandType, valType, n)
+		return invalidType, errorf(CodeType, "incompatible operand type: '%s' vs %s in expr '%s'", operandType, valType, n)
 	}
 
 	if tp != valType {
-		return invalidType, fmt.Errorf("up op expects type '%s' but operand is '%s'", tp, valType)
+		return invalidType, errorf(CodeType, "up op expects type '%s' but operand is '%s'", tp, valType)
 	}
 	return tp, nil
 }
@@ -793,76 +999,182 @@ func (n *exprUnOpNode) getType() (exprType, error) {
 func (n *ifExprNode) getType() (exprType, error) {
 	tp, err := n.condExpr.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("cond type evaluation failed: %s", err.Error())
+		return invalidType, errorf(CodeType, "cond type evaluation failed: %s", err.Error())
 	}
 
 	condType := tp
 	if condType != intType {
-		return invalidType, fmt.Errorf("cond type is '%s', expected '%s'", condType, tp)
+		return invalidType, errorf(CodeType, "cond type is '%s', expected '%s'", condType, tp)
 	}
 
 	condTrueExprType, err := n.condTrueExpr.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("first block has invalid type: %s", err.Error())
+		return invalidType, errorf(CodeType, "first block has invalid type: %s", err.Error())
 	}
 	condFalseExprType, err := n.condFalseExpr.getType()
 	if err != nil {
-		return invalidType, fmt.Errorf("second block has invalid type: %s", err.Error())
+		return invalidType, errorf(CodeType, "second block has invalid type: %s", err.Error())
 	}
 	if condTrueExprType != condFalseExprType {
-		return invalidType, fmt.Errorf("if blocks types mismatch '%s' vs '%s'", condTrueExprType, condFalseExprType)
+		return invalidType, errorf(CodeType, "if blocks types mismatch '%s' vs '%s'", condTrueExprType, condFalseExprType)
 	}
 
 	return condTrueExprType, nil
 }
 
+func (n *switchExprNode) getType() (exprType, error) {
+	var common exprType
+	for i, ch := range n.children() {
+		tp, err := ch.(ExprNodeIf).getType()
+		if err != nil {
+			return invalidType, err
+		}
+		if i > 0 && tp != common {
+			return invalidType, errorf(CodeType, "switch branches types mismatch '%s' vs '%s'", common, tp)
+		}
+		common = tp
+	}
+	return common, nil
+}
+
+// addCase checks that values of the case are constants of the switch value type
+// and are not used by other cases. Returns index of the offending value on error.
+func (n *switchCases) addCase(values []ExprNodeIf) (int, error) {
+	if len(n.cases) == 0 {
+		tp, err := n.value.getType()
+		if err != nil {
+			return -1, err
+		}
+		n.caseType = tp
+	}
+	for i, value := range values {
+		var key string
+		var tp exprType
+		if v, ok := intConstValue(value); ok {
+			key, tp = strconv.FormatUint(v, 10), intType
+		} else if v, ok := bytesConstValue(value); ok {
+			key, tp = string(v), bytesType
+		} else {
+			return i, errorf(CodeSemantic, "case value must be a constant")
+		}
+		if n.caseType == unknownType {
+			n.caseType = tp
+		}
+		if tp != n.caseType {
+			return i, errorf(CodeType, "incompatible types: (switch) %s vs %s (case)", n.caseType, tp)
+		}
+		if n.seen[key] {
+			return i, errorf(CodeSemantic, "duplicate case value %s", caseValueString(value))
+		}
+		n.seen[key] = true
+	}
+	n.cases = append(n.cases, values)
+	return -1, nil
+}
+
+func caseValueString(value ExprNodeIf) string {
+	if ident, ok := value.(*exprIdentNode); ok {
+		return ident.name
+	}
+	return value.String()
+}
+
 func (n *exprGroupNode) getType() (exprType, error) {
 	return n.value.getType()
 }
 
 // Scans node's children recursively and find return statements,
 // applies type resolution and track conflicts.
-// Return expr type or invalidType on error
-func determineBlockReturnType(node TreeNodeIf, retTypeSeen []exprType) (exprType, error) {
+// Return types of returned values or error on type or values number mismatch,
+// nil if the block does not return
+func determineBlockReturnTypes(node TreeNodeIf, retTypesSeen [][]exprType) ([]exprType, error) {
+	types, terminated, err := blockReturnTypes(node, retTypesSeen)
+	if err == nil && types == nil && terminated {
+		// a block having nothing but errors is ok for a single int value of the main function
+		return []exprType{intType}, nil
+	}
+	return types, err
+}
+
+// blockReturnTypes does the work of determineBlockReturnTypes and reports if the block has error statements.
+// Errors are taken as int values only if nothing is returned so that they do not conflict with returns of other types.
+func blockReturnTypes(node TreeNodeIf, retTypesSeen [][]exprType) ([]exprType, bool, error) {
 	var statements []TreeNodeIf
 	if node != nil {
 		statements = node.children()
 	}
 
+	terminated := false
 	for _, stmt := range statements {
 		switch tt := stmt.(type) {
 		case *returnNode:
-			tp, err := tt.value.getType()
-			if err != nil {
-				return invalidType, err
+			types := make([]exprType, len(tt.values))
+			for i, value := range tt.values {
+				tp, err := value.getType()
+				if err != nil {
+					return nil, false, err
+				}
+				types[i] = tp
 			}
-			retTypeSeen = append(retTypeSeen, tp)
+			retTypesSeen = append(retTypesSeen, types)
 		case *errorNode:
-			retTypeSeen = append(retTypeSeen, intType) // error is ok
-		case *ifStatementNode, *blockNode:
-			blockType, err := determineBlockReturnType(stmt, retTypeSeen)
+			terminated = true // error is ok for any number of values
+		case *ifStatementNode, *switchStatementNode, *forStatementNode, *blockNode:
+			blockTypes, blockTerminated, err := blockReturnTypes(stmt, retTypesSeen)
 			if err != nil {
-				return invalidType, err
+				return nil, false, err
 			}
-			retTypeSeen = append(retTypeSeen, blockType)
+			terminated = terminated || blockTerminated
+			if blockTypes != nil {
+				retTypesSeen = append(retTypesSeen, blockTypes)
+			}
+		case *contractNode:
+			// methods return encoded values, only bare calls return from the program
+			for _, call := range tt.bare {
+				blockTypes, err := determineBlockReturnTypes(call.body, retTypesSeen)
+				if err != nil {
+					return nil, false, err
+				}
+				if blockTypes != nil {
+					retTypesSeen = append(retTypesSeen, blockTypes)
+				}
+			}
+			terminated = true
 		}
 	}
 
-	if len(retTypeSeen) == 0 {
-		return unknownType, nil
+	if len(retTypesSeen) == 0 {
+		return nil, terminated, nil
 	}
-	commonType := retTypeSeen[0]
-	for _, tp := range retTypeSeen {
-		if commonType == unknownType && tp != unknownType {
-			commonType = tp
-			continue
+	commonTypes := append([]exprType{}, retTypesSeen[0]...)
+	for _, types := range retTypesSeen {
+		if len(types) != len(commonTypes) {
+			return nil, false, errorf(CodeControlFlow, "return values number mismatch: %d vs %d", len(commonTypes), len(types))
 		}
+		for i, tp := range types {
+			if commonTypes[i] == unknownType && tp != unknownType {
+				commonTypes[i] = tp
+				continue
+			}
 
-		if commonType != unknownType && tp != commonType {
-			return invalidType, fmt.Errorf("block types mismatch: %s vs %s", commonType, tp)
+			if commonTypes[i] != unknownType && tp != commonTypes[i] {
+				return nil, false, errorf(CodeType, "block types mismatch: %s vs %s", commonTypes[i], tp)
+			}
 		}
 	}
-	return commonType, nil
+	return commonTypes, terminated, nil
+}
+
+// returnTypes returns annotated return types of the function or deduces them from return statements
+func (n *funDefNode) returnTypes() ([]exprType, error) {
+	if n == nil {
+		// the function is not parsed yet
+		return nil, nil
+	}
+	if n.returns != nil {
+		return n.returns, nil
+	}
+	return determineBlockReturnTypes(n, nil)
 }
 
 func ensureBlockReturns(node TreeNodeIf) bool {
@@ -873,7 +1185,7 @@ func ensureBlockReturns(node TreeNodeIf) bool {
 
 	lastNode := node.children()[chLength-1]
 	switch tt := lastNode.(type) {
-	case *returnNode, *errorNode:
+	case *returnNode, *errorNode, *contractNode:
 		return true
 	case *ifStatementNode:
 		if len(tt.children()) == 1 {
@@ -882,6 +1194,16 @@ func ensureBlockReturns(node TreeNodeIf) bool {
 		}
 		// otherwise ensure both if-else and else-block returns
 		return ensureBlockReturns(lastNode.children()[0]) && ensureBlockReturns(lastNode.children()[1])
+	case *switchStatementNode:
+		if !tt.hasDefault {
+			return false
+		}
+		for _, branch := range tt.children() {
+			if !ensureBlockReturns(branch) {
+				return false
+			}
+		}
+		return true
 	default:
 	}
 
@@ -899,7 +1221,7 @@ func (n *funCallNode) getType() (exprType, error) {
 	if err != nil {
 		_, builtin = builtinFun[n.name]
 		if !builtin {
-			return invalidType, fmt.Errorf("function %s lookup failed: %s", n.name, err.Error())
+			return invalidType, errorf(CodeUndefined, "function %s lookup failed: %s", n.name, err.Error())
 		}
 	}
 
@@ -910,72 +1232,58 @@ func (n *funCallNode) getType() (exprType, error) {
 			if idx, ok := builtinFunDependantTypes[n.name]; ok {
 				tp, err = n.childrenNodes[idx].(ExprNodeIf).getType()
 				if err != nil {
-					return invalidType, fmt.Errorf("function %s type deduction failed: %s", n.name, err.Error())
+					return invalidType, errorf(CodeType, "function %s type deduction failed: %s", n.name, err.Error())
 				}
 			}
 		}
 	} else {
-		tp, err = determineBlockReturnType(n.definition, []exprType{})
+		var types []exprType
+		types, err = n.definition.returnTypes()
+		switch {
+		case err != nil:
+			tp = invalidType
+		case len(types) == 0:
+			tp = unknownType
+		case len(types) == 1:
+			tp = types[0]
+		default:
+			tp = invalidType
+			err = errorf(CodeType, "function %s returns %d values but used as a single value", n.name, len(types))
+		}
 	}
 	n.funType = tp
 	return tp, err
 }
 
-func (n *funCallNode) getTypeTuple() (exprType, exprType, error) {
-	var err error
-	builtin := false
-	_, builtin = builtinFun[n.name]
-	if !builtin {
-		return invalidType, invalidType, fmt.Errorf("function %s lookup failed: %s", n.name, err.Error())
+// getTypes returns types of all values returned by builtin or user function
+func (n *funCallNode) getTypes() ([]exprType, error) {
+	if _, err := n.ctx.lookup(n.name); err == nil {
+		return n.definition.returnTypes()
+	}
+	if _, builtin := builtinFun[n.name]; !builtin {
+		return nil, errorf(CodeUndefined, "function %s lookup failed", n.name)
 	}
 
-	var tpl exprType = invalidType
-	var tph exprType = invalidType
-	tph, err = opTypeFromSpec(n.name, 0)
-	if err != nil {
-		return tph, tpl, err
+	types := make([]exprType, len(langOps[n.name].Returns))
+	for i := range types {
+		tp, err := opTypeFromSpec(n.name, i)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = tp
 	}
-	tpl, err = opTypeFromSpec(n.name, 1)
 
 	// some functions (acct_params_get for example) might have any type in the return spec
 	// but also have field types. In this case funCallNode has it resolved and can be used
 	if n.funType != unknownType {
-		if tph == unknownType {
-			tph = n.funType
-		} else if tpl == unknownType {
-			tpl = n.funType
+		for i, tp := range types {
+			if tp == unknownType {
+				types[i] = n.funType
+				break
+			}
 		}
 	}
-	return tph, tpl, err
-}
-
-func (n *funCallNode) getTypeQuadruple() (exprType, exprType, exprType, exprType, error) {
-	var err error
-	builtin := false
-	_, builtin = builtinFun[n.name]
-	if !builtin {
-		return invalidType, invalidType, invalidType, invalidType, fmt.Errorf("function %s lookup failed: %s", n.name, err.Error())
-	}
-
-	var tpl exprType = invalidType
-	var tph exprType = invalidType
-	var rtpl exprType = invalidType
-	var rtph exprType = invalidType
-
-	tph, err = opTypeFromSpec(n.name, 3)
-	if err != nil {
-		return tph, tpl, rtpl, rtph, err
-	}
-	tpl, err = opTypeFromSpec(n.name, 2)
-	if err != nil {
-		return tph, tpl, rtpl, rtph, err
-	}
-	rtph, err = opTypeFromSpec(n.name, 1)
-	if err != nil {
-		return tph, tpl, rtpl, rtph, err
-	}
-	rtpl, err = opTypeFromSpec(n.name, 0)
-	return tph, tpl, rtpl, rtph, err
+	return types, nil
 }
 
 func (n *funCallNode) checkBuiltinArgs() (argErrorPos int, err error) {
@@ -991,7 +1299,7 @@ func (n *funCallNode) checkBuiltinArgs() (argErrorPos int, err error) {
 			return i, err
 		}
 		if tp != unknownType && actualType != unknownType && actualType != tp {
-			return i, fmt.Errorf("incompatible types: (exp) %s vs %s (actual) in expr '%s'", tp, actualType, n)
+			return i, errorf(CodeType, "incompatible types: (exp) %s vs %s (actual) in expr '%s'", tp, actualType, n)
 		}
 	}
 	return
@@ -1014,7 +1322,7 @@ func (n *runtimeFieldNode) getType() (exprType, error) {
 
 	tp, err := runtimeFieldTypeFromSpec(n.op, n.field)
 	if err != nil {
-		return invalidType, fmt.Errorf("lookup failed: %s", err.Error())
+		return invalidType, errorf(CodeUndefined, "lookup failed: %s", err.Error())
 	}
 
 	n.exprType = tp
@@ -1028,7 +1336,7 @@ func (n *runtimeArgNode) getType() (exprType, error) {
 
 	tp, err := opTypeFromSpec(n.op, 0)
 	if err != nil {
-		return invalidType, fmt.Errorf("lookup failed: %s", err.Error())
+		return invalidType, errorf(CodeUndefined, "lookup failed: %s", err.Error())
 	}
 
 	n.exprType = tp
@@ -1044,12 +1352,100 @@ func (n *typeCastNode) getType() (exprType, error) {
 	if err != nil {
 		return unknownType, err
 	}
+	if exprType.structure() && n.targetType == bytesType {
+		return n.targetType, nil
+	}
 	if exprType != unknownType && exprType != n.targetType {
-		return unknownType, fmt.Errorf("cannot cast %s to %s", exprType.String(), n.targetType.String())
+		return unknownType, errorf(CodeType, "cannot cast %s to %s", exprType.String(), n.targetType.String())
 	}
 	return n.targetType, nil
 }
 
+func (n *structNewNode) getType() (exprType, error) {
+	return structType(n.def.name), nil
+}
+
+func (n *structFieldNode) getType() (exprType, error) {
+	return n.field.theType, nil
+}
+
+// addField appends a field to the end of the struct
+func (n *structDefNode) addField(name string, theType exprType, size uint) error {
+	if _, ok := n.field(name); ok {
+		return errorf(CodeRedeclared, "field '%s' already declared", name)
+	}
+	n.fields = append(n.fields, structField{name, theType, n.size, size})
+	n.size += size
+	return nil
+}
+
+func (n *structDefNode) field(name string) (structField, bool) {
+	for _, f := range n.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// typeName returns the field type as written in the struct declaration
+func (f structField) typeName() string {
+	if f.theType == bytesType {
+		return fmt.Sprintf("byte[%d]", f.size)
+	}
+	return f.theType.String()
+}
+
+// check verifies the value can be stored in the field.
+// Lengths of constant byte arrays are checked here, other values are checked at runtime.
+func (f structField) check(value ExprNodeIf) error {
+	tp, err := value.getType()
+	if err != nil {
+		return err
+	}
+	if tp != f.theType {
+		return errorf(CodeType, "incompatible types: (field %s) %s vs %s (expr)", f.name, f.typeName(), tp)
+	}
+	if bytes, ok := bytesConstValue(value); ok && tp == bytesType && uint(len(bytes)) != f.size {
+		return errorf(CodeType, "field %s is %s but value is %d bytes long", f.name, f.typeName(), len(bytes))
+	}
+	return nil
+}
+
+// runtimeCheck reports if length of the value stored in the field must be checked by the program
+func (f structField) runtimeCheck(value ExprNodeIf) bool {
+	if f.theType != bytesType {
+		return false
+	}
+	bytes, ok := bytesConstValue(value)
+	return !ok || uint(len(bytes)) != f.size
+}
+
+// resolve decides if the struct is constructed from fields values or converted from packed bytes,
+// a single byte[] or untyped argument is converted
+func (n *structNewNode) resolve() (argErrorPos int, err error) {
+	args := n.children()
+	if len(args) == 1 {
+		tp, err := args[0].(ExprNodeIf).getType()
+		if err != nil {
+			return 0, err
+		}
+		if tp == bytesType || tp == unknownType {
+			n.convert = true
+			return 0, nil
+		}
+	}
+	if len(args) != len(n.def.fields) {
+		return -1, errorf(CodeType, "struct %s has %d fields but %d values given", n.def.name, len(n.def.fields), len(args))
+	}
+	for i, f := range n.def.fields {
+		if err := f.check(args[i].(ExprNodeIf)); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
+
 //--------------------------------------------------------------------------------------------------
 //
 // Common node methods
@@ -1072,6 +1468,10 @@ func (n *TreeNode) parent() TreeNodeIf {
 	return n.parentNode
 }
 
+func (n *TreeNode) position() sourcePos {
+	return n.pos
+}
+
 // Print AST and context
 func (n *TreeNode) Print() {
 	printImpl(n, 0)
@@ -1090,8 +1490,11 @@ func (n *varDeclNode) String() string {
 	return fmt.Sprintf("var (%s) %s = %s", n.exprType, n.name, n.value)
 }
 
-func (n *varDeclTupleNode) String() string {
-	return fmt.Sprintf("var (%s) %s, %s = %s", n.exprType, n.high, n.low, n.value)
+func (n *destructuringNode) String() string {
+	if n.declare {
+		return fmt.Sprintf("var %s = %s", strings.Join(n.names, ", "), n.value)
+	}
+	return fmt.Sprintf("%s = %s", strings.Join(n.names, ", "), n.value)
 }
 
 func (n *constNode) String() string {
@@ -1127,11 +1530,18 @@ func (n *ifExprNode) String() string {
 }
 
 func (n *forStatementNode) String() string {
+	if n.init != nil || n.step != nil {
+		return fmt.Sprintf("for %v; %s; %v { %s}", n.init, n.condExpr, n.step, n.condTrueExpr)
+	}
 	return fmt.Sprintf("for %s { %s}", n.condExpr, n.condTrueExpr)
 }
 
 func (n *returnNode) String() string {
-	return fmt.Sprintf("return %s", n.value)
+	values := make([]string, len(n.values))
+	for i, value := range n.values {
+		values[i] = value.String()
+	}
+	return fmt.Sprintf("return %s", strings.Join(values, ", "))
 }
 
 func (n *assignNode) String() string {
@@ -1142,10 +1552,42 @@ func (n *ifStatementNode) String() string {
 	return fmt.Sprintf("if %s", n.condExpr)
 }
 
+func (n *switchStatementNode) String() string {
+	return fmt.Sprintf("switch %s", n.value)
+}
+
+func (n *switchExprNode) String() string {
+	return fmt.Sprintf("switch %s { %v }", n.value, n.children())
+}
+
+func (n *contractNode) String() string {
+	return fmt.Sprintf("contract %s", n.name)
+}
+
 func (n *funCallNode) String() string {
 	return fmt.Sprintf("%s (%v)", n.name, n.children())
 }
 
+func (n *structDefNode) String() string {
+	fields := make([]string, len(n.fields))
+	for i, f := range n.fields {
+		fields[i] = fmt.Sprintf("%s %s", f.name, f.typeName())
+	}
+	return fmt.Sprintf("struct %s { %s }", n.name, strings.Join(fields, "; "))
+}
+
+func (n *structNewNode) String() string {
+	return fmt.Sprintf("%s (%v)", n.def.name, n.children())
+}
+
+func (n *structFieldNode) String() string {
+	return fmt.Sprintf("%s.%s", n.value, n.field.name)
+}
+
+func (n *assignStructFieldNode) String() string {
+	return fmt.Sprintf("%s.%s = %s", n.name, n.field.name, n.value)
+}
+
 func (n *runtimeFieldNode) String() string {
 	switch n.op {
 	case "gtxn":
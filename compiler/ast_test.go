@@ -406,7 +406,7 @@ function logic() {
 		let x = 4;
 	}
 	let y = 5;
-	return 1;
+	return x + y;
 }`
 	result, errors := Parse(source)
 	a.NotEmpty(result, errors)
@@ -732,6 +732,157 @@ function logic() {return test();}
 	a.Empty(parserErrors)
 }
 
+func TestFunctionMultipleReturn(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function minmax(x, y) {
+	if x < y {
+		return x, y
+	}
+	return y, x
+}
+inline function split(x) {
+	return x / 2, x % 2, "half"
+}
+let lo, hi = minmax(2, 1)
+function logic() {
+	let q, r, s = split(hi)
+	lo, hi = minmax(q, r)
+	let h, l = mulw(lo, hi)
+	return len(s) + l
+}
+`
+	result, parserErrors := Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	source = `
+function pair() { return 1, "a"; }
+function logic() {
+	let a, b = pair()
+	a = b
+	return a
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "incompatible types: (var) uint64 vs byte[] (expr)")
+
+	source = `
+function pair() { return 1, "a"; }
+function logic() {
+	let a, b, c = pair()
+	return a
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "assignment mismatch: 3 variables but pair returns 2 values")
+
+	source = `
+function logic() {
+	let a, b, c = mulw(1, 2)
+	return a
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "assignment mismatch: 3 variables but mulw returns 2 values")
+
+	source = `
+function pair() { return 1, 2; }
+function logic() {
+	let a = 1
+	let b = "b"
+	a, b = pair()
+	return a + pair()
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(2, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "incompatible types: (var) byte[] vs uint64 (expr)")
+	a.Contains(parserErrors[1].msg, "function pair returns 2 values but used as a single value")
+
+	source = `
+function pair(x) {
+	if x {
+		return 1, 2
+	}
+	return 3
+}
+function logic() {
+	let a, b = pair(1)
+	return a
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "return values number mismatch: 2 vs 1")
+
+	// returns from loops are checked as well
+	source = `
+function pair(x) {
+	for let i = 0; i < x; i = i + 1 {
+		return 1, 2
+	}
+	return 3
+}
+function logic() {
+	let a, b = pair(1)
+	return a
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "return values number mismatch: 2 vs 1")
+
+	source = `
+function logic() {
+	for txn.Fee > 0 {
+		return "a"
+	}
+	return 1
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "block types mismatch: byte[] vs uint64")
+
+	// error does not conflict with returns of other types
+	source = `
+function name(x) {
+	for x > 10 {
+		error
+	}
+	return "a"
+}
+function logic() {
+	return len(name(1))
+}
+`
+	result, parserErrors = Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	source = `
+function logic() {
+	return 1, 2
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Contains(parserErrors[0].msg, "main function must return a single value but returns 2")
+}
+
 func TestBuiltinApp(t *testing.T) {
 	a := require.New(t)
 
@@ -839,3 +990,339 @@ return 1
 	a.Contains(parserErrors[0].msg, `cannot cast uint64 to byte[]`)
 
 }
+
+func TestStruct(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+struct Point { x uint64; y uint64 }
+struct Box {
+	min Point
+	max Point
+	tag byte[2]
+}
+function area(b) {
+	return (b.max.x - b.min.x) * (b.max.y - b.min.y)
+}
+function logic() {
+	let b = Box(Point(1, 2), Point(3, 4), "ab")
+	b.tag = txn.Note
+	b.min = Point(0, 0)
+	let p = Point(apps[0].get("point"))
+	apps[0].put("box", b)
+	return area(b) > p.x && len(tobyte(b)) == 34 && b.min == p
+}
+`
+	result, parserErrors := Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	errorCases := []struct {
+		body string
+		msg  string
+	}{
+		{`let p = Point(1, 2); let b = Box(p, p, "ab"); b = p`, "incompatible types: (var) Box vs Point (expr)"},
+		{`let p = Point(1, "a")`, "incompatible types: (field y) uint64 vs byte[] (expr)"},
+		{`let b = Box(Point(1, 2), Point(3, 4), "abc")`, "field tag is byte[2] but value is 3 bytes long"},
+		{`let p = Point(1, 2, 3)`, "struct Point has 2 fields but 3 values given"},
+		{`let p = Point(1, 2); let z = p.z`, "struct Point has no field z"},
+		{`let p = Point(1, 2); p.z = 1`, "struct Point has no field z"},
+		{`let p = Point(1, 2); p.x = "a"`, "incompatible types: (field x) uint64 vs byte[] (expr)"},
+		{`let x = 1; let y = x.y`, "field y access on non-struct type uint64"},
+		{`let x = 1; x.y = 1`, "type uint64 is not a struct"},
+		{`Point = 1`, "cannot assign to a struct"},
+		{`let p = Point(1, 2); let q = p + p`, "incompatible left operand type"},
+	}
+	for _, test := range errorCases {
+		source := `
+struct Point { x uint64; y uint64 }
+struct Box {
+	min Point
+	max Point
+	tag byte[2]
+}
+function logic() {
+	` + test.body + `
+	return 1
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.body)
+		a.Equal(1, len(parserErrors), parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+
+	declCases := []struct {
+		decl string
+		msg  string
+	}{
+		{`struct S { a byte }`, "field a must have fixed length byte[N]"},
+		{`struct S { a byte[0] }`, "field a length must be in range [1, 4096]"},
+		{`struct S { a uint64[2] }`, "field a of type uint64 can not have length"},
+		{`struct S { a uint64; a byte[1] }`, "field 'a' already declared"},
+		{`struct S { a Foo }`, "field a has unknown type Foo"},
+		{`struct uint64 { a uint64 }`, "struct name 'uint64' is reserved"},
+		{`struct S { a byte[4000]; b byte[100] }`, "struct S is 4100 bytes long but byte arrays are limited to 4096"},
+		{`struct S { a uint64 }
+struct S { b uint64 }`, "struct 'S' already declared"},
+	}
+	for _, test := range declCases {
+		source := test.decl + `
+function logic() {
+	return 1
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.decl)
+		a.Equal(1, len(parserErrors), parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	a := require.New(t)
+
+	prelude := `
+struct Point { x uint64; y uint64 }
+function get(key: bytes): uint64 {
+	return apps[0].get(key)
+}
+inline function scale(p: Point, k: uint64): Point {
+	return Point(p.x * k, p.y * k)
+}
+`
+	source := prelude + `
+function logic() {
+	let n: uint64 = get("n")
+	let s: byte[] = accounts[0].get("s")
+	let p: Point = scale(Point(1, 2), n)
+	let q = scale(apps[0].get("p"), get(apps[0].get("key")))
+	return n + len(s) + p.y > q.x
+}
+`
+	result, parserErrors := Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	errorCases := []struct {
+		body string
+		msg  string
+	}{
+		{`let x: uint64 = "abc"`, "incompatible types: (var) uint64 vs byte[] (expr)"},
+		{`let x: bytes = get("a")`, "incompatible types: (var) byte[] vs uint64 (expr)"},
+		{`let x: foo = 1`, "unknown type foo"},
+		{`let x: uint64[] = 1`, "unknown type uint64[]"},
+		{`let x = get(1)`, "incompatible types: (param key) byte[] vs uint64 (expr)"},
+		{`let x = get("a"); let y = get(2)`, "incompatible types: (param key) byte[] vs uint64 (expr)"},
+		{`let p = scale(1, 2)`, "incompatible types: (param p) Point vs uint64 (expr)"},
+	}
+	for _, test := range errorCases {
+		source := prelude + `
+function logic() {
+	` + test.body + `
+	return 1
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.body)
+		a.Equal(1, len(parserErrors), parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+
+	declCases := []struct {
+		decl string
+		msg  string
+	}{
+		{`function f(a): bytes { return a; }`, "incompatible types: (return) byte[] vs uint64 (expr)"},
+		{`function f(a): uint64, uint64 { return a; }`, "return values number mismatch: 1 vs 2 declared"},
+		{`function f(a: Foo) { return 1; }`, "unknown type Foo"},
+		{`function f(a): byte { return 1; }`, "unknown type byte"},
+	}
+	for _, test := range declCases {
+		source := test.decl + `
+function logic() {
+	let x = 1
+	if x == 0 { x = f(1) }
+	return x
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.decl)
+		a.GreaterOrEqual(len(parserErrors), 1, parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+}
+
+func TestLoopControlErrors(t *testing.T) {
+	a := require.New(t)
+
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{"function logic() {\n\tbreak;\n\treturn 1\n}", "break outside of a loop"},
+		{"function logic() {\n\tif 1 { continue; }\n\treturn 1\n}", "continue outside of a loop"},
+		{"inline function f() {\n\tbreak;\n\treturn 1\n}\nfunction logic() {\n\tfor 1 { let x = f() }\n\treturn 1\n}", "break outside of a loop"},
+		{"function logic() {\n\tfor let i = 0; i < 2; i = i + 1 { }\n\treturn i\n}", "ident not found"},
+	}
+	for _, test := range tests {
+		result, parserErrors := Parse(test.source)
+		a.Empty(result, test.source)
+		a.NotEmpty(parserErrors, test.source)
+		a.Contains(parserErrors[0].msg, test.msg, test.source)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+const Pay = 1
+function logic() {
+	let x = txn.TypeEnum
+	switch x {
+	case Pay, 2: { x = 10 }
+	case 4: { return 0 }
+	default: { x = 30 }
+	}
+	let y = switch txn.Note {
+	case "a": { 1 }
+	case "b", "c": { x }
+	default: { 0 }
+	}
+	return y
+}
+`
+	result, parserErrors := Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	errorCases := []struct {
+		body string
+		msg  string
+	}{
+		{`switch x { case 1, 1: { x = 2 } }`, "duplicate case value 1"},
+		{`switch x { case 1: { x = 2 } case Pay: { x = 3 } }`, "duplicate case value Pay"},
+		{`switch x { case x: { x = 2 } }`, "case value must be a constant"},
+		{`switch x { case "a": { x = 2 } }`, "incompatible types: (switch) uint64 vs byte[] (case)"},
+		{`let y = switch x { case 1: { "a" } default: { 2 } }`, "switch branches types mismatch"},
+	}
+	for _, test := range errorCases {
+		source := `
+const Pay = 1
+function logic() {
+	let x = 1
+	` + test.body + `
+	return 1
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.body)
+		a.Equal(1, len(parserErrors), parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+
+	// switch returns only if all branches return and there is a default branch
+	source = `
+function logic() {
+	switch txn.TypeEnum {
+	case 1: { return 1 }
+	}
+}
+`
+	result, parserErrors = Parse(source)
+	a.Empty(result)
+	a.NotEmpty(parserErrors)
+
+	source = `
+function logic() {
+	switch txn.TypeEnum {
+	case 1: { return 1 }
+	default: { return 0 }
+	}
+}
+`
+	result, parserErrors = Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+}
+
+func TestContract(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+struct Point { x uint64; y uint64 }
+contract Registry {
+	abi method add(a: uint64, b: uint64) returns (uint64) {
+		return a + b
+	}
+	abi method hello(name: string) returns (string) {
+		return concat("Hello, ", name)
+	}
+	abi method set(p: Point, key: byte[32], flag: bool) {
+		apps[0].put(key, p.x + flag)
+	}
+	abi method send(receiver: account, asa: asset, amount: uint64) {
+		if amount == 0 {
+			return
+		}
+		assert(receiver != txn.Sender)
+	}
+	bare create {
+		apps[0].put("owner", txn.Sender)
+	}
+	bare optin, closeout {
+		return 1
+	}
+}
+`
+	result, parserErrors := Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+
+	errorCases := []struct {
+		body string
+		msg  string
+	}{
+		{`abi method get(a: uint65) returns (uint64) { return 1 }`, "unknown ABI type uint65"},
+		{`abi method get(a: uint64) returns (account) { return 1 }`, "account type can only be a method argument"},
+		{`abi method get(a: asset[]) { assert(a) }`, "asset type can only be a method argument"},
+		{`abi method get(a: byte[5000]) { assert(1) }`, "array length must be in range [0, 4096]"},
+		{`abi method get() returns (uint64) { return 1 } abi method get() returns (uint64) { return 2 }`, "method get()uint64 is already declared"},
+		{`abi method get() returns (uint64) { if txn.Fee > 0 { return 1 } }`, "method get does not return"},
+		{`abi method get() { return 1 }`, "return values number mismatch: 1 vs 0 declared"},
+		{`abi method get() returns (string) { return 1 }`, "incompatible types"},
+		{`abi method get() returns (uint64) { return }`, "return values number mismatch: 0 vs 1 declared"},
+		{`abi method get(a: uint64, b: uint64, c: uint64, d: uint64, e: uint64, f: uint64, g: uint64, h: uint64, i: uint64, j: uint64, k: uint64, l: uint64, m: uint64, n: uint64, o: uint64, p: uint64) { assert(a) }`, "method get has 16 arguments but at most 15 are supported"},
+		{`bare create { return }`, "return without a value is allowed only in void methods"},
+		{`bare noop { return 1 }`, "unknown bare call action noop, expected one of create, optin, closeout, update, delete"},
+		{`bare update { return 1 } bare delete, update { return 0 }`, "bare call action update is already handled"},
+	}
+	for _, test := range errorCases {
+		source := `
+contract Registry {
+	` + test.body + `
+}
+`
+		result, parserErrors := Parse(source)
+		a.Empty(result, test.body)
+		a.Equal(1, len(parserErrors), parserErrors)
+		a.Contains(parserErrors[0].msg, test.msg)
+	}
+
+	_, parserErrors = Parse("function logic() {\n\treturn\n}\n")
+	a.Equal(1, len(parserErrors), parserErrors)
+	a.Equal("return without a value is allowed only in void methods", parserErrors[0].msg)
+	a.Equal(CodeControlFlow, parserErrors[0].Code())
+
+	// methods with the same name but different signatures are allowed
+	source = `
+contract Registry {
+	abi method get(a: uint64) returns (uint64) { return a }
+	abi method get(a: byte[]) returns (uint64) { return len(a) }
+}
+`
+	result, parserErrors = Parse(source)
+	a.NotEmpty(result, parserErrors)
+	a.Empty(parserErrors)
+}
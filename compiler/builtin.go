@@ -1,9 +1,5 @@
 package compiler
 
-import (
-	"fmt"
-)
-
 var builtinFun = map[string]bool{
 	"sha256":              true,
 	"keccak256":           true,
@@ -130,7 +126,7 @@ func remapFun3(exprNode *funCallNode, target string) (argErrorPos int, err error
 	case *constNode:
 		if arg1.exprType != intType {
 			argErrorPos = 1
-			err = fmt.Errorf("arg #1 must be int")
+			err = errorf(CodeType, "arg #1 must be int")
 			return
 		} else {
 			arg1Val = arg1.value
@@ -138,7 +134,7 @@ func remapFun3(exprNode *funCallNode, target string) (argErrorPos int, err error
 	case *exprLiteralNode:
 		if arg1.exprType != intType {
 			argErrorPos = 1
-			err = fmt.Errorf("arg #1 must be int")
+			err = errorf(CodeType, "arg #1 must be int")
 			return
 		} else {
 			arg1Val = arg1.value
@@ -148,7 +144,7 @@ func remapFun3(exprNode *funCallNode, target string) (argErrorPos int, err error
 	case *constNode:
 		if arg2.exprType != intType {
 			argErrorPos = 2
-			err = fmt.Errorf("arg #2 must be int")
+			err = errorf(CodeType, "arg #2 must be int")
 			return
 		} else {
 			arg2Val = arg2.value
@@ -156,7 +152,7 @@ func remapFun3(exprNode *funCallNode, target string) (argErrorPos int, err error
 	case *exprLiteralNode:
 		if arg2.exprType != intType {
 			argErrorPos = 2
-			err = fmt.Errorf("arg #2 must be int")
+			err = errorf(CodeType, "arg #2 must be int")
 			return
 		} else {
 			arg2Val = arg2.value
@@ -178,7 +174,7 @@ func remapGaid(exprNode *funCallNode) (argErrorPos int, err error) {
 	case *constNode:
 		if arg0.exprType != intType {
 			argErrorPos = 0
-			err = fmt.Errorf("arg #0 must be int")
+			err = errorf(CodeType, "arg #0 must be int")
 			return
 		} else {
 			arg0Val = arg0.value
@@ -186,7 +182,7 @@ func remapGaid(exprNode *funCallNode) (argErrorPos int, err error) {
 	case *exprLiteralNode:
 		if arg0.exprType != intType {
 			argErrorPos = 0
-			err = fmt.Errorf("arg #0 must be int")
+			err = errorf(CodeType, "arg #0 must be int")
 			return
 		} else {
 			arg0Val = arg0.value
@@ -11,24 +11,47 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
 const trueConstValue = "1"
 const falseConstValue = "0"
 
-// TODO: switch from global var to recursive breakNode -> forNode lookup
-var ids []interface{}
-
 // Codegen by default emits AST node as a comment
 func (n *TreeNode) Codegen(ostream io.Writer) {
 	fmt.Fprintf(ostream, "// %s\n", n.String())
 }
 
+// labelID returns program-unique label suffix made of enclosing function name, source line and a counter
+func (n *TreeNode) labelID() string {
+	funcName := "global"
+	for node := n.parent(); node != nil; node = node.parent() {
+		if def, ok := node.(*funDefNode); ok {
+			funcName = def.name
+			break
+		}
+	}
+	id := n.ctx.labels.next
+	n.ctx.labels.next++
+	return fmt.Sprintf("%s_%d_%d", funcName, n.pos.line, id)
+}
+
 // Codegen of program node generates literals and runs code generation for children nodes
 func (n *programNode) Codegen(ostream io.Writer) {
 	ctx := n.ctx
+	if n.prune {
+		// code generation might need literals pruned before, e.g. after AssertTypes
+		if n.parsedLiterals == nil {
+			n.parsedLiterals = ctx.literals.copy()
+		}
+		*ctx.literals = *n.parsedLiterals.copy()
+		pruneLiterals(n)
+	}
+	// restart labels numbering so that the same AST always produces the same TEAL
+	ctx.labels.next = 0
 
-	fmt.Fprintf(ostream, "#pragma version %d\n", tealVersion())
+	fmt.Fprintf(ostream, "#pragma version %d\n", ctx.targetVersion())
 
 	// emit literals
 	if len(ctx.literals.intc) > 0 {
@@ -65,6 +88,11 @@ func (n *programNode) Codegen(ostream io.Writer) {
 }
 
 func (n *funDefNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	if n.method != nil {
+		n.codegenMethod(ostream)
+		return
+	}
 	fmt.Fprintf(ostream, "fun_%s:\n", n.name)
 	if !n.inline {
 		for i := len(n.args) - 1; i >= 0; i-- {
@@ -89,20 +117,23 @@ func literalTypeToOpcode(theType exprType) string {
 }
 
 func (n *exprLiteralNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	op := literalTypeToOpcode(n.exprType)
-	fmt.Fprintf(ostream, "%s %d\n", op, n.ctx.literals.literals[n.value].offset)
+	fmt.Fprintf(ostream, "%s %d\n", op, n.ctx.literalOffset(n.value))
 }
 
 func (n *exprIdentNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	info, _ := n.ctx.lookup(n.name)
-	op := "load"
 	if info.constant() {
-		op = literalTypeToOpcode(info.theType)
+		fmt.Fprintf(ostream, "%s %d\n", literalTypeToOpcode(info.theType), n.ctx.literalOffset(*info.value))
+		return
 	}
-	fmt.Fprintf(ostream, "%s %d\n", op, info.address)
+	fmt.Fprintf(ostream, "load %d\n", info.address)
 }
 
 func (n *assignInnerTxnNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 
 	//info, _ := n.ctx.lookup(n.name)
@@ -110,54 +141,61 @@ func (n *assignInnerTxnNode) Codegen(ostream io.Writer) {
 }
 
 func (n *assignNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 
 	info, _ := n.ctx.lookup(n.name)
 	fmt.Fprintf(ostream, "store %d\n", info.address)
 }
 
-func (n *assignTupleNode) Codegen(ostream io.Writer) {
+func (n *destructuringNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 
-	info, _ := n.ctx.lookup(n.low)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.high)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-}
-
-func (n *assignQuadrupleNode) Codegen(ostream io.Writer) {
-	n.value.Codegen(ostream)
-
-	info, _ := n.ctx.lookup(n.rlow)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.rhigh)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.low)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.high)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
+	// the last value is on top of the stack
+	for i := len(n.names) - 1; i >= 0; i-- {
+		info, _ := n.ctx.lookup(n.names[i])
+		fmt.Fprintf(ostream, "store %d\n", info.address)
+	}
 }
 
 func (n *returnNode) Codegen(ostream io.Writer) {
-	n.value.Codegen(ostream)
-	if n.definition.name == mainFuncName {
+	defer enterNode(ostream, n)()
+	for _, value := range n.values {
+		value.Codegen(ostream)
+	}
+	if method := n.definition.method; method != nil {
+		// void methods only approve the call
+		if method.returns != nil {
+			method.returns.codegenEncode(ostream, n.ctx)
+			fmt.Fprintf(ostream, "bytec %d\n", n.ctx.literalOffset(bytesLiteral(abiReturnPrefix)))
+			fmt.Fprintf(ostream, "swap\n")
+			fmt.Fprintf(ostream, "concat\n")
+			fmt.Fprintf(ostream, "log\n")
+		}
+		fmt.Fprintf(ostream, "intc %d\n", n.ctx.uintLiteral(1))
+		fmt.Fprintf(ostream, "return\n")
+	} else if n.definition.name == mainFuncName {
 		fmt.Fprintf(ostream, "return\n")
 	} else if !n.definition.inline {
 		fmt.Fprintf(ostream, "retsub\n")
 	} else {
-		fmt.Fprintf(ostream, "b end_%s_%d\n", n.definition.name, &n.definition.name)
+		fmt.Fprintf(ostream, "b %s\n", n.definition.endLabel)
 	}
 }
 
 func (n *errorNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	fmt.Fprintf(ostream, "err\n")
 }
 
 func (n *exprGroupNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 }
 
 func (n *exprBinOpNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.lhs.Codegen(ostream)
 	n.rhs.Codegen(ostream)
 
@@ -165,41 +203,22 @@ func (n *exprBinOpNode) Codegen(ostream io.Writer) {
 }
 
 func (n *exprUnOpNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 
 	fmt.Fprintf(ostream, "%s\n", n.op)
 }
 
 func (n *varDeclNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.value.Codegen(ostream)
 
 	info, _ := n.ctx.lookup(n.name)
 	fmt.Fprintf(ostream, "store %d\n", info.address)
 }
 
-func (n *varDeclTupleNode) Codegen(ostream io.Writer) {
-	n.value.Codegen(ostream)
-
-	info, _ := n.ctx.lookup(n.low)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.high)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-}
-
-func (n *varDeclQuadrupleNode) Codegen(ostream io.Writer) {
-	n.value.Codegen(ostream)
-
-	info, _ := n.ctx.lookup(n.rlow)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.rhigh)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.low)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-	info, _ = n.ctx.lookup(n.high)
-	fmt.Fprintf(ostream, "store %d\n", info.address)
-}
-
 func (n *runtimeFieldNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	switch n.op {
 	case "gtxn":
 		fmt.Fprintf(ostream, "%s %s %s\n", n.op, n.index1, n.field)
@@ -242,6 +261,7 @@ func (n *runtimeFieldNode) Codegen(ostream io.Writer) {
 }
 
 func (n *runtimeArgNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	if n.number != "" {
 		fmt.Fprintf(ostream, "%s %s\n", n.op, n.number)
 	} else {
@@ -253,16 +273,20 @@ func (n *runtimeArgNode) Codegen(ostream io.Writer) {
 }
 
 func (n *ifExprNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	id := n.labelID()
 	n.condExpr.Codegen(ostream)
-	fmt.Fprintf(ostream, "bz if_expr_false_%d\n", &n)
+	fmt.Fprintf(ostream, "bz if_expr_false_%s\n", id)
 	n.condTrueExpr.Codegen(ostream)
-	fmt.Fprintf(ostream, "b if_expr_end_%d\n", &n)
-	fmt.Fprintf(ostream, "if_expr_false_%d:\n", &n)
+	fmt.Fprintf(ostream, "b if_expr_end_%s\n", id)
+	fmt.Fprintf(ostream, "if_expr_false_%s:\n", id)
 	n.condFalseExpr.Codegen(ostream)
-	fmt.Fprintf(ostream, "if_expr_end_%d:\n", &n)
+	fmt.Fprintf(ostream, "if_expr_end_%s:\n", id)
 }
 
 func (n *ifStatementNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	id := n.labelID()
 	n.condExpr.Codegen(ostream)
 	ch := n.children()
 	hasFalse := false
@@ -271,57 +295,288 @@ func (n *ifStatementNode) Codegen(ostream io.Writer) {
 	}
 
 	if hasFalse {
-		fmt.Fprintf(ostream, "bz if_stmt_false_%d\n", &n)
+		fmt.Fprintf(ostream, "bz if_stmt_false_%s\n", id)
 	} else {
-		fmt.Fprintf(ostream, "bz if_stmt_end_%d\n", &n)
+		fmt.Fprintf(ostream, "bz if_stmt_end_%s\n", id)
 	}
 
 	ch[0].Codegen(ostream)
 
 	if hasFalse {
-		fmt.Fprintf(ostream, "b if_stmt_end_%d\n", &n)
-		fmt.Fprintf(ostream, "if_stmt_false_%d:\n", &n)
+		fmt.Fprintf(ostream, "b if_stmt_end_%s\n", id)
+		fmt.Fprintf(ostream, "if_stmt_false_%s:\n", id)
 		ch[1].Codegen(ostream)
 	}
 
-	fmt.Fprintf(ostream, "if_stmt_end_%d:\n", &n)
+	fmt.Fprintf(ostream, "if_stmt_end_%s:\n", id)
 }
 
-func (n *forStatementNode) Codegen(ostream io.Writer) {
-	if ids == nil {
-		ids = make([]interface{}, 0)
+// jumpTableVersion is the first TEAL version having switch and match opcodes
+const jumpTableVersion = 8
+
+// maxJumpTargets is the maximum number of switch and match opcode labels
+const maxJumpTargets = 255
+
+// maxTargetVersion is the highest TEAL version the code can be generated for
+const maxTargetVersion = jumpTableVersion
+
+func (n *switchStatementNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	id := n.labelID()
+	n.codegenBranches(ostream, n.ctx.targetVersion(), id, n.children())
+}
+
+func (n *switchExprNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	id := n.labelID()
+	n.codegenBranches(ostream, n.ctx.targetVersion(), id, n.children())
+}
+
+// codegenBranches emits jumps to the cases followed by the case branches and the default branch
+func (n *switchCases) codegenBranches(ostream io.Writer, version int, id string, branches []TreeNodeIf) {
+	defaultLabel := fmt.Sprintf("switch_end_%s", id)
+	if n.hasDefault {
+		defaultLabel = fmt.Sprintf("switch_default_%s", id)
+	}
+	caseLabel := func(i int) string {
+		return fmt.Sprintf("switch_case_%d_%s", i, id)
+	}
+	pop := n.codegenJump(ostream, version, caseLabel, defaultLabel)
+	for i, branch := range branches {
+		if i < len(n.cases) {
+			fmt.Fprintf(ostream, "switch_case_%d_%s:\n", i, id)
+			if pop {
+				fmt.Fprintf(ostream, "pop\n")
+			}
+		} else {
+			fmt.Fprintf(ostream, "switch_default_%s:\n", id)
+		}
+		branch.Codegen(ostream)
+		if i < len(branches)-1 {
+			fmt.Fprintf(ostream, "b switch_end_%s\n", id)
+		}
+	}
+	fmt.Fprintf(ostream, "switch_end_%s:\n", id)
+}
+
+// codegenJump evaluates the switch value and jumps to the matching case or to the default label.
+// Jump tables are used if the target version supports them, otherwise values are compared one by one
+// and the switch value is left on the stack for the cases to pop it, returns true in this case.
+func (n *switchCases) codegenJump(ostream io.Writer, version int, caseLabel func(int) string, defaultLabel string) bool {
+	count := 0
+	for _, values := range n.cases {
+		count += len(values)
+	}
+	if version >= jumpTableVersion && count > 0 && count <= maxJumpTargets {
+		if table, ok := n.switchTable(); ok {
+			n.value.Codegen(ostream)
+			labels := make([]string, len(table))
+			for i, c := range table {
+				labels[i] = defaultLabel
+				if c >= 0 {
+					labels[i] = caseLabel(c)
+				}
+			}
+			fmt.Fprintf(ostream, "switch %s\n", strings.Join(labels, " "))
+		} else {
+			labels := make([]string, 0, count)
+			for i, values := range n.cases {
+				for _, value := range values {
+					value.Codegen(ostream)
+					labels = append(labels, caseLabel(i))
+				}
+			}
+			n.value.Codegen(ostream)
+			fmt.Fprintf(ostream, "match %s\n", strings.Join(labels, " "))
+		}
+		fmt.Fprintf(ostream, "b %s\n", defaultLabel)
+		return false
+	}
+
+	n.value.Codegen(ostream)
+	for i, values := range n.cases {
+		for _, value := range values {
+			fmt.Fprintf(ostream, "dup\n")
+			value.Codegen(ostream)
+			fmt.Fprintf(ostream, "==\n")
+			fmt.Fprintf(ostream, "bnz %s\n", caseLabel(i))
+		}
 	}
-	ids = append(ids, &n)
+	fmt.Fprintf(ostream, "pop\n")
+	fmt.Fprintf(ostream, "b %s\n", defaultLabel)
+	return true
+}
 
-	fmt.Fprintf(ostream, "loop_start_%d:\n", &n)
+// switchTable maps integer case values to case indexes for the switch opcode, -1 means no case.
+// Only small dense values are mapped so that at most half of the table goes to the default branch.
+func (n *switchCases) switchTable() ([]int, bool) {
+	var max uint64
+	count := 0
+	for _, values := range n.cases {
+		for _, value := range values {
+			v, ok := intConstValue(value)
+			if !ok {
+				return nil, false
+			}
+			if v > max {
+				max = v
+			}
+			count++
+		}
+	}
+	if max >= maxJumpTargets || max+1 > uint64(2*count) {
+		return nil, false
+	}
+	table := make([]int, max+1)
+	for i := range table {
+		table[i] = -1
+	}
+	for i, values := range n.cases {
+		for _, value := range values {
+			v, _ := intConstValue(value)
+			table[v] = i
+		}
+	}
+	return table, true
+}
+
+// Codegen of contract checks the call is NoOp of the existing application if it has arguments
+// and jumps to the method by selector, calls without arguments are dispatched by OnCompletion to the bare calls
+func (n *contractNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	id := n.labelID()
+	fmt.Fprintf(ostream, "txn NumAppArgs\n")
+	fmt.Fprintf(ostream, "bz contract_bare_%s\n", id)
+	fmt.Fprintf(ostream, "txn OnCompletion\n")
+	fmt.Fprintf(ostream, "!\n")
+	fmt.Fprintf(ostream, "txn ApplicationID\n")
+	fmt.Fprintf(ostream, "&&\n")
+	fmt.Fprintf(ostream, "assert\n")
+
+	// methods may share names, so labels are numbered like the bare calls
+	methodLabel := func(i int) string {
+		return fmt.Sprintf("abi_%d_%s", i, id)
+	}
+	pop := n.codegenJump(ostream, n.ctx.targetVersion(), methodLabel, fmt.Sprintf("contract_end_%s", id))
+	for i, method := range n.methods {
+		fmt.Fprintf(ostream, "%s:\n", methodLabel(i))
+		if pop {
+			fmt.Fprintf(ostream, "pop\n")
+		}
+		method.Codegen(ostream)
+	}
+
+	fmt.Fprintf(ostream, "contract_bare_%s:\n", id)
+	for i, call := range n.bare {
+		for _, action := range call.actions {
+			value := abiBareActions[action]
+			fmt.Fprintf(ostream, "txn OnCompletion\n")
+			fmt.Fprintf(ostream, "intc %d\n", n.ctx.uintLiteral(uint(value)))
+			fmt.Fprintf(ostream, "==\n")
+			// create is the only action allowed before the application exists
+			fmt.Fprintf(ostream, "txn ApplicationID\n")
+			if action == "create" {
+				fmt.Fprintf(ostream, "!\n")
+			}
+			fmt.Fprintf(ostream, "&&\n")
+			fmt.Fprintf(ostream, "bnz bare_%d_%s\n", i, id)
+		}
+	}
+	fmt.Fprintf(ostream, "contract_end_%s:\n", id)
+	fmt.Fprintf(ostream, "err\n")
+
+	for i, call := range n.bare {
+		fmt.Fprintf(ostream, "bare_%d_%s:\n", i, id)
+		call.body.Codegen(ostream)
+		if !ensureBlockReturns(call.body) {
+			fmt.Fprintf(ostream, "intc %d\n", n.ctx.uintLiteral(1))
+			fmt.Fprintf(ostream, "return\n")
+		}
+	}
+}
+
+// codegenMethod decodes application args to the method arguments followed by the method body.
+// Methods returning values encode and log them on return, void methods approve the call at the end.
+func (n *funDefNode) codegenMethod(ostream io.Writer) {
+	for i, arg := range n.args {
+		fmt.Fprintf(ostream, "txna ApplicationArgs %d\n", i+1)
+		n.method.args[i].codegenDecode(ostream, n.ctx)
+		info, _ := n.ctx.lookup(arg.n)
+		fmt.Fprintf(ostream, "store %d\n", info.address)
+	}
+	for _, ch := range n.children() {
+		ch.Codegen(ostream)
+	}
+	if n.method.returns == nil && !ensureBlockReturns(n) {
+		fmt.Fprintf(ostream, "intc %d\n", n.ctx.uintLiteral(1))
+		fmt.Fprintf(ostream, "return\n")
+	}
+}
+
+func (n *forStatementNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	n.id = n.labelID()
+	if n.init != nil {
+		n.init.Codegen(ostream)
+	}
+	fmt.Fprintf(ostream, "loop_start_%s:\n", n.id)
 	n.condExpr.Codegen(ostream)
-	fmt.Fprintf(ostream, "bz loop_end_%d\n", &n)
+	fmt.Fprintf(ostream, "bz loop_end_%s\n", n.id)
 	ch := n.children()
 	ch[0].Codegen(ostream)
-	fmt.Fprintf(ostream, "b loop_start_%d\n", &n)
-	fmt.Fprintf(ostream, "loop_end_%d:\n", &n)
+	if n.step != nil {
+		fmt.Fprintf(ostream, "loop_step_%s:\n", n.id)
+		n.step.Codegen(ostream)
+	}
+	fmt.Fprintf(ostream, "b loop_start_%s\n", n.id)
+	fmt.Fprintf(ostream, "loop_end_%s:\n", n.id)
 }
 
 func (n *breakNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	fmt.Fprintf(ostream, "b loop_end_%s\n", n.loop.id)
+}
 
-	id := ids[len(ids)-1]
-	ids = ids[:len(ids)-1]
-
-	fmt.Fprintf(ostream, "bz loop_end_%d\n", id)
-
+func (n *continueNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	if n.loop.step != nil {
+		fmt.Fprintf(ostream, "b loop_step_%s\n", n.loop.id)
+	} else {
+		fmt.Fprintf(ostream, "b loop_start_%s\n", n.loop.id)
+	}
 }
 
 func (n *blockNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	for _, ch := range n.children() {
 		ch.Codegen(ostream)
 	}
 }
 
 func (n *typeCastNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	n.expr.Codegen(ostream)
+	if !n.assert {
+		return
+	}
+	// itob fails on byte arrays and len fails on integers
+	switch n.targetType {
+	case intType:
+		fmt.Fprintf(ostream, "dup\n")
+		fmt.Fprintf(ostream, "itob\n")
+		fmt.Fprintf(ostream, "pop\n")
+	case bytesType:
+		fmt.Fprintf(ostream, "dup\n")
+		fmt.Fprintf(ostream, "len\n")
+		fmt.Fprintf(ostream, "pop\n")
+	default:
+		def, _ := n.ctx.lookupStruct(n.targetType)
+		checkLength(ostream, n.ctx, def.size)
+	}
 }
 
 func (n *funCallNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	_, builtin := builtinFun[n.name]
 	if builtin {
 		// push args
@@ -349,25 +604,162 @@ func (n *funCallNode) Codegen(ostream io.Writer) {
 		}
 
 		if definitionNode.inline {
+			definitionNode.endLabel = fmt.Sprintf("end_%s_%s", n.name, n.labelID())
 			// and now generate statements
 			for _, ch := range definitionNode.children() {
 				ch.Codegen(ostream)
 			}
-			fmt.Fprintf(ostream, "end_%s_%d:\n", n.name, &n.definition.name)
+			fmt.Fprintf(ostream, "%s:\n", definitionNode.endLabel)
 		} else {
 			fmt.Fprintf(ostream, "callsub fun_%s\n", n.name)
 		}
 	}
 }
 
+// maxImmediate is the largest value of extract opcode immediate arguments
+const maxImmediate = 255
+
+// uintLiteral returns intc index of the literal registered by addUintLiteral
+func (ctx *context) uintLiteral(value uint) uint {
+	return ctx.literalOffset(strconv.FormatUint(uint64(value), 10))
+}
+
+// literalOffset returns intc or bytec index of the registered literal.
+// Literals are registered at parsing, a missing one is a compiler bug.
+func (ctx *context) literalOffset(value string) uint {
+	if ctx.literals.used != nil {
+		ctx.literals.used[value] = true
+	}
+	desc, ok := ctx.literals.literals[value]
+	if !ok {
+		panic(fmt.Sprintf("literal %s is not registered", value))
+	}
+	return desc.offset
+}
+
+// extractRange replaces byte array on top of the stack by its range, size must be positive
+func extractRange(ostream io.Writer, ctx *context, offset uint, size uint) {
+	if offset > maxImmediate || size > maxImmediate {
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(offset))
+		fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(size))
+		fmt.Fprintf(ostream, "extract3\n")
+		return
+	}
+	fmt.Fprintf(ostream, "extract %d %d\n", offset, size)
+}
+
+// checkLength fails the program if length of byte array on top of the stack differs from size
+func checkLength(ostream io.Writer, ctx *context, size uint) {
+	fmt.Fprintf(ostream, "dup\n")
+	fmt.Fprintf(ostream, "len\n")
+	fmt.Fprintf(ostream, "intc %d\n", ctx.uintLiteral(size))
+	fmt.Fprintf(ostream, "==\n")
+	fmt.Fprintf(ostream, "assert\n")
+}
+
+// packField converts the value on top of the stack to the field layout
+func packField(ostream io.Writer, ctx *context, field structField, value ExprNodeIf) {
+	if field.theType == intType {
+		fmt.Fprintf(ostream, "itob\n")
+	} else if field.runtimeCheck(value) {
+		checkLength(ostream, ctx, field.size)
+	}
+}
+
+func (n *structNewNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	if n.convert {
+		n.children()[0].Codegen(ostream)
+		checkLength(ostream, n.ctx, n.def.size)
+		return
+	}
+	for i, ch := range n.children() {
+		ch.Codegen(ostream)
+		packField(ostream, n.ctx, n.def.fields[i], ch.(ExprNodeIf))
+		if i > 0 {
+			fmt.Fprintf(ostream, "concat\n")
+		}
+	}
+}
+
+func (n *structFieldNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	n.value.Codegen(ostream)
+	if n.field.theType == intType {
+		fmt.Fprintf(ostream, "intc %d\n", n.ctx.uintLiteral(n.field.offset))
+		fmt.Fprintf(ostream, "extract_uint64\n")
+		return
+	}
+	extractRange(ostream, n.ctx, n.field.offset, n.field.size)
+}
+
+// Codegen of struct field assignment rebuilds the struct from bytes before and after the field and the new value
+func (n *assignStructFieldNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
+	info, _ := n.ctx.lookup(n.name)
+	if n.field.offset > 0 {
+		fmt.Fprintf(ostream, "load %d\n", info.address)
+		extractRange(ostream, n.ctx, 0, n.field.offset)
+	}
+	n.value.Codegen(ostream)
+	packField(ostream, n.ctx, n.field, n.value)
+	if n.field.offset > 0 {
+		fmt.Fprintf(ostream, "concat\n")
+	}
+	if end := n.field.offset + n.field.size; end < n.def.size {
+		fmt.Fprintf(ostream, "load %d\n", info.address)
+		extractRange(ostream, n.ctx, end, n.def.size-end)
+		fmt.Fprintf(ostream, "concat\n")
+	}
+	fmt.Fprintf(ostream, "store %d\n", info.address)
+}
+
 func (n *itxnBeginNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	fmt.Fprintf(ostream, "itxn_begin\n")
 }
 
 func (n *itxnEndNode) Codegen(ostream io.Writer) {
+	defer enterNode(ostream, n)()
 	fmt.Fprintf(ostream, "itxn_submit\n")
 }
 
+// AssertTypes makes the program check types of annotated values of unknown type at runtime.
+// Must be called after parsing and before code generation.
+func AssertTypes(prog TreeNodeIf) {
+	if root, ok := prog.(*programNode); ok {
+		for _, node := range root.annotations {
+			node.assert = true
+		}
+	}
+}
+
+// SetTargetVersion makes code generation emit the program for the TEAL version.
+// Versions above the language spec only enable switch and match opcodes.
+// Must be called after parsing and before code generation.
+func SetTargetVersion(prog TreeNodeIf, version int) error {
+	root, ok := prog.(*programNode)
+	if !ok {
+		return fmt.Errorf("not a program")
+	}
+	if version < tealVersion() || version > maxTargetVersion {
+		return fmt.Errorf("target version must be in range [%d, %d]", tealVersion(), maxTargetVersion)
+	}
+	root.ctx.version = version
+	return nil
+}
+
+// targetVersion returns TEAL version the program is generated for
+func (ctx *context) targetVersion() int {
+	for ctx.parent != nil {
+		ctx = ctx.parent
+	}
+	if ctx.version == 0 {
+		return tealVersion()
+	}
+	return ctx.version
+}
+
 // Codegen runs code generation for a node and returns the program as a string
 func Codegen(prog TreeNodeIf) string {
 	buf := new(gobytes.Buffer)
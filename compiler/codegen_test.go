@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	gobytes "bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -177,18 +178,18 @@ fun_main:
 global MinTxnFee
 store 0
 gtxn 1 Sender
-store 1
+store 0
 arg 0
-store 2
+store 0
 txna ApplicationArgs 0
-store 3
+store 1
 gtxna 1 Assets 0
-store 4
-load 2
+store 1
+load 0
 intc 1
 +
 args
-store 2
+store 0
 intc 1`
 	CompareTEAL(a, expected, actual)
 }
@@ -212,12 +213,12 @@ fun_main:
 txna ApplicationArgs 0
 store 0
 intc 1
-store 1
-load 1
+store 0
+load 0
 intc 1
 +
 txnas ApplicationArgs
-store 2
+store 0
 intc 1`
 	CompareTEAL(a, expected, actual)
 }
@@ -242,15 +243,15 @@ fun_main:
 gtxn 0 Sender
 store 0
 intc 1
-store 1
-load 1
+store 0
+load 0
 gtxns Sender
-store 2
-load 1
+store 1
+load 0
 intc 1
 +
 gtxns Sender
-store 3
+store 0
 intc 1`
 	CompareTEAL(a, expected, actual)
 
@@ -275,16 +276,16 @@ gtxna 0 ApplicationArgs 1
 store 1
 load 0
 gtxnas 0 ApplicationArgs
-store 2
+store 1
 load 0
 gtxnsa ApplicationArgs 1
-store 3
+store 1
 load 0
 load 0
 intc 2
 +
 gtxnsas ApplicationArgs
-store 4
+store 0
 intc 1`
 	CompareTEAL(a, expected, actual)
 
@@ -313,27 +314,27 @@ fun_main:
 intc 1
 store 0
 load 0
-store 1
+store 0
 intc 2
-store 2
+store 1
+load 0
 load 1
-load 2
 +
 b end_sum_*
 end_sum_*
-store 1
+store 0
 intc 3
-store 2
-load 2
-store 3
+store 0
+load 0
+store 0
 intc 1
-store 4
-load 3
-load 4
+store 1
+load 0
+load 1
 +
 b end_sum_*
 end_sum_*
-store 3
+store 0
 intc 1
 return
 end_main:
@@ -375,21 +376,21 @@ store 0
 load 0
 intc 2
 callsub fun_sum
-store 1
+store 0
 intc 3
-store 2
-load 2
+store 0
+load 0
 intc 1
 callsub fun_sum
-store 3
+store 0
 intc 1
 return
 end_main:
 fun_sum:
-store 4
-store 3
-load 3
-load 4
+store 1
+store 0
+load 0
+load 1
 +
 retsub
 end_sum:
@@ -555,13 +556,13 @@ intc 1
 store 0
 fun_main:
 intc 2
-store 1
+store 0
 intc 1
 bz if_stmt_end_*
 intc 3
-store 2
+store 1
 if_stmt_end_*
-load 1
+load 0
 return
 end_main:
 `
@@ -654,13 +655,13 @@ store 1
 intc 5
 intc 6
 addw
-store 2
-store 3
+store 1
+store 1
 intc 3
 intc 4
 expw
-store 4
-store 5
+store 1
+store 1
 load 0
 return
 end_main:
@@ -668,6 +669,88 @@ end_main:
 	CompareTEAL(a, expected, actual)
 }
 
+func TestCodegenMultipleReturn(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function minmax(x, y) {
+	if x < y {
+		return x, y
+	}
+	return y, x
+}
+inline function triple(x) { return x, x + 1, x + 2; }
+function logic() {
+	let lo, hi = minmax(2, 1)
+	let a, b, c = triple(lo)
+	a, b, c = triple(hi)
+	return a + c
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock *
+fun_main:
+intc *
+intc *
+callsub fun_minmax
+store *
+store *
+load *
+store *
+load *
+load *
+intc *
++
+load *
+intc *
++
+b end_triple_*
+end_triple_*
+store *
+store *
+store *
+load *
+store *
+load *
+load *
+intc *
++
+load *
+intc *
++
+b end_triple_*
+end_triple_*
+store *
+store *
+store *
+load *
+load *
++
+return
+end_main:
+fun_minmax:
+store *
+store *
+load *
+load *
+<
+bz if_stmt_end_*
+load *
+load *
+retsub
+if_stmt_end_*
+load *
+load *
+retsub
+end_minmax:
+`
+	CompareTEAL(a, expected, actual)
+}
+
 func TestCodegenApp(t *testing.T) {
 	a := require.New(t)
 
@@ -803,8 +886,8 @@ intc 2
 bytec 0
 app_global_get_ex
 store 0
-store 1
-load 1
+store 0
+load 0
 return
 end_main:
 `
@@ -832,9 +915,9 @@ intc 1
 store 0
 load 0
 app_params_get AppExtraProgramPages
+store 0
 store 1
-store 2
-load 1
+load 0
 return
 end_main:
 `
@@ -944,9 +1027,9 @@ store 1
 load 1
 load 0
 asset_holding_get AssetBalance
-store 2
-store 3
-load 2
+store 0
+store 1
+load 0
 return
 end_main:
 `
@@ -992,8 +1075,8 @@ fun_main:
 intc 0
 asset_params_get AssetTotal
 store 0
-store 1
-load 1
+store 0
+load 0
 return
 end_main:
 `
@@ -1026,8 +1109,8 @@ store 1
 load 0
 load 1
 concat
-store 2
-load 2
+store 0
+load 0
 len
 return
 end_main:
@@ -1059,8 +1142,8 @@ bytec 0
 load 0
 intc 2
 substring3
-store 1
-load 1
+store 0
+load 0
 len
 return
 end_main:
@@ -1159,7 +1242,7 @@ load 0
 intc 2
 ==
 bz if_stmt_end_*
-bz loop_end_*
+b loop_end_*
 if_stmt_end_*
 load 0
 intc 1
@@ -1174,6 +1257,112 @@ end_main:
 	CompareTEAL(a, expected, actual)
 }
 
+func TestLoopControl(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function logic() {
+	let s = 0
+	for let i = 0; i < 10; i = i + 1 {
+		if i == 2 { continue; }
+		for 1 {
+			break;
+		}
+		if i == 5 { break; }
+		s = s + i
+	}
+	return s
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 10 2 5
+fun_main:
+intc 0
+store 0
+intc 0
+store 1
+loop_start_main_4_0:
+load 1
+intc 2
+<
+bz loop_end_main_4_0
+load 1
+intc 3
+==
+bz if_stmt_end_main_5_1
+b loop_step_main_4_0
+if_stmt_end_main_5_1:
+loop_start_main_6_2:
+intc 1
+bz loop_end_main_6_2
+b loop_end_main_6_2
+b loop_start_main_6_2
+loop_end_main_6_2:
+load 1
+intc 4
+==
+bz if_stmt_end_main_9_3
+b loop_end_main_4_0
+if_stmt_end_main_9_3:
+load 0
+load 1
++
+store 0
+loop_step_main_4_0:
+load 1
+intc 1
++
+store 1
+b loop_start_main_4_0
+loop_end_main_4_0:
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	source = `
+function logic() {
+	let i = 0
+	for ; i < 3; {
+		i = i + 1
+		continue
+	}
+	return i
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 3
+fun_main:
+intc 0
+store 0
+loop_start_main_4_0:
+load 0
+intc 2
+<
+bz loop_end_main_4_0
+load 0
+intc 1
++
+store 0
+b loop_start_main_4_0
+b loop_start_main_4_0
+loop_end_main_4_0:
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
 func TestCodegenGetSetBitByte(t *testing.T) {
 	a := require.New(t)
 
@@ -1250,14 +1439,14 @@ setbyte
 store 2
 load 1
 btoi
-store 3
+store 1
 load 2
 btoi
-store 4
+store 2
 load 0
-load 3
+load 1
 +
-load 4
+load 2
 +
 return
 end_main:
@@ -1286,7 +1475,7 @@ store 0
 load 0
 bytec 0
 b&
-store 1
+store 0
 intc 1
 return
 end_main:
@@ -1317,7 +1506,7 @@ load 0
 intc 1
 +
 gaids
-store 1
+store 0
 intc 1
 return
 end_main:
@@ -1350,7 +1539,7 @@ store 0
 load 0
 intc 1
 +
-store 1
+store 0
 intc 1
 return
 end_main:
@@ -1393,10 +1582,10 @@ bytec 0
 concat
 store 0
 itxna ApplicationArgs 0
-store 1
-load 1
+store 0
+load 0
 itxnas Logs
-store 2
+store 0
 intc 1
 return
 end_main:
@@ -1513,8 +1702,8 @@ store 0
 bytec 0
 intc 1
 extract_uint16
-store 3
-load 3
+store 0
+load 0
 intc 4
 ==
 assert
@@ -1524,3 +1713,615 @@ end_main:
 `
 	CompareTEAL(a, expected, actual)
 }
+
+func TestCodegenStruct(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+struct Order {
+	amount uint64
+	owner byte[4]
+}
+function approval() {
+	let o = Order(apps[0].get("order"))
+	o.amount = o.amount + txn.Amount
+	o.owner = "abcd"
+	apps[0].put("order", o)
+	return o.amount > 10
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 12 10
+bytecblock 0x6f72646572 0x61626364
+// struct
+fun_main:
+bytec 0
+app_global_get
+dup
+len
+intc 2
+==
+assert
+store 0
+load 0
+intc 0
+extract_uint64
+txn Amount
++
+itob
+load 0
+extract 8 4
+concat
+store 0
+load 0
+extract 0 8
+bytec 1
+concat
+store 0
+bytec 0
+load 0
+app_global_put
+load 0
+intc 0
+extract_uint64
+intc 3
+>
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	source = `
+struct Point { x uint64; y uint64 }
+struct Box {
+	min Point
+	tag byte[2]
+}
+function logic() {
+	let b = Box(Point(1, 2), txn.Note)
+	return b.min.y == 2
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 2 8
+// struct
+// struct
+fun_main:
+intc 1
+itob
+intc 2
+itob
+concat
+txn Note
+dup
+len
+intc 2
+==
+assert
+concat
+store 0
+load 0
+extract 0 16
+intc 3
+extract_uint64
+intc 2
+==
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestCodegenTypeAnnotations(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+struct Point { x uint64; y uint64 }
+function logic() {
+	let n: uint64 = accounts[0].get("n")
+	let p: Point = apps[0].get("p")
+	let s: bytes = apps[0].get("s")
+	return n + p.y > len(s)
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 16 8
+bytecblock 0x6e 0x70 0x73
+// struct
+fun_main:
+intc 0
+bytec 0
+app_local_get
+store 0
+bytec 1
+app_global_get
+store 1
+bytec 2
+app_global_get
+store 2
+load 0
+load 1
+intc 3
+extract_uint64
++
+load 2
+len
+>
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	AssertTypes(result)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 16 8
+bytecblock 0x6e 0x70 0x73
+// struct
+fun_main:
+intc 0
+bytec 0
+app_local_get
+dup
+itob
+pop
+store 0
+bytec 1
+app_global_get
+dup
+len
+intc 2
+==
+assert
+store 1
+bytec 2
+app_global_get
+dup
+len
+pop
+store 2
+load 0
+load 1
+intc 3
+extract_uint64
++
+load 2
+len
+>
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// the optimizer keeps literals of the checks added after it
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	a.Empty(Optimize(result))
+	AssertTypes(result)
+	actual = Codegen(result)
+	CompareTEAL(a, expected, actual)
+}
+
+func TestCodegenLabels(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function logic() {
+	let x = txn.Fee
+	if x > 1 {
+		x = if x > 2 { 1 } else { 2 }
+	}
+	for x > 0 {
+		x = x - 1
+	}
+	return 1
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 2
+fun_main:
+txn Fee
+store 0
+load 0
+intc 1
+>
+bz if_stmt_end_main_4_0
+load 0
+intc 2
+>
+bz if_expr_false_main_5_1
+intc 1
+b if_expr_end_main_5_1
+if_expr_false_main_5_1:
+intc 2
+if_expr_end_main_5_1:
+store 0
+if_stmt_end_main_4_0:
+loop_start_main_7_2:
+load 0
+intc 0
+>
+bz loop_end_main_7_2
+load 0
+intc 1
+-
+store 0
+b loop_start_main_7_2
+loop_end_main_7_2:
+intc 1
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// same source and same AST produce the same program
+	a.Equal(actual, Codegen(result))
+	result, errors = Parse(source)
+	a.Empty(errors)
+	a.Equal(actual, Codegen(result))
+}
+
+func TestCodegenSwitch(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function logic() {
+	let x = txn.TypeEnum
+	switch x {
+	case 1, 2: { x = 10 }
+	case 4: { x = 20 }
+	default: { x = 30 }
+	}
+	return x
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 2 10 4 20 30
+fun_main:
+txn TypeEnum
+store 0
+load 0
+dup
+intc 1
+==
+bnz switch_case_0_*
+dup
+intc 2
+==
+bnz switch_case_0_*
+dup
+intc 4
+==
+bnz switch_case_1_*
+pop
+b switch_default_*
+switch_case_0_*
+pop
+intc 3
+store 0
+b switch_end_*
+switch_case_1_*
+pop
+intc 5
+store 0
+b switch_end_*
+switch_default_*
+intc 6
+store 0
+switch_end_*
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	source = `
+function logic() {
+	let y = switch txn.Note {
+	case "a": { 1 }
+	default: { 2 }
+	}
+	return y
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 2
+bytecblock 0x61
+fun_main:
+txn Note
+dup
+bytec 0
+==
+bnz switch_case_0_*
+pop
+b switch_default_*
+switch_case_0_*
+pop
+intc 1
+b switch_end_*
+switch_default_*
+intc 2
+switch_end_*
+store 0
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestCodegenSwitchJump(t *testing.T) {
+	a := require.New(t)
+
+	ctx := newContext("root", nil)
+	intValue := func(value uint64) ExprNodeIf {
+		v := fmt.Sprintf("%d", value)
+		ctx.addLiteral(v, intType)
+		return newExprLiteralNode(ctx, nil, intType, v)
+	}
+	bytesValue := func(value string) ExprNodeIf {
+		ctx.addLiteral(value, bytesType)
+		return newExprLiteralNode(ctx, nil, bytesType, value)
+	}
+	jump := func(version int, field string, cases ...[]ExprNodeIf) (string, bool) {
+		n := newSwitchStatementNode(ctx, nil)
+		n.value = newRuntimeFieldNode(ctx, n, "txn", field)
+		n.cases = cases
+		buf := new(gobytes.Buffer)
+		pop := n.codegenJump(buf, version, func(i int) string { return fmt.Sprintf("case_%d", i) }, "default")
+		return buf.String(), pop
+	}
+
+	// dense integers use a jump table indexed by the value
+	dense := [][]ExprNodeIf{{intValue(1), intValue(2)}, {intValue(4)}}
+	actual, pop := jump(jumpTableVersion, "NumAppArgs", dense...)
+	a.False(pop)
+	CompareTEAL(a, "txn NumAppArgs\nswitch default case_0 case_0 default case_1\nb default\n", actual)
+
+	// sparse integers and bytes are matched against the values
+	actual, pop = jump(jumpTableVersion, "NumAppArgs", []ExprNodeIf{intValue(1)}, []ExprNodeIf{intValue(1000)})
+	a.False(pop)
+	CompareTEAL(a, "intc 1\nintc *\ntxn NumAppArgs\nmatch case_0 case_1\nb default\n", actual)
+
+	actual, pop = jump(jumpTableVersion, "Note", []ExprNodeIf{bytesValue(`"a"`)}, []ExprNodeIf{bytesValue(`"b"`)})
+	a.False(pop)
+	CompareTEAL(a, "bytec 0\nbytec 1\ntxn Note\nmatch case_0 case_1\nb default\n", actual)
+
+	// values are compared one by one before TEAL 8
+	actual, pop = jump(jumpTableVersion-1, "NumAppArgs", dense...)
+	a.True(pop)
+	CompareTEAL(a, `txn NumAppArgs
+dup
+intc 1
+==
+bnz case_0
+dup
+intc *
+==
+bnz case_0
+dup
+intc *
+==
+bnz case_1
+pop
+b default
+`, actual)
+
+	// and if there are more values than the opcodes accept
+	var many []ExprNodeIf
+	for i := uint64(0); i <= maxJumpTargets; i++ {
+		many = append(many, intValue(i))
+	}
+	actual, pop = jump(jumpTableVersion, "NumAppArgs", many)
+	a.True(pop)
+	a.True(strings.HasPrefix(actual, "txn NumAppArgs\ndup\nintc 0\n==\nbnz case_0\n"))
+	a.NotContains(actual, "switch")
+	a.NotContains(actual, "match")
+}
+
+func TestCodegenTargetVersion(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function logic() {
+	let x = txn.TypeEnum
+	switch x {
+	case 1, 2: { x = 10 }
+	case 4: { x = 20 }
+	default: { x = 30 }
+	}
+	return x
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	a.Error(SetTargetVersion(result, tealVersion()-1))
+	a.Error(SetTargetVersion(result, maxTargetVersion+1))
+	a.NoError(SetTargetVersion(result, jumpTableVersion))
+	actual := Codegen(result)
+	expected := `#pragma version 8
+intcblock 0 1 2 10 4 20 30
+fun_main:
+txn TypeEnum
+store 0
+load 0
+switch switch_default_* switch_case_0_* switch_case_0_* switch_default_* switch_case_1_*
+b switch_default_*
+switch_case_0_*
+intc 3
+store 0
+b switch_end_*
+switch_case_1_*
+intc 5
+store 0
+b switch_end_*
+switch_default_*
+intc 6
+store 0
+switch_end_*
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestCodegenContract(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+contract Calc {
+	abi method add(a: uint64, b: uint64) returns (uint64) {
+		return a + b
+	}
+	bare create {
+	}
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 8
+bytecblock 0x151f7c75 0xfe6bdf69
+fun_main:
+txn NumAppArgs
+bz contract_bare_*
+txn OnCompletion
+!
+txn ApplicationID
+&&
+assert
+txna ApplicationArgs 0
+dup
+bytec 1
+==
+bnz abi_0_*
+pop
+b contract_end_*
+abi_0_*
+pop
+txna ApplicationArgs 1
+dup
+len
+intc 2
+==
+assert
+btoi
+store 0
+txna ApplicationArgs 2
+dup
+len
+intc 2
+==
+assert
+btoi
+store 1
+load 0
+load 1
++
+itob
+bytec 0
+swap
+concat
+log
+intc 1
+return
+contract_bare_*
+txn OnCompletion
+intc 0
+==
+txn ApplicationID
+!
+&&
+bnz bare_0_*
+contract_end_*
+err
+bare_0_*
+intc 1
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// void methods approve the call on bare return
+	source = `
+contract Flag {
+	abi method stop() {
+		if txn.Fee > 0 {
+			return
+		}
+		apps[0].put("stopped", 1)
+	}
+}
+`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1
+bytecblock *
+fun_main:
+txn NumAppArgs
+bz contract_bare_*
+txn OnCompletion
+!
+txn ApplicationID
+&&
+assert
+txna ApplicationArgs 0
+dup
+bytec 0
+==
+bnz abi_0_*
+pop
+b contract_end_*
+abi_0_*
+pop
+txn Fee
+intc 0
+>
+bz if_stmt_end_*
+intc 1
+return
+if_stmt_end_*
+bytec 1
+intc 1
+app_global_put
+intc 1
+return
+contract_bare_*
+contract_end_*
+err
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
@@ -0,0 +1,484 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Static opcode cost and program size estimation
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	gobytes "bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LogicSigBudget is the maximum opcode cost of a LogicSig program
+	LogicSigBudget = 20000
+	// AppBudget is the maximum opcode cost of a single application call
+	AppBudget = 700
+)
+
+// program modes named after the main function
+const (
+	// ModeLogicSig is a stateless program with logic function
+	ModeLogicSig = "logic"
+	// ModeApproval is an application approval program with approval function or contract
+	ModeApproval = "approval"
+	// ModeClearState is an application clear state program with clearstate function
+	ModeClearState = "clearstate"
+)
+
+// LineCost is opcode cost of the code generated for a source line
+type LineCost struct {
+	File string
+	Line int
+	Cost int
+	// Loop is set if the line is in a loop body and the cost is per iteration
+	Loop bool
+}
+
+// FunctionCost is the worst-case opcode cost of a function execution
+type FunctionCost struct {
+	Name string
+	Cost int
+	// Loop is set if the function has loops and every loop iteration is counted once
+	Loop bool
+}
+
+// CostReport is a static estimation of the program cost and size
+type CostReport struct {
+	Functions []FunctionCost
+	Lines     []LineCost
+	// Cost is the worst-case opcode cost of the program
+	Cost int
+	// Loop is set if the program has loops and every loop iteration is counted once
+	Loop bool
+	// Size is the bytecode size of the program
+	Size int
+	// Mode is ModeLogicSig, ModeApproval, ModeClearState or empty if the program has no main function
+	Mode string
+}
+
+// costInfo is a worst-case cost of a code path
+type costInfo struct {
+	cost int
+	loop bool
+}
+
+func (c *costInfo) add(other costInfo) {
+	c.cost += other.cost
+	c.loop = c.loop || other.loop
+}
+
+type lineKey struct {
+	file string
+	line int
+}
+
+type costEstimator struct {
+	lines     map[lineKey]*LineCost
+	functions map[*funDefNode]costInfo
+	loopDepth int
+}
+
+func newCostEstimator() (e *costEstimator) {
+	e = new(costEstimator)
+	e.lines = make(map[lineKey]*LineCost)
+	e.functions = make(map[*funDefNode]costInfo)
+	return
+}
+
+// EstimateCost calculates worst-case opcode cost of the program per function and per source line.
+// Loops are unbounded so every loop iteration is counted once.
+// The size is calculated for the TEAL program provided that might be optimized.
+func EstimateCost(prog TreeNodeIf, teal string) (report CostReport) {
+	e := newCostEstimator()
+	total := costInfo{}
+	if root, ok := prog.(*programNode); ok {
+		report.Mode = root.mode
+		if len(root.ctx.literals.intc) > 0 {
+			total.cost += langOps["intcblock"].Cost
+		}
+		if len(root.ctx.literals.bytec) > 0 {
+			total.cost += langOps["bytecblock"].Cost
+		}
+		for _, ch := range root.children() {
+			if def, ok := ch.(*funDefNode); ok {
+				c := e.function(def)
+				report.Functions = append(report.Functions, FunctionCost{def.name, c.cost, c.loop})
+				total.add(c)
+			} else {
+				total.add(e.statement(ch))
+			}
+		}
+		for _, def := range root.nonInlineFunc {
+			c := e.function(def)
+			report.Functions = append(report.Functions, FunctionCost{def.name, c.cost, c.loop})
+		}
+	} else {
+		total.add(e.statement(prog))
+	}
+
+	report.Cost = total.cost
+	report.Loop = total.loop
+	for _, line := range e.lines {
+		report.Lines = append(report.Lines, *line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].File != report.Lines[j].File {
+			return report.Lines[i].File < report.Lines[j].File
+		}
+		return report.Lines[i].Line < report.Lines[j].Line
+	})
+	report.Size = tealSize(parseTEAL(teal))
+	return
+}
+
+// Warnings returns messages about the execution budget of the program mode the program exceeds,
+// programs of unknown mode are checked against both budgets
+func (r CostReport) Warnings() (warnings []string) {
+	logicSig := r.Mode == ModeLogicSig || len(r.Mode) == 0
+	app := r.Mode == ModeApproval || r.Mode == ModeClearState || len(r.Mode) == 0
+	if logicSig && r.Cost > LogicSigBudget {
+		warnings = append(warnings, fmt.Sprintf("cost %d exceeds LogicSig budget of %d", r.Cost, LogicSigBudget))
+	}
+	if app && r.Cost > AppBudget {
+		warnings = append(warnings, fmt.Sprintf("cost %d exceeds application call budget of %d", r.Cost, AppBudget))
+	}
+	return
+}
+
+func (r CostReport) String() string {
+	perIteration := func(loop bool) string {
+		if loop {
+			return " (per loop iteration)"
+		}
+		return ""
+	}
+	loopsOnce := func(loop bool) string {
+		if loop {
+			return " (every loop iteration counted once)"
+		}
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("functions:\n")
+	for _, fun := range r.Functions {
+		sb.WriteString(fmt.Sprintf("  %s: %d%s\n", fun.Name, fun.Cost, loopsOnce(fun.Loop)))
+	}
+	sb.WriteString("lines:\n")
+	for _, line := range r.Lines {
+		location := fmt.Sprintf("line %d", line.Line)
+		if len(line.File) > 0 {
+			location = fmt.Sprintf("%s:%d", line.File, line.Line)
+		}
+		sb.WriteString(fmt.Sprintf("  %s: %d%s\n", location, line.Cost, perIteration(line.Loop)))
+	}
+	sb.WriteString(fmt.Sprintf("total cost: %d%s\n", r.Cost, loopsOnce(r.Loop)))
+	sb.WriteString(fmt.Sprintf("size: %d bytes\n", r.Size))
+	return sb.String()
+}
+
+// line attributes the cost to the source line of the node
+func (e *costEstimator) line(node TreeNodeIf, cost int) costInfo {
+	pos := node.position()
+	if pos.line > 0 && cost > 0 {
+		key := lineKey{line: pos.line}
+		if pos.file != nil {
+			key.file = pos.file.name
+		}
+		entry, ok := e.lines[key]
+		if !ok {
+			entry = &LineCost{File: key.file, Line: key.line}
+			e.lines[key] = entry
+		}
+		entry.Cost += cost
+		entry.Loop = entry.Loop || e.loopDepth > 0
+	}
+	return costInfo{cost: cost}
+}
+
+// function returns worst-case cost of a function body.
+// Non-inline functions are estimated once, their lines are not attributed to the caller.
+func (e *costEstimator) function(def *funDefNode) costInfo {
+	if c, ok := e.functions[def]; ok {
+		return c
+	}
+	// functions can not be recursive but guard against it anyway
+	e.functions[def] = costInfo{}
+
+	depth := e.loopDepth
+	e.loopDepth = 0
+	c := e.line(def, ownCost(def, def.children()...))
+	c.add(e.block(def.children()))
+	e.loopDepth = depth
+
+	e.functions[def] = c
+	return c
+}
+
+func (e *costEstimator) block(statements []TreeNodeIf) (c costInfo) {
+	for _, stmt := range statements {
+		c.add(e.statement(stmt))
+	}
+	return
+}
+
+func (e *costEstimator) statement(node TreeNodeIf) (c costInfo) {
+	switch tt := node.(type) {
+	case *constNode, *structDefNode:
+	case *blockNode:
+		c = e.block(tt.children())
+	case *ifStatementNode:
+		branches := tt.children()
+		c = e.line(tt, ownCost(tt, branches...))
+		c.add(e.calls(tt.condExpr))
+		c.add(e.worst(branches))
+	case *switchStatementNode:
+		branches := tt.children()
+		c = e.line(tt, ownCost(tt, branches...))
+		c.add(e.calls(tt.value))
+		c.add(e.worst(branches))
+	case *contractNode:
+		branches := tt.children()
+		c = e.line(tt, ownCost(tt, branches...))
+		c.add(e.worst(branches))
+	case *forStatementNode:
+		e.loopDepth++
+		body := tt.children()
+		c = e.line(tt, ownCost(tt, body...))
+		c.add(e.calls(tt.init))
+		c.add(e.calls(tt.condExpr))
+		c.add(e.calls(tt.step))
+		c.add(e.block(body))
+		c.loop = true
+		e.loopDepth--
+	default:
+		c = e.line(node, tealCost(node))
+		c.add(e.calls(node))
+	}
+	return
+}
+
+// worst returns cost of the most expensive branch, contract methods are branches as well
+func (e *costEstimator) worst(branches []TreeNodeIf) (worst costInfo) {
+	for _, branch := range branches {
+		var bc costInfo
+		if def, ok := branch.(*funDefNode); ok {
+			bc = e.line(def, ownCost(def, def.children()...))
+			bc.add(e.block(def.children()))
+		} else {
+			bc = e.statement(branch)
+		}
+		if bc.cost > worst.cost {
+			worst.cost = bc.cost
+		}
+		worst.loop = worst.loop || bc.loop
+	}
+	return
+}
+
+// calls returns cost of non-inline functions called by the node.
+// Loops in inlined functions are reported as well.
+func (e *costEstimator) calls(node TreeNodeIf) (c costInfo) {
+	if node == nil {
+		return
+	}
+	switch tt := node.(type) {
+	case *forStatementNode:
+		c.loop = true
+	case *funCallNode:
+		if tt.definition != nil && !tt.definition.inline {
+			c.add(e.function(tt.definition))
+		}
+	}
+	for _, nested := range nestedNodes(node) {
+		c.add(e.calls(nested))
+	}
+	return
+}
+
+// nestedNodes returns children of the node along with expressions and statements kept in its fields
+func nestedNodes(node TreeNodeIf) []TreeNodeIf {
+	var result []TreeNodeIf
+	appendNode := func(n TreeNodeIf) {
+		if n != nil {
+			result = append(result, n)
+		}
+	}
+	appendExpr := func(n ExprNodeIf) {
+		if n != nil {
+			result = append(result, n)
+		}
+	}
+
+	switch tt := node.(type) {
+	case *varDeclNode:
+		appendExpr(tt.value)
+	case *destructuringNode:
+		appendExpr(tt.value)
+	case *assignNode:
+		appendExpr(tt.value)
+	case *assignInnerTxnNode:
+		appendExpr(tt.value)
+	case *assignStructFieldNode:
+		appendExpr(tt.value)
+	case *structFieldNode:
+		appendExpr(tt.value)
+	case *returnNode:
+		for _, value := range tt.values {
+			appendExpr(value)
+		}
+	case *exprGroupNode:
+		appendExpr(tt.value)
+	case *exprBinOpNode:
+		appendExpr(tt.lhs)
+		appendExpr(tt.rhs)
+	case *exprUnOpNode:
+		appendExpr(tt.value)
+	case *typeCastNode:
+		appendExpr(tt.expr)
+	case *ifExprNode:
+		appendExpr(tt.condExpr)
+		appendExpr(tt.condTrueExpr)
+		appendExpr(tt.condFalseExpr)
+	case *ifStatementNode:
+		appendExpr(tt.condExpr)
+	case *switchStatementNode:
+		appendExpr(tt.value)
+	case *switchExprNode:
+		appendExpr(tt.value)
+	case *contractNode:
+		appendExpr(tt.value)
+	case *forStatementNode:
+		appendNode(tt.init)
+		appendExpr(tt.condExpr)
+		appendNode(tt.step)
+	case *funCallNode:
+		if tt.definition != nil && tt.definition.inline {
+			appendNode(tt.definition)
+		}
+	}
+	for _, ch := range node.children() {
+		appendNode(ch)
+	}
+	return result
+}
+
+// tealCost returns opcode cost of the code generated for the node
+func tealCost(node TreeNodeIf) int {
+	buf := new(gobytes.Buffer)
+	node.Codegen(buf)
+	cost := 0
+	for _, ins := range parseTEAL(buf.String()) {
+		if ins.isLabel() || strings.HasPrefix(ins.op, "#") {
+			continue
+		}
+		if op, ok := langOps[ins.op]; ok {
+			cost += op.Cost
+		} else {
+			cost++
+		}
+	}
+	return cost
+}
+
+// ownCost returns cost of the code generated for the node without its nested statements
+func ownCost(node TreeNodeIf, nested ...TreeNodeIf) int {
+	cost := tealCost(node)
+	for _, n := range nested {
+		cost -= tealCost(n)
+	}
+	return cost
+}
+
+func uvarintSize(value uint64) int {
+	var scratch [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(scratch[:], value)
+}
+
+// bytesLiteralSize returns length of a bytes constant in TEAL notation
+func bytesLiteralSize(value string) int {
+	if strings.HasPrefix(value, "0x") {
+		if data, err := hex.DecodeString(value[2:]); err == nil {
+			return len(data)
+		}
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return len(unquoted)
+	}
+	return len(value)
+}
+
+// tealSize returns bytecode size of the program as assembled by go-algorand
+func tealSize(program []instruction) int {
+	size := 0
+	for _, ins := range program {
+		if ins.isLabel() {
+			continue
+		}
+		if strings.HasPrefix(ins.op, "#") {
+			if ins.op == "#pragma" && len(ins.args) == 2 && ins.args[0] == "version" {
+				version, _ := strconv.ParseUint(ins.args[1], 10, 64)
+				size += uvarintSize(version)
+			}
+			continue
+		}
+		op, ok := langOps[ins.op]
+		if !ok {
+			size++
+			continue
+		}
+		if op.Size != 0 && len(ins.args) != 1 {
+			size += op.Size
+			continue
+		}
+		switch ins.op {
+		case "intcblock":
+			size += 1 + uvarintSize(uint64(len(ins.args)))
+			for _, arg := range ins.args {
+				value, _ := strconv.ParseUint(arg, 0, 64)
+				size += uvarintSize(value)
+			}
+		case "bytecblock":
+			size += 1 + uvarintSize(uint64(len(ins.args)))
+			for _, arg := range ins.args {
+				length := bytesLiteralSize(arg)
+				size += uvarintSize(uint64(length)) + length
+			}
+		case "pushint":
+			if len(ins.args) != 1 {
+				size++
+				continue
+			}
+			value, _ := strconv.ParseUint(ins.args[0], 0, 64)
+			size += 1 + uvarintSize(value)
+		case "pushbytes":
+			if len(ins.args) != 1 {
+				size++
+				continue
+			}
+			length := bytesLiteralSize(ins.args[0])
+			size += 1 + uvarintSize(uint64(length)) + length
+		case "switch", "match":
+			// opcode, labels number and 2 bytes offset per label
+			size += 2 + 2*len(ins.args)
+		case "intc", "bytec", "arg":
+			// the first four constants and arguments have dedicated single byte opcodes
+			if idx, err := strconv.Atoi(ins.args[0]); err == nil && idx < 4 {
+				size++
+			} else {
+				size += op.Size
+			}
+		default:
+			size += op.Size
+		}
+	}
+	return size
+}
@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostReport(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function double(x) {
+	return x + x
+}
+function logic() {
+	let a = 1
+	for a < 10 {
+		a = double(a)
+	}
+	return a
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	report := EstimateCost(result, Codegen(result))
+
+	a.Equal([]FunctionCost{{"main", 17, true}, {"double", 5, false}}, report.Functions)
+	a.Equal([]LineCost{
+		{"", 2, 1, false},
+		{"", 3, 4, false},
+		{"", 6, 2, false},
+		{"", 7, 5, true},
+		{"", 8, 3, true},
+		{"", 10, 2, false},
+	}, report.Lines)
+	a.Equal(18, report.Cost)
+	a.True(report.Loop)
+	a.Equal(37, report.Size)
+	a.Equal(ModeLogicSig, report.Mode)
+	a.Empty(report.Warnings())
+	a.Contains(report.String(), "line 8: 3 (per loop iteration)\n")
+	a.Contains(report.String(), "total cost: 18 (every loop iteration counted once)\n")
+
+	a.Equal([]string{"cost 701 exceeds application call budget of 700"}, CostReport{Cost: 701}.Warnings())
+	a.Equal(2, len(CostReport{Cost: 20001}.Warnings()))
+}
+
+func TestCostWarnings(t *testing.T) {
+	a := require.New(t)
+
+	// LogicSigs are checked against LogicSig budget only
+	a.Empty(CostReport{Cost: 701, Mode: ModeLogicSig}.Warnings())
+	a.Equal([]string{"cost 20001 exceeds LogicSig budget of 20000"}, CostReport{Cost: 20001, Mode: ModeLogicSig}.Warnings())
+
+	// applications are checked against application call budget only
+	for _, mode := range []string{ModeApproval, ModeClearState} {
+		a.Empty(CostReport{Cost: 700, Mode: mode}.Warnings())
+		a.Equal([]string{"cost 701 exceeds application call budget of 700"}, CostReport{Cost: 701, Mode: mode}.Warnings())
+		a.Equal([]string{"cost 20001 exceeds application call budget of 700"}, CostReport{Cost: 20001, Mode: mode}.Warnings())
+	}
+
+	for source, mode := range map[string]string{
+		"function logic() { return 1 }":      ModeLogicSig,
+		"function approval() { return 1 }":   ModeApproval,
+		"function clearstate() { return 1 }": ModeClearState,
+		"contract C { bare create { } }":     ModeApproval,
+	} {
+		result, errors := Parse(source)
+		a.NotEmpty(result, errors)
+		a.Empty(errors)
+		a.Equal(mode, EstimateCost(result, Codegen(result)).Mode, source)
+	}
+}
+
+func TestCostSize(t *testing.T) {
+	a := require.New(t)
+
+	// the size matches go-algorand assembler output
+	teal := `#pragma version 6
+intcblock 0 1 300 4 5
+bytecblock 0x0102
+intc 2
+intc 4
++
+bytec 0
+pushbytes 0x01
+concat
+pop
+pushint 1000
++
+b label
+label:
+txn Fee
+return
+`
+	a.Equal(34, tealSize(parseTEAL(teal)))
+}
@@ -0,0 +1,1545 @@
+//--------------------------------------------------------------------------------------------------
+//
+// TEAL to tealang decompiler
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// named integer constants of TEAL assembler
+var tealNamedInts = map[string]uint64{
+	"unknown": 0, "pay": 1, "keyreg": 2, "acfg": 3, "axfer": 4, "afrz": 5, "appl": 6,
+	"NoOp": 0, "OptIn": 1, "CloseOut": 2, "ClearState": 3, "UpdateApplication": 4, "DeleteApplication": 5,
+}
+
+// TEAL ops written as tealang infix operators
+var tealBinOps = map[string]int{
+	"*": precMul, "/": precMul, "%": precMul,
+	"+": precAdd, "-": precAdd,
+	"<": precRel, ">": precRel, "<=": precRel, ">=": precRel, "==": precRel, "!=": precRel,
+	"|": precBit, "&": precBit, "^": precBit,
+	"&&": precLogic, "||": precLogic,
+}
+
+// TEAL ops written as tealang builtin function calls with a different name
+var tealRenamedFuncs = map[string]string{
+	"b+": "badd", "b-": "bsub", "b/": "bdiv", "b*": "bmul", "b%": "bmod",
+	"b<": "blt", "b>": "bgt", "b<=": "ble", "b>=": "bge", "b==": "beq", "b!=": "bne",
+	"b|": "bor", "b&": "band", "b^": "bxor", "b~": "bnot",
+	"substring3": "substring", "extract3": "extract", "gaids": "gaid",
+}
+
+// TEAL ops written as tealang builtin function calls with the same name
+var tealFuncs = map[string]bool{
+	"sha256": true, "keccak256": true, "sha512_256": true, "ed25519verify": true,
+	"len": true, "itob": true, "btoi": true, "concat": true, "divw": true, "exp": true,
+	"getbit": true, "getbyte": true, "setbit": true, "setbyte": true, "shl": true, "shr": true,
+	"sqrt": true, "bitlen": true, "bzero": true, "bsqrt": true,
+}
+
+// TEAL ops returning several values written as tealang tuple expressions
+var tealTupleFuncs = map[string]bool{
+	"mulw": true, "addw": true, "expw": true, "divmodw": true,
+}
+
+var negatedRelation = map[string]string{"==": "!=", "!=": "==", "<": ">=", "<=": ">", ">": "<=", ">=": "<"}
+
+// operators precedence as in tealang grammar, lower binds tighter
+const (
+	precAtom = iota
+	precUnary
+	precMul
+	precAdd
+	precRel
+	precBit
+	precLogic
+	precIfExpr
+)
+
+// dvalue is a decompiled expression on the symbolic stack
+type dvalue struct {
+	text string
+	prec int
+	typ  exprType
+	// impure values call functions or read state that statements might change
+	impure bool
+	// scratch slots read by the expression
+	reads map[int]bool
+	// expression reads variables declared in the current block
+	scoped bool
+
+	// relation or negation parts used to invert conditions
+	op       string
+	operands []*dvalue
+}
+
+func atom(text string, typ exprType) *dvalue {
+	return &dvalue{text: text, prec: precAtom, typ: typ}
+}
+
+// derived creates an expression of the operands inheriting their reads and impurity
+func derived(text string, prec int, typ exprType, operands ...*dvalue) *dvalue {
+	v := &dvalue{text: text, prec: prec, typ: typ}
+	for _, op := range operands {
+		v.impure = v.impure || op.impure
+		v.scoped = v.scoped || op.scoped
+		for slot := range op.reads {
+			if v.reads == nil {
+				v.reads = make(map[int]bool)
+			}
+			v.reads[slot] = true
+		}
+	}
+	return v
+}
+
+func (v *dvalue) paren(prec int) string {
+	if v.prec > prec {
+		return "(" + v.text + ")"
+	}
+	return v.text
+}
+
+// cast wraps the value of unknown type to toint or tobyte
+func (v *dvalue) cast(typ exprType) *dvalue {
+	if v.typ != unknownType || typ == unknownType {
+		return v
+	}
+	name := "toint"
+	if typ == bytesType {
+		name = "tobyte"
+	}
+	return derived(fmt.Sprintf("%s(%s)", name, v.text), precAtom, typ, v)
+}
+
+func binaryValue(op string, lhs *dvalue, rhs *dvalue) *dvalue {
+	prec := tealBinOps[op]
+	typ, _ := opTypeFromSpec(op, 0)
+	lhs = lhs.cast(argType(op, 0))
+	rhs = rhs.cast(argType(op, 1))
+	v := derived(fmt.Sprintf("%s %s %s", lhs.paren(prec), op, rhs.paren(prec-1)), prec, typ, lhs, rhs)
+	v.op = op
+	v.operands = []*dvalue{lhs, rhs}
+	return v
+}
+
+func unaryValue(op string, value *dvalue) *dvalue {
+	value = value.cast(intType)
+	v := derived(op+value.paren(precUnary), precUnary, intType, value)
+	v.op = op
+	v.operands = []*dvalue{value}
+	return v
+}
+
+// negate returns the condition inverted
+func negate(cond *dvalue) *dvalue {
+	if cond.op == "!" {
+		return cond.operands[0]
+	}
+	if inverted, ok := negatedRelation[cond.op]; ok {
+		return binaryValue(inverted, cond.operands[0], cond.operands[1])
+	}
+	return unaryValue("!", cond)
+}
+
+func callValue(name string, typ exprType, args ...*dvalue) *dvalue {
+	texts := make([]string, len(args))
+	for i, arg := range args {
+		texts[i] = arg.text
+	}
+	return derived(fmt.Sprintf("%s(%s)", name, strings.Join(texts, ", ")), precAtom, typ, args...)
+}
+
+func argType(op string, idx int) exprType {
+	typ, err := argOpTypeFromSpec(op, idx)
+	if err != nil {
+		return unknownType
+	}
+	return typ
+}
+
+func returnType(op string, idx int) exprType {
+	typ, err := opTypeFromSpec(op, idx)
+	if err != nil || typ == invalidType {
+		return unknownType
+	}
+	return typ
+}
+
+func fieldType(op string, field string) exprType {
+	typ, err := runtimeFieldTypeFromSpec(op, field)
+	if err != nil || typ == invalidType {
+		return unknownType
+	}
+	return typ
+}
+
+// bytesLiteral formats bytes as tealang string literal, the lexer only allows hex escapes
+func bytesLiteral(value []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, ch := range value {
+		if ch >= 0x20 && ch < 0x7f && ch != '"' && ch != '\\' {
+			sb.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&sb, "\\x%02x", ch)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// parseTEALBytes decodes byte constant arguments of byte, pushbytes and bytecblock
+func parseTEALBytes(args []string) ([]byte, int, error) {
+	if len(args) == 0 {
+		return nil, 0, fmt.Errorf("byte constant expected")
+	}
+	arg := args[0]
+	decode := func(encoding string, value string) ([]byte, error) {
+		switch encoding {
+		case "base64", "b64":
+			return base64.StdEncoding.DecodeString(value)
+		default:
+			return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(value, "="))
+		}
+	}
+	switch {
+	case strings.HasPrefix(arg, "0x"):
+		value, err := hex.DecodeString(arg[2:])
+		return value, 1, err
+	case strings.HasPrefix(arg, "\""):
+		value, err := strconv.Unquote(arg)
+		return []byte(value), 1, err
+	case arg == "base64" || arg == "b64" || arg == "base32" || arg == "b32":
+		if len(args) < 2 {
+			return nil, 0, fmt.Errorf("%s value expected", arg)
+		}
+		value, err := decode(arg, args[1])
+		return value, 2, err
+	}
+	if open := strings.IndexByte(arg, '('); open > 0 && strings.HasSuffix(arg, ")") {
+		value, err := decode(arg[:open], arg[open+1:len(arg)-1])
+		return value, 1, err
+	}
+	return nil, 0, fmt.Errorf("unknown byte constant %s", arg)
+}
+
+func parseTEALInt(arg string) (uint64, error) {
+	if value, ok := tealNamedInts[arg]; ok {
+		return value, nil
+	}
+	return strconv.ParseUint(arg, 0, 64)
+}
+
+// splitTEALLine splits a line to fields keeping quoted strings and dropping the comment
+func splitTEALLine(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inString := false
+	flush := func() {
+		if current.Len() > 0 {
+			fields = append(fields, current.String())
+			current.Reset()
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inString:
+			current.WriteByte(ch)
+			if ch == '\\' && i+1 < len(line) {
+				i++
+				current.WriteByte(line[i])
+			} else if ch == '"' {
+				inString = false
+			}
+		case ch == '"':
+			inString = true
+			current.WriteByte(ch)
+		case ch == '/' && i+1 < len(line) && line[i+1] == '/':
+			flush()
+			return fields
+		case ch == ' ' || ch == '\t':
+			flush()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	flush()
+	return fields
+}
+
+// normalizeInstruction converts op shortcuts to the generic form
+func normalizeInstruction(ins instruction) instruction {
+	for _, prefix := range []string{"intc", "bytec", "arg"} {
+		if strings.HasPrefix(ins.op, prefix+"_") {
+			return instruction{op: prefix, args: []string{ins.op[len(prefix)+1:]}, line: ins.line}
+		}
+	}
+	switch {
+	case ins.op == "pushint":
+		ins.op = "int"
+	case ins.op == "pushbytes":
+		ins.op = "byte"
+	case ins.op == "txn" && len(ins.args) == 2:
+		ins.op = "txna"
+	case ins.op == "gtxn" && len(ins.args) == 3:
+		ins.op = "gtxna"
+	}
+	return ins
+}
+
+// tealBlock is a basic block of instructions [start, end) ending with a terminator op or falling through
+type tealBlock struct {
+	start  int
+	end    int
+	kind   string
+	target int
+	next   int
+}
+
+func (b *tealBlock) successors() []int {
+	switch b.kind {
+	case "b":
+		return []int{b.target}
+	case "bz", "bnz":
+		return []int{b.target, b.next}
+	case "return", "err", "retsub":
+		return nil
+	}
+	if b.next < 0 {
+		return nil
+	}
+	return []int{b.next}
+}
+
+// tealFunc is the main program or a subroutine
+type tealFunc struct {
+	name    string
+	entry   int
+	blocks  []int
+	args    int
+	returns int
+	// stack heights are inconsistent or the function is recursive
+	broken bool
+	// subroutine is being analyzed, guards against recursion
+	visiting bool
+	analyzed bool
+}
+
+type decompiler struct {
+	program []instruction
+	version int
+	labels  map[string]int
+	intc    []string
+	bytec   [][]byte
+	blocks  map[int]*tealBlock
+	funcs   map[int]*tealFunc
+	order   []*tealFunc
+
+	// scratch slots types collected by the first pass
+	slotTypes map[int]exprType
+	slotSeen  map[int]map[exprType]bool
+	final     bool
+}
+
+// Decompile converts TEAL program text to tealang source.
+// Scratch slots become global variables pinned to the same slots, subroutines become functions,
+// branches and loops become if-else and for statements.
+// Constructions that can not be expressed in tealang are left as comments.
+func Decompile(teal string) (string, error) {
+	d := &decompiler{
+		labels:    make(map[string]int),
+		blocks:    make(map[int]*tealBlock),
+		funcs:     make(map[int]*tealFunc),
+		slotTypes: make(map[int]exprType),
+		slotSeen:  make(map[int]map[exprType]bool),
+	}
+	if err := d.parse(teal); err != nil {
+		return "", err
+	}
+	if len(d.program) == 0 {
+		return "", fmt.Errorf("empty program")
+	}
+	d.buildBlocks()
+	main := &tealFunc{name: "logic", entry: 0}
+	d.funcs[0] = main
+	d.analyze(main)
+	if main.args != 0 || main.returns != 0 {
+		main.broken = true
+		main.args, main.returns = 0, 0
+	}
+
+	// the first pass collects types of values stored to scratch slots
+	d.emit()
+	for slot, types := range d.slotSeen {
+		d.slotTypes[slot] = intType
+		if types[bytesType] && !types[intType] {
+			d.slotTypes[slot] = bytesType
+		}
+	}
+	d.final = true
+	return d.emit(), nil
+}
+
+func (d *decompiler) parse(teal string) error {
+	for idx, line := range strings.Split(teal, "\n") {
+		fields := splitTEALLine(strings.TrimSpace(line))
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "#pragma" {
+			if len(fields) == 3 && fields[1] == "version" {
+				d.version, _ = strconv.Atoi(fields[2])
+			}
+			continue
+		}
+		if len(fields) == 1 && strings.HasSuffix(fields[0], ":") {
+			label := strings.TrimSuffix(fields[0], ":")
+			d.labels[label] = len(d.program)
+			d.program = append(d.program, instruction{label: label, line: idx + 1})
+			continue
+		}
+		ins := normalizeInstruction(instruction{op: fields[0], args: fields[1:], line: idx + 1})
+		switch ins.op {
+		case "intcblock":
+			for _, arg := range ins.args {
+				value, err := parseTEALInt(arg)
+				if err != nil {
+					return fmt.Errorf("line %d: %s", ins.line, err.Error())
+				}
+				d.intc = append(d.intc, strconv.FormatUint(value, 10))
+			}
+		case "bytecblock":
+			for args := ins.args; len(args) > 0; {
+				value, n, err := parseTEALBytes(args)
+				if err != nil {
+					return fmt.Errorf("line %d: %s", ins.line, err.Error())
+				}
+				d.bytec = append(d.bytec, value)
+				args = args[n:]
+			}
+		}
+		d.program = append(d.program, ins)
+	}
+	return nil
+}
+
+func (d *decompiler) target(ins instruction) int {
+	if len(ins.args) == 0 {
+		return -1
+	}
+	if idx, ok := d.labels[ins.args[0]]; ok {
+		return idx
+	}
+	return -1
+}
+
+func (d *decompiler) buildBlocks() {
+	leaders := map[int]bool{0: true}
+	for idx, ins := range d.program {
+		switch {
+		case len(ins.label) > 0:
+			leaders[idx] = true
+		case ins.op == "b" || ins.op == "bz" || ins.op == "bnz" || ins.op == "return" || ins.op == "err" || ins.op == "retsub":
+			leaders[idx+1] = true
+		}
+	}
+	starts := make([]int, 0, len(leaders))
+	for idx := range leaders {
+		if idx < len(d.program) {
+			starts = append(starts, idx)
+		}
+	}
+	sort.Ints(starts)
+	for i, start := range starts {
+		end := len(d.program)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		block := &tealBlock{start: start, end: end, target: -1, next: -1}
+		if end < len(d.program) {
+			block.next = end
+		}
+		last := d.program[end-1]
+		switch last.op {
+		case "b", "bz", "bnz":
+			block.kind = last.op
+			block.target = d.target(last)
+		case "return", "err", "retsub":
+			block.kind = last.op
+		}
+		d.blocks[start] = block
+	}
+}
+
+// stackEffect returns number of values the instruction pops and pushes
+func (d *decompiler) stackEffect(ins instruction) (int, int, bool) {
+	depth := func() int {
+		if len(ins.args) == 0 {
+			return 0
+		}
+		n, _ := strconv.Atoi(ins.args[0])
+		return n
+	}
+	switch ins.op {
+	case "":
+		return 0, 0, true
+	case "int", "byte", "addr", "method", "intc", "bytec", "arg":
+		return 0, 1, true
+	case "dig":
+		return depth() + 1, depth() + 2, true
+	case "cover", "uncover":
+		return depth() + 1, depth() + 1, true
+	case "callsub":
+		callee := d.subroutine(ins)
+		if callee == nil || callee.broken {
+			return 0, 0, false
+		}
+		return callee.args, callee.returns, true
+	case "retsub", "b":
+		return 0, 0, true
+	}
+	spec, ok := langOps[ins.op]
+	if !ok {
+		return 0, 0, false
+	}
+	return len(spec.Args), len(spec.Returns), true
+}
+
+// subroutine returns analyzed function called by callsub
+func (d *decompiler) subroutine(ins instruction) *tealFunc {
+	entry := d.target(ins)
+	if entry < 0 {
+		return nil
+	}
+	fn, ok := d.funcs[entry]
+	if !ok {
+		fn = &tealFunc{name: subroutineName(ins.args[0], d.funcs), entry: entry}
+		d.funcs[entry] = fn
+	}
+	if fn.visiting {
+		fn.broken = true
+		return fn
+	}
+	if !fn.analyzed {
+		d.analyze(fn)
+	}
+	return fn
+}
+
+// subroutineName makes tealang identifier of the label
+func subroutineName(label string, funcs map[int]*tealFunc) string {
+	var sb strings.Builder
+	for i, ch := range label {
+		if ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || i > 0 && ch >= '0' && ch <= '9' {
+			sb.WriteRune(ch)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	name := "sub_" + sb.String()
+	for _, fn := range funcs {
+		if fn.name == name {
+			name = fmt.Sprintf("%s_%d", name, len(funcs))
+		}
+	}
+	return name
+}
+
+// analyze finds blocks of the function, number of arguments and return values
+func (d *decompiler) analyze(fn *tealFunc) {
+	fn.visiting = true
+	defer func() {
+		fn.visiting = false
+		fn.analyzed = true
+		d.order = append(d.order, fn)
+	}()
+
+	heights := map[int]int{fn.entry: 0}
+	queue := []int{fn.entry}
+	minHeight := 0
+	returns := -1
+	for len(queue) > 0 {
+		start := queue[0]
+		queue = queue[1:]
+		fn.blocks = append(fn.blocks, start)
+		block := d.blocks[start]
+		height := heights[start]
+		for idx := block.start; idx < block.end; idx++ {
+			ins := d.program[idx]
+			if ins.op == "retsub" {
+				if returns >= 0 && returns != height-minHeight {
+					fn.broken = true
+				}
+				returns = height - minHeight
+			}
+			pops, pushes, ok := d.stackEffect(ins)
+			if !ok {
+				fn.broken = true
+				break
+			}
+			height -= pops
+			if height < minHeight {
+				minHeight = height
+			}
+			height += pushes
+		}
+		for _, succ := range block.successors() {
+			if succ < 0 {
+				fn.broken = true
+				continue
+			}
+			if h, ok := heights[succ]; ok {
+				if h != height {
+					fn.broken = true
+				}
+				continue
+			}
+			heights[succ] = height
+			queue = append(queue, succ)
+		}
+	}
+	sort.Ints(fn.blocks)
+	fn.args = -minHeight
+	if returns > 0 {
+		fn.returns = returns
+	}
+	if fn.returns > 1 {
+		fn.broken = true
+	}
+}
+
+// emit generates tealang source from the analyzed program
+func (d *decompiler) emit() string {
+	var sb strings.Builder
+	sb.WriteString("// decompiled from TEAL")
+	if d.version > 0 {
+		fmt.Fprintf(&sb, " version %d", d.version)
+	}
+	sb.WriteString("\n")
+
+	var functions strings.Builder
+	var main string
+	for _, fn := range d.order {
+		text := newFuncDecompiler(d, fn).decompile()
+		if fn.entry == 0 {
+			main = text
+		} else {
+			functions.WriteString(text)
+			functions.WriteString("\n")
+		}
+	}
+
+	slots := make([]int, 0, len(d.slotTypes))
+	for slot := range d.slotTypes {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	for _, slot := range slots {
+		zero := "0"
+		if d.slotTypes[slot] == bytesType {
+			zero = `""`
+		}
+		fmt.Fprintf(&sb, "let %s @ %d = %s\n", slotName(slot), slot, zero)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(functions.String())
+	sb.WriteString(main)
+	return sb.String()
+}
+
+func slotName(slot int) string {
+	return fmt.Sprintf("slot%d", slot)
+}
+
+// codeLine is a statement of decompiled code with nesting depth
+type codeLine struct {
+	depth int
+	text  string
+}
+
+type code struct {
+	lines []codeLine
+}
+
+func (c *code) add(text string, args ...interface{}) {
+	c.lines = append(c.lines, codeLine{0, fmt.Sprintf(text, args...)})
+}
+
+func (c *code) comment(text string, args ...interface{}) {
+	c.add("// "+text, args...)
+}
+
+func (c *code) nest(other *code) {
+	for _, line := range other.lines {
+		c.lines = append(c.lines, codeLine{line.depth + 1, line.text})
+	}
+}
+
+// tealLoop is a natural loop of the control flow graph
+type tealLoop struct {
+	header int
+	follow int
+	body   map[int]bool
+	parent *tealLoop
+}
+
+type funcDecompiler struct {
+	d      *decompiler
+	fn     *tealFunc
+	temps  []string
+	next   int
+	budget int
+	ipdom  map[int]int
+	loops  map[int]*tealLoop
+}
+
+// exitBlock is a virtual block all terminators lead to
+const exitBlock = -1
+
+// noBlock marks absent loop follow or if-else join
+const noBlock = -2
+
+func newFuncDecompiler(d *decompiler, fn *tealFunc) *funcDecompiler {
+	f := &funcDecompiler{d: d, fn: fn, budget: 16*len(fn.blocks) + 64}
+	f.analyzeFlow()
+	return f
+}
+
+func (f *funcDecompiler) successors(block int) []int {
+	succ := f.d.blocks[block].successors()
+	if len(succ) == 0 {
+		return []int{exitBlock}
+	}
+	return succ
+}
+
+// analyzeFlow finds immediate post-dominators and natural loops
+func (f *funcDecompiler) analyzeFlow() {
+	all := make(map[int]bool, len(f.fn.blocks)+1)
+	all[exitBlock] = true
+	for _, b := range f.fn.blocks {
+		all[b] = true
+	}
+	intersect := func(sets []map[int]bool) map[int]bool {
+		result := make(map[int]bool)
+		for k := range sets[0] {
+			in := true
+			for _, s := range sets[1:] {
+				in = in && s[k]
+			}
+			if in {
+				result[k] = true
+			}
+		}
+		return result
+	}
+
+	// post-dominators
+	pdom := map[int]map[int]bool{exitBlock: {exitBlock: true}}
+	for _, b := range f.fn.blocks {
+		pdom[b] = all
+	}
+	preds := make(map[int][]int)
+	for _, b := range f.fn.blocks {
+		for _, s := range f.successors(b) {
+			preds[s] = append(preds[s], b)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(f.fn.blocks) - 1; i >= 0; i-- {
+			b := f.fn.blocks[i]
+			var sets []map[int]bool
+			for _, s := range f.successors(b) {
+				sets = append(sets, pdom[s])
+			}
+			result := intersect(sets)
+			result[b] = true
+			if len(result) != len(pdom[b]) {
+				pdom[b] = result
+				changed = true
+			}
+		}
+	}
+	f.ipdom = make(map[int]int)
+	for _, b := range f.fn.blocks {
+		f.ipdom[b] = exitBlock
+		for candidate := range pdom[b] {
+			if candidate != b && len(pdom[candidate]) == len(pdom[b])-1 {
+				f.ipdom[b] = candidate
+			}
+		}
+	}
+
+	// dominators
+	dom := map[int]map[int]bool{f.fn.entry: {f.fn.entry: true}}
+	for _, b := range f.fn.blocks {
+		if b != f.fn.entry {
+			dom[b] = all
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range f.fn.blocks {
+			if b == f.fn.entry || len(preds[b]) == 0 {
+				continue
+			}
+			var sets []map[int]bool
+			for _, p := range preds[b] {
+				sets = append(sets, dom[p])
+			}
+			result := intersect(sets)
+			result[b] = true
+			if len(result) != len(dom[b]) {
+				dom[b] = result
+				changed = true
+			}
+		}
+	}
+
+	// natural loops of back edges
+	f.loops = make(map[int]*tealLoop)
+	for _, b := range f.fn.blocks {
+		for _, h := range f.successors(b) {
+			if h == exitBlock || !dom[b][h] {
+				continue
+			}
+			loop, ok := f.loops[h]
+			if !ok {
+				loop = &tealLoop{header: h, follow: noBlock, body: map[int]bool{h: true}}
+				f.loops[h] = loop
+			}
+			stack := []int{b}
+			for len(stack) > 0 {
+				n := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if loop.body[n] {
+					continue
+				}
+				loop.body[n] = true
+				stack = append(stack, preds[n]...)
+			}
+		}
+	}
+	for h, loop := range f.loops {
+		// prefer the exit of the loop condition
+		for _, s := range f.successors(h) {
+			if s != exitBlock && !loop.body[s] {
+				loop.follow = s
+			}
+		}
+		if loop.follow != noBlock {
+			continue
+		}
+		for _, b := range f.fn.blocks {
+			if !loop.body[b] {
+				continue
+			}
+			for _, s := range f.successors(b) {
+				if s != exitBlock && !loop.body[s] && (loop.follow == noBlock || s < loop.follow) {
+					loop.follow = s
+				}
+			}
+		}
+	}
+}
+
+func (f *funcDecompiler) decompile() string {
+	body := &code{}
+	if f.fn.broken {
+		body.comment("stack usage of this code can not be decompiled:")
+		for _, b := range f.fn.blocks {
+			block := f.d.blocks[b]
+			for idx := block.start; idx < block.end; idx++ {
+				body.comment("%s", f.d.program[idx].String())
+			}
+		}
+		body.add("error")
+	} else {
+		var st []*dvalue
+		for i := 0; i < f.fn.args; i++ {
+			st = append(st, atom(fmt.Sprintf("p%d", i), unknownType))
+		}
+		f.region(f.fn.entry, noBlock, st, nil, body)
+	}
+
+	var sb strings.Builder
+	args := make([]string, f.fn.args)
+	for i := range args {
+		args[i] = fmt.Sprintf("p%d", i)
+	}
+	if f.fn.entry != 0 && f.fn.returns == 0 && !f.fn.broken {
+		sb.WriteString("// no return value, returns 1 to be called in assert\n")
+	}
+	fmt.Fprintf(&sb, "function %s(%s) {\n", f.fn.name, strings.Join(args, ", "))
+	for _, decl := range f.temps {
+		fmt.Fprintf(&sb, "    %s\n", decl)
+	}
+	for _, line := range body.lines {
+		fmt.Fprintf(&sb, "%s%s\n", strings.Repeat("    ", line.depth+1), line.text)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// temp declares a function variable for the value and assigns it
+func (f *funcDecompiler) temp(v *dvalue, out *code) *dvalue {
+	name := fmt.Sprintf("tmp%d", f.next)
+	f.next++
+	typ := v.typ
+	if typ == unknownType {
+		typ = intType
+		v = v.cast(intType)
+	}
+	zero := "0"
+	if typ == bytesType {
+		zero = `""`
+	}
+	f.temps = append(f.temps, fmt.Sprintf("let %s = %s", name, zero))
+	out.add("%s = %s", name, v.text)
+	return atom(name, typ)
+}
+
+// flush assigns to variables stack values that the next statement might change
+func (f *funcDecompiler) flush(st []*dvalue, slot int, out *code) {
+	for i, v := range st {
+		if v.impure || slot >= 0 && v.reads[slot] {
+			st[i] = f.temp(v, out)
+		}
+	}
+}
+
+// unscope assigns to function variables values of tuple variables declared in a branch block
+func (f *funcDecompiler) unscope(st []*dvalue, outer []*dvalue, out *code) {
+	declared := make(map[*dvalue]bool, len(outer))
+	for _, v := range outer {
+		declared[v] = true
+	}
+	for i, v := range st {
+		if v.scoped && !declared[v] {
+			st[i] = f.temp(v, out)
+		}
+	}
+}
+
+// region emits blocks from start until stop is reached,
+// returns the stack at stop and false if all paths terminate
+func (f *funcDecompiler) region(start int, stop int, st []*dvalue, loop *tealLoop, out *code) ([]*dvalue, bool) {
+	for b := start; ; {
+		if b == stop {
+			return st, true
+		}
+		f.budget--
+		if f.budget < 0 {
+			out.comment("control flow is too complex to decompile")
+			out.add("error")
+			return nil, false
+		}
+		if loop != nil {
+			if b == loop.header {
+				out.add("continue")
+				return nil, false
+			}
+			if b == loop.follow {
+				out.add("break")
+				return nil, false
+			}
+			for outer := loop.parent; outer != nil; outer = outer.parent {
+				if b == outer.header || b == outer.follow {
+					out.comment("jump to %s of an outer loop can not be decompiled", f.label(b))
+					out.add("error")
+					return nil, false
+				}
+			}
+		}
+		if l, ok := f.loops[b]; ok && (loop == nil || loop.header != b) {
+			var reached bool
+			st, reached = f.loop(l, st, loop, out)
+			if !reached {
+				return nil, false
+			}
+			b = l.follow
+			continue
+		}
+
+		var next int
+		var reached bool
+		st, next, reached = f.block(b, st, loop, out)
+		if !reached {
+			return nil, false
+		}
+		b = next
+	}
+}
+
+func (f *funcDecompiler) label(b int) string {
+	if ins := f.d.program[b]; len(ins.label) > 0 {
+		return ins.label
+	}
+	return fmt.Sprintf("line %d", f.d.program[b].line)
+}
+
+// loop emits for statement of the loop, returns the stack at the loop follow
+func (f *funcDecompiler) loop(l *tealLoop, st []*dvalue, parent *tealLoop, out *code) ([]*dvalue, bool) {
+	for i, v := range st {
+		if v.prec != precAtom || v.impure || len(v.reads) > 0 {
+			st[i] = f.temp(v, out)
+		}
+	}
+	inner := &tealLoop{header: l.header, follow: l.follow, body: l.body, parent: parent}
+	body := &code{}
+	cond := "1"
+
+	// the condition checked before every iteration makes for statement header
+	header := f.d.blocks[l.header]
+	probe := &code{}
+	temps, next := len(f.temps), f.next
+	hst := f.exec(header, append([]*dvalue{}, st...), probe)
+	simple := false
+	if hst != nil && len(probe.lines) == 0 && len(hst) == len(st)+1 && (header.kind == "bz" || header.kind == "bnz") {
+		whenTrue, whenFalse := header.next, header.target
+		c := hst[len(hst)-1].cast(intType)
+		if header.kind == "bnz" {
+			whenTrue, whenFalse = header.target, header.next
+		}
+		if whenFalse == l.follow && l.body[whenTrue] {
+			cond, simple = c.text, true
+			f.region(whenTrue, noBlock, st, inner, body)
+		} else if whenTrue == l.follow && l.body[whenFalse] {
+			cond, simple = negate(c).text, true
+			f.region(whenFalse, noBlock, st, inner, body)
+		}
+	}
+	if !simple {
+		f.temps, f.next = f.temps[:temps], next
+		body = &code{}
+		if hst, follow, reached := f.block(l.header, append([]*dvalue{}, st...), inner, body); reached {
+			f.region(follow, noBlock, hst, inner, body)
+		}
+	}
+	if n := len(body.lines); n > 0 && body.lines[n-1].depth == 0 && body.lines[n-1].text == "continue" {
+		body.lines = body.lines[:n-1]
+	}
+	out.add("for %s {", cond)
+	out.nest(body)
+	out.add("}")
+	return st, l.follow != noBlock
+}
+
+// block emits the block code and its terminator, returns the next block and the stack
+func (f *funcDecompiler) block(b int, st []*dvalue, loop *tealLoop, out *code) ([]*dvalue, int, bool) {
+	block := f.d.blocks[b]
+	st = f.exec(block, st, out)
+	if st == nil {
+		return nil, 0, false
+	}
+	pop := func() *dvalue {
+		if len(st) == 0 {
+			return nil
+		}
+		v := st[len(st)-1]
+		st = st[:len(st)-1]
+		return v
+	}
+
+	switch block.kind {
+	case "b":
+		return st, block.target, true
+	case "err":
+		out.add("error")
+		return nil, 0, false
+	case "return":
+		v := pop()
+		if v == nil {
+			out.comment("return with empty stack")
+			out.add("error")
+		} else if f.fn.entry == 0 {
+			out.add("return %s", v.cast(intType).text)
+		} else if v.text == "0" {
+			out.comment("return 0 exits the program")
+			out.add("error")
+		} else {
+			out.comment("return %s exits the program and can not be decompiled in a function", v.text)
+			out.add("error")
+		}
+		return nil, 0, false
+	case "retsub":
+		if f.fn.returns == 0 {
+			out.add("return 1")
+		} else {
+			out.add("return %s", pop().text)
+		}
+		return nil, 0, false
+	case "bz", "bnz":
+		cond := pop()
+		if cond == nil {
+			out.comment("branch with empty stack")
+			out.add("error")
+			return nil, 0, false
+		}
+		return f.branch(b, cond.cast(intType), st, loop, out)
+	}
+	if block.next < 0 {
+		// program end returns the top of the stack
+		v := pop()
+		if v == nil || f.fn.entry != 0 {
+			out.comment("program end can not be decompiled")
+			out.add("error")
+		} else {
+			out.add("return %s", v.cast(intType).text)
+		}
+		return nil, 0, false
+	}
+	return st, block.next, true
+}
+
+// branch emits if-else statement of the conditional branch, returns the join block and the stack there
+func (f *funcDecompiler) branch(b int, cond *dvalue, st []*dvalue, loop *tealLoop, out *code) ([]*dvalue, int, bool) {
+	block := f.d.blocks[b]
+	whenTrue, whenFalse := block.next, block.target
+	if block.kind == "bnz" {
+		whenTrue, whenFalse = block.target, block.next
+	}
+	follow := f.ipdom[b]
+	if follow == exitBlock || loop != nil && !loop.body[follow] {
+		follow = noBlock
+	}
+
+	trueCode, falseCode := &code{}, &code{}
+	trueStack, trueReached := f.region(whenTrue, follow, append([]*dvalue{}, st...), loop, trueCode)
+	falseStack, falseReached := f.region(whenFalse, follow, append([]*dvalue{}, st...), loop, falseCode)
+	f.unscope(trueStack, st, trueCode)
+	f.unscope(falseStack, st, falseCode)
+
+	var merged []*dvalue
+	switch {
+	case trueReached && falseReached:
+		if len(trueStack) != len(falseStack) {
+			out.comment("branches leave different number of values on the stack")
+			out.add("error")
+			return nil, 0, false
+		}
+		merged = make([]*dvalue, len(trueStack))
+		if len(trueCode.lines) == 0 && len(falseCode.lines) == 0 {
+			// values computed in branches without statements make conditional expression
+			for i := range trueStack {
+				merged[i] = trueStack[i]
+				if trueStack[i].text != falseStack[i].text {
+					text := fmt.Sprintf("if %s { %s } else { %s }", cond.text, trueStack[i].text, falseStack[i].text)
+					merged[i] = derived(text, precIfExpr, trueStack[i].typ, cond, trueStack[i], falseStack[i])
+				}
+			}
+			return merged, follow, true
+		}
+		for i := range trueStack {
+			merged[i] = trueStack[i]
+			if trueStack[i].text != falseStack[i].text {
+				merged[i] = f.temp(trueStack[i], trueCode)
+				falseCode.add("%s = %s", merged[i].text, falseStack[i].cast(merged[i].typ).text)
+			}
+		}
+	case trueReached:
+		merged = trueStack
+	case falseReached:
+		merged = falseStack
+	}
+
+	if !trueReached && !falseReached {
+		// the shorter branch goes under if statement and the other one follows it
+		if len(falseCode.lines) < len(trueCode.lines) || len(falseCode.lines) == 1 && falseCode.lines[0].text == "error" {
+			cond, trueCode, falseCode = negate(cond), falseCode, trueCode
+		}
+		out.add("if %s {", cond.text)
+		out.nest(trueCode)
+		out.add("}")
+		out.lines = append(out.lines, falseCode.lines...)
+		return nil, 0, false
+	}
+
+	switch {
+	case len(falseCode.lines) == 0 && falseReached:
+		out.add("if %s {", cond.text)
+		out.nest(trueCode)
+	case len(trueCode.lines) == 0 && trueReached:
+		out.add("if %s {", negate(cond).text)
+		out.nest(falseCode)
+	default:
+		out.add("if %s {", cond.text)
+		out.nest(trueCode)
+		out.add("} else {")
+		out.nest(falseCode)
+	}
+	out.add("}")
+	return merged, follow, true
+}
+
+// exec emits statements of the block instructions except the terminator and returns the stack
+func (f *funcDecompiler) exec(block *tealBlock, st []*dvalue, out *code) []*dvalue {
+	end := block.end
+	if len(block.kind) > 0 {
+		end--
+	}
+	for idx := block.start; idx < end; idx++ {
+		ins := f.d.program[idx]
+		if len(ins.label) > 0 {
+			continue
+		}
+		var ok bool
+		if st, ok = f.instruction(ins, st, out); !ok {
+			out.comment("TEAL: %s", ins.String())
+			out.comment("instruction can not be decompiled")
+			out.add("error")
+			return nil
+		}
+	}
+	return st
+}
+
+// instruction applies TEAL instruction to the symbolic stack and emits statements
+func (f *funcDecompiler) instruction(ins instruction, st []*dvalue, out *code) ([]*dvalue, bool) {
+	pop := func(n int) []*dvalue {
+		if len(st) < n {
+			return nil
+		}
+		values := append([]*dvalue{}, st[len(st)-n:]...)
+		st = st[:len(st)-n]
+		return values
+	}
+	push := func(values ...*dvalue) {
+		st = append(st, values...)
+	}
+	arg := func(i int) string {
+		if i < len(ins.args) {
+			return ins.args[i]
+		}
+		return ""
+	}
+	index := func(i int) (int, bool) {
+		n, err := strconv.Atoi(arg(i))
+		return n, err == nil
+	}
+
+	op := ins.op
+	if spec, ok := langOps[op]; ok && len(st) < len(spec.Args) {
+		return st, false
+	}
+	switch {
+	case op == "intcblock" || op == "bytecblock":
+	case op == "int":
+		value, err := parseTEALInt(arg(0))
+		if err != nil {
+			return st, false
+		}
+		push(atom(strconv.FormatUint(value, 10), intType))
+	case op == "intc":
+		n, ok := index(0)
+		if !ok || n >= len(f.d.intc) {
+			return st, false
+		}
+		push(atom(f.d.intc[n], intType))
+	case op == "byte":
+		value, _, err := parseTEALBytes(ins.args)
+		if err != nil {
+			return st, false
+		}
+		push(atom(bytesLiteral(value), bytesType))
+	case op == "bytec":
+		n, ok := index(0)
+		if !ok || n >= len(f.d.bytec) {
+			return st, false
+		}
+		push(atom(bytesLiteral(f.d.bytec[n]), bytesType))
+	case op == "addr":
+		push(atom(fmt.Sprintf(`addr"%s"`, arg(0)), bytesType))
+	case op == "method":
+		sig, err := strconv.Unquote(arg(0))
+		if err != nil {
+			return st, false
+		}
+		hash := sha512.Sum512_256([]byte(sig))
+		push(atom(bytesLiteral(hash[:4]), bytesType))
+	case op == "arg":
+		push(atom(fmt.Sprintf("args[%s]", arg(0)), bytesType))
+	case op == "args":
+		v := pop(1)[0].cast(intType)
+		push(derived(fmt.Sprintf("args[%s]", v.text), precAtom, bytesType, v))
+	case op == "load":
+		n, ok := index(0)
+		if !ok {
+			return st, false
+		}
+		v := atom(slotName(n), f.d.slotTypes[n])
+		if !f.d.final {
+			v.typ = unknownType
+		}
+		v.reads = map[int]bool{n: true}
+		push(v)
+	case op == "store":
+		n, ok := index(0)
+		if !ok {
+			return st, false
+		}
+		v := pop(1)[0]
+		if _, seen := f.d.slotSeen[n]; !seen {
+			f.d.slotSeen[n] = make(map[exprType]bool)
+		}
+		f.d.slotSeen[n][v.typ] = true
+		f.flush(st, n, out)
+		typ := f.d.slotTypes[n]
+		if f.d.final && v.typ != unknownType && v.typ != typ {
+			out.comment("slot %d holds values of both uint64 and byte[] types", n)
+		}
+		out.add("%s = %s", slotName(n), v.cast(typ).text)
+	case op == "pop":
+		if v := pop(1)[0]; v.impure {
+			f.temp(v, out)
+		}
+	case op == "dup" || op == "dup2":
+		n := 1
+		if op == "dup2" {
+			n = 2
+		}
+		for i := len(st) - n; i < len(st); i++ {
+			if st[i].prec != precAtom || st[i].impure {
+				st[i] = f.temp(st[i], out)
+			}
+		}
+		push(st[len(st)-n:]...)
+	case op == "swap":
+		st[len(st)-1], st[len(st)-2] = st[len(st)-2], st[len(st)-1]
+	case op == "dig":
+		n, ok := index(0)
+		if !ok || n >= len(st) {
+			return st, false
+		}
+		i := len(st) - 1 - n
+		if st[i].prec != precAtom || st[i].impure {
+			st[i] = f.temp(st[i], out)
+		}
+		push(st[i])
+	case op == "cover" || op == "uncover":
+		n, ok := index(0)
+		if !ok || n >= len(st) {
+			return st, false
+		}
+		i := len(st) - 1 - n
+		if op == "cover" {
+			top := st[len(st)-1]
+			copy(st[i+1:], st[i:len(st)-1])
+			st[i] = top
+		} else {
+			v := st[i]
+			copy(st[i:], st[i+1:])
+			st[len(st)-1] = v
+		}
+	case op == "select":
+		args := pop(3)
+		cond := args[2].cast(intType)
+		text := fmt.Sprintf("if %s { %s } else { %s }", cond.text, args[1].text, args[0].text)
+		push(derived(text, precIfExpr, args[1].typ, args...))
+	case op == "!" || op == "~":
+		push(unaryValue(op, pop(1)[0]))
+	case tealBinOps[op] > 0:
+		args := pop(2)
+		push(binaryValue(op, args[0], args[1]))
+	case tealFuncs[op] || tealRenamedFuncs[op] != "":
+		name := op
+		if renamed, ok := tealRenamedFuncs[op]; ok {
+			name = renamed
+		}
+		args := f.typedArgs(op, pop(len(langOps[op].Args)))
+		push(callValue(name, returnType(op, 0), args...))
+	case tealTupleFuncs[op]:
+		args := f.typedArgs(op, pop(len(langOps[op].Args)))
+		push(f.tuple(op, callValue(op, unknownType, args...).text, args, out)...)
+	case op == "substring" || op == "extract":
+		v := pop(1)[0].cast(bytesType)
+		push(derived(fmt.Sprintf("%s(%s, %s, %s)", op, v.text, arg(0), arg(1)), precAtom, bytesType, v))
+	case op == "extract_uint16" || op == "extract_uint32" || op == "extract_uint64":
+		args := f.typedArgs(op, pop(2))
+		text := fmt.Sprintf("extract(%s, %s, %s)", strings.ToUpper(strings.TrimPrefix(op, "extract_")), args[0].text, args[1].text)
+		push(derived(text, precAtom, intType, args...))
+	case op == "gaid":
+		push(atom(fmt.Sprintf("gaid(%s)", arg(0)), intType))
+	case op == "ecdsa_verify":
+		args := f.typedArgs(op, pop(5))
+		push(callValue(op, intType, append([]*dvalue{atom(arg(0), unknownType)}, args...)...))
+	case op == "ecdsa_pk_decompress" || op == "ecdsa_pk_recover":
+		args := f.typedArgs(op, pop(len(langOps[op].Args)))
+		text := callValue(op, unknownType, append([]*dvalue{atom(arg(0), unknownType)}, args...)...).text
+		push(f.tuple(op, text, args, out)...)
+	case op == "assert":
+		v := pop(1)[0].cast(intType)
+		f.flush(st, -1, out)
+		out.add("assert(%s)", v.text)
+	case op == "log":
+		v := pop(1)[0].cast(bytesType)
+		f.flush(st, -1, out)
+		out.add("log(%s)", v.text)
+	case op == "txn" || op == "global" || op == "itxn":
+		v := atom(fmt.Sprintf("%s.%s", op, arg(0)), fieldType(op, arg(0)))
+		v.impure = op == "itxn"
+		push(v)
+	case op == "txna" || op == "itxna":
+		v := atom(fmt.Sprintf("%s.%s[%s]", strings.TrimSuffix(op, "a"), arg(0), arg(1)), fieldType("txn", arg(0)))
+		v.impure = op == "itxna"
+		push(v)
+	case op == "txnas" || op == "itxnas":
+		i := pop(1)[0].cast(intType)
+		push(derived(fmt.Sprintf("%s.%s[%s]", strings.TrimSuffix(op, "as"), arg(0), i.text), precAtom, fieldType("txn", arg(0)), i))
+	case op == "gtxn":
+		push(atom(fmt.Sprintf("gtxn[%s].%s", arg(0), arg(1)), fieldType("txn", arg(1))))
+	case op == "gtxna":
+		push(atom(fmt.Sprintf("gtxn[%s].%s[%s]", arg(0), arg(1), arg(2)), fieldType("txn", arg(1))))
+	case op == "gtxns":
+		g := pop(1)[0].cast(intType)
+		push(derived(fmt.Sprintf("gtxn[%s].%s", g.text, arg(0)), precAtom, fieldType("txn", arg(0)), g))
+	case op == "gtxnsa":
+		g := pop(1)[0].cast(intType)
+		push(derived(fmt.Sprintf("gtxn[%s].%s[%s]", g.text, arg(0), arg(1)), precAtom, fieldType("txn", arg(0)), g))
+	case op == "gtxnas":
+		i := pop(1)[0].cast(intType)
+		push(derived(fmt.Sprintf("gtxn[%s].%s[%s]", arg(0), arg(1), i.text), precAtom, fieldType("txn", arg(1)), i))
+	case op == "gtxnsas":
+		args := f.typedArgs(op, pop(2))
+		push(derived(fmt.Sprintf("gtxn[%s].%s[%s]", args[0].text, arg(0), args[1].text), precAtom, fieldType("txn", arg(0)), args...))
+	case op == "itxn_begin":
+		f.flush(st, -1, out)
+		out.add("itxn.begin()")
+	case op == "itxn_submit":
+		f.flush(st, -1, out)
+		out.add("itxn.submit()")
+	case op == "itxn_field":
+		v := pop(1)[0].cast(fieldType("itxn_field", arg(0)))
+		f.flush(st, -1, out)
+		out.add("itxn.%s = %s", arg(0), v.text)
+	case op == "callsub":
+		callee := f.d.subroutine(ins)
+		if callee == nil || callee.broken {
+			return st, false
+		}
+		args := pop(callee.args)
+		if args == nil {
+			return st, false
+		}
+		call := callValue(callee.name, unknownType, args...)
+		call.impure = true
+		if callee.returns == 0 {
+			f.flush(st, -1, out)
+			out.add("assert(%s)", call.text)
+		} else {
+			push(call)
+		}
+	default:
+		return f.state(ins, st, out)
+	}
+	return st, true
+}
+
+// state applies accounts, apps and assets access instructions
+func (f *funcDecompiler) state(ins instruction, st []*dvalue, out *code) ([]*dvalue, bool) {
+	op := ins.op
+	spec, ok := langOps[op]
+	if !ok {
+		return st, false
+	}
+	n := len(spec.Args)
+	args := f.typedArgs(op, st[len(st)-n:])
+	st = st[:len(st)-n]
+	field := ""
+	if len(ins.args) > 0 {
+		field = ins.args[0]
+	}
+
+	value := func(text string) {
+		v := derived(text, precAtom, returnType(op, 0), args...)
+		v.impure = true
+		st = append(st, v)
+	}
+	statement := func(text string) {
+		f.flush(st, -1, out)
+		out.add("%s", text)
+	}
+
+	switch op {
+	case "balance":
+		value(fmt.Sprintf("accounts[%s].Balance", args[0].text))
+	case "min_balance":
+		value(fmt.Sprintf("accounts[%s].MinimumBalance", args[0].text))
+	case "app_opted_in":
+		value(fmt.Sprintf("accounts[%s].optedIn(%s)", args[0].text, args[1].text))
+	case "app_local_get":
+		value(fmt.Sprintf("accounts[%s].get(%s)", args[0].text, args[1].text))
+	case "app_global_get":
+		value(fmt.Sprintf("apps[0].get(%s)", args[0].text))
+	case "app_local_put":
+		statement(fmt.Sprintf("accounts[%s].put(%s, %s)", args[0].text, args[1].text, args[2].text))
+	case "app_global_put":
+		statement(fmt.Sprintf("apps[0].put(%s, %s)", args[0].text, args[1].text))
+	case "app_local_del":
+		statement(fmt.Sprintf("accounts[%s].del(%s)", args[0].text, args[1].text))
+	case "app_global_del":
+		statement(fmt.Sprintf("apps[0].del(%s)", args[0].text))
+	case "app_local_get_ex":
+		st = append(st, f.tuple(op, fmt.Sprintf("accounts[%s].getEx(%s, %s)", args[0].text, args[1].text, args[2].text), args, out)...)
+	case "app_global_get_ex":
+		st = append(st, f.tuple(op, fmt.Sprintf("apps[%s].getEx(%s)", args[0].text, args[1].text), args, out)...)
+	case "asset_holding_get":
+		method := map[string]string{"AssetBalance": "assetBalance", "AssetFrozen": "assetIsFrozen"}[field]
+		if len(method) == 0 {
+			return st, false
+		}
+		st = append(st, f.tuple(op, fmt.Sprintf("accounts[%s].%s(%s)", args[0].text, method, args[1].text), args, out)...)
+	case "asset_params_get":
+		st = append(st, f.tuple(op, fmt.Sprintf("assets[%s].%s", args[0].text, field), args, out)...)
+	case "app_params_get":
+		st = append(st, f.tuple(op, fmt.Sprintf("apps[%s].%s", args[0].text, field), args, out)...)
+	case "acct_params_get":
+		if len(field) == 0 {
+			return st, false
+		}
+		method := strings.ToLower(field[:1]) + field[1:]
+		st = append(st, f.tuple(op, fmt.Sprintf("accounts[%s].%s()", args[0].text, method), args, out)...)
+	default:
+		return st, false
+	}
+	return st, true
+}
+
+// typedArgs casts arguments of unknown type to the types the op expects
+func (f *funcDecompiler) typedArgs(op string, args []*dvalue) []*dvalue {
+	result := make([]*dvalue, len(args))
+	for i, arg := range args {
+		result[i] = arg.cast(argType(op, i))
+	}
+	return result
+}
+
+// tuple declares variables for values returned by the op and returns them
+func (f *funcDecompiler) tuple(op string, text string, args []*dvalue, out *code) []*dvalue {
+	f.flush(args, -1, out)
+	count := len(langOps[op].Returns)
+	names := make([]string, count)
+	values := make([]*dvalue, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("tmp%d", f.next)
+		f.next++
+		values[i] = atom(names[i], returnType(op, i))
+		values[i].scoped = true
+	}
+	out.add("let %s = %s", strings.Join(names, ", "), text)
+	return values
+}
@@ -0,0 +1,330 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/stretchr/testify/require"
+)
+
+// requireRoundTrip checks decompiled source compiles back to an assemblable program
+func requireRoundTrip(a *require.Assertions, source string) {
+	prog, parserErrors := Parse(source)
+	a.Empty(parserErrors, source)
+	a.NotNil(prog, source)
+	_, err := logic.AssembleString(Codegen(prog))
+	a.NoError(err, source)
+}
+
+func TestDecompileBranches(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+intcblock 0 1
+bytecblock 0x68656c6c6f "a\"b"
+txn Fee
+int 1000
+<=
+bz fail
+txn TypeEnum
+int pay
+==
+bnz pay
+int 1
+store 0
+b done
+pay:
+txn Amount
+store 0
+done:
+load 0
+int 10
+>
+return
+fail:
+err
+`
+	expected := `// decompiled from TEAL version 5
+let slot0 @ 0 = 0
+
+function logic() {
+    if txn.Fee > 1000 {
+        error
+    }
+    if txn.TypeEnum == 1 {
+        slot0 = txn.Amount
+    } else {
+        slot0 = 1
+    }
+    return slot0 > 10
+}
+`
+	actual, err := Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+}
+
+func TestDecompileLoopSubroutine(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+int 0
+store 1
+int 0
+store 2
+loop:
+load 1
+int 10
+<
+bz end
+load 2
+load 1
+callsub double
++
+store 2
+load 1
+int 1
++
+store 1
+b loop
+end:
+load 2
+int 90
+==
+return
+double:
+dup
++
+retsub
+`
+	expected := `// decompiled from TEAL version 5
+let slot1 @ 1 = 0
+let slot2 @ 2 = 0
+
+function sub_double(p0) {
+    return toint(p0) + toint(p0)
+}
+
+function logic() {
+    slot1 = 0
+    slot2 = 0
+    for slot1 < 10 {
+        slot2 = slot2 + toint(sub_double(slot1))
+        slot1 = slot1 + 1
+    }
+    return slot2 == 90
+}
+`
+	actual, err := Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+
+	teal = `#pragma version 5
+int 0
+store 0
+loop:
+load 0
+int 1
++
+store 0
+load 0
+int 5
+<
+bnz loop
+int 1
+return
+`
+	expected = `// decompiled from TEAL version 5
+let slot0 @ 0 = 0
+
+function logic() {
+    slot0 = 0
+    for 1 {
+        slot0 = slot0 + 1
+        if slot0 < 5 {
+            continue
+        }
+        break
+    }
+    return 1
+}
+`
+	actual, err = Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+}
+
+func TestDecompileBuiltins(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+byte "k"
+app_global_get
+int 1
++
+store 3
+byte "k"
+load 3
+app_global_put
+int 0
+byte "x"
+app_global_get_ex
+pop
+pop
+txn OnCompletion
+int NoOp
+==
+txn Sender
+global CreatorAddress
+==
+||
+assert
+itxn_begin
+int pay
+itxn_field TypeEnum
+txn Sender
+itxn_field Receiver
+itxn_submit
+txna ApplicationArgs 0
+btoi
+int 3
+txn NumAppArgs
+select
+int 1
+int 2
+txn NumAppArgs
+bnz x
+pop
+int 5
+x:
++
++
+`
+	expected := `// decompiled from TEAL version 5
+let slot3 @ 3 = 0
+
+function logic() {
+    slot3 = toint(apps[0].get("k")) + 1
+    apps[0].put("k", slot3)
+    let tmp0, tmp1 = apps[0].getEx("x")
+    assert(txn.OnCompletion == 0 || txn.Sender == global.CreatorAddress)
+    itxn.begin()
+    itxn.TypeEnum = 1
+    itxn.Receiver = txn.Sender
+    itxn.submit()
+    return (if txn.NumAppArgs { 3 } else { btoi(txn.ApplicationArgs[0]) }) + (1 + (if txn.NumAppArgs { 2 } else { 5 }))
+}
+`
+	actual, err := Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+}
+
+func TestDecompileFallback(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+int 1
+bnz skip
+int 2
+skip:
+return
+`
+	expected := `// decompiled from TEAL version 5
+
+function logic() {
+    // stack usage of this code can not be decompiled:
+    // int 1
+    // bnz skip
+    // int 2
+    // skip:
+    // return
+    error
+}
+`
+	actual, err := Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+
+	teal = `#pragma version 5
+int 1
+stores
+int 1
+`
+	actual, err = Decompile(teal)
+	a.NoError(err)
+	a.Contains(actual, "// stack usage of this code can not be decompiled:")
+	requireRoundTrip(a, actual)
+
+	_, err = Decompile("intcblock abc")
+	a.Error(err)
+}
+
+func TestDecompileBytecode(t *testing.T) {
+	a := require.New(t)
+
+	ops, err := logic.AssembleString(`#pragma version 5
+intcblock 0 1 1000
+bytecblock 0x68656c6c6f "abc"
+txn Fee
+intc_2
+<=
+bz fail
+byte "hello"
+bytec_1
+concat
+len
+pushint 8
+==
+txna Accounts 1
+global ZeroAddress
+==
+&&
+b end
+fail:
+err
+end:
+return
+`)
+	a.NoError(err)
+	teal, err := logic.Disassemble(ops.Program)
+	a.NoError(err)
+
+	expected := `// decompiled from TEAL version 5
+
+function logic() {
+    if txn.Fee > 1000 {
+        error
+    }
+    return len(concat("hello", "abc")) == 8 && txn.Accounts[1] == global.ZeroAddress
+}
+`
+	actual, err := Decompile(teal)
+	a.NoError(err)
+	a.Equal(expected, actual)
+	requireRoundTrip(a, actual)
+}
+
+func TestDecompileLiterals(t *testing.T) {
+	a := require.New(t)
+
+	a.Equal(`"a\x22b\x5c\x00"`, bytesLiteral([]byte("a\"b\\\x00")))
+
+	value, n, err := parseTEALBytes([]string{"base64", "aGk="})
+	a.NoError(err)
+	a.Equal(2, n)
+	a.Equal([]byte("hi"), value)
+	value, n, err = parseTEALBytes([]string{"b32(NBUQ)"})
+	a.NoError(err)
+	a.Equal(1, n)
+	a.Equal([]byte("hi"), value)
+
+	a.Equal([]string{"byte", `"a // b"`}, splitTEALLine(`byte "a // b" // comment`))
+	a.Equal(instruction{op: "txna", args: []string{"Accounts", "1"}}, normalizeInstruction(instruction{op: "txn", args: []string{"Accounts", "1"}}))
+	a.Equal(instruction{op: "intc", args: []string{"2"}}, normalizeInstruction(instruction{op: "intc_2"}))
+}
@@ -0,0 +1,273 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Diagnostic codes, stable across releases
+const (
+	CodeSyntax          = "TL1001"
+	CodeAmbiguity       = "TL1002"
+	CodeSemantic        = "TL2000"
+	CodeUndefined       = "TL2001"
+	CodeRedeclared      = "TL2002"
+	CodeType            = "TL2003"
+	CodeLiteral         = "TL2004"
+	CodeModule          = "TL2005"
+	CodeControlFlow     = "TL2006"
+	CodeScratch         = "TL2007"
+	CodeConstantFolding = "TL2008"
+
+	CodeUnusedVariable  = "TL3001"
+	CodeUnusedParameter = "TL3002"
+	CodeUnusedConst     = "TL3003"
+	CodeUnusedFunction  = "TL3004"
+	CodeUnusedImport    = "TL3005"
+	CodeShadow          = "TL3006"
+	CodeUnreachable     = "TL3007"
+
+	CodeLintRekeyTo          = "TL4001"
+	CodeLintCloseRemainderTo = "TL4002"
+	CodeLintAssetCloseTo     = "TL4003"
+	CodeLintFee              = "TL4004"
+	CodeLintOnCompletion     = "TL4005"
+	CodeLintGroupSize        = "TL4006"
+)
+
+// codeDescriptions are short descriptions of diagnostic codes
+var codeDescriptions = map[string]string{
+	CodeSyntax:          "Syntax error",
+	CodeAmbiguity:       "Ambiguous grammar construction",
+	CodeSemantic:        "Semantic error",
+	CodeUndefined:       "Undefined identifier or function",
+	CodeRedeclared:      "Identifier, function or scratch slot declared twice",
+	CodeType:            "Type mismatch",
+	CodeLiteral:         "Invalid string, address or number literal",
+	CodeModule:          "Module import failure",
+	CodeControlFlow:     "Invalid return, break or continue",
+	CodeScratch:         "Scratch space allocation failure",
+	CodeConstantFolding: "Integer overflow or division by zero in constant expression",
+
+	CodeUnusedVariable:  "Variable is never read",
+	CodeUnusedParameter: "Function parameter is never read",
+	CodeUnusedConst:     "Constant is never used",
+	CodeUnusedFunction:  "Function is never called",
+	CodeUnusedImport:    "Imported module is never used",
+	CodeShadow:          "Variable shadows a declaration of the enclosing scope",
+	CodeUnreachable:     "Statement after return or error is never executed",
+
+	CodeLintRekeyTo:          "Approval path does not check txn.RekeyTo",
+	CodeLintCloseRemainderTo: "Approval path does not check txn.CloseRemainderTo",
+	CodeLintAssetCloseTo:     "Approval path does not check txn.AssetCloseTo",
+	CodeLintFee:              "Approval path does not limit txn.Fee",
+	CodeLintOnCompletion:     "Approval path allows application update or deletion",
+	CodeLintGroupSize:        "Group transaction index is not validated against global.GroupSize",
+}
+
+func (t parserErrorType) String() string {
+	switch t {
+	case syntaxError:
+		return "syntax"
+	case ambiguityError:
+		return "ambiguity"
+	case semanticError:
+		return "semantic"
+	case warningError:
+		return "warning"
+	case lintError:
+		return "lint"
+	}
+	return "unknown"
+}
+
+// Kind returns error kind: syntax, ambiguity, semantic, warning or lint
+func (err *ParserError) Kind() string {
+	return err.errorType.String()
+}
+
+// Code returns stable code of the error category
+func (err *ParserError) Code() string {
+	switch err.errorType {
+	case syntaxError:
+		return CodeSyntax
+	case ambiguityError:
+		return CodeAmbiguity
+	}
+	if err.code == "" {
+		return CodeSemantic
+	}
+	return err.code
+}
+
+// Range returns start and end (inclusive) source offsets of the token the error is reported at
+func (err *ParserError) Range() (int, int) {
+	return err.start, err.end
+}
+
+// Excerpt returns the source line of the error and a line with the error position marker
+func (err *ParserError) Excerpt() []string {
+	return err.excerpt
+}
+
+// Diagnostic is JSON representation of ParserError
+type Diagnostic struct {
+	Code      string   `json:"code"`
+	Kind      string   `json:"kind"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndColumn int      `json:"end_column"`
+	Start     int      `json:"start"`
+	End       int      `json:"end"`
+	Message   string   `json:"message"`
+	Excerpt   []string `json:"excerpt,omitempty"`
+}
+
+// Diagnostic converts the error to a serializable form
+func (err *ParserError) Diagnostic() Diagnostic {
+	start, end := err.Range()
+	return Diagnostic{
+		Code:      err.Code(),
+		Kind:      err.Kind(),
+		File:      err.Filename(),
+		Line:      err.Line(),
+		Column:    err.Column(),
+		EndColumn: err.Column() + err.Length(),
+		Start:     start,
+		End:       end,
+		Message:   err.Message(),
+		Excerpt:   err.Excerpt(),
+	}
+}
+
+// DiagnosticFormats lists formats supported by WriteDiagnostics
+var DiagnosticFormats = []string{"text", "json", "sarif"}
+
+// WriteDiagnostics prints errors as text, JSON array of Diagnostic or SARIF 2.1.0 log
+func WriteDiagnostics(w io.Writer, errors []ParserError, format string) error {
+	switch format {
+	case "text":
+		for _, e := range errors {
+			if _, err := fmt.Fprintf(w, "%s\n", e.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		diagnostics := make([]Diagnostic, 0, len(errors))
+		for _, e := range errors {
+			diagnostics = append(diagnostics, e.Diagnostic())
+		}
+		return writeJSON(w, diagnostics)
+	case "sarif":
+		return writeJSON(w, newSarifLog(errors))
+	}
+	return fmt.Errorf("unknown diagnostics format %s", format)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// minimal subset of SARIF 2.1.0 schema
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion has 1-based lines and columns
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func newSarifLog(errors []ParserError) sarifLog {
+	codes := make(map[string]bool)
+	results := make([]sarifResult, 0, len(errors))
+	for _, e := range errors {
+		d := e.Diagnostic()
+		codes[d.Code] = true
+		level := "error"
+		if e.errorType == warningError || e.errorType == lintError {
+			level = "warning"
+		}
+		result := sarifResult{RuleID: d.Code, Level: level, Message: sarifMessage{d.Message}}
+		if len(d.File) > 0 && d.Line > 0 {
+			result.Locations = []sarifLocation{{sarifPhysicalLocation{
+				sarifArtifactLocation{d.File},
+				sarifRegion{d.Line, d.Column + 1, d.EndColumn + 1},
+			}}}
+		}
+		results = append(results, result)
+	}
+
+	rules := make([]sarifRule, 0, len(codes))
+	for code := range codes {
+		rules = append(rules, sarifRule{code, sarifMessage{codeDescriptions[code]}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "tealang",
+				InformationURI: "https://github.com/pzbitskiy/tealang",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
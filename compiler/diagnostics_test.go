@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticCodes(t *testing.T) {
+	a := require.New(t)
+
+	// the code is set where the error is reported and does not depend on the message
+	err := ParserError{errorType: semanticError, msg: "return values number mismatch: 1 vs 2", code: CodeControlFlow}
+	a.Equal(CodeControlFlow, err.Code())
+	err = ParserError{errorType: semanticError, msg: "type %s is not a struct", code: CodeType}
+	a.Equal(CodeType, err.Code())
+	err = ParserError{errorType: semanticError, msg: "unexpected token"}
+	a.Equal(CodeSemantic, err.Code())
+
+	err = ParserError{errorType: syntaxError, msg: "extraneous input"}
+	a.Equal(CodeSyntax, err.Code())
+	a.Equal("syntax", err.Kind())
+
+	a.Equal(CodeUndefined, errorCode(errorf(CodeUndefined, "ident '%s' not defined", "x")))
+	a.Equal("ident 'x' not defined", errorf(CodeUndefined, "ident '%s' not defined", "x").Error())
+	a.Equal(CodeSemantic, errorCode(fmt.Errorf("module lib not found")))
+
+	err = newNodeError(CodeScratch, sourcePos{}, "too many live variables")
+	a.Equal(CodeScratch, err.Code())
+	a.Equal("semantic", err.Kind())
+
+	wc := newWarningCollector()
+	wc.warn(warnUnusedVariable, sourcePos{line: 1}, "variable x is never read")
+	wc.report(lintError, lintRekeyTo, sourcePos{line: 2}, "txn.RekeyTo is not checked")
+	a.Equal(CodeUnusedVariable, wc.warnings[0].Code())
+	a.Equal(CodeLintRekeyTo, wc.warnings[1].Code())
+
+	for _, code := range []string{
+		CodeSyntax, CodeAmbiguity, CodeSemantic, CodeUndefined, CodeRedeclared, CodeType,
+		CodeLiteral, CodeModule, CodeControlFlow, CodeScratch, CodeConstantFolding,
+	} {
+		a.Contains(codeDescriptions, code)
+	}
+}
+
+func TestParserErrorCodes(t *testing.T) {
+	a := require.New(t)
+
+	tests := []struct {
+		source string
+		code   string
+	}{
+		{"function logic() { return x }", CodeUndefined},
+		{"function logic() { let x = 1; let x = 2; return x }", CodeRedeclared},
+		{"function logic() { let x = 1; x = \"a\"; return x }", CodeType},
+		{"function logic() { break; return 1 }", CodeControlFlow},
+		{"function logic() { return \"\\q\" == \"a\" }", CodeLiteral},
+		{"import lib.missing\nfunction logic() { return 1 }", CodeModule},
+	}
+	for _, test := range tests {
+		_, parserErrors := Parse(test.source)
+		a.NotEmpty(parserErrors, test.source)
+		a.Equal(test.code, parserErrors[0].Code(), test.source)
+	}
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	a := require.New(t)
+
+	errors := []ParserError{{semanticError, 26, 26, 2, 8, "ident not found", "y", "test.tl", []string{"return y", "-----^-----"}, "", CodeUndefined}}
+
+	var buf bytes.Buffer
+	a.NoError(WriteDiagnostics(&buf, errors, "text"))
+	a.Equal("error at test.tl line 2, col 8 near token 'y'\nreturn y\n-----^-----\nident not found\n", buf.String())
+
+	buf.Reset()
+	a.NoError(WriteDiagnostics(&buf, errors, "json"))
+	var diagnostics []Diagnostic
+	a.NoError(json.Unmarshal(buf.Bytes(), &diagnostics))
+	a.Equal([]Diagnostic{{
+		Code:      CodeUndefined,
+		Kind:      "semantic",
+		File:      "test.tl",
+		Line:      2,
+		Column:    8,
+		EndColumn: 9,
+		Start:     26,
+		End:       26,
+		Message:   "ident not found",
+		Excerpt:   []string{"return y", "-----^-----"},
+	}}, diagnostics)
+
+	buf.Reset()
+	a.NoError(WriteDiagnostics(&buf, errors, "sarif"))
+	var log sarifLog
+	a.NoError(json.Unmarshal(buf.Bytes(), &log))
+	a.Equal("2.1.0", log.Version)
+	a.Equal(1, len(log.Runs))
+	a.Equal([]sarifRule{{CodeUndefined, sarifMessage{"Undefined identifier or function"}}}, log.Runs[0].Tool.Driver.Rules)
+	a.Equal([]sarifResult{{
+		RuleID:  CodeUndefined,
+		Level:   "error",
+		Message: sarifMessage{"ident not found"},
+		Locations: []sarifLocation{{sarifPhysicalLocation{
+			sarifArtifactLocation{"test.tl"},
+			sarifRegion{2, 9, 10},
+		}}},
+	}}, log.Runs[0].Results)
+
+	a.Error(WriteDiagnostics(&buf, errors, "xml"))
+}
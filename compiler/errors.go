@@ -13,6 +13,8 @@ const (
 	syntaxError    parserErrorType = 1
 	ambiguityError parserErrorType = 2
 	semanticError  parserErrorType = 3
+	warningError   parserErrorType = 4
+	lintError      parserErrorType = 5
 )
 
 // ParserError provides generic info about the error
@@ -26,6 +28,8 @@ type ParserError struct {
 	token     string
 	filename  string
 	excerpt   []string
+	warning   string
+	code      string
 }
 
 type errorCollector struct {
@@ -36,6 +40,7 @@ type errorCollector struct {
 
 type tealangBaseRecognitionException struct {
 	message        string
+	code           string
 	recognizer     antlr.Recognizer
 	offendingToken antlr.Token
 	offendingState int
@@ -44,10 +49,11 @@ type tealangBaseRecognitionException struct {
 }
 
 // copy of Antlr's NewBaseRecognitionException
-func newTealangBaseRecognitionException(message string, parser antlr.Parser, token antlr.Token, rule antlr.RuleContext) *tealangBaseRecognitionException {
+func newTealangBaseRecognitionException(code string, message string, parser antlr.Parser, token antlr.Token, rule antlr.RuleContext) *tealangBaseRecognitionException {
 	t := new(tealangBaseRecognitionException)
 
 	t.message = message
+	t.code = code
 	t.recognizer = parser
 	t.input = parser.GetInputStream()
 	t.ctx = rule
@@ -62,6 +68,7 @@ func newTealangParserErrorException(err ParserError, parser antlr.Parser, token
 	t := new(tealangBaseRecognitionException)
 
 	t.message = err.String()
+	t.code = err.Code()
 	t.recognizer = parser
 	t.input = parser.GetInputStream()
 	t.ctx = rule
@@ -91,6 +98,92 @@ func newErrorCollector(source string, filename string) (er *errorCollector) {
 	return
 }
 
+// newNodeError creates a semantic error for AST node when there is no parser to report to
+func newNodeError(code string, pos sourcePos, msg string) ParserError {
+	filename := ""
+	var excerpt []string
+	if pos.file != nil {
+		filename = pos.file.name
+		excerpt = newErrorCollector(pos.file.text, pos.file.name).formatExcerpt(pos.start, pos.end)
+	}
+	return ParserError{
+		semanticError,
+		pos.start,
+		pos.end,
+		pos.line,
+		pos.column,
+		msg,
+		pos.token,
+		filename,
+		excerpt,
+		"",
+		code,
+	}
+}
+
+// codedError is an error carrying a diagnostic code to the reporting site
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (e codedError) Error() string {
+	return e.msg
+}
+
+func errorf(code string, format string, args ...interface{}) error {
+	return codedError{code, fmt.Sprintf(format, args...)}
+}
+
+// errorCode returns the diagnostic code of err or CodeSemantic if there is none
+func errorCode(err error) string {
+	if e, ok := err.(codedError); ok {
+		return e.code
+	}
+	return CodeSemantic
+}
+
+// warningCollector accumulates non-fatal diagnostics, nil collector ignores warnings
+type warningCollector struct {
+	warnings []ParserError
+	reported map[warningKey]bool
+}
+
+type warningKey struct {
+	name string
+	pos  sourcePos
+}
+
+func newWarningCollector() *warningCollector {
+	return &warningCollector{reported: make(map[warningKey]bool)}
+}
+
+// warn records a warning of the check name at pos
+func (wc *warningCollector) warn(name string, pos sourcePos, msg string) {
+	wc.report(warningError, name, pos, msg)
+}
+
+// report records a warning or a lint finding of the check name at pos
+func (wc *warningCollector) report(errorType parserErrorType, name string, pos sourcePos, msg string) {
+	if wc == nil {
+		return
+	}
+	// inline functions are parsed for every call so the same warning might appear several times
+	key := warningKey{name, pos}
+	if wc.reported[key] {
+		return
+	}
+	wc.reported[key] = true
+	code := warningCodes[name]
+	if errorType == lintError {
+		code = lintCodes[name]
+	}
+	err := newNodeError(code, pos, msg)
+	err.errorType = errorType
+	err.warning = name
+	wc.warnings = append(wc.warnings, err)
+}
+
 func (er *errorCollector) copyErrors(other *errorCollector) {
 	er.errors = append(er.errors, other.errors...)
 }
@@ -176,6 +269,7 @@ func (er *errorCollector) SyntaxError(recognizer antlr.Recognizer, offendingSymb
 	var token string
 
 	errorType := syntaxError
+	code := CodeSyntax
 	cast := false
 	if offendingSymbol != nil {
 		if symbol, ok := offendingSymbol.(*antlr.CommonToken); ok {
@@ -193,6 +287,10 @@ func (er *errorCollector) SyntaxError(recognizer antlr.Recognizer, offendingSymb
 		}
 		if e.GetMessage() != "" {
 			errorType = semanticError
+			code = CodeSemantic
+			if te, ok := e.(*tealangBaseRecognitionException); ok && te.code != "" {
+				code = te.code
+			}
 		}
 	}
 
@@ -206,6 +304,8 @@ func (er *errorCollector) SyntaxError(recognizer antlr.Recognizer, offendingSymb
 		token,
 		er.filename,
 		er.formatExcerpt(start, end),
+		"",
+		code,
 	}
 	er.errors = append(er.errors, info)
 }
@@ -221,6 +321,8 @@ func (er *errorCollector) ReportAmbiguity(recognizer antlr.Parser, dfa *antlr.DF
 		"",
 		er.filename,
 		er.formatExcerpt(startIndex, stopIndex),
+		"",
+		CodeAmbiguity,
 	}
 	er.errors = append(er.errors, info)
 }
@@ -237,6 +339,8 @@ func (er *errorCollector) ReportAttemptingFullContext(recognizer antlr.Parser, d
 		"",
 		er.filename,
 		er.formatExcerpt(startIndex, stopIndex),
+		"",
+		CodeAmbiguity,
 	}
 	er.errors = append(er.errors, info)
 }
@@ -252,6 +356,8 @@ func (er *errorCollector) ReportContextSensitivity(recognizer antlr.Parser, dfa
 		"",
 		er.filename,
 		er.formatExcerpt(startIndex, stopIndex),
+		"",
+		CodeAmbiguity,
 	}
 	er.errors = append(er.errors, info)
 }
@@ -267,6 +373,16 @@ func (err *ParserError) String() (msg string) {
 		lines := append([]string{msg}, err.excerpt...)
 		lines = append(lines, err.msg)
 		msg = strings.Join(lines, "\n")
+	case warningError:
+		msg = fmt.Sprintf("warning at %sline %d, col %d near token '%s'", filename, err.line, err.column, err.token)
+		lines := append([]string{msg}, err.excerpt...)
+		lines = append(lines, fmt.Sprintf("%s [-W%s]", err.msg, err.warning))
+		msg = strings.Join(lines, "\n")
+	case lintError:
+		msg = fmt.Sprintf("lint at %sline %d, col %d near token '%s'", filename, err.line, err.column, err.token)
+		lines := append([]string{msg}, err.excerpt...)
+		lines = append(lines, fmt.Sprintf("%s [%s]", err.msg, err.warning))
+		msg = strings.Join(lines, "\n")
 	case syntaxError:
 		msg = fmt.Sprintf("syntax error at %sline %d, col %d near token '%s'", filename, err.line, err.column, err.token)
 		lines := append([]string{msg}, err.excerpt...)
@@ -282,3 +398,36 @@ func (err *ParserError) String() (msg string) {
 	}
 	return msg
 }
+
+// Line returns 1-based source line of the error
+func (err *ParserError) Line() int {
+	return err.line
+}
+
+// Column returns 0-based source column of the error
+func (err *ParserError) Column() int {
+	return err.column
+}
+
+// Length returns length of the token the error is reported at
+func (err *ParserError) Length() int {
+	return len(err.token)
+}
+
+// Filename returns name of the source file the error is in
+func (err *ParserError) Filename() string {
+	return err.filename
+}
+
+// Warning returns name of the warning check or lint rule, empty string for errors
+func (err *ParserError) Warning() string {
+	return err.warning
+}
+
+// Message returns error description without location and excerpt
+func (err *ParserError) Message() string {
+	if len(err.msg) == 0 {
+		return fmt.Sprintf("syntax error near token '%s'", err.token)
+	}
+	return err.msg
+}
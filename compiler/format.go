@@ -0,0 +1,263 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+
+	gen "github.com/pzbitskiy/tealang/gen/go"
+)
+
+const formatIndent = "    "
+
+// keywords followed by a space even if the next token is a bracket
+var spacedKeywords = map[int]bool{
+	gen.TealangLexerIF:      true,
+	gen.TealangLexerELSE:    true,
+	gen.TealangLexerFOR:     true,
+	gen.TealangLexerRET:     true,
+	gen.TealangLexerLET:     true,
+	gen.TealangLexerCONST:   true,
+	gen.TealangLexerIMPORT:  true,
+	gen.TealangLexerRETURNS: true,
+}
+
+// layoutListener collects tokens those position depends on the parse tree:
+// statement, struct field, switch case and contract member starts, block, struct, switch and contract braces and semicolons of for loop header
+type layoutListener struct {
+	*gen.BaseTealangParserListener
+	lineStarts    map[int]bool
+	blockBraces   map[int]bool
+	forSemicolons map[int]bool
+}
+
+func newLayoutListener() *layoutListener {
+	return &layoutListener{
+		lineStarts:    make(map[int]bool),
+		blockBraces:   make(map[int]bool),
+		forSemicolons: make(map[int]bool),
+	}
+}
+
+func (l *layoutListener) EnterEveryRule(ctx antlr.ParserRuleContext) {
+	switch ctx := ctx.(type) {
+	case *gen.StatementContext, *gen.DeclarationContext, *gen.MainContext, *gen.StructFieldContext:
+		l.lineStarts[ctx.GetStart().GetTokenIndex()] = true
+	case *gen.BlockContext:
+		l.blockBraces[ctx.LEFTFIGURE().GetSymbol().GetTokenIndex()] = true
+		l.blockBraces[ctx.RIGHTFIGURE().GetSymbol().GetTokenIndex()] = true
+	case *gen.AbiMethodContext, *gen.BareCallContext:
+		l.lineStarts[ctx.GetStart().GetTokenIndex()] = true
+	case *gen.ContractContext:
+		l.blockBraces[ctx.LEFTFIGURE().GetSymbol().GetTokenIndex()] = true
+		l.blockBraces[ctx.RIGHTFIGURE().GetSymbol().GetTokenIndex()] = true
+	case *gen.StructDefContext:
+		l.blockBraces[ctx.LEFTFIGURE().GetSymbol().GetTokenIndex()] = true
+		l.blockBraces[ctx.RIGHTFIGURE().GetSymbol().GetTokenIndex()] = true
+	case *gen.SwitchCaseContext, *gen.SwitchExprCaseContext:
+		l.lineStarts[ctx.GetStart().GetTokenIndex()] = true
+	case *gen.SwitchStatementContext:
+		l.blockBraces[ctx.LEFTFIGURE().GetSymbol().GetTokenIndex()] = true
+		l.blockBraces[ctx.RIGHTFIGURE().GetSymbol().GetTokenIndex()] = true
+		if ctx.DEFAULT() != nil {
+			l.lineStarts[ctx.DEFAULT().GetSymbol().GetTokenIndex()] = true
+		}
+	case *gen.SwitchCondExprContext:
+		// the first and the last braces enclose cases, the rest wrap branch values
+		braces := ctx.AllRIGHTFIGURE()
+		l.blockBraces[ctx.LEFTFIGURE(0).GetSymbol().GetTokenIndex()] = true
+		l.blockBraces[braces[len(braces)-1].GetSymbol().GetTokenIndex()] = true
+		l.lineStarts[ctx.DEFAULT().GetSymbol().GetTokenIndex()] = true
+	case *gen.ForStatementContext:
+		for _, node := range ctx.AllSEMICOLON() {
+			l.forSemicolons[node.GetSymbol().GetTokenIndex()] = true
+		}
+	}
+}
+
+// formatter prints tokens stream using layout info
+type formatter struct {
+	layout *layoutListener
+	out    strings.Builder
+
+	indent    int
+	newlines  int // line breaks in the source before the next token
+	required  int // minimal line breaks before the next token
+	lineStart bool
+	comment   bool        // the last printed token is a comment
+	prev      antlr.Token // the last printed token except comments
+	prevBlock bool        // prev is a block brace
+}
+
+func (f *formatter) token(token antlr.Token) {
+	index := token.GetTokenIndex()
+	switch token.GetTokenType() {
+	case antlr.TokenEOF, gen.TealangLexerWHITESPACE:
+		return
+	case gen.TealangLexerNEWLINE, gen.TealangLexerMODULENAMEEND:
+		text := token.GetText()
+		if n := strings.Count(text, "\n"); n > 0 {
+			f.newlines += n
+		} else {
+			f.newlines += len(text)
+		}
+		return
+	case gen.TealangLexerCOMMENT:
+		text := strings.TrimRight(token.GetText(), " \t")
+		if f.newlines == 0 && !f.lineStart && f.out.Len() > 0 {
+			// trailing comment stays on the line
+			f.out.WriteString(" " + text)
+		} else {
+			f.flush()
+			f.out.WriteString(text)
+		}
+		f.lineStart = false
+		f.comment = true
+		f.require(1)
+		return
+	case gen.TealangLexerSEMICOLON:
+		if !f.layout.forSemicolons[index] {
+			// statement terminator
+			f.require(1)
+			return
+		}
+	case gen.TealangLexerELSE:
+		if f.prevBlock && !f.comment {
+			// } else {
+			f.newlines = 0
+			f.required = 0
+		}
+	case gen.TealangLexerRIGHTFIGURE:
+		if f.layout.blockBraces[index] {
+			f.indent--
+			f.require(1)
+			if f.newlines > 1 {
+				f.newlines = 1
+			}
+		}
+	}
+
+	if f.layout.lineStarts[index] {
+		f.require(1)
+	}
+	f.flush()
+	if !f.lineStart && f.needSpace(token) {
+		f.out.WriteString(" ")
+	}
+	f.out.WriteString(token.GetText())
+	f.lineStart = false
+	f.comment = false
+	f.prev = token
+	f.prevBlock = f.layout.blockBraces[index]
+
+	if f.prevBlock && token.GetTokenType() == gen.TealangLexerLEFTFIGURE {
+		f.indent++
+		f.require(1)
+	}
+}
+
+// require requests at least n line breaks before the next token
+func (f *formatter) require(n int) {
+	if f.required < n {
+		f.required = n
+	}
+}
+
+// flush writes requested line breaks: at most one blank line
+// and none at the beginning of the file and after opening brace
+func (f *formatter) flush() {
+	n := f.newlines
+	if n < f.required {
+		n = f.required
+	}
+	f.newlines, f.required = 0, 0
+	if f.out.Len() == 0 {
+		n = 0
+	}
+	if f.prevBlock && f.prev.GetTokenType() == gen.TealangLexerLEFTFIGURE && n > 1 {
+		n = 1
+	}
+	if n > 2 {
+		n = 2
+	}
+	if n > 0 {
+		f.out.WriteString(strings.Repeat("\n", n))
+		f.lineStart = true
+	}
+	if f.lineStart {
+		f.out.WriteString(strings.Repeat(formatIndent, f.indent))
+	}
+}
+
+func isWord(token antlr.Token) bool {
+	text := token.GetText()
+	if token.GetTokenType() == gen.TealangLexerSTRING || len(text) == 0 {
+		return false
+	}
+	c := text[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (f *formatter) needSpace(token antlr.Token) bool {
+	if f.prev == nil {
+		return false
+	}
+	switch f.prev.GetTokenType() {
+	case gen.TealangLexerLEFTPARA, gen.TealangLexerLEFTSQUARE, gen.TealangLexerDOT,
+		gen.TealangLexerLNOT, gen.TealangLexerBNOT:
+		return false
+	}
+	switch token.GetTokenType() {
+	case gen.TealangLexerRIGHTPARA, gen.TealangLexerRIGHTSQUARE, gen.TealangLexerDOT,
+		gen.TealangLexerCOMMA, gen.TealangLexerSEMICOLON, gen.TealangLexerCOLON:
+		return false
+	case gen.TealangLexerLEFTPARA, gen.TealangLexerLEFTSQUARE:
+		// function calls and indexing
+		return !isWord(f.prev) || spacedKeywords[f.prev.GetTokenType()]
+	}
+	return true
+}
+
+func (f *formatter) String() string {
+	return strings.TrimRight(f.out.String(), "\n") + "\n"
+}
+
+// Format parses the source and prints it back in canonical layout:
+// 4 spaces indentation, single spaces between operands and operators,
+// one statement per line, at most one blank line in a row.
+// Comments are preserved. Programs and modules are accepted.
+func Format(source string, filename string) (string, []ParserError) {
+	collector := newErrorCollector(source, filename)
+	parser := newParser(source, collector)
+	stream := parser.GetTokenStream().(*antlr.CommonTokenStream)
+	stream.Fill()
+
+	module := true
+	for _, token := range stream.GetAllTokens() {
+		if token.GetTokenType() == gen.TealangLexerMAINFUNC || token.GetTokenType() == gen.TealangLexerCONTRACT {
+			module = false
+			break
+		}
+	}
+
+	var tree antlr.ParserRuleContext
+	if module {
+		tree = parser.Module()
+	} else {
+		tree = parser.Program()
+	}
+
+	collector.filterAmbiguity()
+	if len(collector.errors) > 0 {
+		return "", collector.errors
+	}
+
+	l := newLayoutListener()
+	antlr.ParseTreeWalkerDefault.Walk(l, tree)
+
+	f := formatter{layout: l, lineStart: true}
+	for _, token := range stream.GetAllTokens() {
+		f.token(token)
+	}
+	return f.String(), nil
+}
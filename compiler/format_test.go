@@ -0,0 +1,92 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	a := require.New(t)
+
+	source := `// header comment
+import stdlib.const
+
+
+const fee=1000   // min fee
+function check(a){
+return a>fee&&!(a==0)
+}
+function logic() {
+
+
+    let x=txn.Fee;let y = if x==1 {x+1} else {x}
+	for let i=0;i<10;i=i+1 {
+		if i==2 { continue; }
+	}
+    if x>fee {
+        // too high
+        return 0
+    }
+    else {
+        return check(gtxn[0].Fee)
+    }
+}
+
+
+`
+	expected := `// header comment
+import stdlib.const
+
+const fee = 1000 // min fee
+function check(a) {
+    return a > fee && !(a == 0)
+}
+function logic() {
+    let x = txn.Fee
+    let y = if x == 1 { x + 1 } else { x }
+    for let i = 0; i < 10; i = i + 1 {
+        if i == 2 {
+            continue
+        }
+    }
+    if x > fee {
+        // too high
+        return 0
+    } else {
+        return check(gtxn[0].Fee)
+    }
+}
+`
+	formatted, errors := Format(source, "test.tl")
+	a.Empty(errors)
+	a.Equal(expected, formatted)
+
+	formatted, errors = Format(expected, "test.tl")
+	a.Empty(errors)
+	a.Equal(expected, formatted)
+
+	// modules without main function
+	formatted, errors = Format("function sum(a,b) {\n\treturn a+b\n}\n", "lib.tl")
+	a.Empty(errors)
+	a.Equal("function sum(a, b) {\n    return a + b\n}\n", formatted)
+
+	formatted, errors = Format("struct Point {x uint64;y byte[8]}\nfunction logic() {\n\tlet p=Point(1,\"abcdefgh\");p.x=2\n\treturn p.x\n}\n", "test.tl")
+	a.Empty(errors)
+	a.Equal("struct Point {\n    x uint64\n    y byte[8]\n}\nfunction logic() {\n    let p = Point(1, \"abcdefgh\")\n    p.x = 2\n    return p.x\n}\n", formatted)
+
+	formatted, errors = Format("function get(key:bytes):uint64 {\n\treturn apps[0].get(key)\n}\nfunction logic() {\n\tlet s:byte[]=\"a\"\n\treturn get(s)\n}\n", "test.tl")
+	a.Empty(errors)
+	a.Equal("function get(key: bytes): uint64 {\n    return apps[0].get(key)\n}\nfunction logic() {\n    let s: byte[] = \"a\"\n    return get(s)\n}\n", formatted)
+
+	formatted, errors = Format("function logic() {\n\tlet x=1\n\tswitch x {case 1,2:{x=2} default:{x=3}}\n\treturn x\n}\n", "test.tl")
+	a.Empty(errors)
+	a.Equal("function logic() {\n    let x = 1\n    switch x {\n        case 1, 2: {\n            x = 2\n        }\n        default: {\n            x = 3\n        }\n    }\n    return x\n}\n", formatted)
+
+	formatted, errors = Format("contract Calc {\nabi method add(a:uint64,b:byte[8])returns(uint64){return a}\nbare create,optin{return 1}\n}\n", "test.tl")
+	a.Empty(errors)
+	a.Equal("contract Calc {\n    abi method add(a: uint64, b: byte[8]) returns (uint64) {\n        return a\n    }\n    bare create, optin {\n        return 1\n    }\n}\n", formatted)
+
+	_, errors = Format("function logic() {\n\tlet\n}\n", "test.tl")
+	a.NotEmpty(errors)
+}
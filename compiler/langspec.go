@@ -1,7 +1,5 @@
 package compiler
 
-import "fmt"
-
 func opTypeFromSpec(name string, ret int) (exprType, error) {
 	if op, ok := langOps[name]; ok && len(op.Returns) != 0 {
 		switch op.Returns[ret] {
@@ -13,7 +11,7 @@ func opTypeFromSpec(name string, ret int) (exprType, error) {
 			return unknownType, nil
 		}
 	}
-	return invalidType, fmt.Errorf("can't get type for %s ret #%d", name, ret+1)
+	return invalidType, errorf(CodeType, "can't get type for %s ret #%d", name, ret+1)
 }
 
 func argOpTypeFromSpec(name string, arg int) (exprType, error) {
@@ -27,7 +25,7 @@ func argOpTypeFromSpec(name string, arg int) (exprType, error) {
 			return unknownType, nil
 		}
 	}
-	return invalidType, fmt.Errorf("can't get type for %s arg #%d", name, arg+1)
+	return invalidType, errorf(CodeType, "can't get type for %s arg #%d", name, arg+1)
 }
 
 func runtimeFieldTypeFromSpec(name string, field string) (exprType, error) {
@@ -48,7 +46,7 @@ func runtimeFieldTypeFromSpec(name string, field string) (exprType, error) {
 		// fallback
 		return opTypeFromSpec(name, 0)
 	}
-	return invalidType, fmt.Errorf("can't get type for %s.%s", name, field)
+	return invalidType, errorf(CodeType, "can't get type for %s.%s", name, field)
 }
 
 func tealVersion() int {
@@ -0,0 +1,660 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Security linter: path-sensitive checks of approval paths for common smart contract pitfalls
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lint rules names
+const (
+	lintRekeyTo          = "rekey-to"
+	lintCloseRemainderTo = "close-remainder-to"
+	lintAssetCloseTo     = "asset-close-to"
+	lintFee              = "fee"
+	lintOnCompletion     = "on-completion"
+	lintGroupSize        = "group-size"
+)
+
+// LintRules lists names of all lint rules
+var LintRules = []string{
+	lintRekeyTo,
+	lintCloseRemainderTo,
+	lintAssetCloseTo,
+	lintFee,
+	lintOnCompletion,
+	lintGroupSize,
+}
+
+var lintCodes = map[string]string{
+	lintRekeyTo:          CodeLintRekeyTo,
+	lintCloseRemainderTo: CodeLintCloseRemainderTo,
+	lintAssetCloseTo:     CodeLintAssetCloseTo,
+	lintFee:              CodeLintFee,
+	lintOnCompletion:     CodeLintOnCompletion,
+	lintGroupSize:        CodeLintGroupSize,
+}
+
+// program modes the rules apply to
+const (
+	// LintModeLogicSig selects rules for stateless programs
+	LintModeLogicSig = "logicsig"
+	// LintModeApp selects rules for application programs
+	LintModeApp = "app"
+)
+
+var lintModes = map[string][]string{
+	LintModeLogicSig: {lintRekeyTo, lintCloseRemainderTo, lintAssetCloseTo, lintFee, lintGroupSize},
+	LintModeApp:      {lintOnCompletion, lintGroupSize},
+}
+
+// LintConfig selects lint rules to run
+type LintConfig struct {
+	// Mode is LintModeLogicSig, LintModeApp or empty to derive it from the main function
+	Mode string
+	// Disabled is a set of rules names not to run
+	Disabled map[string]bool
+}
+
+// transaction fields with enumerated values tracked as a set of possible values
+const (
+	typeEnumField     = "txn.TypeEnum"
+	onCompletionField = "txn.OnCompletion"
+	groupSizeField    = "global.GroupSize"
+)
+
+// TypeEnum and OnCompletion values excluded from the set make some checks unnecessary
+const (
+	typeEnumPay          = 1
+	typeEnumAxfer        = 4
+	onCompletionUpdate   = 4
+	onCompletionDelete   = 5
+	allValues            = valueSet(0xff)
+	updateOrDeleteValues = valueSet(1<<onCompletionUpdate | 1<<onCompletionDelete)
+)
+
+// valueSet is a bit set of small enumerated values, bits above 7 are not tracked
+type valueSet uint8
+
+func valuesBelow(k uint64) valueSet {
+	if k >= 8 {
+		return allValues
+	}
+	return valueSet(1)<<k - 1
+}
+
+func singleValue(k uint64) valueSet {
+	if k >= 8 {
+		return 0
+	}
+	return valueSet(1) << k
+}
+
+// groupAccess is gtxn field access with a constant group index
+type groupAccess struct {
+	index uint64
+	pos   sourcePos
+}
+
+// lintState is a set of facts established on a code path
+type lintState struct {
+	// txn fields compared for equality, and txn.Fee bounded from above
+	checked map[string]bool
+	// possible values of txn.TypeEnum and txn.OnCompletion
+	values map[string]valueSet
+	// upper bound of global.GroupSize, 0 if unchecked
+	groupSize uint64
+	// gtxn accesses made on the path
+	accesses []groupAccess
+}
+
+func newLintState() *lintState {
+	return &lintState{
+		checked: make(map[string]bool),
+		values:  map[string]valueSet{typeEnumField: allValues, onCompletionField: allValues},
+	}
+}
+
+func (s *lintState) copy() *lintState {
+	result := newLintState()
+	for field := range s.checked {
+		result.checked[field] = true
+	}
+	for field, values := range s.values {
+		result.values[field] = values
+	}
+	result.groupSize = s.groupSize
+	result.accesses = append(result.accesses, s.accesses...)
+	return result
+}
+
+func (s *lintState) access(index uint64, pos sourcePos) {
+	for _, acc := range s.accesses {
+		if acc.pos == pos {
+			return
+		}
+	}
+	s.accesses = append(s.accesses, groupAccess{index, pos})
+}
+
+func (s *lintState) boundGroupSize(k uint64) {
+	if s.groupSize == 0 || k < s.groupSize {
+		s.groupSize = k
+	}
+}
+
+// restrict returns the state with possible values of the field limited to the set, nil if none is left
+func (s *lintState) restrict(field string, values valueSet) *lintState {
+	result := s.copy()
+	result.values[field] &= values
+	if result.values[field] == 0 {
+		return nil
+	}
+	return result
+}
+
+// join merges states of two paths, nil state is an unreachable path.
+// Only facts of both paths hold after the merge but accesses of any path are kept.
+func join(a *lintState, b *lintState) *lintState {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	result := newLintState()
+	for field := range a.checked {
+		if b.checked[field] {
+			result.checked[field] = true
+		}
+	}
+	for field := range result.values {
+		result.values[field] = a.values[field] | b.values[field]
+	}
+	if a.groupSize != 0 && b.groupSize != 0 {
+		result.groupSize = a.groupSize
+		if b.groupSize > a.groupSize {
+			result.groupSize = b.groupSize
+		}
+	}
+	result.accesses = append(result.accesses, a.accesses...)
+	for _, acc := range b.accesses {
+		result.access(acc.index, acc.pos)
+	}
+	return result
+}
+
+// meet adds facts established by a called function to the caller state
+func meet(s *lintState, other *lintState) *lintState {
+	if s == nil || other == nil {
+		return nil
+	}
+	result := s.copy()
+	for field := range other.checked {
+		result.checked[field] = true
+	}
+	for field, values := range other.values {
+		result.values[field] &= values
+		if result.values[field] == 0 {
+			return nil
+		}
+	}
+	if other.groupSize != 0 {
+		result.boundGroupSize(other.groupSize)
+	}
+	for _, acc := range other.accesses {
+		result.access(acc.index, acc.pos)
+	}
+	return result
+}
+
+// lintSummary describes a function effect on the caller path:
+// facts holding after any return and facts holding when the function returns non-zero
+type lintSummary struct {
+	after    *lintState
+	whenTrue *lintState
+}
+
+type linter struct {
+	rules     map[string]bool
+	summaries map[*funDefNode]*lintSummary
+	findings  *warningCollector
+}
+
+// Lint checks approval paths of the program for missing security checks.
+// A path approves if it ends with return of a value not known to be zero,
+// and the facts are collected from assert calls, if conditions, returned conditions and called functions.
+func Lint(prog TreeNodeIf, config LintConfig) []ParserError {
+	root, ok := prog.(*programNode)
+	if !ok {
+		return nil
+	}
+	var main *funDefNode
+	for _, ch := range root.children() {
+		if def, ok := ch.(*funDefNode); ok && def.name == mainFuncName {
+			main = def
+		}
+	}
+	if main == nil {
+		return nil
+	}
+
+	mode := config.Mode
+	if len(mode) == 0 {
+		switch root.mode {
+		case ModeLogicSig:
+			mode = LintModeLogicSig
+		case ModeApproval, ModeClearState:
+			mode = LintModeApp
+		default:
+			// no main function declared, e.g. a hand-built tree
+			mode = LintModeLogicSig
+			if usesApplication(main, make(map[*funDefNode]bool)) {
+				mode = LintModeApp
+			}
+		}
+	}
+	l := &linter{
+		rules:     make(map[string]bool),
+		summaries: make(map[*funDefNode]*lintSummary),
+		findings:  newWarningCollector(),
+	}
+	for _, rule := range lintModes[mode] {
+		if !config.Disabled[rule] {
+			l.rules[rule] = true
+		}
+	}
+
+	l.block(newLintState(), main.children(), nil)
+
+	result := l.findings.warnings
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].filename != result[j].filename {
+			return result[i].filename < result[j].filename
+		}
+		if result[i].line != result[j].line {
+			return result[i].line < result[j].line
+		}
+		return result[i].column < result[j].column
+	})
+	return result
+}
+
+// usesApplication reports if the code reads application call fields or state
+func usesApplication(node TreeNodeIf, visited map[*funDefNode]bool) bool {
+	switch tt := node.(type) {
+	case *runtimeFieldNode:
+		if tt.field == "ApplicationID" || tt.field == "OnCompletion" || tt.field == "CurrentApplicationID" ||
+			tt.field == "ApplicationArgs" || tt.field == "NumAppArgs" {
+			return true
+		}
+	case *itxnBeginNode, *contractNode:
+		return true
+	case *funCallNode:
+		if strings.HasPrefix(tt.name, "app_") || strings.HasPrefix(tt.name, "box_") || tt.name == "log" {
+			return true
+		}
+		if tt.definition != nil && !tt.definition.inline && !visited[tt.definition] {
+			visited[tt.definition] = true
+			if usesApplication(tt.definition, visited) {
+				return true
+			}
+		}
+	}
+	for _, nested := range nestedNodes(node) {
+		if usesApplication(nested, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// block walks statements and returns the state at the end, nil if no path falls through.
+// Returns of the main function are checked, returns of other functions are added to the summary.
+func (l *linter) block(s *lintState, statements []TreeNodeIf, summary *lintSummary) *lintState {
+	for _, stmt := range statements {
+		if s == nil {
+			return nil
+		}
+		s = l.statement(s, stmt, summary)
+	}
+	return s
+}
+
+func (l *linter) statement(s *lintState, node TreeNodeIf, summary *lintSummary) *lintState {
+	switch tt := node.(type) {
+	case *constNode, *structDefNode:
+		return s
+	case *blockNode:
+		return l.block(s, tt.children(), summary)
+	case *errorNode, *breakNode, *continueNode:
+		return nil
+	case *returnNode:
+		for _, value := range tt.values {
+			s = l.visit(s, value)
+		}
+		if s == nil {
+			return nil
+		}
+		if tt.definition != nil && tt.definition.method != nil {
+			// contract methods approve the call whatever value they return
+			l.approve(s, tt.position())
+			return nil
+		}
+		// only a single returned value is a condition
+		var cond ExprNodeIf
+		if len(tt.values) == 1 {
+			cond = tt.values[0]
+		}
+		if summary != nil {
+			summary.after = join(summary.after, s)
+			summary.whenTrue = join(summary.whenTrue, l.assume(s, cond, true))
+		} else if approved := l.assume(s, cond, true); approved != nil {
+			l.approve(approved, tt.position())
+		}
+		return nil
+	case *ifStatementNode:
+		s = l.visit(s, tt.condExpr)
+		if s == nil {
+			return nil
+		}
+		branches := tt.children()
+		thenState := l.statement(l.assume(s, tt.condExpr, true), branches[0], summary)
+		elseState := l.assume(s, tt.condExpr, false)
+		if len(branches) > 1 {
+			elseState = l.statement(elseState, branches[1], summary)
+		}
+		return join(thenState, elseState)
+	case *switchStatementNode:
+		s = l.visit(s, tt.value)
+		if s == nil {
+			return nil
+		}
+		// a case is taken if the value equals one of the case values, the default if none matches
+		branches := tt.children()
+		var result *lintState
+		other := s
+		for i, values := range tt.cases {
+			var taken *lintState
+			for _, value := range values {
+				taken = join(taken, l.compare(s, "==", tt.value, value, true))
+				if other != nil {
+					other = l.compare(other, "==", tt.value, value, false)
+				}
+			}
+			result = join(result, l.statement(taken, branches[i], summary))
+		}
+		if tt.hasDefault {
+			other = l.statement(other, branches[len(tt.cases)], summary)
+		}
+		return join(result, other)
+	case *contractNode:
+		// methods are NoOp calls, bare calls are taken by OnCompletion of their actions
+		methods := s.restrict(onCompletionField, singleValue(abiBareActions["create"]))
+		for _, method := range tt.methods {
+			if end := l.block(methods, method.children(), summary); end != nil {
+				l.approve(end, method.position())
+			}
+		}
+		for _, call := range tt.bare {
+			var values valueSet
+			for _, action := range call.actions {
+				values |= singleValue(abiBareActions[action])
+			}
+			if end := l.statement(s.restrict(onCompletionField, values), call.body, summary); end != nil {
+				l.approve(end, call.pos)
+			}
+		}
+		return nil
+	case *forStatementNode:
+		s = l.visit(s, tt.init)
+		s = l.visit(s, tt.condExpr)
+		if s == nil {
+			return nil
+		}
+		// the body might not run, only its accesses are added to the state after the loop
+		body := l.visit(l.block(l.assume(s, tt.condExpr, true), tt.children(), summary), tt.step)
+		if body != nil {
+			s = s.copy()
+			for _, acc := range body.accesses {
+				s.access(acc.index, acc.pos)
+			}
+		}
+		return s
+	case *funCallNode:
+		if tt.name == "assert" && len(tt.children()) == 1 {
+			cond := tt.children()[0].(ExprNodeIf)
+			return l.assume(l.visit(s, cond), cond, true)
+		}
+	}
+	return l.visit(s, node)
+}
+
+// visit records gtxn accesses of the node and applies effects of the functions called
+func (l *linter) visit(s *lintState, node TreeNodeIf) *lintState {
+	if s == nil || node == nil {
+		return s
+	}
+	switch tt := node.(type) {
+	case *runtimeFieldNode:
+		if tt.op == "gtxn" || tt.op == "gtxna" || tt.op == "gtxnas" {
+			if index, err := strconv.ParseUint(tt.index1, 0, 64); err == nil {
+				s = s.copy()
+				s.access(index, tt.position())
+			}
+		}
+	case *funCallNode:
+		for _, ch := range tt.children() {
+			s = l.visit(s, ch)
+		}
+		if tt.definition != nil {
+			s = meet(s, l.function(tt.definition).after)
+		}
+		return s
+	}
+	for _, nested := range nestedNodes(node) {
+		s = l.visit(s, nested)
+	}
+	return s
+}
+
+// function returns summary of the function body analyzed independently of the callers
+func (l *linter) function(def *funDefNode) *lintSummary {
+	if summary, ok := l.summaries[def]; ok {
+		return summary
+	}
+	// functions can not be recursive but guard against it anyway
+	l.summaries[def] = &lintSummary{newLintState(), newLintState()}
+
+	summary := &lintSummary{}
+	l.block(newLintState(), def.children(), summary)
+	l.summaries[def] = summary
+	return summary
+}
+
+// assume returns the state refined by the condition evaluated to truth, nil if the condition can not have the value
+func (l *linter) assume(s *lintState, cond ExprNodeIf, truth bool) *lintState {
+	if s == nil || cond == nil {
+		return s
+	}
+	if value, ok := intConstValue(cond); ok {
+		if (value != 0) != truth {
+			return nil
+		}
+		return s
+	}
+	switch tt := cond.(type) {
+	case *exprGroupNode:
+		return l.assume(s, tt.value, truth)
+	case *typeCastNode:
+		return l.assume(s, tt.expr, truth)
+	case *exprUnOpNode:
+		if tt.op == "!" {
+			return l.assume(s, tt.value, !truth)
+		}
+	case *ifExprNode:
+		return join(
+			l.assume(l.assume(s, tt.condExpr, true), tt.condTrueExpr, truth),
+			l.assume(l.assume(s, tt.condExpr, false), tt.condFalseExpr, truth),
+		)
+	case *funCallNode:
+		if tt.definition != nil {
+			summary := l.function(tt.definition)
+			if truth {
+				return meet(s, summary.whenTrue)
+			}
+			return meet(s, summary.after)
+		}
+	case *exprBinOpNode:
+		switch tt.op {
+		case "&&":
+			if truth {
+				return l.assume(l.assume(s, tt.lhs, true), tt.rhs, true)
+			}
+			return join(l.assume(s, tt.lhs, false), l.assume(s, tt.rhs, false))
+		case "||":
+			if truth {
+				return join(l.assume(s, tt.lhs, true), l.assume(s, tt.rhs, true))
+			}
+			return l.assume(l.assume(s, tt.lhs, false), tt.rhs, false)
+		case "==", "!=", "<", "<=", ">", ">=":
+			return l.compare(s, tt.op, tt.lhs, tt.rhs, truth)
+		}
+	}
+	return s
+}
+
+var swappedComparison = map[string]string{"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+var negatedComparison = map[string]string{"==": "!=", "!=": "==", "<": ">=", "<=": ">", ">": "<=", ">=": "<"}
+
+// compare refines the state by a comparison of a transaction field
+func (l *linter) compare(s *lintState, op string, lhs ExprNodeIf, rhs ExprNodeIf, truth bool) *lintState {
+	field := trackedField(lhs)
+	if len(field) == 0 {
+		field = trackedField(rhs)
+		lhs, rhs = rhs, lhs
+		op = swappedComparison[op]
+	}
+	if len(field) == 0 {
+		return s
+	}
+	if !truth {
+		op = negatedComparison[op]
+	}
+	value, isConst := intConstValue(unwrapGroup(rhs))
+
+	s = s.copy()
+	switch op {
+	case "==":
+		s.checked[field] = true
+		if isConst {
+			if values, ok := s.values[field]; ok {
+				s.values[field] = values & singleValue(value)
+			}
+			if field == groupSizeField {
+				s.boundGroupSize(value)
+			}
+		}
+	case "!=":
+		if values, ok := s.values[field]; ok && isConst {
+			s.values[field] = values &^ singleValue(value)
+		}
+	case "<", "<=":
+		if field == "txn.Fee" {
+			s.checked[field] = true
+		}
+		if !isConst {
+			break
+		}
+		if op == "<=" {
+			value++
+		}
+		if values, ok := s.values[field]; ok {
+			s.values[field] = values & valuesBelow(value)
+		}
+		if field == groupSizeField && value > 0 {
+			s.boundGroupSize(value - 1)
+		}
+	case ">", ">=":
+		if !isConst {
+			break
+		}
+		if op == ">" {
+			value++
+		}
+		if values, ok := s.values[field]; ok {
+			s.values[field] = values &^ valuesBelow(value)
+		}
+	}
+	for _, values := range s.values {
+		if values == 0 {
+			return nil
+		}
+	}
+	return s
+}
+
+func unwrapGroup(expr ExprNodeIf) ExprNodeIf {
+	for {
+		group, ok := expr.(*exprGroupNode)
+		if !ok {
+			return expr
+		}
+		expr = group.value
+	}
+}
+
+// trackedField returns txn.<field> or global.GroupSize name of the expression, empty string otherwise
+func trackedField(expr ExprNodeIf) string {
+	field, ok := unwrapGroup(expr).(*runtimeFieldNode)
+	if !ok {
+		return ""
+	}
+	if field.op == "txn" {
+		return "txn." + field.field
+	}
+	if field.op == "global" && field.field == "GroupSize" {
+		return groupSizeField
+	}
+	return ""
+}
+
+// approve reports rules violated by the approval path ending at pos
+func (l *linter) approve(s *lintState, pos sourcePos) {
+	report := func(rule string, at sourcePos, msg string) {
+		if l.rules[rule] {
+			l.findings.report(lintError, rule, at, msg)
+		}
+	}
+	types := s.values[typeEnumField]
+
+	if !s.checked["txn.RekeyTo"] {
+		report(lintRekeyTo, pos, "approval path does not check txn.RekeyTo against global.ZeroAddress")
+	}
+	if !s.checked["txn.CloseRemainderTo"] && types&singleValue(typeEnumPay) != 0 {
+		report(lintCloseRemainderTo, pos, "approval path does not check txn.CloseRemainderTo against global.ZeroAddress")
+	}
+	if !s.checked["txn.AssetCloseTo"] && types&singleValue(typeEnumAxfer) != 0 {
+		report(lintAssetCloseTo, pos, "approval path does not check txn.AssetCloseTo against global.ZeroAddress")
+	}
+	if !s.checked["txn.Fee"] {
+		report(lintFee, pos, "approval path does not limit txn.Fee")
+	}
+	if s.values[onCompletionField]&updateOrDeleteValues != 0 && !s.checked["txn.Sender"] {
+		report(lintOnCompletion, pos, "approval path allows UpdateApplication or DeleteApplication without checking txn.Sender")
+	}
+	for _, acc := range s.accesses {
+		if s.groupSize == 0 {
+			report(lintGroupSize, acc.pos, fmt.Sprintf("gtxn[%d] is accessed but global.GroupSize is not checked on the approval path", acc.index))
+		} else if acc.index >= s.groupSize {
+			report(lintGroupSize, acc.pos, fmt.Sprintf("gtxn[%d] is out of global.GroupSize bound %d checked on the approval path", acc.index, s.groupSize))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type finding struct {
+	rule string
+	line int
+	msg  string
+}
+
+func lintFindings(a *require.Assertions, source string, config LintConfig) []finding {
+	prog, errors := Parse(source)
+	a.Empty(errors)
+	a.NotNil(prog)
+	var actual []finding
+	for _, f := range Lint(prog, config) {
+		a.Equal("lint", f.Kind())
+		actual = append(actual, finding{f.Warning(), f.Line(), f.Message()})
+	}
+	return actual
+}
+
+func TestLintLogicSig(t *testing.T) {
+	a := require.New(t)
+
+	source := `import stdlib.const
+function logic() {
+	assert(txn.RekeyTo == global.ZeroAddress)
+	if txn.Fee > 1000 {
+		error
+	}
+	if txn.TypeEnum == TxTypePayment {
+		return txn.CloseRemainderTo == global.ZeroAddress
+	}
+	return gtxn[1].Amount > 0 && global.GroupSize == 2
+}
+`
+	a.Equal([]finding{
+		{"asset-close-to", 10, "approval path does not check txn.AssetCloseTo against global.ZeroAddress"},
+	}, lintFindings(a, source, LintConfig{}))
+
+	source = `
+function closed() {
+	return txn.AssetCloseTo == global.ZeroAddress && txn.CloseRemainderTo == global.ZeroAddress
+}
+function logic() {
+	if txn.Amount > 10 {
+		return closed()
+	}
+	let x = gtxn[2].Fee
+	return x
+}
+`
+	a.Equal([]finding{
+		{"rekey-to", 7, "approval path does not check txn.RekeyTo against global.ZeroAddress"},
+		{"fee", 7, "approval path does not limit txn.Fee"},
+		{"group-size", 9, "gtxn[2] is accessed but global.GroupSize is not checked on the approval path"},
+		{"rekey-to", 10, "approval path does not check txn.RekeyTo against global.ZeroAddress"},
+		{"close-remainder-to", 10, "approval path does not check txn.CloseRemainderTo against global.ZeroAddress"},
+		{"asset-close-to", 10, "approval path does not check txn.AssetCloseTo against global.ZeroAddress"},
+		{"fee", 10, "approval path does not limit txn.Fee"},
+	}, lintFindings(a, source, LintConfig{}))
+
+	disabled := map[string]bool{"rekey-to": true, "close-remainder-to": true, "asset-close-to": true, "fee": true}
+	a.Equal([]finding{
+		{"group-size", 9, "gtxn[2] is accessed but global.GroupSize is not checked on the approval path"},
+	}, lintFindings(a, source, LintConfig{Disabled: disabled}))
+}
+
+func TestLintApp(t *testing.T) {
+	a := require.New(t)
+
+	source := `import stdlib.const
+function approval() {
+	if txn.OnCompletion == AcDeleteApplication {
+		return txn.Sender == global.CreatorAddress
+	}
+	if txn.OnCompletion == AcUpdateApplication {
+		return 1
+	}
+	if global.GroupSize > 2 {
+		return 0
+	}
+	return gtxn[2].Amount
+}
+`
+	a.Equal([]finding{
+		{"on-completion", 7, "approval path allows UpdateApplication or DeleteApplication without checking txn.Sender"},
+		{"group-size", 12, "gtxn[2] is out of global.GroupSize bound 2 checked on the approval path"},
+	}, lintFindings(a, source, LintConfig{}))
+
+	a.Empty(lintFindings(a, source, LintConfig{Mode: LintModeApp, Disabled: map[string]bool{"on-completion": true, "group-size": true}}))
+
+	// the mode follows the main function even if no application fields are read
+	source = `
+function approval() {
+	return 1
+}
+`
+	a.Equal([]finding{
+		{"on-completion", 3, "approval path allows UpdateApplication or DeleteApplication without checking txn.Sender"},
+	}, lintFindings(a, source, LintConfig{}))
+
+	source = `
+function logic() {
+	if txn.OnCompletion == 0 {
+		return 1
+	}
+	return 0
+}
+`
+	a.Equal([]finding{
+		{"rekey-to", 4, "approval path does not check txn.RekeyTo against global.ZeroAddress"},
+		{"close-remainder-to", 4, "approval path does not check txn.CloseRemainderTo against global.ZeroAddress"},
+		{"asset-close-to", 4, "approval path does not check txn.AssetCloseTo against global.ZeroAddress"},
+		{"fee", 4, "approval path does not limit txn.Fee"},
+	}, lintFindings(a, source, LintConfig{}))
+}
+
+func TestLintState(t *testing.T) {
+	a := require.New(t)
+
+	l := &linter{}
+	fee := newRuntimeFieldNode(nil, nil, "txn", "Fee")
+	onCompletion := newRuntimeFieldNode(nil, nil, "txn", "OnCompletion")
+	groupSize := newRuntimeFieldNode(nil, nil, "global", "GroupSize")
+	four := newExprLiteralNode(nil, nil, intType, "4")
+
+	s := l.compare(newLintState(), ">", four, fee, true)
+	a.True(s.checked["txn.Fee"])
+	a.False(l.compare(newLintState(), ">", fee, four, true).checked["txn.Fee"])
+	a.True(l.compare(newLintState(), ">", fee, four, false).checked["txn.Fee"])
+
+	s = l.compare(newLintState(), "<", onCompletion, four, true)
+	a.Equal(valueSet(0x0f), s.values[onCompletionField])
+	s = l.compare(s, "!=", onCompletion, newExprLiteralNode(nil, nil, intType, "0"), true)
+	a.Equal(valueSet(0x0e), s.values[onCompletionField])
+	a.Nil(l.compare(s, "==", onCompletion, four, true))
+
+	s = l.compare(newLintState(), "<=", groupSize, four, true)
+	a.Equal(uint64(4), s.groupSize)
+	s = l.compare(s, "<", groupSize, four, true)
+	a.Equal(uint64(3), s.groupSize)
+
+	other := newLintState()
+	other.checked["txn.Fee"] = true
+	other.values[onCompletionField] = valueSet(0x10)
+	joined := join(s, other)
+	a.False(joined.checked["txn.Fee"])
+	a.Equal(valueSet(0xff), joined.values[onCompletionField])
+	a.Equal(uint64(0), joined.groupSize)
+	a.Equal(other, join(nil, other))
+
+	met := meet(s, other)
+	a.True(met.checked["txn.Fee"])
+	a.Equal(uint64(3), met.groupSize)
+	a.Nil(meet(s, nil))
+}
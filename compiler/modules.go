@@ -1,7 +1,6 @@
 package compiler
 
 import (
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -18,7 +17,7 @@ func resolveModule(moduleName string, sourceDir string, currentDir string) (Inpu
 		var ok bool
 		source, ok = stdlib.LoadModule(moduleName)
 		if !ok {
-			return InputDesc{}, fmt.Errorf("standard module %s not found", moduleName)
+			return InputDesc{}, errorf(CodeModule, "standard module %s not found", moduleName)
 		}
 		sourceFile = moduleName
 		sourceDir = currentDir
@@ -50,7 +49,7 @@ func resolveModule(moduleName string, sourceDir string, currentDir string) (Inpu
 		}
 
 		if source == "" {
-			return InputDesc{}, fmt.Errorf("module %s not found", moduleName)
+			return InputDesc{}, errorf(CodeModule, "module %s not found", moduleName)
 		}
 	}
 	return InputDesc{source, sourceFile, sourceDir, currentDir}, nil
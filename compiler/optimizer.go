@@ -0,0 +1,435 @@
+//--------------------------------------------------------------------------------------------------
+//
+// AST optimizations
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	gobytes "bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type optimizer struct {
+	visited  map[TreeNodeIf]bool
+	reported map[sourcePos]bool
+	errors   []ParserError
+}
+
+func newOptimizer() (o *optimizer) {
+	o = new(optimizer)
+	o.visited = make(map[TreeNodeIf]bool)
+	o.reported = make(map[sourcePos]bool)
+	o.errors = make([]ParserError, 0, 16)
+	return
+}
+
+// Optimize folds constant expressions and simplifies identities in AST.
+// Must be called after parsing and before code generation.
+func Optimize(prog TreeNodeIf) []ParserError {
+	o := newOptimizer()
+	o.statement(prog)
+	if root, ok := prog.(*programNode); ok {
+		// literals are pruned by the code generation so that
+		// literals needed by later passes like AssertTypes are kept
+		root.prune = true
+	}
+	return o.errors
+}
+
+// pruneLiterals drops literals of folded expressions from intc and bytec blocks.
+// The program body is generated once to collect literals referenced by the code,
+// internal 0 and 1 literals are kept first as the code generation expects.
+func pruneLiterals(prog *programNode) {
+	literals := prog.ctx.literals
+	literals.used = map[string]bool{falseConstValue: true, trueConstValue: true}
+	for _, ch := range prog.children() {
+		ch.Codegen(ioutil.Discard)
+	}
+	for _, def := range prog.nonInlineFunc {
+		def.Codegen(ioutil.Discard)
+	}
+	used := literals.used
+	literals.used = nil
+
+	values := make([]string, 0, len(literals.literals))
+	for value := range literals.literals {
+		values = append(values, value)
+	}
+	// keep the original order of the remaining literals
+	sort.Slice(values, func(i, j int) bool {
+		return literals.literals[values[i]].offset < literals.literals[values[j]].offset
+	})
+
+	intc := make([]string, 0, len(literals.intc))
+	bytec := make([][]byte, 0, len(literals.bytec))
+	for _, value := range values {
+		desc := literals.literals[value]
+		if !used[value] {
+			delete(literals.literals, value)
+			continue
+		}
+		if desc.theType == intType {
+			desc.offset = uint(len(intc))
+			intc = append(intc, literals.intc[literals.literals[value].offset])
+		} else {
+			desc.offset = uint(len(bytec))
+			bytec = append(bytec, literals.bytec[literals.literals[value].offset])
+		}
+		literals.literals[value] = desc
+	}
+	literals.intc = intc
+	literals.bytec = bytec
+}
+
+func (o *optimizer) report(pos sourcePos, msg string) {
+	if o.reported[pos] {
+		// inline functions are parsed for every call so the same error might appear several times
+		return
+	}
+	o.reported[pos] = true
+	o.errors = append(o.errors, newNodeError(CodeConstantFolding, pos, msg))
+}
+
+func (o *optimizer) children(node TreeNodeIf) {
+	ch := node.children()
+	for i, stmt := range ch {
+		switch tt := stmt.(type) {
+		case *constNode, *structDefNode:
+			continue
+		case ExprNodeIf:
+			ch[i] = o.expr(tt)
+		default:
+			o.statement(stmt)
+		}
+	}
+}
+
+func (o *optimizer) statement(node TreeNodeIf) {
+	if node == nil || o.visited[node] {
+		return
+	}
+	o.visited[node] = true
+
+	switch tt := node.(type) {
+	case *programNode:
+		o.children(tt)
+		for _, fun := range tt.nonInlineFunc {
+			o.statement(fun)
+		}
+	case *funDefNode, *blockNode, *contractNode:
+		o.children(tt)
+	case *varDeclNode:
+		tt.value = o.expr(tt.value)
+	case *destructuringNode:
+		tt.value = o.expr(tt.value)
+	case *assignNode:
+		tt.value = o.expr(tt.value)
+	case *assignInnerTxnNode:
+		tt.value = o.expr(tt.value)
+	case *assignStructFieldNode:
+		tt.value = o.expr(tt.value)
+	case *returnNode:
+		for i, value := range tt.values {
+			tt.values[i] = o.expr(value)
+		}
+	case *ifStatementNode:
+		tt.condExpr = o.expr(tt.condExpr)
+		o.children(tt)
+	case *switchStatementNode:
+		tt.value = o.expr(tt.value)
+		o.children(tt)
+	case *forStatementNode:
+		o.statement(tt.init)
+		tt.condExpr = o.expr(tt.condExpr)
+		o.statement(tt.step)
+		o.children(tt)
+	}
+}
+
+func (o *optimizer) expr(node ExprNodeIf) ExprNodeIf {
+	if node == nil {
+		return nil
+	}
+
+	switch tt := node.(type) {
+	case *exprGroupNode:
+		// grouping only matters for parsing
+		return o.expr(tt.value)
+	case *exprBinOpNode:
+		tt.lhs = o.expr(tt.lhs)
+		tt.rhs = o.expr(tt.rhs)
+		return o.foldBinOp(tt)
+	case *exprUnOpNode:
+		tt.value = o.expr(tt.value)
+		return o.foldUnOp(tt)
+	case *ifExprNode:
+		tt.condExpr = o.expr(tt.condExpr)
+		tt.condTrueExpr = o.expr(tt.condTrueExpr)
+		tt.condFalseExpr = o.expr(tt.condFalseExpr)
+		if cond, ok := intConstValue(tt.condExpr); ok {
+			if cond != 0 {
+				return tt.condTrueExpr
+			}
+			return tt.condFalseExpr
+		}
+	case *switchExprNode:
+		tt.value = o.expr(tt.value)
+		o.children(tt)
+	case *typeCastNode:
+		tt.expr = o.expr(tt.expr)
+	case *funCallNode:
+		o.children(tt)
+		if tt.definition != nil && tt.definition.inline {
+			o.statement(tt.definition)
+		}
+		return o.foldFunCall(tt)
+	case *runtimeFieldNode, *runtimeArgNode, *structNewNode:
+		o.children(tt)
+	case *structFieldNode:
+		tt.value = o.expr(tt.value)
+	}
+	return node
+}
+
+// intConstValue returns value of integer literal or constant
+func intConstValue(node ExprNodeIf) (uint64, bool) {
+	var value string
+	switch tt := node.(type) {
+	case *exprLiteralNode:
+		if tt.exprType != intType {
+			return 0, false
+		}
+		value = tt.value
+	case *exprIdentNode:
+		info, err := tt.ctx.lookup(tt.name)
+		if err != nil || !info.constant() || info.theType != intType {
+			return 0, false
+		}
+		value = *info.value
+	default:
+		return 0, false
+	}
+
+	result, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return result, true
+}
+
+// bytesConstValue returns decoded value of byte literal or constant
+func bytesConstValue(node ExprNodeIf) ([]byte, bool) {
+	var value string
+	switch tt := node.(type) {
+	case *exprLiteralNode:
+		if tt.exprType != bytesType {
+			return nil, false
+		}
+		value = tt.value
+	case *exprIdentNode:
+		info, err := tt.ctx.lookup(tt.name)
+		if err != nil || !info.constant() || info.theType != bytesType {
+			return nil, false
+		}
+		value = *info.value
+	default:
+		return nil, false
+	}
+
+	result, err := parseStringLiteral(value)
+	if err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// isBoolExpr returns true if the expression is known to evaluate to 0 or 1
+func isBoolExpr(node ExprNodeIf) bool {
+	switch tt := node.(type) {
+	case *exprBinOpNode:
+		switch tt.op {
+		case "<", ">", "<=", ">=", "==", "!=", "&&", "||":
+			return true
+		}
+	case *exprUnOpNode:
+		return tt.op == "!"
+	case *exprLiteralNode:
+		value, ok := intConstValue(tt)
+		return ok && value <= 1
+	}
+	return false
+}
+
+func newIntLiteral(ctx *context, parent TreeNodeIf, value uint64) ExprNodeIf {
+	str := strconv.FormatUint(value, 10)
+	ctx.addLiteral(str, intType)
+	return newExprLiteralNode(ctx, parent, intType, str)
+}
+
+func newBoolLiteral(ctx *context, parent TreeNodeIf, value bool) ExprNodeIf {
+	if value {
+		return newIntLiteral(ctx, parent, 1)
+	}
+	return newIntLiteral(ctx, parent, 0)
+}
+
+func newBytesLiteral(ctx *context, parent TreeNodeIf, value []byte) ExprNodeIf {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	for _, b := range value {
+		sb.WriteString(fmt.Sprintf(`\x%02x`, b))
+	}
+	sb.WriteString(`"`)
+	str := sb.String()
+	ctx.addLiteral(str, bytesType)
+	return newExprLiteralNode(ctx, parent, bytesType, str)
+}
+
+func (o *optimizer) foldBinOp(node *exprBinOpNode) ExprNodeIf {
+	lhs, lhsConst := intConstValue(node.lhs)
+	rhs, rhsConst := intConstValue(node.rhs)
+	if lhsConst && rhsConst {
+		var result uint64
+		switch node.op {
+		case "+":
+			result = lhs + rhs
+			if result < lhs {
+				o.report(node.pos, fmt.Sprintf("integer overflow in '%s'", node))
+				return node
+			}
+		case "-":
+			if rhs > lhs {
+				o.report(node.pos, fmt.Sprintf("integer underflow in '%s'", node))
+				return node
+			}
+			result = lhs - rhs
+		case "*":
+			result = lhs * rhs
+			if lhs != 0 && result/lhs != rhs {
+				o.report(node.pos, fmt.Sprintf("integer overflow in '%s'", node))
+				return node
+			}
+		case "/", "%":
+			if rhs == 0 {
+				o.report(node.pos, fmt.Sprintf("division by zero in '%s'", node))
+				return node
+			}
+			if node.op == "/" {
+				result = lhs / rhs
+			} else {
+				result = lhs % rhs
+			}
+		case "|":
+			result = lhs | rhs
+		case "&":
+			result = lhs & rhs
+		case "^":
+			result = lhs ^ rhs
+		case "<":
+			return newBoolLiteral(node.ctx, node.parent(), lhs < rhs)
+		case ">":
+			return newBoolLiteral(node.ctx, node.parent(), lhs > rhs)
+		case "<=":
+			return newBoolLiteral(node.ctx, node.parent(), lhs <= rhs)
+		case ">=":
+			return newBoolLiteral(node.ctx, node.parent(), lhs >= rhs)
+		case "==":
+			return newBoolLiteral(node.ctx, node.parent(), lhs == rhs)
+		case "!=":
+			return newBoolLiteral(node.ctx, node.parent(), lhs != rhs)
+		case "&&":
+			return newBoolLiteral(node.ctx, node.parent(), lhs != 0 && rhs != 0)
+		case "||":
+			return newBoolLiteral(node.ctx, node.parent(), lhs != 0 || rhs != 0)
+		default:
+			return node
+		}
+		return newIntLiteral(node.ctx, node.parent(), result)
+	}
+
+	lhsBytes, lhsBytesConst := bytesConstValue(node.lhs)
+	rhsBytes, rhsBytesConst := bytesConstValue(node.rhs)
+	if lhsBytesConst && rhsBytesConst {
+		switch node.op {
+		case "==":
+			return newBoolLiteral(node.ctx, node.parent(), gobytes.Equal(lhsBytes, rhsBytes))
+		case "!=":
+			return newBoolLiteral(node.ctx, node.parent(), !gobytes.Equal(lhsBytes, rhsBytes))
+		}
+		return node
+	}
+
+	// identities: x + 0, x - 0, x * 1, x / 1, x | 0, x ^ 0 and commutative variants
+	switch node.op {
+	case "+", "|", "^":
+		if rhsConst && rhs == 0 {
+			return node.lhs
+		}
+		if lhsConst && lhs == 0 {
+			return node.rhs
+		}
+	case "-":
+		if rhsConst && rhs == 0 {
+			return node.lhs
+		}
+	case "*":
+		if rhsConst && rhs == 1 {
+			return node.lhs
+		}
+		if lhsConst && lhs == 1 {
+			return node.rhs
+		}
+	case "/":
+		if rhsConst && rhs == 1 {
+			return node.lhs
+		}
+	}
+	return node
+}
+
+func (o *optimizer) foldUnOp(node *exprUnOpNode) ExprNodeIf {
+	if value, ok := intConstValue(node.value); ok {
+		switch node.op {
+		case "!":
+			return newBoolLiteral(node.ctx, node.parent(), value == 0)
+		case "~":
+			return newIntLiteral(node.ctx, node.parent(), ^value)
+		}
+		return node
+	}
+
+	// !!x is x for boolean x, and ~~x is always x
+	if inner, ok := node.value.(*exprUnOpNode); ok && inner.op == node.op {
+		if node.op == "~" || (node.op == "!" && isBoolExpr(inner.value)) {
+			return inner.value
+		}
+	}
+	return node
+}
+
+func (o *optimizer) foldFunCall(node *funCallNode) ExprNodeIf {
+	if _, builtin := builtinFun[node.name]; !builtin {
+		return node
+	}
+
+	args := node.children()
+	switch node.name {
+	case "concat":
+		lhs, lhsOk := bytesConstValue(args[0].(ExprNodeIf))
+		rhs, rhsOk := bytesConstValue(args[1].(ExprNodeIf))
+		if lhsOk && rhsOk {
+			return newBytesLiteral(node.ctx, node.parent(), append(append([]byte{}, lhs...), rhs...))
+		}
+	case "len":
+		if value, ok := bytesConstValue(args[0].(ExprNodeIf)); ok {
+			return newIntLiteral(node.ctx, node.parent(), uint64(len(value)))
+		}
+	}
+	return node
+}
@@ -0,0 +1,166 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimizeConstFolding(t *testing.T) {
+	a := require.New(t)
+
+	source := `const a = 2; function logic() { let x = a * 1000 + 5; return x; }`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1 2005
+// const
+fun_main:
+intc 2
+store 0
+load 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	source = `const c = "abc"; function logic() { let x = len(concat(c, "de")); return (x == 5) && (c != "x"); }`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 5
+// const
+fun_main:
+intc 2
+store 0
+load 0
+intc 2
+==
+intc 1
+&&
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	source = `function logic() { let x = if 2 > 1 { 10 } else { 20 }; return x; }`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 10
+fun_main:
+intc 2
+store 0`
+	CompareTEAL(a, expected, actual)
+
+	// constants still referenced are renumbered along with other literals
+	source = `const a = 2; const b = 7; function logic() { let x = a * 3; return x > b; }`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1 7 6
+// const
+// const
+fun_main:
+intc 3
+store 0
+load 0
+intc 2
+>
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestOptimizeIdentities(t *testing.T) {
+	a := require.New(t)
+
+	source := `function logic() { let y = txn.Fee; let x = (y * 1 + 0) - 0; let z = !!(y == 1); let w = ~~y; return x; }`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual := Codegen(result)
+	expected := `#pragma version *
+intcblock 0 1
+fun_main:
+txn Fee
+store 0
+load 0
+store 1
+load 0
+intc 1
+==
+store 2
+load 0
+store 0
+load 1
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+
+	// !!x is not x for non-boolean x
+	source = `function logic() { let y = txn.Fee; return !!y; }`
+	result, errors = Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	errors = Optimize(result)
+	a.Empty(errors)
+	actual = Codegen(result)
+	expected = `#pragma version *
+intcblock 0 1
+fun_main:
+txn Fee
+store 0
+load 0
+!
+!
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+}
+
+func TestOptimizeErrors(t *testing.T) {
+	a := require.New(t)
+
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{`function logic() { let x = 18446744073709551615 + 1; return 1; }`, "integer overflow"},
+		{`const big = 0xFFFFFFFFFFFFFFFF; function logic() { return big * 2; }`, "integer overflow"},
+		{`function logic() { let x = 1 - 2; return 1; }`, "integer underflow"},
+		{`const zero = 0; function logic() { return 1 / zero; }`, "division by zero"},
+		{`function logic() { return 5 % (2 - 2); }`, "division by zero"},
+	}
+	for _, test := range tests {
+		result, errors := Parse(test.source)
+		a.NotEmpty(result, errors)
+		a.Empty(errors)
+		errors = Optimize(result)
+		a.Equal(1, len(errors), test.source)
+		a.Equal(semanticError, errors[0].errorType)
+		a.Equal(1, errors[0].line)
+		a.Contains(errors[0].msg, test.msg)
+	}
+}
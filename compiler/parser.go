@@ -89,8 +89,8 @@ func newParseContext(input InputDesc, collector *errorCollector) (ctx *parseCont
 	return
 }
 
-func reportError(msg string, parser antlr.Parser, token antlr.Token, rule antlr.RuleContext) {
-	e := newTealangBaseRecognitionException(msg, parser, token, rule)
+func reportError(code string, msg string, parser antlr.Parser, token antlr.Token, rule antlr.RuleContext) {
+	e := newTealangBaseRecognitionException(code, msg, parser, token, rule)
 	parser.NotifyErrorListeners(e.GetMessage(), e.GetOffendingToken(), e)
 }
 
@@ -108,6 +108,7 @@ func reportParserError(err ParserError, parser antlr.Parser, token antlr.Token,
 // EnterProgram is an entry point to AST
 func (l *treeNodeListener) EnterProgram(ctx *gen.ProgramContext) {
 	root := newProgramNode(l.ctx, l.parent)
+	root.pos = tokenPos(ctx.GetStart())
 
 	declarations := ctx.AllDeclaration()
 	for _, declaration := range declarations {
@@ -121,37 +122,56 @@ func (l *treeNodeListener) EnterProgram(ctx *gen.ProgramContext) {
 
 	mainListener := newTreeNodeListener(l.ctx, root)
 
-	ctx.Main().EnterRule(mainListener)
+	// contract is the main function dispatching application calls
+	var mainToken antlr.Token
+	var mainRule antlr.RuleContext
+	if ctx.Contract() != nil {
+		contractCtx := ctx.Contract().(*gen.ContractContext)
+		contractCtx.EnterRule(mainListener)
+		mainToken, mainRule = contractCtx.CONTRACT().GetSymbol(), contractCtx.GetRuleContext()
+		root.mode = ModeApproval
+	} else {
+		mainCtx := ctx.Main().(*gen.MainContext)
+		mainCtx.EnterRule(mainListener)
+		mainToken, mainRule = mainCtx.FUNC().GetSymbol(), mainCtx.GetRuleContext()
+		root.mode = mainCtx.MAINFUNC().GetText()
+	}
 	main := mainListener.getNode()
-	mainCtx := ctx.Main().(*gen.MainContext)
 	if main == nil {
 		reportError(
-			"missing main function",
-			ctx.GetParser(), mainCtx.FUNC().GetSymbol(), mainCtx.GetRuleContext(),
+			CodeControlFlow, "missing main function",
+			ctx.GetParser(), mainToken, mainRule,
 		)
 		return
 	}
 
 	if !ensureBlockReturns(main) {
 		reportError(
-			"main function does not return",
-			ctx.GetParser(), mainCtx.FUNC().GetSymbol(), mainCtx.GetRuleContext(),
+			CodeControlFlow, "main function does not return",
+			ctx.GetParser(), mainToken, mainRule,
 		)
 		return
 	}
 
-	tp, err := determineBlockReturnType(main, []exprType{})
+	types, err := determineBlockReturnTypes(main, nil)
 	if err != nil {
 		reportError(
-			err.Error(),
-			ctx.GetParser(), mainCtx.FUNC().GetSymbol(), mainCtx.GetRuleContext(),
+			errorCode(err), err.Error(),
+			ctx.GetParser(), mainToken, mainRule,
 		)
 		return
 	}
-	if tp != unknownType && tp != intType {
+	if len(types) > 1 {
 		reportError(
-			fmt.Sprintf("main function must return int but got %s", tp),
-			ctx.GetParser(), mainCtx.FUNC().GetSymbol(), mainCtx.GetRuleContext(),
+			CodeControlFlow, fmt.Sprintf("main function must return a single value but returns %d", len(types)),
+			ctx.GetParser(), mainToken, mainRule,
+		)
+		return
+	}
+	if len(types) == 1 && types[0] != unknownType && types[0] != intType {
+		reportError(
+			CodeType, fmt.Sprintf("main function must return int but got %s", types[0]),
+			ctx.GetParser(), mainToken, mainRule,
 		)
 		return
 	}
@@ -164,6 +184,7 @@ func (l *treeNodeListener) EnterProgram(ctx *gen.ProgramContext) {
 // EnterModule is an entry point to AST
 func (l *treeNodeListener) EnterModule(ctx *gen.ModuleContext) {
 	root := newProgramNode(l.ctx, l.parent)
+	root.pos = tokenPos(ctx.GetStart())
 
 	declarations := ctx.AllDeclaration()
 	for _, declaration := range declarations {
@@ -178,43 +199,54 @@ func (l *treeNodeListener) EnterModule(ctx *gen.ModuleContext) {
 	l.node = root
 }
 
-func parseFunDeclarationImpl(l *treeNodeListener, callNode *funCallNode, ctx *gen.DeclarationContext, inline bool) {
+// parseFunDeclarationImpl parses function body for the call,
+// params have annotated types or types of the call arguments
+func parseFunDeclarationImpl(l *treeNodeListener, callNode *funCallNode, ctx *gen.DeclarationContext, inline bool, sig *funTypes) {
 	// start new scoped context
 	name := ctx.IDENT(0).GetText()
 	scopedContext := newContext(name, l.ctx)
 
 	// get arguments vars
-	argCount := len(ctx.AllIDENT()) - 1
-	args := make([]funArg, argCount)
+	params := ctx.AllFunParam()
+	args := make([]funArg, len(params))
 	actualArgs := callNode.children()
 	if len(args) != len(actualArgs) {
-		reportError("mismatching argument(s)", ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
+		reportError(CodeType, "mismatching argument(s)", ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
 		return
 	}
 
-	for i := 0; i < argCount; i++ {
-		ident := ctx.IDENT(i + 1).GetText()
+	for i, param := range params {
+		token := param.(*gen.FunParamContext).IDENT().GetSymbol()
+		ident := token.GetText()
 
-		theType, err := actualArgs[i].(ExprNodeIf).getType()
-		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.IDENT(i+1).GetSymbol(), ctx.GetRuleContext())
-			return
+		theType := sig.params[i]
+		declared := theType != unknownType
+		if !declared {
+			var err error
+			theType, err = actualArgs[i].(ExprNodeIf).getType()
+			if err != nil {
+				reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+				return
+			}
 		}
 
 		// arguments are variables in a new scope
 		// for inline functions they are set when calling
 		// for regular functions they re popped from the stack inside a function
-		err = scopedContext.newVar(ident, theType)
+		err := scopedContext.newVar(ident, theType)
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.IDENT(i+1).GetSymbol(), ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 			return
 		}
-		args[i] = funArg{ident, theType}
+		scopedContext.declare(ident, ParameterSymbol, theType, tokenPos(token), fmt.Sprintf("let %s: %s", ident, theType))
+		args[i] = funArg{ident, theType, declared}
 	}
 	node := newFunDefNode(scopedContext, l.parent)
+	node.pos = tokenPos(ctx.IDENT(0).GetSymbol())
 	node.name = name
 	node.args = args
 	node.inline = inline
+	node.returns = sig.returns
 
 	// parse function body and add statements as children
 	listener := newTreeNodeListener(scopedContext, node)
@@ -237,11 +269,15 @@ func (l *treeNodeListener) EnterDeclaration(ctx *gen.DeclarationContext) {
 		if ctx.INLINE() != nil {
 			inline = true
 		}
+		sig, ok := l.funTypes(ctx)
+		if !ok {
+			return
+		}
 		// register now and parse it later just before the call
 		defParserCb := func(context *context, callNode *funCallNode, vi *varInfo) *funDefNode {
 			if inline || vi.node == nil {
 				listener := newTreeNodeListener(context, callNode)
-				parseFunDeclarationImpl(listener, callNode, ctx, inline)
+				parseFunDeclarationImpl(listener, callNode, ctx, inline, sig)
 				node := listener.node
 				if node == nil {
 					return nil
@@ -249,74 +285,148 @@ func (l *treeNodeListener) EnterDeclaration(ctx *gen.DeclarationContext) {
 				vi.node = node
 				return node.(*funDefNode)
 			}
-			// otherwise fixup internal variable indices
-			// the trick is to use scratch space slots that are not used yet
-			// in order to guarantee function args do not shadow global/main/parent variables.
-			// non-inline functions use stack for passing arguments, so remapping forward internal vars
-			// on invocation is safe and does not cause any problems because the func ends up using
-			// maximal addresses accross all invocations.
-			// the only problem is it requires remapping all way up to nested functions.
-			defNode := vi.node.(*funDefNode)
-			thisCtx := defNode.ctx
-			parentCtx := callNode.ctx
-			if thisCtx.EntryAddress() < parentCtx.LastAddress() {
-				thisCtx.remapTo(parentCtx.LastAddress())
-
-				var remapRec func(defNode *funDefNode)
-				remapRec = func(defNode *funDefNode) {
-					subfuncs := defNode.ctx.functions
-					for _, funCallExprNode := range subfuncs {
-						thisCtx := funCallExprNode.definition.ctx
-						parentCtx := thisCtx.parent
-						if thisCtx.EntryAddress() < parentCtx.LastAddress() {
-							thisCtx.remapTo(parentCtx.LastAddress())
-						}
-						remapRec(funCallExprNode.definition)
-					}
-				}
-
-				remapRec(defNode)
-			}
-			return defNode
+			// non-inline functions are parsed once, scratch slots are assigned after parsing
+			return vi.node.(*funDefNode)
 		}
 		err := l.ctx.newFunc(name, unknownType, defParserCb)
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.FUNC().GetSymbol(), ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.FUNC().GetSymbol(), ctx.GetRuleContext())
 			return
 		}
+		args := make([]string, 0, len(sig.params))
+		for i, param := range ctx.AllFunParam() {
+			arg := param.(*gen.FunParamContext).IDENT().GetText()
+			if sig.params[i] != unknownType {
+				arg = fmt.Sprintf("%s: %s", arg, sig.params[i])
+			}
+			args = append(args, arg)
+		}
+		funType := unknownType
+		if len(sig.returns) == 1 {
+			funType = sig.returns[0]
+		}
+		l.ctx.declare(name, FunctionSymbol, funType, tokenPos(ctx.IDENT(0).GetSymbol()), funSignature(name, args, sig.returns, inline))
+	} else if def := ctx.StructDef(); def != nil {
+		def.EnterRule(l)
 	} else if fun := ctx.IMPORT(); fun != nil {
 		moduleName := ctx.MODULENAME().GetText()
 		tree, err := parseModule(moduleName, l.parseCtx, l.parent, l.ctx)
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.MODULENAME().GetSymbol(), ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.MODULENAME().GetSymbol(), ctx.GetRuleContext())
 			return
 		}
 		if tree == nil {
 			reportError(
-				fmt.Sprintf("module %s parsing failed", moduleName),
+				CodeModule, fmt.Sprintf("module %s parsing failed", moduleName),
 				ctx.GetParser(), ctx.MODULENAME().GetSymbol(), ctx.GetRuleContext(),
 			)
 			return
 		}
-		// Modules contains only functions and constants
+		l.ctx.imported(moduleName, tokenPos(ctx.MODULENAME().GetSymbol()))
+		// Modules contains only functions, constants and structs
 		// and these are registered in the context and are already in AST.
-		// So only need to check that children nodes are constants and func defs
+		// So only need to check that children nodes are constants, func and struct defs
 		for _, ch := range tree.children() {
 			switch ch.(type) {
-			case *constNode, *funDefNode:
+			case *constNode, *funDefNode, *structDefNode:
 				continue
 			default:
-				msg := fmt.Sprintf("module %s has %s but can only hold constants and functions", moduleName, ch.String())
-				reportError(msg, ctx.GetParser(), ctx.FUNC().GetSymbol(), ctx.GetRuleContext())
+				msg := fmt.Sprintf("module %s has %s but can only hold constants, functions and structs", moduleName, ch.String())
+				reportError(CodeModule, msg, ctx.GetParser(), ctx.FUNC().GetSymbol(), ctx.GetRuleContext())
 			}
 		}
 	}
 }
 
+// funTypes holds annotated types of function params and return values,
+// not annotated params have unknown type
+type funTypes struct {
+	params  []exprType
+	returns []exprType
+}
+
+// funTypes resolves type annotations of the function declaration
+func (l *treeNodeListener) funTypes(ctx *gen.DeclarationContext) (*funTypes, bool) {
+	sig := new(funTypes)
+	for _, param := range ctx.AllFunParam() {
+		theType := unknownType
+		if typeName := param.(*gen.FunParamContext).TypeName(); typeName != nil {
+			var err error
+			theType, err = typeFromName(l.ctx, typeName)
+			if err != nil {
+				reportError(errorCode(err), err.Error(), ctx.GetParser(), typeName.GetStart(), ctx.GetRuleContext())
+				return nil, false
+			}
+		}
+		sig.params = append(sig.params, theType)
+	}
+	for _, typeName := range ctx.AllTypeName() {
+		theType, err := typeFromName(l.ctx, typeName)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), typeName.GetStart(), ctx.GetRuleContext())
+			return nil, false
+		}
+		sig.returns = append(sig.returns, theType)
+	}
+	return sig, true
+}
+
+// typeFromName resolves type annotation: uint64, bytes or byte[] and structs declared before
+func typeFromName(ctx *context, typeName gen.ITypeNameContext) (exprType, error) {
+	tn := typeName.(*gen.TypeNameContext)
+	name := tn.IDENT().GetText()
+	if tn.LEFTSQUARE() != nil {
+		if name == "byte" {
+			return bytesType, nil
+		}
+		return invalidType, errorf(CodeType, "unknown type %s[]", name)
+	}
+	switch name {
+	case intType.String():
+		return intType, nil
+	case "bytes":
+		return bytesType, nil
+	}
+	if _, err := ctx.lookupStruct(structType(name)); err != nil {
+		return invalidType, errorf(CodeType, "unknown type %s", name)
+	}
+	return structType(name), nil
+}
+
+// annotate checks the value against the type annotation.
+// Values of unknown type get the annotated type by a type cast that AssertTypes turns into a runtime check
+func annotate(ctx *context, parent TreeNodeIf, value ExprNodeIf, theType exprType, what string) (ExprNodeIf, error) {
+	valueType, err := value.getType()
+	if err != nil {
+		return nil, err
+	}
+	if valueType == theType {
+		return value, nil
+	}
+	if valueType != unknownType {
+		return nil, errorf(CodeType, "incompatible types: (%s) %s vs %s (expr)", what, theType, valueType)
+	}
+
+	node := newTypeCastExprNode(ctx, parent, theType)
+	node.pos = value.position()
+	node.expr = value
+	if def, err := ctx.lookupStruct(theType); err == nil {
+		ctx.addUintLiteral(def.size)
+	}
+	for p := parent; p != nil; p = p.parent() {
+		if prog, ok := p.(*programNode); ok {
+			prog.annotations = append(prog.annotations, node)
+			break
+		}
+	}
+	return node, nil
+}
+
 func (l *treeNodeListener) EnterMain(ctx *gen.MainContext) {
 	scopedContext := newContext("main", l.ctx)
 
 	node := newFunDefNode(scopedContext, l.parent)
+	node.pos = tokenPos(ctx.FUNC().GetSymbol())
 	node.name = mainFuncName
 
 	listener := newTreeNodeListener(scopedContext, node)
@@ -329,122 +439,367 @@ func (l *treeNodeListener) EnterMain(ctx *gen.MainContext) {
 	ctx.Block().ExitRule(listener)
 }
 
-func (l *treeNodeListener) EnterDeclareVar(ctx *gen.DeclareVarContext) {
-	ident := ctx.IDENT().GetText()
-	listener := newExprListener(l.ctx, l.parent)
-	ctx.Expr().EnterRule(listener)
-	exprNode := listener.getExpr()
+func (l *treeNodeListener) EnterContract(ctx *gen.ContractContext) {
+	scopedContext := newContext("main", l.ctx)
 
-	varType, err := exprNode.getType()
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
-		return
+	main := newFunDefNode(scopedContext, l.parent)
+	main.pos = tokenPos(ctx.CONTRACT().GetSymbol())
+	main.name = mainFuncName
+
+	node := newContractNode(scopedContext, main, ctx.IDENT().GetText())
+	node.pos = tokenPos(ctx.IDENT().GetSymbol())
+	node.value = newRuntimeFieldNode(scopedContext, node, "txna", "ApplicationArgs", "0")
+
+	handled := make(map[string]bool)
+	for _, member := range ctx.AllContractMember() {
+		switch member := member.(type) {
+		case *gen.AbiMethodContext:
+			if !l.parseAbiMethod(node, member) {
+				return
+			}
+		case *gen.BareCallContext:
+			if !l.parseBareCall(node, member, handled) {
+				return
+			}
+		}
 	}
+	main.append(node)
+	l.node = main
+}
 
-	err = l.ctx.newVar(ident, varType)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
-		return
+// parseAbiMethod parses ARC-4 method of the contract, arguments are variables of the method scope
+func (l *treeNodeListener) parseAbiMethod(node *contractNode, ctx *gen.AbiMethodContext) bool {
+	name := ctx.IDENT().GetText()
+	scopedContext := newContext(name, node.ctx)
+
+	method := &abiMethod{name: name}
+	def := newFunDefNode(scopedContext, node)
+	def.pos = tokenPos(ctx.IDENT().GetSymbol())
+	def.name = name
+	def.method = method
+	def.returns = []exprType{}
+
+	params := ctx.AllAbiParam()
+	if len(params) > maxAbiArgs {
+		reportError(
+			CodeSemantic, fmt.Sprintf("method %s has %d arguments but at most %d are supported, ARC-4 packing of the rest into the last application arg is not implemented, pass a struct instead", name, len(params), maxAbiArgs),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return false
 	}
+	for _, param := range params {
+		paramCtx := param.(*gen.AbiParamContext)
+		token := paramCtx.IDENT().GetSymbol()
+		ident := token.GetText()
+		theType, err := l.abiType(paramCtx.AbiType(), true)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), paramCtx.AbiType().GetStart(), ctx.GetRuleContext())
+			return false
+		}
+		for _, value := range theType.decodeLiterals() {
+			scopedContext.addUintLiteral(value)
+		}
 
-	node := newVarDeclNode(l.ctx, l.parent, ident, exprNode)
-	l.node = node
+		// arguments are decoded from application args and stored before the method body
+		valueType := theType.valueType()
+		err = scopedContext.newVar(ident, valueType)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+			return false
+		}
+		scopedContext.declare(ident, ParameterSymbol, valueType, tokenPos(token), fmt.Sprintf("let %s: %s", ident, theType))
+		def.args = append(def.args, funArg{ident, valueType, true})
+		method.args = append(method.args, theType)
+	}
+	if ret := ctx.AbiType(); ret != nil {
+		theType, err := l.abiType(ret, false)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ret.GetStart(), ctx.GetRuleContext())
+			return false
+		}
+		for _, value := range theType.encodeLiterals() {
+			scopedContext.addUintLiteral(value)
+		}
+		scopedContext.addLiteral(bytesLiteral(abiReturnPrefix), bytesType)
+		method.returns = theType
+		def.returns = []exprType{theType.valueType()}
+	}
+
+	selector := bytesLiteral(method.selector())
+	scopedContext.addLiteral(selector, bytesType)
+	if _, err := node.addCase([]ExprNodeIf{newExprLiteralNode(scopedContext, node, bytesType, selector)}); err != nil {
+		reportError(
+			CodeRedeclared, fmt.Sprintf("method %s is already declared", method.signature()),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return false
+	}
+
+	listener := newTreeNodeListener(scopedContext, def)
+	ctx.Block().EnterRule(listener)
+	blockNode := listener.getNode()
+	for _, stmt := range blockNode.children() {
+		def.append(stmt)
+	}
+	ctx.Block().ExitRule(listener)
+
+	if method.returns != nil && !ensureBlockReturns(def) {
+		reportError(
+			CodeControlFlow, fmt.Sprintf("method %s does not return", name),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return false
+	}
+	node.methods = append(node.methods, def)
+	node.append(def)
+	return true
 }
 
-func (l *treeNodeListener) EnterDeclareVarTupleExpr(ctx *gen.DeclareVarTupleExprContext) {
-	identHigh := ctx.IDENT(0).GetText()
-	identLow := ctx.IDENT(1).GetText()
-	listener := newExprListener(l.ctx, l.parent)
-	ctx.TupleExpr().EnterRule(listener)
-	exprNode := listener.getExpr()
+// parseBareCall parses handler of the calls without arguments, every action can be handled once
+func (l *treeNodeListener) parseBareCall(node *contractNode, ctx *gen.BareCallContext, handled map[string]bool) bool {
+	call := bareCall{pos: tokenPos(ctx.BARE().GetSymbol())}
+	for _, ident := range ctx.AllIDENT() {
+		action := ident.GetText()
+		value, ok := abiBareActions[action]
+		if !ok {
+			reportError(
+				CodeSemantic, fmt.Sprintf("unknown bare call action %s, expected one of %s", action, strings.Join(abiBareActionNames, ", ")),
+				ctx.GetParser(), ident.GetSymbol(), ctx.GetRuleContext(),
+			)
+			return false
+		}
+		if handled[action] {
+			reportError(
+				CodeRedeclared, fmt.Sprintf("bare call action %s is already handled", action),
+				ctx.GetParser(), ident.GetSymbol(), ctx.GetRuleContext(),
+			)
+			return false
+		}
+		handled[action] = true
+		node.ctx.addUintLiteral(uint(value))
+		call.actions = append(call.actions, action)
+	}
 
-	hType, lType, err := exprNode.(*funCallNode).getTypeTuple()
-	if err != nil {
+	listener := newTreeNodeListener(newContext("bare", node.ctx), node)
+	ctx.Block().EnterRule(listener)
+	call.body = listener.getNode()
+	node.bare = append(node.bare, call)
+	node.append(call.body)
+	return true
+}
+
+// abiType returns ARC-4 type of the type expression, reference types can only be method arguments
+func (l *treeNodeListener) abiType(typeCtx gen.IAbiTypeContext, argument bool) (*abiType, error) {
+	tc := typeCtx.(*gen.AbiTypeContext)
+	var t *abiType
+	if ident := tc.IDENT(); ident != nil {
+		name := ident.GetText()
+		t = abiTypeFromName(name)
+		if t == nil {
+			def, err := l.ctx.lookupStruct(structType(name))
+			if err != nil {
+				return nil, errorf(CodeType, "unknown ABI type %s", name)
+			}
+			t = abiStructType(l.ctx, def)
+		}
+	} else {
+		t = &abiType{kind: abiTuple}
+		for _, field := range tc.AllAbiType() {
+			fieldType, err := l.abiType(field, false)
+			if err != nil {
+				return nil, err
+			}
+			t.fields = append(t.fields, fieldType)
+		}
+	}
+
+	arrays := tc.AllAbiArray()
+	if t.reference() && (!argument || len(arrays) > 0) {
+		return nil, errorf(CodeType, "%s type can only be a method argument", t)
+	}
+	for _, array := range arrays {
+		arrayCtx := array.(*gen.AbiArrayContext)
+		if arrayCtx.NUMBER() == nil {
+			t = &abiType{kind: abiDynamicArray, elem: t}
+			continue
+		}
+		length, err := strconv.ParseUint(arrayCtx.NUMBER().GetText(), 0, 64)
+		if err != nil || length > maxStructSize {
+			return nil, errorf(CodeType, "array length must be in range [0, %d]", maxStructSize)
+		}
+		t = &abiType{kind: abiStaticArray, elem: t, length: uint(length)}
+	}
+	return t, nil
+}
+
+// maxStructSize is the maximum length of TEAL byte arrays
+const maxStructSize = 4096
+
+func (l *treeNodeListener) EnterStructDef(ctx *gen.StructDefContext) {
+	name := ctx.IDENT().GetText()
+	switch name {
+	case intType.String(), "byte", invalidType.String(), unknownType.String():
+		reportError(CodeSemantic, fmt.Sprintf("struct name '%s' is reserved", name), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		return
+	}
+
+	node := newStructDefNode(l.ctx, l.parent, name)
+	node.pos = tokenPos(ctx.IDENT().GetSymbol())
+	for _, field := range ctx.AllStructField() {
+		fieldCtx := field.(*gen.StructFieldContext)
+		theType, size, err := l.structFieldType(fieldCtx)
+		if err == nil {
+			err = node.addField(fieldCtx.IDENT(0).GetText(), theType, size)
+		}
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), fieldCtx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
+			return
+		}
+	}
+	if node.size > maxStructSize {
 		reportError(
-			err.Error(), ctx.GetParser(),
-			ctx.TupleExpr().GetParser().GetCurrentToken(), ctx.GetRuleContext(),
+			CodeType, fmt.Sprintf("struct %s is %d bytes long but byte arrays are limited to %d", name, node.size, maxStructSize),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
 	}
 
-	err = l.ctx.newVar(identLow, lType)
+	err := l.ctx.newStruct(node)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
-	err = l.ctx.newVar(identHigh, hType)
+	l.ctx.declare(name, StructSymbol, structType(name), node.pos, node.String())
+	l.node = node
+}
+
+// structFieldType returns type and packed size of the field: uint64, byte[N] or a struct declared before
+func (l *treeNodeListener) structFieldType(ctx *gen.StructFieldContext) (exprType, uint, error) {
+	name := ctx.IDENT(0).GetText()
+	typeName := ctx.IDENT(1).GetText()
+	if typeName == "byte" {
+		if ctx.NUMBER() == nil {
+			return invalidType, 0, errorf(CodeType, "field %s must have fixed length byte[N]", name)
+		}
+		size, err := strconv.ParseUint(ctx.NUMBER().GetText(), 0, 64)
+		if err != nil || size == 0 || size > maxStructSize {
+			return invalidType, 0, errorf(CodeType, "field %s length must be in range [1, %d]", name, maxStructSize)
+		}
+		return bytesType, uint(size), nil
+	}
+	if ctx.NUMBER() != nil {
+		return invalidType, 0, errorf(CodeType, "field %s of type %s can not have length", name, typeName)
+	}
+	if typeName == intType.String() {
+		return intType, 8, nil
+	}
+	def, err := l.ctx.lookupStruct(structType(typeName))
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
-		return
+		return invalidType, 0, errorf(CodeType, "field %s has unknown type %s", name, typeName)
 	}
+	return structType(def.name), def.size, nil
+}
 
-	remhighctx := ctx.IDENT(2)
-	remlowctx := ctx.IDENT(3)
-	if remlowctx != nil && remhighctx != nil {
-		remhigh := remhighctx.GetText()
-		remlow := remlowctx.GetText()
+func (l *treeNodeListener) EnterDeclareVar(ctx *gen.DeclareVarContext) {
+	ident := ctx.IDENT().GetText()
+	listener := newExprListener(l.ctx, l.parent)
+	ctx.Expr().EnterRule(listener)
+	exprNode := listener.getExpr()
 
-		err = l.ctx.newVar(remlow, lType)
+	if typeName := ctx.TypeName(); typeName != nil {
+		theType, err := typeFromName(l.ctx, typeName)
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.IDENT(3).GetSymbol(), ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), typeName.GetStart(), ctx.GetRuleContext())
 			return
 		}
-		err = l.ctx.newVar(remhigh, hType)
+		exprNode, err = annotate(l.ctx, l.parent, exprNode, theType, "var")
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), ctx.IDENT(2).GetSymbol(), ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+			return
+		}
+	}
+
+	varType, err := exprNode.getType()
+	if err != nil {
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		return
+	}
+
+	if ctx.AT() != nil {
+		// explicitly reserved slot, for example for sharing with other programs by gload
+		if l.ctx.parent != nil {
+			reportError(CodeScratch, "scratch slot can be reserved only for global variables", ctx.GetParser(), ctx.AT().GetSymbol(), ctx.GetRuleContext())
 			return
 		}
-		node := newVarDeclDivmodwTupleNode(l.ctx, l.parent, identLow, identHigh, remlow, remhigh, exprNode)
-		l.node = node
+		address, err := strconv.ParseUint(ctx.NUMBER().GetText(), 0, 64)
+		if err != nil || address >= maxScratchSlots {
+			reportError(CodeScratch, fmt.Sprintf("scratch slot must be in range [0, %d)", maxScratchSlots), ctx.GetParser(), ctx.NUMBER().GetSymbol(), ctx.GetRuleContext())
+			return
+		}
+		err = l.ctx.newReservedVar(ident, varType, uint(address))
 	} else {
-		node := newVarDeclTupleNode(l.ctx, l.parent, identLow, identHigh, exprNode)
-		l.node = node
+		err = l.ctx.newVar(ident, varType)
+	}
+	if err != nil {
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		return
 	}
 
-}
+	l.ctx.declare(ident, VariableSymbol, varType, tokenPos(ctx.IDENT().GetSymbol()), fmt.Sprintf("let %s: %s", ident, varType))
+	if ctx.AT() != nil {
+		l.ctx.keep(ident)
+	}
 
-func (l *treeNodeListener) EnterDeclareQuadrupleExpr(ctx *gen.DeclareQuadrupleExprContext) {
-	identHigh := ctx.IDENT(0).GetText()
-	identLow := ctx.IDENT(1).GetText()
-	remHigh := ctx.IDENT(2).GetText()
-	remLow := ctx.IDENT(3).GetText()
+	node := newVarDeclNode(l.ctx, l.parent, ident, exprNode)
+	node.pos = tokenPos(ctx.IDENT().GetSymbol())
+	l.node = node
+}
 
+func (l *treeNodeListener) EnterDeclareVarTupleExpr(ctx *gen.DeclareVarTupleExprContext) {
 	listener := newExprListener(l.ctx, l.parent)
 	ctx.TupleExpr().EnterRule(listener)
 	exprNode := listener.getExpr()
-
-	hType, lType, rhType, rlType, err := exprNode.(*funCallNode).getTypeQuadruple()
-	if err != nil {
-		reportError(
-			err.Error(), ctx.GetParser(),
-			ctx.TupleExpr().GetParser().GetCurrentToken(), ctx.GetRuleContext(),
-		)
+	if exprNode == nil {
 		return
 	}
 
-	err = l.ctx.newVar(identLow, lType)
+	idents := ctx.AllIDENT()
+	types, err := tupleTypes(exprNode, len(idents))
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.EQ().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
-	err = l.ctx.newVar(identHigh, hType)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
-		return
+
+	names := make([]string, len(idents))
+	for i, ident := range idents {
+		names[i] = ident.GetText()
+		err = l.ctx.newVar(names[i], types[i])
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ident.GetSymbol(), ctx.GetRuleContext())
+			return
+		}
 	}
-	err = l.ctx.newVar(remLow, rlType)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(3).GetSymbol(), ctx.GetRuleContext())
-		return
+
+	node := newDestructuringNode(l.ctx, l.parent, names, true)
+	node.pos = tokenPos(ctx.IDENT(0).GetSymbol())
+	node.value = exprNode
+	l.node = node
+}
+
+// tupleTypes returns types of values of the tuple expression ensuring it produces count values
+func tupleTypes(exprNode ExprNodeIf, count int) ([]exprType, error) {
+	call, ok := exprNode.(*funCallNode)
+	if !ok {
+		return nil, errorf(CodeType, "expression does not return multiple values")
 	}
-	err = l.ctx.newVar(remHigh, rhType)
+	types, err := call.getTypes()
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(2).GetSymbol(), ctx.GetRuleContext())
-		return
+		return nil, err
 	}
-
-	node := newVarDeclDivmodwTupleNode(l.ctx, l.parent, identLow, identHigh, remLow, remHigh, exprNode)
-	l.node = node
+	if len(types) != count {
+		return nil, errorf(CodeType, "assignment mismatch: %d variables but %s returns %d values", count, call.name, len(types))
+	}
+	return types, nil
 }
 
 func (l *treeNodeListener) EnterDeclareNumberConst(ctx *gen.DeclareNumberConstContext) {
@@ -452,11 +807,13 @@ func (l *treeNodeListener) EnterDeclareNumberConst(ctx *gen.DeclareNumberConstCo
 	varValue := ctx.NUMBER().GetText()
 
 	node := newConstNode(l.ctx, l.parent, varName, varValue, intType)
+	node.pos = tokenPos(ctx.GetStart())
 	err := l.ctx.newConst(varName, intType, &varValue)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
+	l.ctx.declare(varName, ConstantSymbol, intType, tokenPos(ctx.IDENT().GetSymbol()), fmt.Sprintf("const %s = %s", varName, varValue))
 	l.node = node
 }
 
@@ -465,22 +822,35 @@ func (l *treeNodeListener) EnterDeclareStringConst(ctx *gen.DeclareStringConstCo
 	varValue := ctx.STRING().GetText()
 
 	node := newConstNode(l.ctx, l.parent, varName, varValue, bytesType)
+	node.pos = tokenPos(ctx.GetStart())
 	err := l.ctx.newConst(varName, bytesType, &varValue)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
+	l.ctx.declare(varName, ConstantSymbol, bytesType, tokenPos(ctx.IDENT().GetSymbol()), fmt.Sprintf("const %s = %s", varName, varValue))
 	l.node = node
 }
 
 func (l *treeNodeListener) EnterBlock(ctx *gen.BlockContext) {
 	block := newBlockNode(l.ctx, l.parent)
+	block.pos = tokenPos(ctx.GetStart())
 	statements := ctx.AllStatement()
+	// statements after return or error, only the first one is reported
+	terminated, unreachable := false, false
 	for _, stmt := range statements {
 		l := newTreeNodeListener(l.ctx, block)
 		stmt.EnterRule(l)
 		node := l.getNode()
 		if node != nil {
+			if terminated && !unreachable {
+				l.ctx.warnings.warn(warnUnreachable, tokenPos(stmt.GetStart()), "unreachable statement")
+				unreachable = true
+			}
+			switch node.(type) {
+			case *returnNode, *errorNode:
+				terminated = true
+			}
 			block.append(node)
 		}
 		stmt.ExitRule(l)
@@ -508,9 +878,12 @@ func (l *treeNodeListener) EnterStatement(ctx *gen.StatementContext) {
 
 func (l *treeNodeListener) EnterTermReturn(ctx *gen.TermReturnContext) {
 	node := newReturnNode(l.ctx, l.parent)
-	listener := newExprListener(l.ctx, node)
-	ctx.Expr().EnterRule(listener)
-	node.value = listener.getExpr()
+	node.pos = tokenPos(ctx.RET().GetSymbol())
+	for _, expr := range ctx.AllExpr() {
+		listener := newExprListener(l.ctx, node)
+		expr.EnterRule(listener)
+		node.values = append(node.values, listener.getExpr())
+	}
 	l.node = node
 
 	parent := node.parent()
@@ -526,16 +899,44 @@ func (l *treeNodeListener) EnterTermReturn(ctx *gen.TermReturnContext) {
 
 	if definition == nil {
 		reportError(
-			"return without enclosing function",
+			CodeControlFlow, "return without enclosing function",
 			ctx.GetParser(), ctx.RET().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
 	}
 	node.definition = definition
+
+	if len(node.values) == 0 && definition.method == nil {
+		reportError(
+			CodeControlFlow, "return without a value is allowed only in void methods",
+			ctx.GetParser(), ctx.RET().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return
+	}
+	if definition.returns == nil {
+		return
+	}
+	if len(node.values) != len(definition.returns) {
+		reportError(
+			CodeControlFlow, fmt.Sprintf("return values number mismatch: %d vs %d declared", len(node.values), len(definition.returns)),
+			ctx.GetParser(), ctx.RET().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return
+	}
+	for i, value := range node.values {
+		checked, err := annotate(l.ctx, node, value, definition.returns[i], "return")
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.Expr(i).GetStart(), ctx.GetRuleContext())
+			return
+		}
+		node.values[i] = checked
+	}
 }
 
 func (l *treeNodeListener) EnterTermError(ctx *gen.TermErrorContext) {
-	l.node = newErorrNode(l.ctx, l.parent)
+	node := newErorrNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
+	l.node = node
 }
 
 func (l *treeNodeListener) EnterTermAssert(ctx *gen.TermAssertContext) {
@@ -543,13 +944,14 @@ func (l *treeNodeListener) EnterTermAssert(ctx *gen.TermAssertContext) {
 
 	listener := newExprListener(l.ctx, l.parent)
 	exprNode := listener.funCallEnterImpl(name, []gen.IExprContext{ctx.Expr()})
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	_, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		parser := ctx.GetParser()
 		token := ctx.Expr().GetStart()
 		rule := ctx.GetRuleContext()
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
 		return
 	}
 
@@ -559,6 +961,7 @@ func (l *treeNodeListener) EnterTermAssert(ctx *gen.TermAssertContext) {
 func (l *treeNodeListener) EnterInnerTxnAssign(ctx *gen.InnerTxnAssignContext) {
 	field := ctx.TXNFIELD().GetText()
 	node := newAssignInnerTxnNode(l.ctx, l.parent, field)
+	node.pos = tokenPos(ctx.GetStart())
 	listener := newExprListener(l.ctx, node)
 	ctx.Expr().EnterRule(listener)
 	rhs := listener.getExpr()
@@ -566,7 +969,7 @@ func (l *treeNodeListener) EnterInnerTxnAssign(ctx *gen.InnerTxnAssignContext) {
 	rhsType, err := rhs.getType()
 	if err != nil {
 		reportError(
-			fmt.Sprintf("failed type resolution type: %s", err.Error()),
+			CodeType, fmt.Sprintf("failed type resolution type: %s", err.Error()),
 			ctx.GetParser(), ctx.TXNFIELD().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
@@ -574,14 +977,14 @@ func (l *treeNodeListener) EnterInnerTxnAssign(ctx *gen.InnerTxnAssignContext) {
 	exprType, err := runtimeFieldTypeFromSpec("txn", field)
 	if err != nil {
 		reportError(
-			fmt.Sprintf("failed to retrieve type of field %s: %s", field, err.Error()),
+			CodeType, fmt.Sprintf("failed to retrieve type of field %s: %s", field, err.Error()),
 			ctx.GetParser(), ctx.TXNFIELD().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
 	}
 	if exprType != rhsType {
 		reportError(
-			fmt.Sprintf("incompatible types: (lhs) %s vs %s (expr)", exprType, rhsType),
+			CodeType, fmt.Sprintf("incompatible types: (lhs) %s vs %s (expr)", exprType, rhsType),
 			ctx.GetParser(), ctx.TXNFIELD().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
@@ -590,11 +993,15 @@ func (l *treeNodeListener) EnterInnerTxnAssign(ctx *gen.InnerTxnAssignContext) {
 }
 
 func (l *treeNodeListener) EnterInnerTxnBegin(ctx *gen.InnerTxnBeginContext) {
-	l.node = newInnertxnBeginNode(l.ctx, l.parent)
+	node := newInnertxnBeginNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
+	l.node = node
 }
 
 func (l *treeNodeListener) EnterInnerTxnEnd(ctx *gen.InnerTxnEndContext) {
-	l.node = newInnertxnEndNode(l.ctx, l.parent)
+	node := newInnertxnEndNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
+	l.node = node
 }
 
 func (l *treeNodeListener) EnterDoLog(ctx *gen.DoLogContext) {
@@ -602,25 +1009,60 @@ func (l *treeNodeListener) EnterDoLog(ctx *gen.DoLogContext) {
 
 	listener := newExprListener(l.ctx, l.parent)
 	exprNode := listener.funCallEnterImpl(name, []gen.IExprContext{ctx.Expr()})
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	_, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		parser := ctx.GetParser()
 		token := ctx.Expr().GetStart()
 		rule := ctx.GetRuleContext()
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
 		return
 	}
 
 	l.node = exprNode
 }
 
+// enclosingLoop returns the innermost loop in the current function the node belongs to
+func enclosingLoop(node TreeNodeIf) *forStatementNode {
+	for ; node != nil; node = node.parent() {
+		switch tt := node.(type) {
+		case *forStatementNode:
+			return tt
+		case *funDefNode:
+			return nil
+		}
+	}
+	return nil
+}
+
 func (l *treeNodeListener) EnterBreak(ctx *gen.BreakContext) {
-	l.node = newBreakNode(l.ctx, l.parent)
+	loop := enclosingLoop(l.parent)
+	if loop == nil {
+		reportError(CodeControlFlow, "break outside of a loop", ctx.GetParser(), ctx.BREAK().GetSymbol(), ctx.GetRuleContext())
+		return
+	}
+	node := newBreakNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.BREAK().GetSymbol())
+	node.loop = loop
+	l.node = node
+}
+
+func (l *treeNodeListener) EnterContinue(ctx *gen.ContinueContext) {
+	loop := enclosingLoop(l.parent)
+	if loop == nil {
+		reportError(CodeControlFlow, "continue outside of a loop", ctx.GetParser(), ctx.CONTINUE().GetSymbol(), ctx.GetRuleContext())
+		return
+	}
+	node := newContinueNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.CONTINUE().GetSymbol())
+	node.loop = loop
+	l.node = node
 }
 
 func (l *treeNodeListener) EnterIfStatement(ctx *gen.IfStatementContext) {
 	node := newIfStatementNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
 
 	exprlistener := newExprListener(l.ctx, node)
 	ctx.CondIfExpr().EnterRule(exprlistener)
@@ -653,17 +1095,73 @@ func (l *treeNodeListener) EnterIfStatementFalse(ctx *gen.IfStatementFalseContex
 	l.node = blockNode
 }
 
+func (l *treeNodeListener) EnterSwitchStatement(ctx *gen.SwitchStatementContext) {
+	node := newSwitchStatementNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
+
+	exprlistener := newExprListener(l.ctx, node)
+	ctx.Expr().EnterRule(exprlistener)
+	node.value = exprlistener.getExpr()
+	if node.value == nil {
+		return
+	}
+
+	for _, caseCtx := range ctx.AllSwitchCase() {
+		caseCtx := caseCtx.(*gen.SwitchCaseContext)
+		if !parseSwitchCase(l.ctx, node, &node.switchCases, caseCtx.AllExpr(), ctx.GetParser(), ctx.GetRuleContext()) {
+			return
+		}
+		listener := newTreeNodeListener(newContext("case", l.ctx), node)
+		caseCtx.Block().EnterRule(listener)
+		node.append(listener.getNode())
+	}
+
+	if ctx.DEFAULT() != nil {
+		node.hasDefault = true
+		listener := newTreeNodeListener(newContext("default", l.ctx), node)
+		ctx.Block().EnterRule(listener)
+		node.append(listener.getNode())
+	}
+	l.node = node
+}
+
+// parseSwitchCase parses values of the case and adds them to the switch cases
+func parseSwitchCase(ctx *context, parent TreeNodeIf, cases *switchCases, exprs []gen.IExprContext, parser antlr.Parser, rule antlr.RuleContext) bool {
+	values := make([]ExprNodeIf, len(exprs))
+	for i, expr := range exprs {
+		listener := newExprListener(ctx, parent)
+		expr.EnterRule(listener)
+		values[i] = listener.getExpr()
+		if values[i] == nil {
+			return false
+		}
+	}
+	if errPos, err := cases.addCase(values); err != nil {
+		token := exprs[0].GetStart()
+		if errPos >= 0 {
+			token = exprs[errPos].GetStart()
+		}
+		reportError(errorCode(err), err.Error(), parser, token, rule)
+		return false
+	}
+	return true
+}
+
 func getVarInfoForAssignment(ident string, ctx *context) (varInfo, error) {
 	info, err := ctx.lookup(ident)
 	if err != nil {
 		return varInfo{}, err
 	}
 	if info.constant() {
-		return varInfo{}, fmt.Errorf("cannot assign to a constant")
+		return varInfo{}, errorf(CodeSemantic, "cannot assign to a constant")
 	}
 
 	if info.function() {
-		return varInfo{}, fmt.Errorf("cannot assign to a function")
+		return varInfo{}, errorf(CodeSemantic, "cannot assign to a function")
+	}
+
+	if info.structure() {
+		return varInfo{}, errorf(CodeSemantic, "cannot assign to a struct")
 	}
 
 	return info, nil
@@ -671,12 +1169,28 @@ func getVarInfoForAssignment(ident string, ctx *context) (varInfo, error) {
 
 func (l *treeNodeListener) EnterForStatement(ctx *gen.ForStatementContext) {
 	node := newForStatementNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
 
-	exprlistener := newExprListener(l.ctx, node)
+	// variables declared in loop header are visible in the loop only
+	scopedContextHeader := newContext("for", l.ctx)
+
+	if ctx.ForInit() != nil {
+		listener := newTreeNodeListener(scopedContextHeader, node)
+		ctx.ForInit().EnterRule(listener)
+		node.init = listener.getNode()
+	}
+
+	exprlistener := newExprListener(scopedContextHeader, node)
 	ctx.CondForExpr().EnterRule(exprlistener)
 	node.condExpr = exprlistener.getExpr()
 
-	scopedContextTrue := newContext("for", l.ctx)
+	if ctx.ForStep() != nil {
+		listener := newTreeNodeListener(scopedContextHeader, node)
+		ctx.ForStep().EnterRule(listener)
+		node.step = listener.getNode()
+	}
+
+	scopedContextTrue := newContext("for", scopedContextHeader)
 
 	listener := newTreeNodeListener(scopedContextTrue, node)
 	ctx.CondTrueBlock().EnterRule(listener)
@@ -684,15 +1198,29 @@ func (l *treeNodeListener) EnterForStatement(ctx *gen.ForStatementContext) {
 	l.node = node
 }
 
+func (l *treeNodeListener) EnterForInit(ctx *gen.ForInitContext) {
+	if ctx.Decl() != nil {
+		ctx.Decl().EnterRule(l)
+	} else if ctx.Assignment() != nil {
+		ctx.Assignment().EnterRule(l)
+	}
+}
+
+func (l *treeNodeListener) EnterForStep(ctx *gen.ForStepContext) {
+	ctx.Assignment().EnterRule(l)
+}
+
 func (l *treeNodeListener) EnterAssign(ctx *gen.AssignContext) {
 	ident := ctx.IDENT().GetSymbol().GetText()
 	info, err := getVarInfoForAssignment(ident, l.ctx)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
 
 	node := newAssignNode(l.ctx, l.parent, ident)
+	node.pos = tokenPos(ctx.GetStart())
+	l.ctx.assignment(ident, node.pos)
 	listener := newExprListener(l.ctx, node)
 	ctx.Expr().EnterRule(listener)
 	rhs := listener.getExpr()
@@ -700,14 +1228,14 @@ func (l *treeNodeListener) EnterAssign(ctx *gen.AssignContext) {
 	rhsType, err := rhs.getType()
 	if err != nil {
 		reportError(
-			fmt.Sprintf("failed type resolution type: %s", err.Error()),
+			CodeType, fmt.Sprintf("failed type resolution type: %s", err.Error()),
 			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
 	}
 	if info.theType != rhsType {
 		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", info.theType, rhsType),
+			CodeType, fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", info.theType, rhsType),
 			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
@@ -716,119 +1244,93 @@ func (l *treeNodeListener) EnterAssign(ctx *gen.AssignContext) {
 }
 
 func (l *treeNodeListener) EnterAssignTuple(ctx *gen.AssignTupleContext) {
-	identHigh := ctx.IDENT(0).GetSymbol().GetText()
-	infoHigh, err := getVarInfoForAssignment(identHigh, l.ctx)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
-		return
-	}
-
-	identLow := ctx.IDENT(1).GetSymbol().GetText()
-	infoLow, err := getVarInfoForAssignment(identLow, l.ctx)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext())
-		return
+	idents := ctx.AllIDENT()
+	names := make([]string, len(idents))
+	infos := make([]varInfo, len(idents))
+	for i, ident := range idents {
+		names[i] = ident.GetText()
+		info, err := getVarInfoForAssignment(names[i], l.ctx)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), ident.GetSymbol(), ctx.GetRuleContext())
+			return
+		}
+		infos[i] = info
 	}
 
-	node := newAssignTupleNode(l.ctx, l.parent, identLow, identHigh)
+	node := newDestructuringNode(l.ctx, l.parent, names, false)
+	node.pos = tokenPos(ctx.GetStart())
 	listener := newExprListener(l.ctx, node)
 	ctx.TupleExpr().EnterRule(listener)
 	rhs := listener.getExpr()
-	node.value = rhs
-	hType, lType, err := rhs.(*funCallNode).getTypeTuple()
-	if err != nil {
-		reportError(
-			fmt.Sprintf("failed type resolution type: %s", err.Error()),
-			ctx.GetParser(), ctx.TupleExpr().GetParser().GetCurrentToken(), ctx.GetRuleContext(),
-		)
+	if rhs == nil {
 		return
 	}
-	if infoHigh.theType != hType {
+	node.value = rhs
+	types, err := tupleTypes(rhs, len(idents))
+	if err != nil {
 		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoHigh.theType, hType),
-			ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext(),
+			CodeType, fmt.Sprintf("failed type resolution type: %s", err.Error()),
+			ctx.GetParser(), ctx.EQ().GetSymbol(), ctx.GetRuleContext(),
 		)
 		return
 	}
-	if infoLow.theType != lType {
-		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoLow.theType, lType),
-			ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext(),
-		)
-		return
+	for i, info := range infos {
+		if info.theType != types[i] {
+			reportError(
+				CodeType, fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", info.theType, types[i]),
+				ctx.GetParser(), idents[i].GetSymbol(), ctx.GetRuleContext(),
+			)
+			return
+		}
 	}
 	l.node = node
 }
 
-func (l *treeNodeListener) EnterAssignQuadruple(ctx *gen.AssignQuadrupleContext) {
-	identHigh := ctx.IDENT(0).GetSymbol().GetText()
-	infoHigh, err := getVarInfoForAssignment(identHigh, l.ctx)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
-		return
-	}
-
-	identLow := ctx.IDENT(1).GetSymbol().GetText()
-	infoLow, err := getVarInfoForAssignment(identLow, l.ctx)
+func (l *treeNodeListener) EnterAssignStructField(ctx *gen.AssignStructFieldContext) {
+	ident := ctx.IDENT(0).GetText()
+	info, err := getVarInfoForAssignment(ident, l.ctx)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
 		return
 	}
-
-	remHigh := ctx.IDENT(2).GetSymbol().GetText()
-	infoRemHigh, err := getVarInfoForAssignment(remHigh, l.ctx)
+	def, err := l.ctx.lookupStruct(info.theType)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(2).GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext())
 		return
 	}
-
-	remLow := ctx.IDENT(3).GetSymbol().GetText()
-	infoRemLow, err := getVarInfoForAssignment(remLow, l.ctx)
-	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.IDENT(3).GetSymbol(), ctx.GetRuleContext())
+	field, ok := def.field(ctx.IDENT(1).GetText())
+	if !ok {
+		reportError(
+			CodeUndefined, fmt.Sprintf("struct %s has no field %s", def.name, ctx.IDENT(1).GetText()),
+			ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext(),
+		)
 		return
 	}
 
-	node := newAssignQuadrupleNode(l.ctx, l.parent, identLow, identHigh, remLow, remHigh)
+	node := newAssignStructFieldNode(l.ctx, l.parent, ident, def, field)
+	node.pos = tokenPos(ctx.GetStart())
+	// other fields are read from the variable
+	l.ctx.reference(ident, node.pos)
 	listener := newExprListener(l.ctx, node)
-	ctx.TupleExpr().EnterRule(listener)
+	ctx.Expr().EnterRule(listener)
 	rhs := listener.getExpr()
-	node.value = rhs
-	hType, lType, rhType, rlType, err := rhs.(*funCallNode).getTypeQuadruple()
-	if err != nil {
-		reportError(
-			fmt.Sprintf("failed type resolution type: %s", err.Error()),
-			ctx.GetParser(), ctx.TupleExpr().GetParser().GetCurrentToken(), ctx.GetRuleContext(),
-		)
+	if rhs == nil {
 		return
 	}
-	if infoHigh.theType != hType {
-		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoHigh.theType, hType),
-			ctx.GetParser(), ctx.IDENT(0).GetSymbol(), ctx.GetRuleContext(),
-		)
+	node.value = rhs
+	if err := field.check(rhs); err != nil {
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext())
 		return
 	}
-	if infoLow.theType != lType {
-		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoLow.theType, lType),
-			ctx.GetParser(), ctx.IDENT(1).GetSymbol(), ctx.GetRuleContext(),
-		)
-		return
+
+	if field.offset > 0 {
+		l.ctx.addRangeLiterals(0, field.offset)
 	}
-	if infoRemHigh.theType != rhType {
-		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoRemHigh.theType, rhType),
-			ctx.GetParser(), ctx.IDENT(2).GetSymbol(), ctx.GetRuleContext(),
-		)
-		return
+	if end := field.offset + field.size; end < def.size {
+		l.ctx.addRangeLiterals(end, def.size-end)
 	}
-	if infoRemLow.theType != rlType {
-		reportError(
-			fmt.Sprintf("incompatible types: (var) %s vs %s (expr)", infoLow.theType, rlType),
-			ctx.GetParser(), ctx.IDENT(3).GetSymbol(), ctx.GetRuleContext(),
-		)
-		return
+	if field.runtimeCheck(rhs) {
+		l.ctx.addUintLiteral(field.size)
 	}
 	l.node = node
 }
@@ -837,20 +1339,23 @@ func (l *exprListener) EnterIdentifier(ctx *gen.IdentifierContext) {
 	ident := ctx.IDENT().GetSymbol().GetText()
 	variable, err := l.ctx.lookup(ident)
 	if err != nil {
-		reportError("ident not found", ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		reportError(CodeUndefined, "ident not found", ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
 
 	node := newExprIdentNode(l.ctx, l.parent, ident, variable.theType)
+	node.pos = tokenPos(ctx.GetStart())
+	l.ctx.reference(ident, node.pos)
 	l.expr = node
 }
 
 func (l *exprListener) EnterNumberLiteral(ctx *gen.NumberLiteralContext) {
 	value := ctx.NUMBER().GetText()
 	node := newExprLiteralNode(l.ctx, l.parent, intType, value)
+	node.pos = tokenPos(ctx.GetStart())
 	_, err := l.ctx.addLiteral(value, intType)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.NUMBER().GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.NUMBER().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
 	l.expr = node
@@ -859,17 +1364,19 @@ func (l *exprListener) EnterNumberLiteral(ctx *gen.NumberLiteralContext) {
 func (l *exprListener) EnterStringLiteral(ctx *gen.StringLiteralContext) {
 	value := ctx.STRING().GetText()
 	node := newExprLiteralNode(l.ctx, l.parent, bytesType, value)
+	node.pos = tokenPos(ctx.GetStart())
 	_, err := l.ctx.addLiteral(value, bytesType)
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.STRING().GetSymbol(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.STRING().GetSymbol(), ctx.GetRuleContext())
 		return
 	}
 	l.expr = node
 }
 
-func (l *exprListener) binOp(op string, lhs gen.IExprContext, rhs gen.IExprContext) {
+func (l *exprListener) binOp(op antlr.Token, lhs gen.IExprContext, rhs gen.IExprContext) {
 
-	node := newExprBinOpNode(l.ctx, l.parent, op)
+	node := newExprBinOpNode(l.ctx, l.parent, op.GetText())
+	node.pos = tokenPos(op)
 
 	subExprListener := newExprListener(l.ctx, node)
 	lhs.EnterRule(subExprListener)
@@ -882,9 +1389,10 @@ func (l *exprListener) binOp(op string, lhs gen.IExprContext, rhs gen.IExprConte
 	l.expr = node
 }
 
-func (l *exprListener) unOp(op string, expr gen.IExprContext) {
+func (l *exprListener) unOp(op antlr.Token, expr gen.IExprContext) {
 
-	node := newExprUnOpNode(l.ctx, l.parent, op)
+	node := newExprUnOpNode(l.ctx, l.parent, op.GetText())
+	node.pos = tokenPos(op)
 
 	subExprListener := newExprListener(l.ctx, node)
 	expr.EnterRule(subExprListener)
@@ -894,44 +1402,38 @@ func (l *exprListener) unOp(op string, expr gen.IExprContext) {
 }
 
 func (l *exprListener) EnterAddSub(ctx *gen.AddSubContext) {
-	op := ctx.GetOp().GetText()
-	l.binOp(op, ctx.Expr(0), ctx.Expr(1))
+	l.binOp(ctx.GetOp(), ctx.Expr(0), ctx.Expr(1))
 }
 
 func (l *exprListener) EnterMulDivMod(ctx *gen.MulDivModContext) {
-	op := ctx.GetOp().GetText()
-	l.binOp(op, ctx.Expr(0), ctx.Expr(1))
+	l.binOp(ctx.GetOp(), ctx.Expr(0), ctx.Expr(1))
 }
 
 func (l *exprListener) EnterRelation(ctx *gen.RelationContext) {
-	op := ctx.GetOp().GetText()
-	l.binOp(op, ctx.Expr(0), ctx.Expr(1))
+	l.binOp(ctx.GetOp(), ctx.Expr(0), ctx.Expr(1))
 }
 
 func (l *exprListener) EnterBitOp(ctx *gen.BitOpContext) {
-	op := ctx.GetOp().GetText()
-	l.binOp(op, ctx.Expr(0), ctx.Expr(1))
+	l.binOp(ctx.GetOp(), ctx.Expr(0), ctx.Expr(1))
 }
 
 func (l *exprListener) EnterAndOr(ctx *gen.AndOrContext) {
-	op := ctx.GetOp().GetText()
-	l.binOp(op, ctx.Expr(0), ctx.Expr(1))
+	l.binOp(ctx.GetOp(), ctx.Expr(0), ctx.Expr(1))
 }
 
 func (l *exprListener) EnterBitNot(ctx *gen.BitNotContext) {
-	op := ctx.GetOp().GetText()
-	l.unOp(op, ctx.Expr())
+	l.unOp(ctx.GetOp(), ctx.Expr())
 }
 
 func (l *exprListener) EnterNot(ctx *gen.NotContext) {
-	op := ctx.GetOp().GetText()
-	l.unOp(op, ctx.Expr())
+	l.unOp(ctx.GetOp(), ctx.Expr())
 }
 
 func (l *exprListener) EnterGroup(ctx *gen.GroupContext) {
 	listener := newExprListener(l.ctx, l.parent)
 	ctx.Expr().EnterRule(listener)
 	node := newExprGroupNode(l.ctx, l.parent, listener.getExpr())
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -941,8 +1443,46 @@ func (l *exprListener) EnterIfExpr(ctx *gen.IfExprContext) {
 	l.expr = listener.getExpr()
 }
 
+func (l *exprListener) EnterSwitchExpr(ctx *gen.SwitchExprContext) {
+	listener := newExprListener(l.ctx, l.parent)
+	ctx.SwitchCondExpr().EnterRule(listener)
+	l.expr = listener.getExpr()
+}
+
+func (l *exprListener) EnterSwitchCondExpr(ctx *gen.SwitchCondExprContext) {
+	node := newSwitchExprNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
+
+	listener := newExprListener(l.ctx, node)
+	ctx.Expr(0).EnterRule(listener)
+	node.value = listener.getExpr()
+	if node.value == nil {
+		return
+	}
+
+	for _, caseCtx := range ctx.AllSwitchExprCase() {
+		caseCtx := caseCtx.(*gen.SwitchExprCaseContext)
+		// case values are followed by the case expression
+		exprs := caseCtx.AllExpr()
+		if !parseSwitchCase(l.ctx, node, &node.switchCases, exprs[:len(exprs)-1], ctx.GetParser(), ctx.GetRuleContext()) {
+			return
+		}
+		listener := newExprListener(l.ctx, node)
+		exprs[len(exprs)-1].EnterRule(listener)
+		node.append(listener.getExpr())
+	}
+
+	node.hasDefault = true
+	listener = newExprListener(l.ctx, node)
+	ctx.Expr(1).EnterRule(listener)
+	node.append(listener.getExpr())
+
+	l.expr = node
+}
+
 func (l *exprListener) EnterCondExpr(ctx *gen.CondExprContext) {
 	node := newIfExprNode(l.ctx, l.parent)
+	node.pos = tokenPos(ctx.GetStart())
 
 	listener := newExprListener(l.ctx, node)
 	ctx.CondIfExpr().EnterRule(listener)
@@ -990,6 +1530,7 @@ func (l *exprListener) EnterTypeCastExpr(ctx *gen.TypeCastExprContext) {
 	} else {
 		node = newTypeCastExprNode(l.ctx, l.parent, intType)
 	}
+	node.pos = tokenPos(ctx.GetStart())
 
 	listener := newExprListener(l.ctx, l.parent)
 	ctx.Expr().EnterRule(listener)
@@ -998,6 +1539,47 @@ func (l *exprListener) EnterTypeCastExpr(ctx *gen.TypeCastExprContext) {
 	l.expr = node
 }
 
+func (l *exprListener) EnterStructFieldExpr(ctx *gen.StructFieldExprContext) {
+	listener := newExprListener(l.ctx, l.parent)
+	ctx.Expr().EnterRule(listener)
+	value := listener.getExpr()
+	if value == nil {
+		return
+	}
+
+	name := ctx.IDENT().GetText()
+	theType, err := value.getType()
+	if err != nil {
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext())
+		return
+	}
+	def, err := l.ctx.lookupStruct(theType)
+	if err != nil {
+		reportError(
+			CodeType, fmt.Sprintf("field %s access on non-struct type %s", name, theType),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return
+	}
+	field, ok := def.field(name)
+	if !ok {
+		reportError(
+			CodeUndefined, fmt.Sprintf("struct %s has no field %s", def.name, name),
+			ctx.GetParser(), ctx.IDENT().GetSymbol(), ctx.GetRuleContext(),
+		)
+		return
+	}
+
+	node := newStructFieldNode(l.ctx, l.parent, value, field)
+	node.pos = tokenPos(ctx.IDENT().GetSymbol())
+	if field.theType == intType {
+		l.ctx.addUintLiteral(field.offset)
+	} else {
+		l.ctx.addRangeLiterals(field.offset, field.size)
+	}
+	l.expr = node
+}
+
 func (l *exprListener) EnterFunctionCallExpr(ctx *gen.FunctionCallExprContext) {
 	listener := newExprListener(l.ctx, l.parent)
 	ctx.FunctionCall().EnterRule(listener)
@@ -1007,6 +1589,7 @@ func (l *exprListener) EnterFunctionCallExpr(ctx *gen.FunctionCallExprContext) {
 func (l *exprListener) EnterBuiltinFunCall(ctx *gen.BuiltinFunCallContext) {
 	name := ctx.BUILTINFUNC().GetText()
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr())
+	exprNode.pos = tokenPos(ctx.GetStart())
 	// convert builtin function name or args if needed
 	if remapper, ok := builtinFunRemap[name]; ok {
 		errPos, err := remapper(exprNode)
@@ -1014,7 +1597,7 @@ func (l *exprListener) EnterBuiltinFunCall(ctx *gen.BuiltinFunCallContext) {
 			errToken := ctx.Expr(errPos).GetStart()
 			parser := ctx.GetParser()
 			rule := ctx.GetRuleContext()
-			reportError(err.Error(), parser, errToken, rule)
+			reportError(errorCode(err), err.Error(), parser, errToken, rule)
 			return
 		}
 	}
@@ -1024,7 +1607,7 @@ func (l *exprListener) EnterBuiltinFunCall(ctx *gen.BuiltinFunCallContext) {
 		parser := ctx.GetParser()
 		token := ctx.BUILTINFUNC().GetSymbol()
 		rule := ctx.GetRuleContext()
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
 		return
 	}
 
@@ -1037,7 +1620,7 @@ func validateAppsIndex(ctx *context, exprNode ExprNodeIf) (err error) {
 		return
 	}
 	if indexType != intType {
-		err = fmt.Errorf("apps index must be int type")
+		err = errorf(CodeType, "apps index must be int type")
 		return
 	}
 
@@ -1048,24 +1631,24 @@ func validateAppsIndex(ctx *context, exprNode ExprNodeIf) (err error) {
 		var info varInfo
 		info, err = ctx.lookup(ident)
 		if err != nil || !info.constant() {
-			err = fmt.Errorf("%s not a constant", ident)
+			err = errorf(CodeSemantic, "%s not a constant", ident)
 			return
 		}
 		value = *info.value
 	case *exprLiteralNode:
 		value = tt.value
 	default:
-		err = fmt.Errorf("apps[%s] must be a literal number or a constant", value)
+		err = errorf(CodeSemantic, "apps[%s] must be a literal number or a constant", value)
 		return
 	}
 
 	val, err := strconv.Atoi(value)
 	if err != nil {
-		err = fmt.Errorf("%s not a number", value)
+		err = errorf(CodeLiteral, "%s not a number", value)
 		return
 	}
 	if val != 0 {
-		err = fmt.Errorf("apps[%s] must be a zero literal number or a constant", value)
+		err = errorf(CodeSemantic, "apps[%s] must be a zero literal number or a constant", value)
 		return
 	}
 
@@ -1086,7 +1669,7 @@ func (l *treeNodeListener) EnterBuiltinVarStatement(ctx *gen.BuiltinVarStatement
 		exprNode := listener.getExpr()
 		token := exprs[0].GetParser().GetCurrentToken()
 		if err := validateAppsIndex(l.ctx, exprNode); err != nil {
-			reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 			return
 		}
 		exprs = exprs[1:]
@@ -1102,11 +1685,12 @@ func (l *treeNodeListener) EnterBuiltinVarStatement(ctx *gen.BuiltinVarStatement
 
 	listener := newExprListener(l.ctx, l.parent)
 	exprNode := listener.funCallEnterImpl(tealOpName, exprs)
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	errPos, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := exprs[errPos].GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 
@@ -1120,27 +1704,47 @@ func (l *exprListener) EnterFunCall(ctx *gen.FunCallContext) {
 	rule := ctx.GetRuleContext()
 	info, err := l.ctx.lookup(name)
 	if err != nil {
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
+		return
+	}
+	if info.structure() {
+		l.structNew(ctx, info.node.(*structDefNode))
 		return
 	}
 	if !info.function() {
-		reportError("not a function", parser, token, rule)
+		reportError(CodeUndefined, "not a function", parser, token, rule)
 		return
 	}
 
 	argExprNodes := ctx.AllExpr()
 	funCallExprNode := l.funCallEnterImpl(name, argExprNodes)
+	funCallExprNode.pos = tokenPos(token)
+	l.ctx.reference(name, funCallExprNode.pos)
 	// parse function body
 	defNode := info.parser(l.ctx, funCallExprNode, &info)
 	if defNode == nil {
-		reportError("function parsing failed", parser, token, rule)
+		reportError(CodeSemantic, "function parsing failed", parser, token, rule)
 		return
 	}
 	l.ctx.update(name, info) // save reference to funNodeDef
 
+	// arguments of annotated params are checked at every call
+	for i, arg := range defNode.args {
+		if !arg.declared {
+			continue
+		}
+		value := funCallExprNode.children()[i].(ExprNodeIf)
+		checked, err := annotate(l.ctx, funCallExprNode, value, arg.t, "param "+arg.n)
+		if err != nil {
+			reportError(errorCode(err), err.Error(), parser, argExprNodes[i].GetStart(), rule)
+			return
+		}
+		funCallExprNode.childrenNodes[i] = checked
+	}
+
 	if !ensureBlockReturns(defNode) {
 		reportError(
-			fmt.Sprintf("%s function does not return", name),
+			CodeControlFlow, fmt.Sprintf("%s function does not return", name),
 			parser, token, rule,
 		)
 		return
@@ -1174,17 +1778,55 @@ func (l *exprListener) EnterFunCall(ctx *gen.FunCallContext) {
 	l.expr = funCallExprNode
 }
 
+// structNew parses struct constructor or conversion that looks like a function call
+func (l *exprListener) structNew(ctx *gen.FunCallContext, def *structDefNode) {
+	node := newStructNewNode(l.ctx, l.parent, def)
+	node.pos = tokenPos(ctx.IDENT().GetSymbol())
+	l.ctx.reference(def.name, node.pos)
+	for _, expr := range ctx.AllExpr() {
+		listener := newExprListener(l.ctx, node)
+		expr.EnterRule(listener)
+		arg := listener.getExpr()
+		if arg == nil {
+			return
+		}
+		node.append(arg)
+	}
+
+	errPos, err := node.resolve()
+	if err != nil {
+		token := ctx.IDENT().GetSymbol()
+		if errPos >= 0 && errPos < len(ctx.AllExpr()) {
+			token = ctx.Expr(errPos).GetStart()
+		}
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		return
+	}
+
+	if node.convert {
+		l.ctx.addUintLiteral(def.size)
+	} else {
+		for i, field := range def.fields {
+			if field.runtimeCheck(node.children()[i].(ExprNodeIf)) {
+				l.ctx.addUintLiteral(field.size)
+			}
+		}
+	}
+	l.expr = node
+}
+
 func (l *exprListener) EnterEcDsaFunCall(ctx *gen.EcDsaFunCallContext) {
 	name := ctx.ECDSAVERIFY().GetText()
 	field := ctx.ECDSACURVE().GetText()
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr(), field)
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	errPos, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		parser := ctx.GetParser()
 		token := ctx.Expr(errPos).GetStart()
 		rule := ctx.GetRuleContext()
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
 		return
 	}
 
@@ -1199,7 +1841,7 @@ func (l *exprListener) EnterExtractFunCall(ctx *gen.ExtractFunCallContext) {
 			parser := ctx.GetParser()
 			token := ctx.EXTRACT().GetSymbol()
 			rule := ctx.GetRuleContext()
-			reportError(fmt.Sprintf("extract %s accepts only 2 args", field), parser, token, rule)
+			reportError(CodeSemantic, fmt.Sprintf("extract %s accepts only 2 args", field), parser, token, rule)
 		}
 		switch field {
 		case "UINT16":
@@ -1212,13 +1854,14 @@ func (l *exprListener) EnterExtractFunCall(ctx *gen.ExtractFunCallContext) {
 	}
 
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr())
+	exprNode.pos = tokenPos(ctx.GetStart())
 	if remapper, ok := builtinFunRemap[name]; ok {
 		errPos, err := remapper(exprNode)
 		if err != nil {
 			errToken := ctx.Expr(errPos).GetStart()
 			parser := ctx.GetParser()
 			rule := ctx.GetRuleContext()
-			reportError(err.Error(), parser, errToken, rule)
+			reportError(errorCode(err), err.Error(), parser, errToken, rule)
 			return
 		}
 	}
@@ -1228,7 +1871,7 @@ func (l *exprListener) EnterExtractFunCall(ctx *gen.ExtractFunCallContext) {
 		parser := ctx.GetParser()
 		token := ctx.EXTRACT().GetSymbol()
 		rule := ctx.GetRuleContext()
-		reportError(err.Error(), parser, token, rule)
+		reportError(errorCode(err), err.Error(), parser, token, rule)
 		return
 	}
 
@@ -1254,6 +1897,12 @@ func (l *exprListener) EnterTupleExpr(ctx *gen.TupleExprContext) {
 		l.expr = exprNode
 		return
 	}
+	if node := ctx.FunctionCall(); node != nil {
+		listener := newExprListener(l.ctx, l.parent)
+		node.EnterRule(listener)
+		l.expr = listener.getExpr()
+		return
+	}
 
 	var field string
 	var name string
@@ -1273,15 +1922,16 @@ func (l *exprListener) EnterTupleExpr(ctx *gen.TupleExprContext) {
 		field = ctx.ECDSACURVE().GetText()
 	} else {
 		token := ctx.GetParser().GetCurrentToken()
-		reportError("unexpected token", ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(CodeSemantic, "unexpected token", ctx.GetParser(), token, ctx.GetRuleContext())
 	}
 
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr(), field)
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	errPos, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := ctx.Expr(errPos).GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 
@@ -1322,18 +1972,19 @@ func (l *exprListener) EnterBuiltinVarTupleExpr(ctx *gen.BuiltinVarTupleExprCont
 	}
 
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr())
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	errPos, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := ctx.Expr(errPos).GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 
 	if fieldArgToken != nil {
 		err = exprNode.resolveFieldArg(fieldArgToken.GetText())
 		if err != nil {
-			reportError(err.Error(), ctx.GetParser(), fieldArgToken, ctx.GetRuleContext())
+			reportError(errorCode(err), err.Error(), ctx.GetParser(), fieldArgToken, ctx.GetRuleContext())
 		}
 	}
 
@@ -1346,11 +1997,12 @@ func (l *exprListener) EnterAccountsBalanceExpr(ctx *gen.AccountsBalanceExprCont
 		name = "min_balance"
 	}
 	exprNode := l.funCallEnterImpl(name, []gen.IExprContext{ctx.Expr()})
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	_, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := ctx.Expr().GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 	l.expr = exprNode
@@ -1364,11 +2016,12 @@ func (l *exprListener) EnterAccountsSingleMethodsExpr(ctx *gen.AccountsSingleMet
 		name = "app_local_get"
 	}
 	exprNode := l.funCallEnterImpl(name, ctx.AllExpr())
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	errPos, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := ctx.Expr(errPos).GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 	l.expr = exprNode
@@ -1380,16 +2033,17 @@ func (l *exprListener) EnterAppsSingleMethodsExpr(ctx *gen.AppsSingleMethodsExpr
 	ctx.Expr(0).EnterRule(listener)
 	if err := validateAppsIndex(l.ctx, listener.getExpr()); err != nil {
 		token := ctx.Expr(0).GetParser().GetCurrentToken()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 
 	exprNode := l.funCallEnterImpl(name, []gen.IExprContext{ctx.Expr(1)})
+	exprNode.pos = tokenPos(ctx.GetStart())
 
 	_, err := exprNode.checkBuiltinArgs()
 	if err != nil {
 		token := ctx.Expr(1).GetStart()
-		reportError(err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), token, ctx.GetRuleContext())
 		return
 	}
 	l.expr = exprNode
@@ -1416,6 +2070,7 @@ func (l *exprListener) EnterBuiltinObject(ctx *gen.BuiltinObjectContext) {
 func (l *exprListener) EnterGlobalFieldExpr(ctx *gen.GlobalFieldExprContext) {
 	field := ctx.GLOBALFIELD().GetText()
 	node := newRuntimeFieldNode(l.ctx, l.parent, "global", field)
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1428,6 +2083,7 @@ func (l *exprListener) EnterTxnFieldExpr(ctx *gen.TxnFieldExprContext) {
 func (l *exprListener) EnterTxnSingleFieldExpr(ctx *gen.TxnSingleFieldExprContext) {
 	field := ctx.TXNFIELD().GetText()
 	node := newRuntimeFieldNode(l.ctx, l.parent, "txn", field)
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1439,7 +2095,7 @@ func (l *exprListener) EnterTxnArrayFieldExpr(ctx *gen.TxnArrayFieldExprContext)
 	exprNode := listener.getExpr()
 
 	var errToken antlr.Token
-	var node ExprNodeIf
+	var node *runtimeFieldNode
 
 	switch expr := exprNode.(type) {
 	case *constNode:
@@ -1461,10 +2117,11 @@ func (l *exprListener) EnterTxnArrayFieldExpr(ctx *gen.TxnArrayFieldExprContext)
 	}
 
 	if errToken != nil {
-		reportError(fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1477,6 +2134,7 @@ func (l *exprListener) EnterInnerTxnFieldExpr(ctx *gen.InnerTxnFieldExprContext)
 func (l *exprListener) EnterInnerTxnSingleFieldExpr(ctx *gen.InnerTxnSingleFieldExprContext) {
 	field := ctx.TXNFIELD().GetText()
 	node := newRuntimeFieldNode(l.ctx, l.parent, "itxn", field)
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1488,7 +2146,7 @@ func (l *exprListener) EnterInnerTxnArrayFieldExpr(ctx *gen.InnerTxnArrayFieldEx
 	exprNode := listener.getExpr()
 
 	var errToken antlr.Token
-	var node ExprNodeIf
+	var node *runtimeFieldNode
 
 	switch expr := exprNode.(type) {
 	case *constNode:
@@ -1510,10 +2168,11 @@ func (l *exprListener) EnterInnerTxnArrayFieldExpr(ctx *gen.InnerTxnArrayFieldEx
 	}
 
 	if errToken != nil {
-		reportError(fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1532,7 +2191,7 @@ func (l *exprListener) EnterGroupTxnSingleFieldExpr(ctx *gen.GroupTxnSingleField
 	var op string
 	var groupIndex string
 	var errToken antlr.Token
-	var node ExprNodeIf
+	var node *runtimeFieldNode
 
 	switch expr := exprNode.(type) {
 	case *constNode:
@@ -1559,10 +2218,11 @@ func (l *exprListener) EnterGroupTxnSingleFieldExpr(ctx *gen.GroupTxnSingleField
 	}
 
 	if errToken != nil {
-		reportError(fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1581,7 +2241,7 @@ func (l *exprListener) EnterGroupTxnArrayFieldExpr(ctx *gen.GroupTxnArrayFieldEx
 	arrayIndexExprNode := listener.getExpr()
 
 	var errToken antlr.Token
-	var node ExprNodeIf
+	var node *runtimeFieldNode
 
 	var groupIndex string
 	switch expr := groupIndexExprNode.(type) {
@@ -1600,7 +2260,7 @@ func (l *exprListener) EnterGroupTxnArrayFieldExpr(ctx *gen.GroupTxnArrayFieldEx
 	default:
 	}
 	if errToken != nil {
-		reportError(fmt.Sprintf("group index %s not a number", groupIndexExprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("group index %s not a number", groupIndexExprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
@@ -1621,7 +2281,7 @@ func (l *exprListener) EnterGroupTxnArrayFieldExpr(ctx *gen.GroupTxnArrayFieldEx
 	default:
 	}
 	if errToken != nil {
-		reportError(fmt.Sprintf("array index %s not a number", arrayIndexExprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("array index %s not a number", arrayIndexExprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
@@ -1645,6 +2305,7 @@ func (l *exprListener) EnterGroupTxnArrayFieldExpr(ctx *gen.GroupTxnArrayFieldEx
 		}
 	}
 
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1654,7 +2315,7 @@ func (l *exprListener) EnterArgsExpr(ctx *gen.ArgsExprContext) {
 	exprNode := listener.getExpr()
 
 	var errToken antlr.Token
-	var node ExprNodeIf
+	var node *runtimeArgNode
 
 	switch expr := exprNode.(type) {
 	case *constNode:
@@ -1676,10 +2337,11 @@ func (l *exprListener) EnterArgsExpr(ctx *gen.ArgsExprContext) {
 	}
 
 	if errToken != nil {
-		reportError(fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
+		reportError(CodeType, fmt.Sprintf("%s not a number", exprNode.String()), ctx.GetParser(), errToken, ctx.GetRuleContext())
 		return
 	}
 
+	node.pos = tokenPos(ctx.GetStart())
 	l.expr = node
 }
 
@@ -1689,17 +2351,44 @@ func (l *treeNodeListener) EnterOnelinecond(ctx *gen.OnelinecondContext) {
 	expr := listener.getExpr()
 	_, err := expr.getType() // trigger type evaluation
 	if err != nil {
-		reportError(err.Error(), ctx.GetParser(), ctx.Expr().GetStart(), ctx.GetRuleContext())
+		reportError(errorCode(err), err.Error(), ctx.GetParser(), ctx.Expr().GetStart(), ctx.GetRuleContext())
 		return
 	}
 
 	root := newProgramNode(l.ctx, l.parent)
+	root.pos = tokenPos(ctx.GetStart())
 	root.append(expr)
 	l.node = root
 }
 
+// sourceStream is antlr input stream remembering the source file it reads
+type sourceStream struct {
+	*antlr.InputStream
+	file *sourceFile
+}
+
+func newSourceStream(source string, filename string) *sourceStream {
+	is := new(sourceStream)
+	is.InputStream = antlr.NewInputStream(source)
+	is.file = &sourceFile{filename, source}
+	return is
+}
+
+// tokenPos returns token location in its source file
+func tokenPos(token antlr.Token) (pos sourcePos) {
+	pos.line = token.GetLine()
+	pos.column = token.GetColumn()
+	pos.start = token.GetStart()
+	pos.end = token.GetStop()
+	pos.token = token.GetText()
+	if is, ok := token.GetInputStream().(*sourceStream); ok {
+		pos.file = is.file
+	}
+	return
+}
+
 func newParser(source string, collector *errorCollector) *gen.TealangParser {
-	is := antlr.NewInputStream(source)
+	is := newSourceStream(source, collector.filename)
 	lexer := gen.NewTealangLexer(is)
 	lexer.RemoveErrorListeners()
 	lexer.AddErrorListener(collector)
@@ -1740,6 +2429,8 @@ func parseModule(moduleName string, parseCtx *parseContext, parent TreeNodeIf, c
 		return nil, err
 	}
 
+	ctx.symbols.addModule(moduleName, input)
+
 	raw := md5.Sum([]byte(input.Source))
 	checksum := hex.EncodeToString(raw[:])
 	if tree, ok := parseCtx.loadedModules[checksum]; ok {
@@ -1754,7 +2445,7 @@ func parseModule(moduleName string, parseCtx *parseContext, parent TreeNodeIf, c
 	collector.filterAmbiguity()
 	if len(collector.errors) > 0 {
 		parseCtx.collector.copyErrors(collector)
-		return nil, fmt.Errorf("error during module %s parsing", moduleName)
+		return nil, errorf(CodeModule, "error during module %s parsing", moduleName)
 	}
 
 	l := newRootTreeNodeListener(ctx, parent, parseCtx)
@@ -1773,7 +2464,7 @@ func parseModule(moduleName string, parseCtx *parseContext, parent TreeNodeIf, c
 
 	parseCtx.collector.copyErrors(collector)
 	if len(collector.errors) > 0 {
-		return nil, fmt.Errorf("error during module %s parsing", moduleName)
+		return nil, errorf(CodeModule, "error during module %s parsing", moduleName)
 	}
 
 	mod := l.getNode()
@@ -1783,10 +2474,20 @@ func parseModule(moduleName string, parseCtx *parseContext, parent TreeNodeIf, c
 
 // ParseProgram accepts InputDesc that describes source location
 func ParseProgram(input InputDesc) (TreeNodeIf, []ParserError) {
+	return parseProgram(input, nil, nil, false)
+}
+
+// parseProgram parses a program or a module without main function when module is set
+func parseProgram(input InputDesc, symbols *Symbols, warnings *warningCollector, module bool) (TreeNodeIf, []ParserError) {
 	collector := newErrorCollector(input.Source, input.SourceFile)
 	parser := newParser(input.Source, collector)
 
-	tree := parser.Program()
+	var tree antlr.ParserRuleContext
+	if module {
+		tree = parser.Module()
+	} else {
+		tree = parser.Program()
+	}
 
 	collector.filterAmbiguity()
 	if len(collector.errors) > 0 {
@@ -1794,6 +2495,8 @@ func ParseProgram(input InputDesc) (TreeNodeIf, []ParserError) {
 	}
 
 	ctx := newContext("root", nil)
+	ctx.symbols = symbols
+	ctx.warnings = warnings
 
 	parseCtx := newParseContext(input, collector)
 	l := newRootTreeNodeListener(ctx, nil, parseCtx)
@@ -1815,6 +2518,12 @@ func ParseProgram(input InputDesc) (TreeNodeIf, []ParserError) {
 	}
 
 	prog := l.getNode()
+	if module {
+		return prog, nil
+	}
+	if errors := allocateScratch(prog); len(errors) > 0 {
+		return nil, errors
+	}
 	return prog, nil
 }
 
@@ -1861,6 +2570,9 @@ func parseTestProgModule(progSource, moduleSource string) (TreeNodeIf, []ParserE
 	}
 
 	prog := l.getNode()
+	if errors := allocateScratch(prog); len(errors) > 0 {
+		return nil, errors
+	}
 	return prog, nil
 
 }
@@ -0,0 +1,362 @@
+//--------------------------------------------------------------------------------------------------
+//
+// TEAL peephole optimizations
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// instruction is a single line of TEAL program: opcode with arguments or a label
+type instruction struct {
+	label string
+	op    string
+	args  []string
+
+	// line is the line of the instruction in the original program, starting from 1
+	line int
+}
+
+func (i instruction) isLabel() bool {
+	return len(i.label) > 0
+}
+
+func (i instruction) String() string {
+	if i.isLabel() {
+		return i.label + ":"
+	}
+	if len(i.args) == 0 {
+		return i.op
+	}
+	return i.op + " " + strings.Join(i.args, " ")
+}
+
+// parseTEAL splits TEAL program text into instructions.
+// Comments and empty lines are dropped.
+func parseTEAL(teal string) []instruction {
+	lines := strings.Split(teal, "\n")
+	result := make([]instruction, 0, len(lines))
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if strings.HasSuffix(line, ":") && !strings.Contains(line, " ") {
+			result = append(result, instruction{label: line[:len(line)-1], line: idx + 1})
+			continue
+		}
+		fields := strings.Fields(line)
+		result = append(result, instruction{op: fields[0], args: fields[1:], line: idx + 1})
+	}
+	return result
+}
+
+func printTEAL(program []instruction) string {
+	var sb strings.Builder
+	for _, ins := range program {
+		sb.WriteString(ins.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+type peepholeRule func(program []instruction) ([]instruction, bool)
+
+// OptimizeTEAL applies peephole optimizations to a TEAL program produced by Codegen.
+// Stores to reserved slots are kept since other programs of the group might read them,
+// see ReservedSlots.
+func OptimizeTEAL(teal string, reserved []uint) string {
+	return printTEAL(optimizeTEAL(parseTEAL(teal), reserved))
+}
+
+// OptimizeTEALWithSourceMap applies peephole optimizations and updates the source map
+// to refer lines of the optimized program
+func OptimizeTEALWithSourceMap(teal string, sm *SourceMap, reserved []uint) string {
+	program := optimizeTEAL(parseTEAL(teal), reserved)
+	lines := make(map[int]SourceLocation, len(program))
+	for idx, ins := range program {
+		if loc, ok := sm.Lines[ins.line]; ok {
+			lines[idx+1] = loc
+		}
+	}
+	sm.Lines = lines
+	return printTEAL(program)
+}
+
+func optimizeTEAL(program []instruction, reserved []uint) []instruction {
+	rules := []peepholeRule{
+		removeUnreachable,
+		removeJumpToNext,
+		foldConstantBranches,
+		removeStoreLoad(reserved),
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range rules {
+			var applied bool
+			program, applied = rule(program)
+			changed = changed || applied
+		}
+	}
+	return inlineSingleUseConstants(program)
+}
+
+func isTerminator(op string) bool {
+	switch op {
+	case "return", "err", "retsub", "b":
+		return true
+	}
+	return false
+}
+
+func isBranch(op string) bool {
+	switch op {
+	case "b", "bz", "bnz", "callsub", "switch", "match":
+		return true
+	}
+	return false
+}
+
+// referencedLabels returns all labels used as jump targets
+func referencedLabels(program []instruction) map[string]bool {
+	labels := make(map[string]bool)
+	for _, ins := range program {
+		if isBranch(ins.op) {
+			for _, arg := range ins.args {
+				labels[arg] = true
+			}
+		}
+	}
+	return labels
+}
+
+// removeUnreachable drops instructions between unconditional control transfer and a next jump target
+func removeUnreachable(program []instruction) ([]instruction, bool) {
+	targets := referencedLabels(program)
+	result := make([]instruction, 0, len(program))
+	changed := false
+	unreachable := false
+	for _, ins := range program {
+		if ins.isLabel() && targets[ins.label] {
+			unreachable = false
+		}
+		if unreachable {
+			changed = true
+			continue
+		}
+		result = append(result, ins)
+		if isTerminator(ins.op) {
+			unreachable = true
+		}
+	}
+	return result, changed
+}
+
+// labelsAt returns labels defined right before the instruction at position pos
+func labelsAt(program []instruction, pos int) map[string]bool {
+	labels := make(map[string]bool)
+	for i := pos; i < len(program) && program[i].isLabel(); i++ {
+		labels[program[i].label] = true
+	}
+	return labels
+}
+
+// removeJumpToNext drops a jump to the label that immediately follows the jump.
+// Conditional jumps still consume the condition so they are replaced by pop.
+func removeJumpToNext(program []instruction) ([]instruction, bool) {
+	result := make([]instruction, 0, len(program))
+	changed := false
+	for i, ins := range program {
+		switch ins.op {
+		case "b", "bz", "bnz":
+			if len(ins.args) == 1 && labelsAt(program, i+1)[ins.args[0]] {
+				changed = true
+				if ins.op != "b" {
+					result = append(result, instruction{op: "pop", line: ins.line})
+				}
+				continue
+			}
+		}
+		result = append(result, ins)
+	}
+	return result, changed
+}
+
+// intConstants returns values of intcblock entries
+func intConstants(program []instruction) []string {
+	for _, ins := range program {
+		if ins.op == "intcblock" {
+			return ins.args
+		}
+	}
+	return nil
+}
+
+// constIntPush returns value pushed by the instruction if it is an integer constant
+func constIntPush(ins instruction, intc []string) (uint64, bool) {
+	var value string
+	switch ins.op {
+	case "int", "pushint":
+		if len(ins.args) != 1 {
+			return 0, false
+		}
+		value = ins.args[0]
+	case "intc":
+		if len(ins.args) != 1 {
+			return 0, false
+		}
+		idx, err := strconv.Atoi(ins.args[0])
+		if err != nil || idx < 0 || idx >= len(intc) {
+			return 0, false
+		}
+		value = intc[idx]
+	default:
+		return 0, false
+	}
+	result, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return result, true
+}
+
+// foldConstantBranches replaces conditional jumps on constant conditions
+// by unconditional jumps or removes them
+func foldConstantBranches(program []instruction) ([]instruction, bool) {
+	intc := intConstants(program)
+	result := make([]instruction, 0, len(program))
+	changed := false
+	for i := 0; i < len(program); i++ {
+		ins := program[i]
+		if i+1 < len(program) {
+			next := program[i+1]
+			if value, ok := constIntPush(ins, intc); ok && (next.op == "bz" || next.op == "bnz") {
+				taken := (value == 0) == (next.op == "bz")
+				if taken {
+					result = append(result, instruction{op: "b", args: next.args, line: next.line})
+				}
+				changed = true
+				i++
+				continue
+			}
+		}
+		result = append(result, ins)
+	}
+	return result, changed
+}
+
+// removeStoreLoad removes "store N; load N" pairs if the slot is not loaded anywhere else
+// and is not reserved, and "load N; store N" pairs that do not change anything
+func removeStoreLoad(reserved []uint) peepholeRule {
+	return func(program []instruction) ([]instruction, bool) {
+		loads := make(map[string]int)
+		for _, slot := range reserved {
+			// reserved slots are loaded by other programs
+			loads[strconv.FormatUint(uint64(slot), 10)]++
+		}
+		for _, ins := range program {
+			switch ins.op {
+			case "loads", "stores":
+				// slots are accessed dynamically, can't reason about them
+				return program, false
+			case "load":
+				if len(ins.args) == 1 {
+					loads[ins.args[0]]++
+				}
+			}
+		}
+
+		result := make([]instruction, 0, len(program))
+		changed := false
+		for i := 0; i < len(program); i++ {
+			ins := program[i]
+			if i+1 < len(program) && len(ins.args) == 1 {
+				next := program[i+1]
+				if len(next.args) == 1 && ins.args[0] == next.args[0] {
+					if ins.op == "store" && next.op == "load" && loads[ins.args[0]] == 1 ||
+						ins.op == "load" && next.op == "store" {
+						changed = true
+						i++
+						continue
+					}
+				}
+			}
+			result = append(result, ins)
+		}
+		return result, changed
+	}
+}
+
+// inlineSingleUseConstants replaces intc/bytec referring to constants used only once
+// by pushint/pushbytes, drops unused constants and orders the rest by usage
+func inlineSingleUseConstants(program []instruction) []instruction {
+	program = inlineConstBlock(program, "intcblock", "intc", "pushint")
+	program = inlineConstBlock(program, "bytecblock", "bytec", "pushbytes")
+	return program
+}
+
+func inlineConstBlock(program []instruction, blockOp string, refOp string, pushOp string) []instruction {
+	blockPos := -1
+	for i, ins := range program {
+		if ins.op == blockOp {
+			blockPos = i
+			break
+		}
+	}
+	if blockPos == -1 {
+		return program
+	}
+	values := program[blockPos].args
+
+	uses := make([]int, len(values))
+	for _, ins := range program {
+		if ins.op == refOp && len(ins.args) == 1 {
+			idx, err := strconv.Atoi(ins.args[0])
+			if err != nil || idx < 0 || idx >= len(values) {
+				// unexpected reference, leave the program as is
+				return program
+			}
+			uses[idx]++
+		}
+	}
+
+	kept := make([]int, 0, len(values))
+	for idx, count := range uses {
+		if count > 1 {
+			kept = append(kept, idx)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return uses[kept[i]] > uses[kept[j]] })
+	remap := make(map[int]int, len(kept))
+	keptValues := make([]string, len(kept))
+	for newIdx, oldIdx := range kept {
+		remap[oldIdx] = newIdx
+		keptValues[newIdx] = values[oldIdx]
+	}
+
+	result := make([]instruction, 0, len(program))
+	for i, ins := range program {
+		if i == blockPos {
+			if len(keptValues) > 0 {
+				result = append(result, instruction{op: blockOp, args: keptValues, line: ins.line})
+			}
+			continue
+		}
+		if ins.op == refOp && len(ins.args) == 1 {
+			idx, _ := strconv.Atoi(ins.args[0])
+			if newIdx, ok := remap[idx]; ok {
+				ins = instruction{op: refOp, args: []string{fmt.Sprintf("%d", newIdx)}, line: ins.line}
+			} else {
+				ins = instruction{op: pushOp, args: []string{values[idx]}, line: ins.line}
+			}
+		}
+		result = append(result, ins)
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeepholeStoreLoad(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+intcblock 0 1 5
+// const
+fun_main:
+intc 2
+store 0
+load 0
+intc 2
++
+store 1
+load 1
+store 1
+load 1
+load 1
+==
+return
+end_main:
+`
+	expected := `#pragma version 5
+intcblock 5
+fun_main:
+intc 0
+intc 0
++
+store 1
+load 1
+load 1
+==
+return
+`
+	a.Equal(expected, OptimizeTEAL(teal, nil))
+
+	// reserved slots are read by other programs of the group
+	teal = `#pragma version 5
+fun_main:
+txn Amount
+store 3
+load 3
+return
+end_main:
+`
+	expected = `#pragma version 5
+fun_main:
+txn Amount
+store 3
+load 3
+return
+`
+	a.Equal(expected, OptimizeTEAL(teal, []uint{3}))
+	a.Equal("#pragma version 5\nfun_main:\ntxn Amount\nreturn\n", OptimizeTEAL(teal, nil))
+}
+
+func TestPeepholeJumps(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+intcblock 0 1 2
+fun_main:
+txn Fee
+bz if_stmt_end_main_3_0
+intc 2
+store 0
+if_stmt_end_main_3_0:
+intc 1
+bz if_stmt_false_main_4_1
+b if_stmt_end_main_4_1
+if_stmt_false_main_4_1:
+err
+if_stmt_end_main_4_1:
+intc 0
+bnz skip
+b next
+next:
+txn Fee
+bnz done
+done:
+intc 1
+return
+intc 2
+store 0
+end_main:
+`
+	expected := `#pragma version 5
+fun_main:
+txn Fee
+bz if_stmt_end_main_3_0
+pushint 2
+store 0
+if_stmt_end_main_3_0:
+if_stmt_end_main_4_1:
+next:
+txn Fee
+pop
+done:
+pushint 1
+return
+`
+	a.Equal(expected, OptimizeTEAL(teal, nil))
+}
+
+func TestPeepholeConstants(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 5
+intcblock 0 1 10 20
+bytecblock 0x01 0x0203
+fun_main:
+intc 3
+intc 3
+intc 3
+intc 2
+bytec 1
+bytec 1
+bytec 0
+concat
+==
+return
+`
+	expected := `#pragma version 5
+intcblock 20
+bytecblock 0x0203
+fun_main:
+intc 0
+intc 0
+intc 0
+pushint 10
+bytec 0
+bytec 0
+pushbytes 0x01
+concat
+==
+return
+`
+	a.Equal(expected, OptimizeTEAL(teal, nil))
+}
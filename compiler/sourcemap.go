@@ -0,0 +1,145 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Source maps from generated TEAL and bytecode back to tealang source
+//
+//--------------------------------------------------------------------------------------------------
+
+package compiler
+
+import (
+	gobytes "bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SourceLocation is a location in tealang source file.
+// Line numbering starts from 1, column is zero-based as reported by the parser.
+type SourceLocation struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (loc SourceLocation) String() string {
+	if len(loc.File) == 0 {
+		return fmt.Sprintf("line %d", loc.Line)
+	}
+	return fmt.Sprintf("%s:%d", loc.File, loc.Line)
+}
+
+// Variable is a tealang variable stored in a scratch slot.
+// Slots are shared between variables that are not live at the same time,
+// Line and EndLine are source lines of the first and the last variable references in File.
+type Variable struct {
+	Name     string `json:"name"`
+	Function string `json:"function"`
+	Type     string `json:"type"`
+	Slot     uint   `json:"slot"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	EndLine  int    `json:"end_line"`
+}
+
+// SourceMap maps generated TEAL lines and assembled bytecode offsets to tealang source locations
+type SourceMap struct {
+	// Lines maps TEAL program line (starting from 1) to the source location it was generated for
+	Lines map[int]SourceLocation `json:"lines"`
+	// PCs maps bytecode offset of an opcode to the source location it was generated for
+	PCs map[int]SourceLocation `json:"pcs,omitempty"`
+	// Variables lists scratch slots of the program variables
+	Variables []Variable `json:"variables,omitempty"`
+
+	// sources keeps text of the source files by name
+	sources map[string]string
+}
+
+func newSourceMap() *SourceMap {
+	return &SourceMap{Lines: make(map[int]SourceLocation), sources: make(map[string]string)}
+}
+
+// SourceText returns text of the source line the location points to
+func (sm *SourceMap) SourceText(loc SourceLocation) string {
+	text, ok := sm.sources[loc.File]
+	if !ok {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if loc.Line < 1 || loc.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[loc.Line-1])
+}
+
+// Source returns text of the source file
+func (sm *SourceMap) Source(file string) string {
+	return sm.sources[file]
+}
+
+// SetOffsets fills bytecode offsets mapping from assembler's offset to TEAL line mapping.
+// Assembler lines are zero-based, logic.OpStream.OffsetToLine can be passed as is.
+func (sm *SourceMap) SetOffsets(offsetToLine map[int]int) {
+	sm.PCs = make(map[int]SourceLocation, len(offsetToLine))
+	for pc, line := range offsetToLine {
+		if loc, ok := sm.Lines[line+1]; ok {
+			sm.PCs[pc] = loc
+		}
+	}
+}
+
+// sourceMapWriter remembers source location of every TEAL line written by code generation
+type sourceMapWriter struct {
+	out       io.Writer
+	line      int
+	lineStart bool
+	stack     []sourcePos
+	sm        *SourceMap
+}
+
+func newSourceMapWriter(out io.Writer) *sourceMapWriter {
+	return &sourceMapWriter{out: out, line: 1, lineStart: true, sm: newSourceMap()}
+}
+
+func (w *sourceMapWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if w.lineStart && len(w.stack) > 0 {
+			pos := w.stack[len(w.stack)-1]
+			loc := SourceLocation{Line: pos.line, Column: pos.column}
+			if pos.file != nil {
+				loc.File = pos.file.name
+				w.sm.sources[loc.File] = pos.file.text
+			}
+			w.sm.Lines[w.line] = loc
+		}
+		w.lineStart = b == '\n'
+		if w.lineStart {
+			w.line++
+		}
+	}
+	return w.out.Write(p)
+}
+
+// enterNode attributes TEAL emitted until the returned function is called to the node source location.
+// Nested nodes override location of their parents, nodes without location inherit it.
+func enterNode(ostream io.Writer, n TreeNodeIf) func() {
+	w, ok := ostream.(*sourceMapWriter)
+	if !ok || n.position().line == 0 {
+		return func() {}
+	}
+	w.stack = append(w.stack, n.position())
+	return func() {
+		w.stack = w.stack[:len(w.stack)-1]
+	}
+}
+
+// CodegenWithSourceMap runs code generation for a node and returns the program
+// along with source locations of its lines
+func CodegenWithSourceMap(prog TreeNodeIf) (string, *SourceMap) {
+	buf := new(gobytes.Buffer)
+	w := newSourceMapWriter(buf)
+	prog.Codegen(w)
+	if root, ok := prog.(*programNode); ok {
+		w.sm.Variables = root.variables
+	}
+	return buf.String(), w.sm
+}
@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceMapCodegen(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+function logic() {
+	let a = 1
+	if a == 1 {
+		return a
+	}
+	return 0
+}
+`
+	result, errors := Parse(source)
+	a.NotEmpty(result, errors)
+	a.Empty(errors)
+	actual, sm := CodegenWithSourceMap(result)
+	a.Equal(Codegen(result), actual)
+	expected := `#pragma version *
+intcblock 0 1
+fun_main:
+intc 1
+store 0
+load 0
+intc 1
+==
+bz if_stmt_end_main_4_0
+load 0
+return
+if_stmt_end_main_4_0:
+intc 0
+return
+end_main:
+`
+	CompareTEAL(a, expected, actual)
+	a.Equal(map[int]SourceLocation{
+		3:  {"", 2, 0},
+		4:  {"", 3, 9},
+		5:  {"", 3, 5},
+		6:  {"", 4, 4},
+		7:  {"", 4, 9},
+		8:  {"", 4, 6},
+		9:  {"", 4, 1},
+		10: {"", 5, 9},
+		11: {"", 5, 2},
+		12: {"", 4, 1},
+		13: {"", 7, 8},
+		14: {"", 7, 1},
+		15: {"", 2, 0},
+	}, sm.Lines)
+	a.Equal([]Variable{{Name: "a", Function: "main", Type: "uint64", Slot: 0, Line: 3, EndLine: 5}}, sm.Variables)
+}
+
+func TestSourceMapOptimize(t *testing.T) {
+	a := require.New(t)
+
+	teal := `#pragma version 6
+intcblock 0 1 5
+fun_main:
+intc 2
+store 0
+load 0
+return
+end_main:
+`
+	sm := &SourceMap{Lines: map[int]SourceLocation{
+		3: {"a.tl", 2, 0},
+		4: {"a.tl", 3, 9},
+		5: {"a.tl", 3, 5},
+		6: {"a.tl", 4, 8},
+		7: {"a.tl", 4, 1},
+		8: {"a.tl", 2, 0},
+	}}
+	expected := `#pragma version 6
+fun_main:
+pushint 5
+return
+`
+	a.Equal(expected, OptimizeTEALWithSourceMap(teal, sm, nil))
+	a.Equal(map[int]SourceLocation{
+		2: {"a.tl", 2, 0},
+		3: {"a.tl", 3, 9},
+		4: {"a.tl", 4, 1},
+	}, sm.Lines)
+
+	// assembler reports zero-based lines
+	sm.SetOffsets(map[int]int{1: 2, 3: 3})
+	a.Equal(map[int]SourceLocation{
+		1: {"a.tl", 3, 9},
+		3: {"a.tl", 4, 1},
+	}, sm.PCs)
+}
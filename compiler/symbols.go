@@ -0,0 +1,280 @@
+package compiler
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SymbolKind is a kind of declared name
+type SymbolKind int
+
+const (
+	// VariableSymbol is a variable
+	VariableSymbol SymbolKind = iota
+	// ConstantSymbol is a constant
+	ConstantSymbol
+	// FunctionSymbol is a function
+	FunctionSymbol
+	// ParameterSymbol is a function argument
+	ParameterSymbol
+	// StructSymbol is a struct type
+	StructSymbol
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case ConstantSymbol:
+		return "const"
+	case FunctionSymbol:
+		return "function"
+	case StructSymbol:
+		return "struct"
+	}
+	return "let"
+}
+
+// Symbol is a declaration of a variable, constant, function or struct
+type Symbol struct {
+	Name     string
+	Kind     SymbolKind
+	Type     string
+	Location SourceLocation
+	// Detail is a declaration text like function signature or constant value
+	Detail string
+}
+
+// Reference is a use of a symbol in the source
+type Reference struct {
+	Location SourceLocation
+	Symbol   *Symbol
+}
+
+// Symbols indexes declarations and references found during parsing for editor tooling.
+// Locations have 1-based lines and 0-based columns.
+type Symbols struct {
+	Declarations []*Symbol
+	References   []Reference
+	// Paths maps imported module file names to their paths, embedded stdlib modules have no path
+	Paths map[string]string
+
+	byKey      map[varKey]*Symbol
+	byLocation map[SourceLocation]*Symbol
+	referenced map[SourceLocation]bool
+
+	// used symbols are read at least once, assignments are not counted
+	used      map[*Symbol]bool
+	positions map[*Symbol]sourcePos
+	// moduleFiles maps imported module names to their file names
+	moduleFiles map[string]string
+	imports     []importDecl
+}
+
+// importDecl is an import statement of a module
+type importDecl struct {
+	module string
+	pos    sourcePos
+}
+
+func newSymbols() *Symbols {
+	return &Symbols{
+		Paths:       make(map[string]string),
+		byKey:       make(map[varKey]*Symbol),
+		byLocation:  make(map[SourceLocation]*Symbol),
+		referenced:  make(map[SourceLocation]bool),
+		used:        make(map[*Symbol]bool),
+		positions:   make(map[*Symbol]sourcePos),
+		moduleFiles: make(map[string]string),
+	}
+}
+
+// Lookup returns symbol declared or referenced at the position of the file
+func (s *Symbols) Lookup(file string, line int, column int) *Symbol {
+	at := func(loc SourceLocation, name string) bool {
+		return loc.File == file && loc.Line == line && loc.Column <= column && column <= loc.Column+len(name)
+	}
+	for _, ref := range s.References {
+		if at(ref.Location, ref.Symbol.Name) {
+			return ref.Symbol
+		}
+	}
+	for _, sym := range s.Declarations {
+		if at(sym.Location, sym.Name) {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Visible returns functions and constants, and variables declared in the file before the line.
+// Shadowed names are returned once.
+func (s *Symbols) Visible(file string, line int) []*Symbol {
+	var result []*Symbol
+	seen := make(map[string]bool)
+	for i := len(s.Declarations) - 1; i >= 0; i-- {
+		sym := s.Declarations[i]
+		if seen[sym.Name] {
+			continue
+		}
+		local := sym.Kind == VariableSymbol || sym.Kind == ParameterSymbol
+		if local && (sym.Location.File != file || sym.Location.Line > line) {
+			continue
+		}
+		seen[sym.Name] = true
+		result = append(result, sym)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// declare records a name declared in the context at pos
+func (ctx *context) declare(name string, kind SymbolKind, theType exprType, pos sourcePos, detail string) {
+	if kind == VariableSymbol || kind == ParameterSymbol {
+		ctx.checkShadow(name, pos)
+	}
+	s := ctx.symbols
+	if s == nil {
+		return
+	}
+	loc := symbolLocation(pos)
+	// inline functions are parsed at every call site, keep a single declaration
+	sym, ok := s.byLocation[loc]
+	if !ok {
+		sym = &Symbol{Name: name, Kind: kind, Type: theType.String(), Location: loc, Detail: detail}
+		s.byLocation[loc] = sym
+		s.positions[sym] = pos
+		s.Declarations = append(s.Declarations, sym)
+	}
+	s.byKey[varKey{ctx, name}] = sym
+}
+
+// reference records a read of the name visible in the context at pos
+func (ctx *context) reference(name string, pos sourcePos) {
+	ctx.use(name, pos, true)
+}
+
+// assignment records a write to the variable visible in the context at pos
+func (ctx *context) assignment(name string, pos sourcePos) {
+	ctx.use(name, pos, false)
+}
+
+func (ctx *context) use(name string, pos sourcePos, read bool) {
+	s := ctx.symbols
+	if s == nil {
+		return
+	}
+	for current := ctx; current != nil; current = current.parent {
+		if _, ok := current.vars[name]; !ok {
+			continue
+		}
+		sym, ok := s.byKey[varKey{current, name}]
+		if !ok {
+			return
+		}
+		if read {
+			s.used[sym] = true
+		}
+		loc := symbolLocation(pos)
+		if !s.referenced[loc] {
+			s.referenced[loc] = true
+			s.References = append(s.References, Reference{loc, sym})
+		}
+		return
+	}
+}
+
+// keep marks the variable declared in the context as used,
+// variables in reserved scratch slots are read by other programs of the group
+func (ctx *context) keep(name string) {
+	if s := ctx.symbols; s != nil {
+		if sym, ok := s.byKey[varKey{ctx, name}]; ok {
+			s.used[sym] = true
+		}
+	}
+}
+
+// imported records import of the module at pos
+func (ctx *context) imported(module string, pos sourcePos) {
+	if s := ctx.symbols; s != nil {
+		s.imports = append(s.imports, importDecl{module, pos})
+	}
+}
+
+// addModule remembers file name and path of the imported module file
+func (s *Symbols) addModule(module string, input InputDesc) {
+	if s == nil {
+		return
+	}
+	s.moduleFiles[module] = input.SourceFile
+	if !fileExists(path.Join(input.SourceDir, input.SourceFile)) {
+		return
+	}
+	s.Paths[input.SourceFile] = path.Join(input.SourceDir, input.SourceFile)
+}
+
+func symbolLocation(pos sourcePos) SourceLocation {
+	loc := SourceLocation{Line: pos.line, Column: pos.column}
+	if pos.file != nil {
+		loc.File = pos.file.name
+	}
+	return loc
+}
+
+func funSignature(name string, args []string, returns []exprType, inline bool) string {
+	prefix := "function"
+	if inline {
+		prefix = "inline function"
+	}
+	signature := fmt.Sprintf("%s %s(%s)", prefix, name, strings.Join(args, ", "))
+	if len(returns) > 0 {
+		types := make([]string, len(returns))
+		for i, tp := range returns {
+			types[i] = tp.String()
+		}
+		signature += ": " + strings.Join(types, ", ")
+	}
+	return signature
+}
+
+// BuiltinDoc returns description of the builtin function from the TEAL language spec
+func BuiltinDoc(name string) (string, bool) {
+	if !builtinFun[name] {
+		return "", false
+	}
+	op, ok := langOps[name]
+	if !ok {
+		return "", false
+	}
+	return op.Doc, true
+}
+
+// FieldType returns type of the field of TEAL opcode like txn or global from the language spec
+func FieldType(opcode string, field string) (string, bool) {
+	theType, err := runtimeFieldTypeFromSpec(opcode, field)
+	if err != nil || theType == unknownType {
+		return "", false
+	}
+	return theType.String(), true
+}
+
+// ParseProgramWithSymbols parses the program as ParseProgram does and
+// also returns declarations and references found, even if there are semantic errors.
+// Symbols are nil when parsing failed before any declaration, for example on syntax errors.
+func ParseProgramWithSymbols(input InputDesc) (TreeNodeIf, *Symbols, []ParserError) {
+	return parseWithSymbols(input, false)
+}
+
+// ParseModuleWithSymbols parses a module that has no main function and returns its symbols
+func ParseModuleWithSymbols(input InputDesc) (TreeNodeIf, *Symbols, []ParserError) {
+	return parseWithSymbols(input, true)
+}
+
+func parseWithSymbols(input InputDesc, module bool) (TreeNodeIf, *Symbols, []ParserError) {
+	symbols := newSymbols()
+	prog, errors := parseProgram(input, symbols, nil, module)
+	if len(symbols.byKey) == 0 && len(errors) > 0 {
+		return nil, nil, errors
+	}
+	return prog, symbols, errors
+}
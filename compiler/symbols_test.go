@@ -0,0 +1,91 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbols(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	module := `const ONE = 1
+function add(x, y) {
+	return x + y
+}
+`
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "lib.tl"), []byte(module), 0644))
+
+	source := `import lib
+function logic() {
+	let a = add(1, 2)
+	a = a + ONE
+	return a
+}
+`
+	input := InputDesc{source, "main.tl", dir, dir}
+	prog, symbols, errors := ParseProgramWithSymbols(input)
+	a.Empty(errors)
+	a.NotNil(prog)
+	a.Equal(map[string]string{"lib.tl": filepath.Join(dir, "lib.tl")}, symbols.Paths)
+
+	add := symbols.Lookup("main.tl", 3, 10)
+	a.NotNil(add)
+	a.Equal(Symbol{"add", FunctionSymbol, "unknown", SourceLocation{"lib.tl", 2, 9}, "function add(x, y)"}, *add)
+
+	one := symbols.Lookup("main.tl", 4, 9)
+	a.NotNil(one)
+	a.Equal(Symbol{"ONE", ConstantSymbol, "uint64", SourceLocation{"lib.tl", 1, 6}, "const ONE = 1"}, *one)
+
+	// assignment, reference and declaration resolve to the same variable
+	variable := symbols.Lookup("main.tl", 3, 5)
+	a.NotNil(variable)
+	a.Equal("let a: uint64", variable.Detail)
+	a.Same(variable, symbols.Lookup("main.tl", 4, 1))
+	a.Same(variable, symbols.Lookup("main.tl", 5, 8))
+
+	x := symbols.Lookup("lib.tl", 3, 8)
+	a.NotNil(x)
+	a.Equal(SourceLocation{"lib.tl", 2, 13}, x.Location)
+
+	a.Nil(symbols.Lookup("main.tl", 5, 2))
+
+	var names []string
+	for _, sym := range symbols.Visible("main.tl", 3) {
+		names = append(names, sym.Name)
+	}
+	a.Equal([]string{"ONE", "a", "add"}, names)
+
+	// semantic errors keep symbols declared so far
+	_, symbols, errors = ParseProgramWithSymbols(InputDesc{"const c = 1\nfunction logic() {\n\treturn d\n}\n", "main.tl", "", ""})
+	a.NotEmpty(errors)
+	a.NotNil(symbols)
+	a.Equal("c", symbols.Lookup("main.tl", 1, 6).Name)
+
+	_, symbols, errors = ParseModuleWithSymbols(InputDesc{module, "lib.tl", "", ""})
+	a.Empty(errors)
+	a.Equal(2, len(symbols.Declarations))
+}
+
+func TestBuiltinDoc(t *testing.T) {
+	a := require.New(t)
+
+	doc, ok := BuiltinDoc("sha256")
+	a.True(ok)
+	a.Equal("SHA256 hash of value A, yields [32]byte", doc)
+
+	_, ok = BuiltinDoc("substring3")
+	a.False(ok)
+
+	theType, ok := FieldType("txn", "Sender")
+	a.True(ok)
+	a.Equal("byte[]", theType)
+	theType, ok = FieldType("global", "GroupSize")
+	a.True(ok)
+	a.Equal("uint64", theType)
+	_, ok = FieldType("txn", "Unknown")
+	a.False(ok)
+}
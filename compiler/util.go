@@ -5,7 +5,6 @@ import (
 	"crypto/sha512"
 	"encoding/base32"
 	"encoding/base64"
-	"fmt"
 	"strconv"
 	"strings"
 )
@@ -35,7 +34,7 @@ func parseStringLiteral(input string) (result []byte, err error) {
 	}
 
 	if input[start] != '"' || input[end] != '"' {
-		return nil, fmt.Errorf("no quotes")
+		return nil, errorf(CodeLiteral, "no quotes")
 	}
 
 	return rawString(input, start+1, end)
@@ -67,11 +66,11 @@ func addrString(input string, start int, end int) (result []byte, err error) {
 	address := input[start:end]
 	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode address %s to base 32", address)
+		return nil, errorf(CodeLiteral, "failed to decode address %s to base 32", address)
 	}
 	var short digest
 	if len(decoded) < len(short) {
-		return nil, fmt.Errorf("decoded bad addr: %s", address)
+		return nil, errorf(CodeLiteral, "decoded bad addr: %s", address)
 	}
 
 	copy(short[:], decoded[:len(short)])
@@ -81,12 +80,12 @@ func addrString(input string, start int, end int) (result []byte, err error) {
 	isValid := bytes.Equal(incomingchecksum, calculatedchecksum)
 
 	if !isValid {
-		return nil, fmt.Errorf("address %s is malformed, checksum verification failed", address)
+		return nil, errorf(CodeLiteral, "address %s is malformed, checksum verification failed", address)
 	}
 
 	// Validate that we had a canonical string representation
 	if canonical(short) != address {
-		return nil, fmt.Errorf("address %s is non-canonical", address)
+		return nil, errorf(CodeLiteral, "address %s is non-canonical", address)
 	}
 
 	return short[:], nil
@@ -103,7 +102,7 @@ func rawString(input string, start int, end int) (result []byte, err error) {
 		char := input[pos]
 		if char == '\\' && !escapeSeq {
 			if hexSeq {
-				return nil, fmt.Errorf("escape seq inside hex number")
+				return nil, errorf(CodeLiteral, "escape seq inside hex number")
 			}
 			escapeSeq = true
 			pos++
@@ -127,13 +126,13 @@ func rawString(input string, start int, end int) (result []byte, err error) {
 				pos++
 				continue
 			default:
-				return nil, fmt.Errorf("invalid escape seq \\%c", char)
+				return nil, errorf(CodeLiteral, "invalid escape seq \\%c", char)
 			}
 		}
 		if hexSeq {
 			hexSeq = false
 			if pos >= len(input)-2 { // count a closing quote
-				return nil, fmt.Errorf("non-terminated hex seq")
+				return nil, errorf(CodeLiteral, "non-terminated hex seq")
 			}
 			num, err := strconv.ParseUint(input[pos:pos+2], 16, 8)
 			if err != nil {
@@ -147,7 +146,7 @@ func rawString(input string, start int, end int) (result []byte, err error) {
 		pos++
 	}
 	if escapeSeq || hexSeq {
-		return nil, fmt.Errorf("non-terminated escape seq")
+		return nil, errorf(CodeLiteral, "non-terminated escape seq")
 	}
 
 	return
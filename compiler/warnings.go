@@ -0,0 +1,165 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// warning checks names
+const (
+	warnUnusedVariable  = "unused-variable"
+	warnUnusedParameter = "unused-parameter"
+	warnUnusedConst     = "unused-const"
+	warnUnusedFunction  = "unused-function"
+	warnUnusedImport    = "unused-import"
+	warnShadow          = "shadow"
+	warnUnreachable     = "unreachable"
+)
+
+// WarningNames lists names of all warning checks, all are enabled by default
+var WarningNames = []string{
+	warnUnusedVariable,
+	warnUnusedParameter,
+	warnUnusedConst,
+	warnUnusedFunction,
+	warnUnusedImport,
+	warnShadow,
+	warnUnreachable,
+}
+
+var warningCodes = map[string]string{
+	warnUnusedVariable:  CodeUnusedVariable,
+	warnUnusedParameter: CodeUnusedParameter,
+	warnUnusedConst:     CodeUnusedConst,
+	warnUnusedFunction:  CodeUnusedFunction,
+	warnUnusedImport:    CodeUnusedImport,
+	warnShadow:          CodeShadow,
+	warnUnreachable:     CodeUnreachable,
+}
+
+// enclosing returns the lexically enclosing scope:
+// the parent for if/else/for blocks and the global scope for functions
+// because function bodies are parsed in the context of the call site
+func (ctx *context) enclosing() *context {
+	switch ctx.name {
+	case "if", "else", "for":
+		return ctx.parent
+	}
+	root := ctx
+	for root.parent != nil {
+		root = root.parent
+	}
+	if root == ctx {
+		return nil
+	}
+	return root
+}
+
+// checkShadow warns if the variable declared in the context hides a name of the enclosing scopes
+func (ctx *context) checkShadow(name string, pos sourcePos) {
+	if ctx.warnings == nil {
+		return
+	}
+	for current := ctx.enclosing(); current != nil; current = current.enclosing() {
+		if _, ok := current.vars[name]; !ok {
+			continue
+		}
+		msg := fmt.Sprintf("'%s' shadows declaration in the enclosing scope", name)
+		if ctx.symbols != nil {
+			if sym, ok := ctx.symbols.byKey[varKey{current, name}]; ok {
+				msg = fmt.Sprintf("'%s' shadows declaration at %s:%d", name, sym.Location.File, sym.Location.Line)
+			}
+		}
+		ctx.warnings.warn(warnShadow, pos, msg)
+		return
+	}
+}
+
+// checkUnused warns about declarations of the file that are never read
+func (wc *warningCollector) checkUnused(s *Symbols, file string) {
+	for _, sym := range s.Declarations {
+		if sym.Location.File != file || s.used[sym] {
+			continue
+		}
+		pos := s.positions[sym]
+		switch sym.Kind {
+		case VariableSymbol:
+			wc.warn(warnUnusedVariable, pos, fmt.Sprintf("variable '%s' is declared but never used", sym.Name))
+		case ParameterSymbol:
+			wc.warn(warnUnusedParameter, pos, fmt.Sprintf("parameter '%s' is never used", sym.Name))
+		case ConstantSymbol:
+			wc.warn(warnUnusedConst, pos, fmt.Sprintf("constant '%s' is declared but never used", sym.Name))
+		case FunctionSymbol:
+			wc.warn(warnUnusedFunction, pos, fmt.Sprintf("function '%s' is declared but never called", sym.Name))
+		}
+	}
+}
+
+// checkImports warns about modules imported by the file which symbols are never referenced.
+// A module is used if its own symbols or symbols of modules it imports are referenced.
+func (wc *warningCollector) checkImports(s *Symbols, file string) {
+	referenced := make(map[string]bool)
+	for _, ref := range s.References {
+		if ref.Location.File != ref.Symbol.Location.File {
+			referenced[ref.Symbol.Location.File] = true
+		}
+	}
+
+	var used func(moduleFile string, seen map[string]bool) bool
+	used = func(moduleFile string, seen map[string]bool) bool {
+		if referenced[moduleFile] {
+			return true
+		}
+		if seen[moduleFile] {
+			return false
+		}
+		seen[moduleFile] = true
+		for _, imp := range s.imports {
+			if imp.pos.file != nil && imp.pos.file.name == moduleFile && used(s.moduleFiles[imp.module], seen) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, imp := range s.imports {
+		if imp.pos.file == nil || imp.pos.file.name != file {
+			continue
+		}
+		if !used(s.moduleFiles[imp.module], make(map[string]bool)) {
+			wc.warn(warnUnusedImport, imp.pos, fmt.Sprintf("module %s is imported but not used", imp.module))
+		}
+	}
+}
+
+// inFile returns warnings of the file sorted by position
+func (wc *warningCollector) inFile(file string) []ParserError {
+	var result []ParserError
+	for _, w := range wc.warnings {
+		if w.filename == file {
+			result = append(result, w)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].line != result[j].line {
+			return result[i].line < result[j].line
+		}
+		return result[i].column < result[j].column
+	})
+	return result
+}
+
+// ParseProgramWithWarnings parses the program as ParseProgram does and also returns warnings
+// about unused declarations and imports, shadowed variables and unreachable statements of the source file.
+// Imported modules are not checked.
+func ParseProgramWithWarnings(input InputDesc) (TreeNodeIf, []ParserError, []ParserError) {
+	symbols := newSymbols()
+	warnings := newWarningCollector()
+	prog, errors := parseProgram(input, symbols, warnings, false)
+	if len(errors) > 0 {
+		return nil, nil, errors
+	}
+	warnings.checkUnused(symbols, input.SourceFile)
+	warnings.checkImports(symbols, input.SourceFile)
+	return prog, warnings.inFile(input.SourceFile), nil
+}
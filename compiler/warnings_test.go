@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarnings(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "lib.tl"), []byte("const ONE = 1\nconst TWO = 2\n"), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "unused.tl"), []byte("const THREE = 3\n"), 0644))
+
+	source := `import lib
+import unused
+const UNUSED = 5
+let shared @ 1 = 0
+let x = 1
+function helper(a, b) {
+	return a
+}
+function never() {
+	return 1
+}
+function logic() {
+	let y = 2
+	let z = 0
+	z = 3
+	if y == ONE {
+		let y = 3
+		return helper(y, x)
+	}
+	return 1
+	error
+}
+`
+	input := InputDesc{source, "main.tl", dir, dir}
+	prog, warnings, errors := ParseProgramWithWarnings(input)
+	a.Empty(errors)
+	a.NotNil(prog)
+
+	type warning struct {
+		name string
+		line int
+		msg  string
+	}
+	var actual []warning
+	for _, w := range warnings {
+		actual = append(actual, warning{w.Warning(), w.Line(), w.Message()})
+	}
+	a.Equal([]warning{
+		{"unused-import", 2, "module unused is imported but not used"},
+		{"unused-const", 3, "constant 'UNUSED' is declared but never used"},
+		{"unused-parameter", 6, "parameter 'b' is never used"},
+		{"unused-function", 9, "function 'never' is declared but never called"},
+		{"unused-variable", 14, "variable 'z' is declared but never used"},
+		{"shadow", 17, "'y' shadows declaration at main.tl:13"},
+		{"unreachable", 21, "unreachable statement"},
+	}, actual)
+
+	a.Equal(CodeShadow, warnings[5].Code())
+	a.Equal("warning", warnings[5].Kind())
+
+	// parse errors suppress warnings
+	_, warnings, errors = ParseProgramWithWarnings(InputDesc{"let x = 1\nfunction logic() {\n\treturn y\n}\n", "main.tl", "", ""})
+	a.NotEmpty(errors)
+	a.Empty(warnings)
+}
+
+func TestWarningCollector(t *testing.T) {
+	a := require.New(t)
+
+	var wc *warningCollector
+	wc.warn(warnShadow, sourcePos{line: 1}, "ignored")
+
+	wc = newWarningCollector()
+	wc.warn(warnShadow, sourcePos{line: 2, token: "a"}, "'a' shadows declaration at main.tl:1")
+	wc.warn(warnShadow, sourcePos{line: 2, token: "a"}, "'a' shadows declaration at main.tl:1")
+	wc.warn(warnUnusedVariable, sourcePos{line: 2, token: "a"}, "variable 'a' is declared but never used")
+	wc.warn(warnUnreachable, sourcePos{line: 1, token: "b"}, "unreachable statement")
+	warnings := wc.inFile("")
+	a.Equal(3, len(warnings))
+	a.Equal(warnUnreachable, warnings[0].Warning())
+	a.Equal(CodeUnreachable, warnings[0].Code())
+	a.Equal("warning at line 1, col 0 near token 'b'\nunreachable statement [-Wunreachable]", warnings[0].String())
+
+	for _, name := range WarningNames {
+		a.Contains(codeDescriptions, warningCodes[name])
+	}
+}
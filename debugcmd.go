@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/spf13/cobra"
+
+	"github.com/pzbitskiy/tealang/compiler"
+	dr "github.com/pzbitskiy/tealang/dryrun"
+)
+
+var debugTxnFile string
+var debugLedgerFile string
+var debugAppID uint64
+var debugGroupIndex int
+var debugBreakpoints []string
+var debugOptimize bool
+
+var debugCmd = &cobra.Command{
+	Use:   "debug [flags] source-file",
+	Short: "Step through tealang program in dryrun",
+	Long: `Compile the program and evaluate it in dryrun stopping at tealang source lines.
+Breakpoints are set by [file:]line, the source file is used when file is omitted.
+Without breakpoints the debugger stops at the first line, type help at the prompt for the list of commands.`,
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fullPath, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		srcBytes, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		workDir, err := os.Getwd()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		input := compiler.InputDesc{
+			Source:     string(srcBytes),
+			SourceFile: filepath.Base(fullPath),
+			SourceDir:  filepath.Dir(fullPath),
+			CurrentDir: workDir,
+		}
+
+		breakpoints := make([]compiler.SourceLocation, 0, len(debugBreakpoints))
+		for _, value := range debugBreakpoints {
+			loc, err := dr.ParseLocation(value, input.SourceFile)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			breakpoints = append(breakpoints, loc)
+		}
+
+		prog, parseErrors := compiler.ParseProgram(input)
+		if len(parseErrors) == 0 {
+			parseErrors = compiler.Optimize(prog)
+		}
+		if len(parseErrors) > 0 {
+			printErrors(parseErrors)
+			os.Exit(1)
+		}
+		teal, sourceMap := compiler.CodegenWithSourceMap(prog)
+		if debugOptimize {
+			teal = compiler.OptimizeTEALWithSourceMap(teal, sourceMap, compiler.ReservedSlots(prog))
+		}
+		op, err := logic.AssembleString(teal)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		sourceMap.SetOffsets(op.OffsetToLine)
+
+		debugger := dr.NewDebugger(op.Program, sourceMap, breakpoints, os.Stdin, os.Stdout)
+		var pass bool
+		appMode := cmd.Flags().Changed("ledger") || debugAppID != 0
+		if appMode {
+			var result dr.AppResult
+			result, err = dr.DebugApp(op.Program, debugTxnFile, debugLedgerFile, debugGroupIndex, debugAppID, debugger)
+			pass = result.Pass
+			if err == nil {
+				fmt.Print(result.String())
+			}
+		} else {
+			pass, err = dr.DebugRun(op.Program, debugTxnFile, debugGroupIndex, debugger)
+		}
+		if pass {
+			fmt.Printf(" - pass -\n")
+		} else {
+			fmt.Printf("REJECT\n")
+		}
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func setDebugCmdFlags() {
+	debugCmd.Flags().StringVarP(&debugTxnFile, "dryrun", "d", "", "transaction group JSON or msgpack file, sample transaction if omitted")
+	debugCmd.Flags().StringVar(&debugLedgerFile, "ledger", "", "debug as application call against ledger state from the JSON file provided")
+	debugCmd.Flags().Uint64Var(&debugAppID, "app-id", 0, "application ID to debug the program as, overrides ApplicationID of the transaction")
+	debugCmd.Flags().IntVar(&debugGroupIndex, "group-index", 0, "index of the transaction in the group the program is evaluated for")
+	debugCmd.Flags().StringSliceVarP(&debugBreakpoints, "break", "b", nil, "set breakpoint at [file:]line, can be repeated")
+	debugCmd.Flags().BoolVarP(&debugOptimize, "optimize", "O", false, "apply peephole optimizations to generated TEAL")
+	rootCmd.AddCommand(debugCmd)
+}
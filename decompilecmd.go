@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/spf13/cobra"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+var decompileOutFile string
+var decompileBytecode bool
+
+var decompileCmd = &cobra.Command{
+	Use:   "decompile [flags] teal-file",
+	Short: "Convert TEAL program to tealang source",
+	Long: `Decompile TEAL assembly or compiled bytecode (*.tok files and binary input are disassembled first) to tealang.
+Branches and loops become if-else and for statements, subroutines become functions,
+scratch slots become variables pinned to the same slots and txn, gtxn, global and state access ops become builtin objects.
+Code that can not be structured is kept as comments followed by error statement.
+Use - to read the program from stdin.`,
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		teal := string(data)
+		if decompileBytecode || filepath.Ext(args[0]) == ".tok" || !isText(data) {
+			teal, err = logic.Disassemble(data)
+			if err != nil {
+				fmt.Printf("disassembly failed: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		source, err := compiler.Decompile(teal)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if len(decompileOutFile) == 0 {
+			fmt.Print(source)
+			return
+		}
+		if err := ioutil.WriteFile(decompileOutFile, []byte(source), 0644); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// isText reports if data looks like TEAL assembly rather than bytecode
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, ch := range data {
+		if ch < 0x20 && ch != '\n' && ch != '\r' && ch != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func setDecompileCmdFlags() {
+	decompileCmd.Flags().StringVarP(&decompileOutFile, "output", "o", "", "write tealang source to the file instead of stdout")
+	decompileCmd.Flags().BoolVarP(&decompileBytecode, "bytecode", "b", false, "treat input as compiled bytecode")
+	rootCmd.AddCommand(decompileCmd)
+}
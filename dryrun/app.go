@@ -0,0 +1,220 @@
+package dryrun
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/algorand/go-algorand/config"
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions"
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/algorand/go-algorand/protocol"
+)
+
+// AppResult is an outcome of application call dry run
+type AppResult struct {
+	Pass bool
+	// Delta holds global and local state changes, logs and inner transactions
+	Delta transactions.EvalDelta
+	// Accounts resolves local state delta account offsets: sender followed by txn.Accounts
+	Accounts []basics.Address
+}
+
+// RunApp runs bytecode as approval program of the application called by groupIndex transaction
+// using transaction group from txnFile and ledger state from ledgerFile.
+// Non-zero appID overrides application ID of the transaction,
+// if both are zero the call creates a new application with bytecode as its approval program.
+// Other transactions of the group are applied to the ledger in order, their fees are not charged.
+func RunApp(bytecode []byte, txnFile string, ledgerFile string, groupIndex int, appID uint64, trace *strings.Builder) (result AppResult, err error) {
+	stxns, err := loadAppTxns(txnFile)
+	if err != nil {
+		return
+	}
+	ledger, err := LoadLedger(ledgerFile)
+	if err != nil {
+		return
+	}
+	proto := config.Consensus[protocol.ConsensusCurrentVersion]
+	return runApp(bytecode, stxns, ledger, groupIndex, appID, &proto, trace, nil)
+}
+
+// DebugApp evaluates bytecode as RunApp does with the debugger attached to its evaluation.
+// Inner application calls are reported to the debugger as well.
+func DebugApp(bytecode []byte, txnFile string, ledgerFile string, groupIndex int, appID uint64, debugger logic.DebuggerHook) (result AppResult, err error) {
+	stxns, err := loadAppTxns(txnFile)
+	if err != nil {
+		return
+	}
+	ledger, err := LoadLedger(ledgerFile)
+	if err != nil {
+		return
+	}
+	proto := config.Consensus[protocol.ConsensusCurrentVersion]
+	return runApp(bytecode, stxns, ledger, groupIndex, appID, &proto, nil, debugger)
+}
+
+// loadAppTxns loads transactions as loadTxns does, the sample transaction is turned into an app call
+func loadAppTxns(txnFile string) (stxns []transactions.SignedTxn, err error) {
+	stxns, err = loadTxns(txnFile)
+	if err == nil && txnFile == "" {
+		stxns[0].Txn.Type = protocol.ApplicationCallTx
+	}
+	return
+}
+
+func runApp(bytecode []byte, stxns []transactions.SignedTxn, ledger *Ledger, groupIndex int, appID uint64, proto *config.ConsensusParams, trace *strings.Builder, debugger logic.DebuggerHook) (result AppResult, err error) {
+	if err = checkGroupIndex(groupIndex, stxns); err != nil {
+		return
+	}
+
+	txn := &stxns[groupIndex].Txn
+	// transactions without Type and TypeEnum are app calls
+	if txn.Type == "" || txn.Type == protocol.UnknownTx {
+		txn.Type = protocol.ApplicationCallTx
+	}
+	if txn.Type != protocol.ApplicationCallTx {
+		return result, fmt.Errorf("txn %d: expected %s transaction but got %s", groupIndex, protocol.ApplicationCallTx, txn.Type)
+	}
+	if appID != 0 {
+		txn.ApplicationID = basics.AppIndex(appID)
+	}
+	if txn.ApplicationID == 0 {
+		// app creation, the ledger allocates a new app index and runs the approval program of the txn
+		txn.ApprovalProgram = bytecode
+	} else {
+		ledger.ensureApp(txn.ApplicationID, txn.Sender, bytecode)
+	}
+
+	ep := logic.NewEvalParams(withApplyData(stxns), proto, &transactions.SpecialAddresses{})
+	ep.Ledger = ledger
+	if err = logic.CheckContract(bytecode, ep); err != nil {
+		return
+	}
+
+	result.Accounts = append([]basics.Address{txn.Sender}, txn.Accounts...)
+	for i := range ep.TxnGroup {
+		if i != groupIndex {
+			if err = ledger.apply(i, ep); err != nil {
+				return result, fmt.Errorf("txn %d: %s", i, err.Error())
+			}
+			continue
+		}
+		ep.Trace = trace
+		ep.Debugger = debugger
+		err = ledger.apply(i, ep)
+		ep.Trace = nil
+		ep.Debugger = nil
+		result.Delta = ep.TxnGroup[i].EvalDelta
+		if _, rejected := err.(rejectedError); rejected {
+			return result, nil
+		}
+		if err != nil {
+			return
+		}
+		result.Pass = true
+	}
+	return
+}
+
+func (r AppResult) String() string {
+	var sb strings.Builder
+	writeEvalDelta(&sb, "", r.Delta, r.Accounts)
+	return sb.String()
+}
+
+func writeEvalDelta(sb *strings.Builder, indent string, delta transactions.EvalDelta, accounts []basics.Address) {
+	if len(delta.GlobalDelta) > 0 {
+		sb.WriteString(fmt.Sprintf("%sglobal delta:\n", indent))
+		writeStateDelta(sb, indent+"  ", delta.GlobalDelta)
+	}
+	if len(delta.LocalDeltas) > 0 {
+		sb.WriteString(fmt.Sprintf("%slocal delta:\n", indent))
+		offsets := make([]uint64, 0, len(delta.LocalDeltas))
+		for offset := range delta.LocalDeltas {
+			offsets = append(offsets, offset)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		for _, offset := range offsets {
+			account := fmt.Sprintf("account %d", offset)
+			if offset < uint64(len(accounts)) {
+				account = accounts[offset].String()
+			}
+			sb.WriteString(fmt.Sprintf("%s  %s:\n", indent, account))
+			writeStateDelta(sb, indent+"    ", delta.LocalDeltas[offset])
+		}
+	}
+	if len(delta.Logs) > 0 {
+		sb.WriteString(fmt.Sprintf("%slogs:\n", indent))
+		for idx, log := range delta.Logs {
+			sb.WriteString(fmt.Sprintf("%s  [%d] 0x%x\n", indent, idx, log))
+		}
+	}
+	if len(delta.InnerTxns) > 0 {
+		sb.WriteString(fmt.Sprintf("%sinner txns:\n", indent))
+		for idx, stxn := range delta.InnerTxns {
+			sb.WriteString(fmt.Sprintf("%s  [%d] %s\n", indent, idx, describeTxn(stxn)))
+			inner := append([]basics.Address{stxn.Txn.Sender}, stxn.Txn.Accounts...)
+			writeEvalDelta(sb, indent+"    ", stxn.EvalDelta, inner)
+		}
+	}
+}
+
+func writeStateDelta(sb *strings.Builder, indent string, delta basics.StateDelta) {
+	keys := make([]string, 0, len(delta))
+	for key := range delta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		vd := delta[key]
+		var value string
+		switch vd.Action {
+		case basics.SetUintAction:
+			value = fmt.Sprintf("%d", vd.Uint)
+		case basics.SetBytesAction:
+			value = fmt.Sprintf("0x%x", vd.Bytes)
+		default:
+			value = "deleted"
+		}
+		sb.WriteString(fmt.Sprintf("%s%q: %s\n", indent, key, value))
+	}
+}
+
+// describeTxn returns a brief one-line description of an inner transaction
+func describeTxn(stxn transactions.SignedTxnWithAD) string {
+	txn := stxn.Txn
+	switch txn.Type {
+	case protocol.PaymentTx:
+		desc := fmt.Sprintf("pay %d from %s to %s", txn.Amount.Raw, txn.Sender, txn.Receiver)
+		if !txn.CloseRemainderTo.IsZero() {
+			desc += fmt.Sprintf(" close to %s", txn.CloseRemainderTo)
+		}
+		return desc
+	case protocol.AssetTransferTx:
+		sender := txn.Sender
+		if !txn.AssetSender.IsZero() {
+			sender = txn.AssetSender
+		}
+		desc := fmt.Sprintf("axfer %d of asset %d from %s to %s", txn.AssetAmount, txn.XferAsset, sender, txn.AssetReceiver)
+		if !txn.AssetCloseTo.IsZero() {
+			desc += fmt.Sprintf(" close to %s", txn.AssetCloseTo)
+		}
+		return desc
+	case protocol.AssetConfigTx:
+		if txn.ConfigAsset == 0 {
+			return fmt.Sprintf("acfg create asset %d by %s", stxn.ConfigAsset, txn.Sender)
+		}
+		return fmt.Sprintf("acfg asset %d by %s", txn.ConfigAsset, txn.Sender)
+	case protocol.AssetFreezeTx:
+		return fmt.Sprintf("afrz asset %d of %s frozen=%t", txn.FreezeAsset, txn.FreezeAccount, txn.AssetFrozen)
+	case protocol.ApplicationCallTx:
+		aid := txn.ApplicationID
+		if aid == 0 {
+			aid = stxn.ApplicationID
+		}
+		return fmt.Sprintf("appl %s app %d by %s", txn.OnCompletion, aid, txn.Sender)
+	default:
+		return fmt.Sprintf("%s by %s", txn.Type, txn.Sender)
+	}
+}
@@ -0,0 +1,163 @@
+package dryrun
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunApp(t *testing.T) {
+	a := require.New(t)
+
+	appAddr := basics.AppIndex(5).Address().String()
+
+	ledger := `{
+	"Round": 10,
+	"Accounts": [
+		{"Address": "` + sender + `", "Balance": 1000000,
+		 "Locals": [{"App": 5, "State": {"visits": {"Uint": 1}}}]}
+	],
+	"Apps": [
+		{"ID": 5, "Creator": "` + receiver + `", "Balance": 500000,
+		 "GlobalState": {"owner": {"Bytes": "AQI="}, "old": {"Uint": 3}}}
+	]
+}`
+	ledgerFile := filepath.Join(t.TempDir(), "ledger.json")
+	a.NoError(ioutil.WriteFile(ledgerFile, []byte(ledger), 0644))
+
+	op, err := logic.AssembleString(`#pragma version 5
+byte "counter"
+global Round
+app_global_put
+byte "old"
+app_global_del
+txn Sender
+byte "visits"
+txn Sender
+byte "visits"
+app_local_get
+int 1
++
+app_local_put
+byte "hello"
+log
+itxn_begin
+int pay
+itxn_field TypeEnum
+txn Sender
+itxn_field Receiver
+int 2000
+itxn_field Amount
+itxn_submit
+int 1
+`)
+	a.NoError(err)
+
+	var trace strings.Builder
+	result, err := RunApp(op.Program, "", ledgerFile, 0, 5, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass)
+	expected := `global delta:
+  "counter": 10
+  "old": deleted
+local delta:
+  ` + sender + `:
+    "visits": 2
+logs:
+  [0] 0x68656c6c6f
+inner txns:
+  [0] pay 2000 from ` + appAddr + ` to ` + sender + `
+`
+	a.Equal(expected, result.String())
+
+	// missing ledger file
+	_, err = RunApp(op.Program, "", filepath.Join(t.TempDir(), "missing.json"), 0, 5, &trace)
+	a.Error(err)
+}
+
+func TestRunAppCreate(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	ledgerFile := filepath.Join(dir, "ledger.json")
+	a.NoError(ioutil.WriteFile(ledgerFile, []byte(`{"Accounts": [{"Address": "`+sender+`", "Balance": 1000}]}`), 0644))
+
+	op, err := logic.AssembleString(`#pragma version 5
+byte "creator"
+txn Sender
+app_global_put
+txn ApplicationID
+!
+global CurrentApplicationID
+int 1000
+==
+&&
+`)
+	a.NoError(err)
+
+	// zero app ID creates the app with the program as its approval program
+	var trace strings.Builder
+	result, err := RunApp(op.Program, "", ledgerFile, 0, 0, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass, trace.String())
+	a.Contains(result.String(), `"creator": 0x`)
+
+	txnFile := filepath.Join(dir, "txn.json")
+	a.NoError(ioutil.WriteFile(txnFile, []byte(`{"Sender": "`+sender+`"}`), 0644))
+	result, err = RunApp(op.Program, txnFile, ledgerFile, 0, 0, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass, trace.String())
+
+	// explicit transaction type must be an app call
+	a.NoError(ioutil.WriteFile(txnFile, []byte(`{"Sender": "`+sender+`", "Type": "pay"}`), 0644))
+	_, err = RunApp(op.Program, txnFile, ledgerFile, 0, 0, &trace)
+	a.EqualError(err, "txn 0: expected appl transaction but got pay")
+}
+
+func TestRunAppGroup(t *testing.T) {
+	a := require.New(t)
+
+	appAddr := basics.AppIndex(5).Address().String()
+	group := `[
+	{"Sender": "` + sender + `", "Type": "pay", "Receiver": "` + appAddr + `", "Amount": 300},
+	{"Sender": "` + sender + `", "Type": "appl", "ApplicationID": 5, "ApplicationArgs": ["AQI="], "Accounts": ["` + receiver + `"]}
+]`
+	dir := t.TempDir()
+	txnFile := filepath.Join(dir, "group.json")
+	a.NoError(ioutil.WriteFile(txnFile, []byte(group), 0644))
+	ledgerFile := filepath.Join(dir, "ledger.json")
+	a.NoError(ioutil.WriteFile(ledgerFile, []byte(`{"Accounts": [
+	{"Address": "`+sender+`", "Balance": 1000},
+	{"Address": "`+receiver+`", "Balance": 77}
+]}`), 0644))
+
+	op, err := logic.AssembleString(`#pragma version 5
+gtxn 0 Amount
+global CurrentApplicationAddress
+balance
+==
+int 1
+balance
+int 77
+==
+&&
+txna ApplicationArgs 0
+byte 0x0102
+==
+&&
+`)
+	a.NoError(err)
+
+	var trace strings.Builder
+	result, err := RunApp(op.Program, txnFile, ledgerFile, 1, 0, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass, trace.String())
+
+	_, err = RunApp(op.Program, txnFile, ledgerFile, 2, 0, &trace)
+	a.EqualError(err, "group index 2 is out of range of 2 transactions")
+}
@@ -30,7 +30,39 @@ type txnDesc struct {
 	AssetSender 	string		// Algorand Address, base32-encoded string with checksum
 	AssetReceiver 	string		// Algorand Address, base32-encoded string with checksum
 	AssetCloseTo 	string		// Algorand Address, base32-encoded string with checksum
-	GroupIndex 		uint64
+	GroupIndex 		uint64		// ignored, position in the group is used
+	ApplicationID 	uint64
+	OnCompletion 	uint64
+	ApplicationArgs []string	// base64-encoded
+	Accounts 		[]string	// Algorand Addresses, base32-encoded strings with checksum
+	Applications 	[]uint64
+	Assets 			[]uint64
+	ApprovalProgram string		// base64-encoded
+	ClearStateProgram string	// base64-encoded
+	GlobalNumUint 	uint64
+	GlobalNumByteSlice uint64
+	LocalNumUint 	uint64
+	LocalNumByteSlice uint64
+	ExtraProgramPages uint64
+	RekeyTo 		string		// Algorand Address, base32-encoded string with checksum
+	ConfigAsset 	uint64
+	ConfigAssetTotal uint64
+	ConfigAssetDecimals uint64
+	ConfigAssetDefaultFrozen bool
+	ConfigAssetUnitName string
+	ConfigAssetName string
+	ConfigAssetURL 	string
+	ConfigAssetMetadataHash string	// base64-encoded
+	ConfigAssetManager string	// Algorand Address, base32-encoded string with checksum
+	ConfigAssetReserve string	// Algorand Address, base32-encoded string with checksum
+	ConfigAssetFreeze string	// Algorand Address, base32-encoded string with checksum
+	ConfigAssetClawback string	// Algorand Address, base32-encoded string with checksum
+	FreezeAsset 	uint64
+	FreezeAssetAccount string	// Algorand Address, base32-encoded string with checksum
+	FreezeAssetFrozen bool
+	Nonparticipation bool
+	Logic 			string		// base64-encoded LogicSig program
+	Args 			[]string	// base64-encoded LogicSig arguments
 }
 
 func init() {
@@ -0,0 +1,283 @@
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+// conditionalBranch matches TEAL conditional jumps generated for if, for and switch statements
+var conditionalBranch = regexp.MustCompile(`^\s*(bz|bnz|switch|match)\s`)
+
+// Coverage accumulates line and branch coverage of tealang sources over one or many dryrun traces.
+// Programs might differ between runs, coverage is tracked by source location.
+type Coverage struct {
+	files map[string]*fileCoverage
+}
+
+type fileCoverage struct {
+	source string
+	// lines maps source line with generated code to its execution count
+	lines map[int]int
+	// branches maps source line to conditional jumps generated for it in the order of appearance
+	branches map[int][]*branchCoverage
+}
+
+// branchCoverage counts conditional jump outcomes.
+// Fall through enters if-true branch or loop body, jump goes to if-false branch or loop end.
+// For switch and match opcodes fall through goes to the default branch, jump goes to any of the cases.
+type branchCoverage struct {
+	executed bool
+	through  int
+	jump     int
+}
+
+// NewCoverage creates an empty coverage
+func NewCoverage() *Coverage {
+	return &Coverage{files: make(map[string]*fileCoverage)}
+}
+
+// SetSource sets text of the source file, lines outside of it are not tracked.
+// By default the text is taken from the source map of the first program run.
+func (c *Coverage) SetSource(file string, source string) {
+	c.file(file).source = source
+}
+
+func (c *Coverage) file(name string) *fileCoverage {
+	fc, ok := c.files[name]
+	if !ok {
+		fc = &fileCoverage{lines: make(map[int]int), branches: make(map[int][]*branchCoverage)}
+		c.files[name] = fc
+	}
+	return fc
+}
+
+func (fc *fileCoverage) tracks(line int) bool {
+	return line >= 1 && line <= strings.Count(fc.source, "\n")+1
+}
+
+// Add records a program run.
+// teal is the program text, offsetToLine maps bytecode offsets to zero-based TEAL lines as logic.OpStream.OffsetToLine,
+// sm is the source map of the program and trace is dryrun trace of the run.
+func (c *Coverage) Add(teal string, offsetToLine map[int]int, sm *compiler.SourceMap, trace string) {
+	// register all source lines and branches of the program
+	for _, loc := range sm.PCs {
+		fc := c.file(loc.File)
+		if len(fc.source) == 0 {
+			fc.source = sm.Source(loc.File)
+		}
+		if _, ok := fc.lines[loc.Line]; !ok && fc.tracks(loc.Line) {
+			fc.lines[loc.Line] = 0
+		}
+	}
+
+	tealLines := strings.Split(teal, "\n")
+	pcs := make([]int, 0, len(offsetToLine))
+	for pc := range offsetToLine {
+		pcs = append(pcs, pc)
+	}
+	sort.Ints(pcs)
+
+	branches := make(map[int]*branchCoverage)
+	// next opcode offset of the branches, switch and match size depends on the number of labels
+	next := make(map[int]int)
+	seen := make(map[compiler.SourceLocation]int)
+	for i, pc := range pcs {
+		line := offsetToLine[pc]
+		if line >= len(tealLines) || !conditionalBranch.MatchString(tealLines[line]) {
+			continue
+		}
+		next[pc] = -1
+		if i+1 < len(pcs) {
+			next[pc] = pcs[i+1]
+		}
+		loc, ok := sm.PCs[pc]
+		if !ok {
+			continue
+		}
+		fc := c.file(loc.File)
+		if !fc.tracks(loc.Line) {
+			continue
+		}
+		key := compiler.SourceLocation{File: loc.File, Line: loc.Line}
+		idx := seen[key]
+		seen[key]++
+		for len(fc.branches[loc.Line]) <= idx {
+			fc.branches[loc.Line] = append(fc.branches[loc.Line], &branchCoverage{})
+		}
+		branches[pc] = fc.branches[loc.Line][idx]
+	}
+
+	// count executions of the program steps, inner application calls are skipped
+	hits := make(map[int]int)
+	depth := 0
+	branchPC := -1
+	for _, line := range strings.Split(trace, "\n") {
+		if strings.HasPrefix(line, "--- enter") {
+			depth++
+			continue
+		}
+		if strings.HasPrefix(line, "--- exit") {
+			depth--
+			continue
+		}
+		if depth > 0 || !traceOp.MatchString(line) {
+			continue
+		}
+		pc, _ := strconv.Atoi(strings.Fields(line)[0])
+		if branchPC >= 0 {
+			if pc == next[branchPC] {
+				branches[branchPC].through++
+			} else {
+				branches[branchPC].jump++
+			}
+			branchPC = -1
+		}
+		if bc, ok := branches[pc]; ok {
+			bc.executed = true
+			branchPC = pc
+		}
+		hits[pc]++
+	}
+
+	// a line is executed as many times as its most executed opcode
+	runs := make(map[compiler.SourceLocation]int)
+	for pc, count := range hits {
+		loc, ok := sm.PCs[pc]
+		if !ok {
+			continue
+		}
+		key := compiler.SourceLocation{File: loc.File, Line: loc.Line}
+		if count > runs[key] {
+			runs[key] = count
+		}
+	}
+	for key, count := range runs {
+		fc := c.file(key.File)
+		if fc.tracks(key.Line) {
+			fc.lines[key.Line] += count
+		}
+	}
+}
+
+func (c *Coverage) fileNames() []string {
+	names := make([]string, 0, len(c.files))
+	for name, fc := range c.files {
+		if len(fc.lines) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedLines(lines map[int]int) []int {
+	result := make([]int, 0, len(lines))
+	for line := range lines {
+		result = append(result, line)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// WriteLcov writes coverage in lcov tracefile format
+func (c *Coverage) WriteLcov(w io.Writer) {
+	for _, name := range c.fileNames() {
+		fc := c.files[name]
+		fmt.Fprintf(w, "TN:\nSF:%s\n", name)
+
+		branchLines := make([]int, 0, len(fc.branches))
+		for line := range fc.branches {
+			branchLines = append(branchLines, line)
+		}
+		sort.Ints(branchLines)
+		found, hit := 0, 0
+		for _, line := range branchLines {
+			for idx, bc := range fc.branches[line] {
+				for branch, count := range []int{bc.through, bc.jump} {
+					taken := "-"
+					if bc.executed {
+						taken = strconv.Itoa(count)
+					}
+					fmt.Fprintf(w, "BRDA:%d,%d,%d,%s\n", line, idx, branch, taken)
+					found++
+					if count > 0 {
+						hit++
+					}
+				}
+			}
+		}
+		fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", found, hit)
+
+		hit = 0
+		for _, line := range sortedLines(fc.lines) {
+			fmt.Fprintf(w, "DA:%d,%d\n", line, fc.lines[line])
+			if fc.lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(fc.lines), hit)
+	}
+}
+
+// WriteListing writes source files annotated with execution counts.
+// Lines never executed are marked with #####, lines without code have no count.
+// Conditional statements list how many times their true and false branches were taken.
+func (c *Coverage) WriteListing(w io.Writer) {
+	for _, name := range c.fileNames() {
+		fc := c.files[name]
+		fmt.Fprintf(w, "%s:\n", name)
+		for idx, text := range strings.Split(strings.TrimRight(fc.source, "\n"), "\n") {
+			line := idx + 1
+			count := ""
+			if runs, ok := fc.lines[line]; ok {
+				count = strconv.Itoa(runs)
+				if runs == 0 {
+					count = "#####"
+				}
+			}
+			fmt.Fprintf(w, "%9s %5d: %s", count, line, text)
+			for _, bc := range fc.branches[line] {
+				fmt.Fprintf(w, "\t// branch true: %d, false: %d", bc.through, bc.jump)
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
+// Summary returns percentage of executed lines and branches
+func (c *Coverage) Summary() string {
+	lines, linesHit, branches, branchesHit := 0, 0, 0, 0
+	for _, fc := range c.files {
+		for _, count := range fc.lines {
+			lines++
+			if count > 0 {
+				linesHit++
+			}
+		}
+		for _, bcs := range fc.branches {
+			for _, bc := range bcs {
+				branches += 2
+				if bc.through > 0 {
+					branchesHit++
+				}
+				if bc.jump > 0 {
+					branchesHit++
+				}
+			}
+		}
+	}
+	percent := func(hit, total int) float64 {
+		if total == 0 {
+			return 100
+		}
+		return float64(hit) * 100 / float64(total)
+	}
+	return fmt.Sprintf("lines: %.1f%% (%d of %d), branches: %.1f%% (%d of %d)",
+		percent(linesHit, lines), linesHit, lines, percent(branchesHit, branches), branchesHit, branches)
+}
@@ -0,0 +1,150 @@
+package dryrun
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+func TestCoverage(t *testing.T) {
+	a := require.New(t)
+
+	source := `function logic() {
+	if txn.Amount > 1000000 {
+		return 0
+	}
+	return 1
+}`
+	teal := `#pragma version 5
+txn Amount
+int 1000000
+>
+bz if_stmt_end
+int 0
+return
+if_stmt_end:
+int 1
+return
+`
+	at := func(line int) compiler.SourceLocation {
+		return compiler.SourceLocation{File: "a.tl", Line: line}
+	}
+	sm := &compiler.SourceMap{Lines: map[int]compiler.SourceLocation{
+		2: at(2), 3: at(2), 4: at(2), 5: at(2),
+		6: at(3), 7: at(3),
+		9: at(5), 10: at(5),
+	}}
+	op, err := logic.AssembleString(teal)
+	a.NoError(err)
+	sm.SetOffsets(op.OffsetToLine)
+
+	cov := NewCoverage()
+	cov.SetSource("a.tl", source)
+
+	// sample transaction amount is above the limit
+	var trace strings.Builder
+	pass, err := Run(op.Program, "", 0, &trace)
+	a.NoError(err)
+	a.False(pass)
+	cov.Add(teal, op.OffsetToLine, sm, trace.String())
+
+	var sb strings.Builder
+	cov.WriteLcov(&sb)
+	expected := `TN:
+SF:a.tl
+BRDA:2,0,0,1
+BRDA:2,0,1,0
+BRF:2
+BRH:1
+DA:2,1
+DA:3,1
+DA:5,0
+LF:3
+LH:2
+end_of_record
+`
+	a.Equal(expected, sb.String())
+	a.Equal("lines: 66.7% (2 of 3), branches: 50.0% (1 of 2)", cov.Summary())
+
+	sb.Reset()
+	cov.WriteListing(&sb)
+	expected = `a.tl:
+              1: function logic() {
+        1     2: 	if txn.Amount > 1000000 {	// branch true: 1, false: 0
+        1     3: 		return 0
+              4: 	}
+    #####     5: 	return 1
+              6: }
+`
+	a.Equal(expected, sb.String())
+
+	// a program that never reaches the branch still registers its lines
+	empty := NewCoverage()
+	empty.SetSource("a.tl", source)
+	empty.Add(teal, op.OffsetToLine, sm, "")
+	sb.Reset()
+	empty.WriteLcov(&sb)
+	a.Contains(sb.String(), "BRDA:2,0,0,-\nBRDA:2,0,1,-\n")
+	a.Contains(sb.String(), "LH:0\n")
+}
+
+func TestCoverageSwitch(t *testing.T) {
+	a := require.New(t)
+
+	source := `function logic() {
+	switch txn.NumAppArgs {
+		case 0: { return 1 }
+		case 1: { return 2 }
+		default: { return 0 }
+	}
+}`
+	// the assembler does not support TEAL 8 so offsets and traces are made by hand
+	teal := `#pragma version 8
+txn NumAppArgs
+switch case_0 case_1
+b default
+case_0:
+pushint 1
+return
+case_1:
+pushint 2
+return
+default:
+pushint 0
+return
+`
+	offsetToLine := map[int]int{1: 1, 3: 2, 9: 3, 12: 5, 14: 6, 15: 8, 17: 9, 18: 11, 20: 12}
+	at := func(line int) compiler.SourceLocation {
+		return compiler.SourceLocation{File: "a.tl", Line: line}
+	}
+	sm := &compiler.SourceMap{Lines: map[int]compiler.SourceLocation{
+		1: at(2), 2: at(2), 3: at(2),
+		5: at(3), 6: at(3),
+		8: at(4), 9: at(4),
+		11: at(5), 12: at(5),
+	}}
+	sm.SetOffsets(offsetToLine)
+
+	cov := NewCoverage()
+	cov.SetSource("a.tl", source)
+	cov.Add(teal, offsetToLine, sm, `  1 txn NumAppArgs => (0 0x0) 
+  3 switch case_0 case_1 => <empty stack>
+ 12 pushint 1 => (1 0x1) 
+ 14 return => (1 0x1) 
+`)
+	cov.Add(teal, offsetToLine, sm, `  1 txn NumAppArgs => (5 0x5) 
+  3 switch case_0 case_1 => <empty stack>
+  9 b default => <empty stack>
+ 18 pushint 0 => (0 0x0) 
+ 20 return => (0 0x0) 
+`)
+
+	var sb strings.Builder
+	cov.WriteLcov(&sb)
+	a.Contains(sb.String(), "BRDA:2,0,0,1\nBRDA:2,0,1,1\nBRF:2\nBRH:2\n")
+	a.Contains(sb.String(), "DA:2,2\nDA:3,1\nDA:4,0\nDA:5,1\n")
+}
@@ -0,0 +1,336 @@
+package dryrun
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions/logic"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+const debuggerPrompt = "(debug) "
+
+const debuggerHelp = `commands:
+  s, step              run until the next source line
+  n, next              run until the next source line of the current function
+  f, finish            run until the current function returns
+  c, continue          run until a breakpoint or the program end
+  b, break [file:]line set a breakpoint, current line if omitted
+  d, delete [file:]line delete a breakpoint
+  p, print name        print a variable
+  v, vars              print variables live at the current line
+  stack                print TEAL stack
+  l, list              print source around the current line
+  q, quit              stop the program
+  h, help              print this help
+empty line repeats the last command
+`
+
+type debugMode int
+
+const (
+	stepMode debugMode = iota
+	nextMode
+	continueMode
+)
+
+// Debugger steps through the program at source line granularity, implements logic.DebuggerHook.
+// Evaluation is paused on new source lines and commands are read from the input.
+type Debugger struct {
+	sm     *compiler.SourceMap
+	execID string
+	in     *bufio.Scanner
+	out    io.Writer
+
+	breakpoints map[compiler.SourceLocation]bool
+	mode        debugMode
+	// callsub depth of the current pc and the depth next and finish commands stop at
+	depth     int
+	stopDepth int
+	ops       map[int]string
+	prevOp    string
+	current   compiler.SourceLocation
+	last      string
+}
+
+// NewDebugger creates a debugger for the program with source map sm.
+// Without breakpoints it stops at the first source line, otherwise at the first breakpoint hit.
+func NewDebugger(program []byte, sm *compiler.SourceMap, breakpoints []compiler.SourceLocation, in io.Reader, out io.Writer) *Debugger {
+	d := &Debugger{
+		sm:          sm,
+		execID:      logic.GetProgramID(program),
+		in:          bufio.NewScanner(in),
+		out:         out,
+		breakpoints: make(map[compiler.SourceLocation]bool),
+		ops:         make(map[int]string),
+	}
+	for _, bp := range breakpoints {
+		d.breakpoints[compiler.SourceLocation{File: bp.File, Line: bp.Line}] = true
+	}
+	if len(breakpoints) > 0 {
+		d.mode = continueMode
+	}
+	return d
+}
+
+// ParseLocation parses [file:]line breakpoint location
+func ParseLocation(value string, file string) (loc compiler.SourceLocation, err error) {
+	line := value
+	if idx := strings.LastIndex(value, ":"); idx >= 0 {
+		file = value[:idx]
+		line = value[idx+1:]
+	}
+	loc.File = file
+	if loc.Line, err = strconv.Atoi(line); err != nil || loc.Line < 1 {
+		return loc, fmt.Errorf("invalid location %s, expected [file:]line", value)
+	}
+	return loc, nil
+}
+
+// Register remembers opcodes of the program to track function calls
+func (d *Debugger) Register(state *logic.DebugState) error {
+	if state.ExecID != d.execID {
+		return nil
+	}
+	for _, po := range state.PCOffset {
+		if po.Offset < len(state.Disassembly) {
+			text := state.Disassembly[po.Offset:]
+			if fields := strings.Fields(strings.SplitN(text, "\n", 2)[0]); len(fields) > 0 {
+				d.ops[po.PC] = fields[0]
+			}
+		}
+	}
+	return nil
+}
+
+// Update is called before every opcode execution and pauses on new source lines
+func (d *Debugger) Update(state *logic.DebugState) error {
+	if state.ExecID != d.execID {
+		// inner application calls
+		return nil
+	}
+	switch d.prevOp {
+	case "callsub":
+		d.depth++
+	case "retsub":
+		d.depth--
+	}
+	d.prevOp = d.ops[state.PC]
+
+	loc, ok := d.sm.PCs[state.PC]
+	if !ok {
+		return nil
+	}
+	line := compiler.SourceLocation{File: loc.File, Line: loc.Line}
+	if line == d.current {
+		return nil
+	}
+	d.current = line
+
+	stop := d.breakpoints[line]
+	switch d.mode {
+	case stepMode:
+		stop = true
+	case nextMode:
+		stop = stop || d.depth <= d.stopDepth
+	}
+	if !stop {
+		return nil
+	}
+	return d.prompt(state)
+}
+
+// Complete reports the program end
+func (d *Debugger) Complete(state *logic.DebugState) error {
+	if state.ExecID != d.execID {
+		return nil
+	}
+	if len(state.Error) > 0 {
+		fmt.Fprintf(d.out, "program failed at %s: %s\n", d.current.String(), state.Error)
+	} else {
+		fmt.Fprintf(d.out, "program finished\n")
+	}
+	d.writeStack(state)
+	return nil
+}
+
+func (d *Debugger) prompt(state *logic.DebugState) error {
+	if text := d.sm.SourceText(d.current); len(text) > 0 {
+		fmt.Fprintf(d.out, "%s: %s\n", d.current.String(), text)
+	} else {
+		fmt.Fprintf(d.out, "%s\n", d.current.String())
+	}
+	for {
+		fmt.Fprint(d.out, debuggerPrompt)
+		if !d.in.Scan() {
+			// no more commands, run to the end
+			fmt.Fprintln(d.out)
+			d.mode = continueMode
+			d.breakpoints = nil
+			return nil
+		}
+		command := strings.TrimSpace(d.in.Text())
+		if len(command) == 0 {
+			command = d.last
+		}
+		d.last = command
+
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := ""
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+		switch fields[0] {
+		case "s", "step":
+			d.mode = stepMode
+			return nil
+		case "n", "next":
+			d.mode = nextMode
+			d.stopDepth = d.depth
+			return nil
+		case "f", "finish":
+			d.mode = nextMode
+			d.stopDepth = d.depth - 1
+			return nil
+		case "c", "continue":
+			d.mode = continueMode
+			return nil
+		case "b", "break", "d", "delete":
+			loc := d.current
+			if len(arg) > 0 {
+				var err error
+				if loc, err = ParseLocation(arg, d.current.File); err != nil {
+					fmt.Fprintln(d.out, err.Error())
+					continue
+				}
+			}
+			if fields[0] == "b" || fields[0] == "break" {
+				d.breakpoints[loc] = true
+				fmt.Fprintf(d.out, "breakpoint at %s\n", loc.String())
+			} else {
+				delete(d.breakpoints, loc)
+				fmt.Fprintf(d.out, "deleted breakpoint at %s\n", loc.String())
+			}
+		case "p", "print":
+			d.writeVariable(state, arg)
+		case "v", "vars":
+			for _, v := range d.liveVariables() {
+				fmt.Fprintf(d.out, "%s = %s\n", v.Name, formatValue(scratchValue(state, v.Slot)))
+			}
+		case "stack":
+			d.writeStack(state)
+		case "l", "list":
+			d.writeListing()
+		case "q", "quit":
+			return fmt.Errorf("stopped by debugger at %s", d.current.String())
+		case "h", "help":
+			fmt.Fprint(d.out, debuggerHelp)
+		default:
+			fmt.Fprintf(d.out, "unknown command %s, type help for the list of commands\n", fields[0])
+		}
+	}
+}
+
+// liveVariables returns variables referenced before and after the current line
+func (d *Debugger) liveVariables() (result []compiler.Variable) {
+	for _, v := range d.sm.Variables {
+		if v.File == d.current.File && v.Line <= d.current.Line && d.current.Line <= v.EndLine {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return
+}
+
+func (d *Debugger) writeVariable(state *logic.DebugState, name string) {
+	var found *compiler.Variable
+	for _, v := range d.liveVariables() {
+		if v.Name == name {
+			found = &v
+			break
+		}
+	}
+	if found == nil {
+		for idx, v := range d.sm.Variables {
+			if v.Name == name {
+				if found != nil {
+					fmt.Fprintf(d.out, "%s is not live here and is declared several times\n", name)
+					return
+				}
+				found = &d.sm.Variables[idx]
+			}
+		}
+	}
+	if found == nil {
+		fmt.Fprintf(d.out, "no variable %s\n", name)
+		return
+	}
+	fmt.Fprintf(d.out, "%s %s = %s (slot %d)\n", found.Name, found.Type, formatValue(scratchValue(state, found.Slot)), found.Slot)
+}
+
+func (d *Debugger) writeStack(state *logic.DebugState) {
+	if len(state.Stack) == 0 {
+		fmt.Fprintf(d.out, "stack: <empty>\n")
+		return
+	}
+	fmt.Fprintf(d.out, "stack:\n")
+	for idx, value := range state.Stack {
+		fmt.Fprintf(d.out, "  [%d] %s\n", idx, formatValue(value))
+	}
+}
+
+func (d *Debugger) writeListing() {
+	const context = 3
+	lines := strings.Split(d.sm.Source(d.current.File), "\n")
+	from := d.current.Line - context
+	if from < 1 {
+		from = 1
+	}
+	to := d.current.Line + context
+	if to > len(lines) {
+		to = len(lines)
+	}
+	for line := from; line <= to; line++ {
+		marker := "  "
+		if line == d.current.Line {
+			marker = "=>"
+		} else if d.breakpoints[compiler.SourceLocation{File: d.current.File, Line: line}] {
+			marker = "* "
+		}
+		fmt.Fprintf(d.out, "%s %4d: %s\n", marker, line, lines[line-1])
+	}
+}
+
+func scratchValue(state *logic.DebugState, slot uint) basics.TealValue {
+	if int(slot) < len(state.Scratch) {
+		return state.Scratch[slot]
+	}
+	return basics.TealValue{}
+}
+
+func formatValue(value basics.TealValue) string {
+	if value.Type != basics.TealBytesType {
+		return strconv.FormatUint(value.Uint, 10)
+	}
+	printable := len(value.Bytes) > 0
+	for _, r := range value.Bytes {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return fmt.Sprintf("0x%x (%q)", value.Bytes, value.Bytes)
+	}
+	return fmt.Sprintf("0x%x", value.Bytes)
+}
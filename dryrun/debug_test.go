@@ -0,0 +1,92 @@
+package dryrun
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+func TestParseLocation(t *testing.T) {
+	a := require.New(t)
+
+	loc, err := ParseLocation("5", "a.tl")
+	a.NoError(err)
+	a.Equal(compiler.SourceLocation{File: "a.tl", Line: 5}, loc)
+
+	loc, err = ParseLocation("lib.tl:12", "a.tl")
+	a.NoError(err)
+	a.Equal(compiler.SourceLocation{File: "lib.tl", Line: 12}, loc)
+
+	_, err = ParseLocation("a.tl:x", "a.tl")
+	a.Error(err)
+	_, err = ParseLocation("0", "a.tl")
+	a.Error(err)
+}
+
+func TestDebugger(t *testing.T) {
+	a := require.New(t)
+
+	// function logic() {
+	// 	let a = txn.Fee
+	// 	let b = a + 1
+	// 	return b
+	// }
+	teal := `#pragma version 5
+txn Fee
+store 0
+load 0
+int 1
++
+store 1
+load 1
+return
+`
+	at := func(line int) compiler.SourceLocation {
+		return compiler.SourceLocation{File: "a.tl", Line: line}
+	}
+	sm := &compiler.SourceMap{
+		Lines: map[int]compiler.SourceLocation{
+			2: at(2), 3: at(2),
+			4: at(3), 5: at(3), 6: at(3), 7: at(3),
+			8: at(4), 9: at(4),
+		},
+		Variables: []compiler.Variable{
+			{Name: "a", Function: "logic", Type: "uint64", Slot: 0, File: "a.tl", Line: 2, EndLine: 3},
+			{Name: "b", Function: "logic", Type: "uint64", Slot: 1, File: "a.tl", Line: 3, EndLine: 4},
+		},
+	}
+	op, err := logic.AssembleString(teal)
+	a.NoError(err)
+	sm.SetOffsets(op.OffsetToLine)
+
+	commands := "s\np a\nv\nstack\nc\n"
+	var out strings.Builder
+	debugger := NewDebugger(op.Program, sm, nil, strings.NewReader(commands), &out)
+	pass, err := DebugRun(op.Program, "", 0, debugger)
+	a.NoError(err)
+	a.True(pass)
+
+	expected := `a.tl:2
+(debug) a.tl:3
+(debug) a uint64 = 1000 (slot 0)
+(debug) a = 1000
+b = 0
+(debug) stack: <empty>
+(debug) program finished
+stack:
+  [0] 1001
+`
+	a.Equal(expected, out.String())
+
+	// breakpoint skips to line 4, quit stops evaluation
+	out.Reset()
+	debugger = NewDebugger(op.Program, sm, []compiler.SourceLocation{at(4)}, strings.NewReader("p b\nq\n"), &out)
+	pass, err = DebugRun(op.Program, "", 0, debugger)
+	a.Error(err)
+	a.False(pass)
+	a.Contains(out.String(), "a.tl:4\n(debug) b uint64 = 1001 (slot 1)\n")
+}
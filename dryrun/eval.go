@@ -1,12 +1,16 @@
 package dryrun
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
 
 	"github.com/algorand/go-algorand/config"
+	"github.com/algorand/go-algorand/crypto"
 	"github.com/algorand/go-algorand/data/basics"
 	"github.com/algorand/go-algorand/data/transactions"
 	"github.com/algorand/go-algorand/data/transactions/logic"
@@ -15,35 +19,83 @@ import (
 
 //go:generate sh ./bundle_sampletxn_json.sh
 
-// Run bytecode using transaction data from txnFile file
-func Run(bytecode []byte, txnFile string, trace *strings.Builder) (bool, error) {
-	txn, err := loadTxn(txnFile)
+// Run bytecode as LogicSig of groupIndex transaction using transaction group from txnFile file.
+// LogicSigs of other transactions in the group are evaluated as well.
+func Run(bytecode []byte, txnFile string, groupIndex int, trace *strings.Builder) (bool, error) {
+	stxns, err := loadTxns(txnFile)
 	if err != nil {
 		return false, err
 	}
-
-	stxn := transactions.SignedTxn{Lsig: transactions.LogicSig{Logic: bytecode}}
-	stxn.Txn = txn
 	proto := config.Consensus[protocol.ConsensusCurrentVersion]
+	return runSignature(bytecode, stxns, groupIndex, &proto, trace, nil)
+}
 
-	stxnads := []transactions.SignedTxnWithAD{{SignedTxn: stxn}}
-	ep := logic.EvalParams{TxnGroup: stxnads, Proto: &proto}
-	err = logic.CheckSignature(0, &ep)
+// DebugRun evaluates bytecode as Run does with the debugger attached to its evaluation
+func DebugRun(bytecode []byte, txnFile string, groupIndex int, debugger logic.DebuggerHook) (bool, error) {
+	stxns, err := loadTxns(txnFile)
 	if err != nil {
 		return false, err
 	}
+	proto := config.Consensus[protocol.ConsensusCurrentVersion]
+	return runSignature(bytecode, stxns, groupIndex, &proto, nil, debugger)
+}
 
-	ep = logic.EvalParams{
-		Proto:    &proto,
-		Trace:    trace,
-		TxnGroup: stxnads,
+func runSignature(bytecode []byte, stxns []transactions.SignedTxn, groupIndex int, proto *config.ConsensusParams, trace *strings.Builder, debugger logic.DebuggerHook) (bool, error) {
+	if err := checkGroupIndex(groupIndex, stxns); err != nil {
+		return false, err
 	}
+	stxns[groupIndex].Lsig.Logic = bytecode
 
-	pass, err := logic.EvalSignature(0, &ep)
-	return pass, err
+	ep := logic.NewEvalParams(withApplyData(stxns), proto, &transactions.SpecialAddresses{})
+	if err := logic.CheckSignature(groupIndex, ep); err != nil {
+		return false, err
+	}
+
+	ep.Trace = trace
+	ep.Debugger = debugger
+	pass, err := logic.EvalSignature(groupIndex, ep)
+	ep.Trace = nil
+	ep.Debugger = nil
+	if !pass || err != nil {
+		return pass, err
+	}
+
+	for i := range ep.TxnGroup {
+		if i == groupIndex || len(ep.TxnGroup[i].Lsig.Logic) == 0 {
+			continue
+		}
+		if err := logic.CheckSignature(i, ep); err != nil {
+			return pass, fmt.Errorf("txn %d: %s", i, err.Error())
+		}
+		if ok, err := logic.EvalSignature(i, ep); !ok || err != nil {
+			if err == nil {
+				err = fmt.Errorf("LogicSig rejected")
+			}
+			return pass, fmt.Errorf("txn %d: %s", i, err.Error())
+		}
+	}
+	return pass, nil
+}
+
+func checkGroupIndex(groupIndex int, stxns []transactions.SignedTxn) error {
+	if groupIndex < 0 || groupIndex >= len(stxns) {
+		return fmt.Errorf("group index %d is out of range of %d transactions", groupIndex, len(stxns))
+	}
+	return nil
 }
 
-func loadTxn(txnFile string) (txn transactions.Transaction, err error) {
+func withApplyData(stxns []transactions.SignedTxn) []transactions.SignedTxnWithAD {
+	stxnads := make([]transactions.SignedTxnWithAD, len(stxns))
+	for i, stxn := range stxns {
+		stxnads[i].SignedTxn = stxn
+	}
+	return stxnads
+}
+
+// loadTxns reads a transaction group from txnFile file.
+// JSON file holds a single transaction description or an array of them,
+// any other content is decoded as msgpack signed transactions as written by goal.
+func loadTxns(txnFile string) (stxns []transactions.SignedTxn, err error) {
 	var txnData []byte
 	if txnFile != "" {
 		txnData, err = ioutil.ReadFile(txnFile)
@@ -54,47 +106,199 @@ func loadTxn(txnFile string) (txn transactions.Transaction, err error) {
 		txnData = sampleTxnData
 	}
 
-	var sampleTxn txnDesc
-	err = json.Unmarshal(txnData, &sampleTxn)
+	trimmed := bytes.TrimSpace(txnData)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		dec := protocol.NewDecoderBytes(txnData)
+		for {
+			var stxn transactions.SignedTxn
+			if err = dec.Decode(&stxn); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			stxns = append(stxns, stxn)
+		}
+		if len(stxns) == 0 {
+			return nil, fmt.Errorf("no transactions in %s", txnFile)
+		}
+		return stxns, nil
+	}
+
+	var descs []txnDesc
+	if trimmed[0] == '{' {
+		descs = make([]txnDesc, 1)
+		err = json.Unmarshal(txnData, &descs[0])
+	} else {
+		err = json.Unmarshal(txnData, &descs)
+	}
 	if err != nil {
 		return
 	}
+	if len(descs) == 0 {
+		return nil, fmt.Errorf("no transactions in %s", txnFile)
+	}
+
+	stxns = make([]transactions.SignedTxn, len(descs))
+	for i, desc := range descs {
+		if stxns[i], err = decodeTxnDesc(desc); err != nil {
+			return nil, fmt.Errorf("txn %d: %s", i, err.Error())
+		}
+	}
+	if len(stxns) > 1 {
+		var group transactions.TxGroup
+		for _, stxn := range stxns {
+			group.TxGroupHashes = append(group.TxGroupHashes, crypto.Digest(stxn.Txn.ID()))
+		}
+		groupID := crypto.HashObj(group)
+		for i := range stxns {
+			stxns[i].Txn.Group = groupID
+		}
+	}
+	return stxns, nil
+}
+
+func decodeTxnDesc(desc txnDesc) (stxn transactions.SignedTxn, err error) {
+	txn := &stxn.Txn
+
+	txn.Type = protocol.TxType(desc.Type)
+	if desc.Type == "" && desc.TypeEnum < uint64(len(logic.TxnTypeNames)) {
+		txn.Type = protocol.TxType(logic.TxnTypeNames[desc.TypeEnum])
+	}
+	if txn.Sender, err = parseAddress(desc.Sender); err != nil {
+		return
+	}
+	txn.Fee = basics.MicroAlgos{Raw: desc.Fee}
+	txn.FirstValid = basics.Round(desc.FirstValid)
+	txn.LastValid = basics.Round(desc.LastValid)
+	if txn.Note, err = base64.StdEncoding.DecodeString(desc.Note); err != nil {
+		return
+	}
+	if err = decodeFixed(txn.Lease[:], desc.Lease); err != nil {
+		return
+	}
+	if txn.RekeyTo, err = parseAddress(desc.RekeyTo); err != nil {
+		return
+	}
 
-	txn.Type = protocol.TxType(sampleTxn.Type)
-	if txn.Sender, err = basics.UnmarshalChecksumAddress(sampleTxn.Sender); err != nil {
+	txn.Amount = basics.MicroAlgos{Raw: desc.Amount}
+	if txn.Receiver, err = parseAddress(desc.Receiver); err != nil {
 		return
 	}
-	txn.Fee = basics.MicroAlgos{sampleTxn.Fee}
-	txn.FirstValid = basics.Round(sampleTxn.FirstValid)
-	txn.LastValid = basics.Round(sampleTxn.LastValid)
-	if txn.Note, err = base64.StdEncoding.DecodeString(sampleTxn.Note); err != nil {
+	if txn.CloseRemainderTo, err = parseAddress(desc.CloseRemainderTo); err != nil {
+		return
+	}
+
+	if err = decodeFixed(txn.VotePK[:], desc.VotePK); err != nil {
 		return
 	}
-	var lease []byte
-	if lease, err = base64.StdEncoding.DecodeString(sampleTxn.Lease); err != nil {
+	if err = decodeFixed(txn.SelectionPK[:], desc.SelectionPK); err != nil {
 		return
 	}
-	copy(txn.Lease[:], lease)
+	txn.VoteFirst = basics.Round(desc.VoteFirst)
+	txn.VoteLast = basics.Round(desc.VoteLast)
+	txn.VoteKeyDilution = desc.VoteKeyDilution
+	txn.Nonparticipation = desc.Nonparticipation
 
-	txn.Amount = basics.MicroAlgos{sampleTxn.Amount}
-	if txn.Receiver, err = basics.UnmarshalChecksumAddress(sampleTxn.Receiver); err != nil {
+	txn.XferAsset = basics.AssetIndex(desc.XferAsset)
+	txn.AssetAmount = desc.AssetAmount
+	if txn.AssetSender, err = parseAddress(desc.AssetSender); err != nil {
+		return
+	}
+	if txn.AssetReceiver, err = parseAddress(desc.AssetReceiver); err != nil {
+		return
+	}
+	if txn.AssetCloseTo, err = parseAddress(desc.AssetCloseTo); err != nil {
+		return
+	}
+
+	txn.ConfigAsset = basics.AssetIndex(desc.ConfigAsset)
+	txn.AssetParams = basics.AssetParams{
+		Total:         desc.ConfigAssetTotal,
+		Decimals:      uint32(desc.ConfigAssetDecimals),
+		DefaultFrozen: desc.ConfigAssetDefaultFrozen,
+		UnitName:      desc.ConfigAssetUnitName,
+		AssetName:     desc.ConfigAssetName,
+		URL:           desc.ConfigAssetURL,
+	}
+	if err = decodeFixed(txn.AssetParams.MetadataHash[:], desc.ConfigAssetMetadataHash); err != nil {
+		return
+	}
+	if txn.AssetParams.Manager, err = parseAddress(desc.ConfigAssetManager); err != nil {
+		return
+	}
+	if txn.AssetParams.Reserve, err = parseAddress(desc.ConfigAssetReserve); err != nil {
+		return
+	}
+	if txn.AssetParams.Freeze, err = parseAddress(desc.ConfigAssetFreeze); err != nil {
+		return
+	}
+	if txn.AssetParams.Clawback, err = parseAddress(desc.ConfigAssetClawback); err != nil {
 		return
 	}
-	if txn.CloseRemainderTo, err = basics.UnmarshalChecksumAddress(sampleTxn.CloseRemainderTo); err != nil {
+
+	txn.FreezeAsset = basics.AssetIndex(desc.FreezeAsset)
+	if txn.FreezeAccount, err = parseAddress(desc.FreezeAssetAccount); err != nil {
 		return
 	}
+	txn.AssetFrozen = desc.FreezeAssetFrozen
 
-	txn.XferAsset = basics.AssetIndex(sampleTxn.XferAsset)
-	txn.AssetAmount = sampleTxn.AssetAmount
-	if txn.AssetSender, err = basics.UnmarshalChecksumAddress(sampleTxn.AssetSender); err != nil {
+	txn.ApplicationID = basics.AppIndex(desc.ApplicationID)
+	txn.OnCompletion = transactions.OnCompletion(desc.OnCompletion)
+	if txn.ApplicationArgs, err = decodeList(desc.ApplicationArgs); err != nil {
 		return
 	}
-	if txn.AssetReceiver, err = basics.UnmarshalChecksumAddress(sampleTxn.AssetReceiver); err != nil {
+	for _, account := range desc.Accounts {
+		var addr basics.Address
+		if addr, err = parseAddress(account); err != nil {
+			return
+		}
+		txn.Accounts = append(txn.Accounts, addr)
+	}
+	for _, app := range desc.Applications {
+		txn.ForeignApps = append(txn.ForeignApps, basics.AppIndex(app))
+	}
+	for _, asset := range desc.Assets {
+		txn.ForeignAssets = append(txn.ForeignAssets, basics.AssetIndex(asset))
+	}
+	if txn.ApprovalProgram, err = base64.StdEncoding.DecodeString(desc.ApprovalProgram); err != nil {
 		return
 	}
-	if txn.AssetCloseTo, err = basics.UnmarshalChecksumAddress(sampleTxn.AssetCloseTo); err != nil {
+	if txn.ClearStateProgram, err = base64.StdEncoding.DecodeString(desc.ClearStateProgram); err != nil {
 		return
 	}
+	txn.GlobalStateSchema = basics.StateSchema{NumUint: desc.GlobalNumUint, NumByteSlice: desc.GlobalNumByteSlice}
+	txn.LocalStateSchema = basics.StateSchema{NumUint: desc.LocalNumUint, NumByteSlice: desc.LocalNumByteSlice}
+	txn.ExtraProgramPages = uint32(desc.ExtraProgramPages)
 
-	return txn, nil
+	if stxn.Lsig.Logic, err = base64.StdEncoding.DecodeString(desc.Logic); err != nil {
+		return
+	}
+	if stxn.Lsig.Args, err = decodeList(desc.Args); err != nil {
+		return
+	}
+	return stxn, nil
+}
+
+// decodeFixed decodes base64-encoded value into a fixed size field
+func decodeFixed(field []byte, value string) error {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	if len(data) > len(field) {
+		return fmt.Errorf("value %s is longer than %d bytes", value, len(field))
+	}
+	copy(field, data)
+	return nil
+}
+
+func decodeList(values []string) (result [][]byte, err error) {
+	for _, value := range values {
+		var data []byte
+		if data, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return
+		}
+		result = append(result, data)
+	}
+	return
 }
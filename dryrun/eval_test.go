@@ -0,0 +1,153 @@
+package dryrun
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions"
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/algorand/go-algorand/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// sender and receiver from sampletxn.json
+const sender = "47YPQTIGQEO7T4Y4RWDYWEKV6RTR2UNBQXBABEEGM72ESWDQNCQ52OPASU"
+const receiver = "PNWOET7LLOWMBMLE4KOCELCX6X3D3Q4H2Q4QJASYIEOF7YIPPQBG3YQ5YI"
+
+func TestLoadTxns(t *testing.T) {
+	a := require.New(t)
+
+	// sample transaction
+	stxns, err := loadTxns("")
+	a.NoError(err)
+	a.Equal(1, len(stxns))
+	a.Equal(protocol.PaymentTx, stxns[0].Txn.Type)
+	a.Equal(uint64(2000000), stxns[0].Txn.Amount.Raw)
+	a.True(stxns[0].Txn.Group.IsZero())
+
+	group := `[
+	{"Sender": "` + sender + `", "TypeEnum": 1, "Receiver": "` + receiver + `", "Amount": 5, "RekeyTo": "` + receiver + `"},
+	{"Sender": "` + sender + `", "Type": "appl", "ApplicationID": 5, "OnCompletion": 1,
+	 "ApplicationArgs": ["AQI=", ""], "Accounts": ["` + receiver + `"], "Applications": [7], "Assets": [8],
+	 "GlobalNumUint": 2, "LocalNumByteSlice": 3, "ExtraProgramPages": 1},
+	{"Sender": "` + sender + `", "Type": "acfg", "ConfigAsset": 8, "ConfigAssetTotal": 100, "ConfigAssetDecimals": 2,
+	 "ConfigAssetUnitName": "TOK", "ConfigAssetManager": "` + receiver + `", "ConfigAssetMetadataHash": "AQI="},
+	{"Sender": "` + sender + `", "Type": "afrz", "FreezeAsset": 8, "FreezeAssetAccount": "` + receiver + `", "FreezeAssetFrozen": true},
+	{"Sender": "` + sender + `", "Type": "keyreg", "VotePK": "AQI=", "VoteFirst": 1, "VoteLast": 10, "VoteKeyDilution": 3},
+	{"Sender": "` + sender + `", "Type": "axfer", "XferAsset": 8, "AssetAmount": 1, "AssetReceiver": "` + receiver + `",
+	 "Logic": "BYEB", "Args": ["AQ=="]}
+]`
+	txnFile := filepath.Join(t.TempDir(), "group.json")
+	a.NoError(ioutil.WriteFile(txnFile, []byte(group), 0644))
+	stxns, err = loadTxns(txnFile)
+	a.NoError(err)
+	a.Equal(6, len(stxns))
+	for _, stxn := range stxns {
+		a.False(stxn.Txn.Group.IsZero())
+		a.Equal(stxns[0].Txn.Group, stxn.Txn.Group)
+	}
+	rcv, err := basics.UnmarshalChecksumAddress(receiver)
+	a.NoError(err)
+
+	a.Equal(protocol.PaymentTx, stxns[0].Txn.Type)
+	a.Equal(rcv, stxns[0].Txn.RekeyTo)
+
+	appl := stxns[1].Txn
+	a.Equal(basics.AppIndex(5), appl.ApplicationID)
+	a.Equal(transactions.OptInOC, appl.OnCompletion)
+	a.Equal([][]byte{{1, 2}, {}}, appl.ApplicationArgs)
+	a.Equal([]basics.Address{rcv}, appl.Accounts)
+	a.Equal([]basics.AppIndex{7}, appl.ForeignApps)
+	a.Equal([]basics.AssetIndex{8}, appl.ForeignAssets)
+	a.Equal(basics.StateSchema{NumUint: 2}, appl.GlobalStateSchema)
+	a.Equal(basics.StateSchema{NumByteSlice: 3}, appl.LocalStateSchema)
+	a.Equal(uint32(1), appl.ExtraProgramPages)
+
+	acfg := stxns[2].Txn
+	a.Equal(basics.AssetIndex(8), acfg.ConfigAsset)
+	a.Equal(uint64(100), acfg.AssetParams.Total)
+	a.Equal(uint32(2), acfg.AssetParams.Decimals)
+	a.Equal("TOK", acfg.AssetParams.UnitName)
+	a.Equal(rcv, acfg.AssetParams.Manager)
+	a.Equal(byte(2), acfg.AssetParams.MetadataHash[1])
+
+	afrz := stxns[3].Txn
+	a.Equal(basics.AssetIndex(8), afrz.FreezeAsset)
+	a.Equal(rcv, afrz.FreezeAccount)
+	a.True(afrz.AssetFrozen)
+
+	keyreg := stxns[4].Txn
+	a.Equal(byte(2), keyreg.VotePK[1])
+	a.Equal(basics.Round(10), keyreg.VoteLast)
+	a.Equal(uint64(3), keyreg.VoteKeyDilution)
+
+	a.Equal([]byte{5, 129, 1}, stxns[5].Lsig.Logic)
+	a.Equal([][]byte{{1}}, stxns[5].Lsig.Args)
+
+	// msgpack
+	var data []byte
+	for _, stxn := range stxns {
+		data = append(data, protocol.Encode(&stxn)...)
+	}
+	txnFile = filepath.Join(t.TempDir(), "group.txn")
+	a.NoError(ioutil.WriteFile(txnFile, data, 0644))
+	decoded, err := loadTxns(txnFile)
+	a.NoError(err)
+	a.Equal(len(stxns), len(decoded))
+	for i := range stxns {
+		a.Equal(protocol.Encode(&stxns[i]), protocol.Encode(&decoded[i]))
+	}
+
+	a.NoError(ioutil.WriteFile(txnFile, []byte("[]"), 0644))
+	_, err = loadTxns(txnFile)
+	a.Error(err)
+}
+
+func TestRunGroup(t *testing.T) {
+	a := require.New(t)
+
+	group := `[
+	{"Sender": "` + sender + `", "Type": "pay", "Receiver": "` + receiver + `", "Amount": 5, "Logic": "BYEB"},
+	{"Sender": "` + sender + `", "Type": "pay"}
+]`
+	txnFile := filepath.Join(t.TempDir(), "group.json")
+	a.NoError(ioutil.WriteFile(txnFile, []byte(group), 0644))
+
+	op, err := logic.AssembleString(`#pragma version 5
+global GroupSize
+int 2
+==
+gtxn 0 Amount
+int 5
+==
+&&
+txn GroupIndex
+int 1
+==
+&&
+`)
+	a.NoError(err)
+
+	var trace strings.Builder
+	pass, err := Run(op.Program, txnFile, 1, &trace)
+	a.NoError(err, trace.String())
+	a.True(pass)
+
+	// the program expects to be the second transaction
+	pass, err = Run(op.Program, txnFile, 0, &trace)
+	a.False(pass)
+	a.NoError(err)
+
+	// LogicSig of the other transaction is evaluated too
+	group = strings.Replace(group, "BYEB", "BYEA", 1)
+	a.NoError(ioutil.WriteFile(txnFile, []byte(group), 0644))
+	pass, err = Run(op.Program, txnFile, 1, &trace)
+	a.True(pass)
+	a.EqualError(err, "txn 0: LogicSig rejected")
+
+	_, err = Run(op.Program, txnFile, 2, &trace)
+	a.Error(err)
+}
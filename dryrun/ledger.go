@@ -0,0 +1,681 @@
+package dryrun
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions"
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/algorand/go-algorand/protocol"
+)
+
+// ledgerDesc is a JSON description of the ledger state an application call runs against
+type ledgerDesc struct {
+	Round           uint64
+	LatestTimestamp int64
+	Accounts        []accountDesc
+	Apps            []appDesc
+	Assets          []assetDesc
+}
+
+type accountDesc struct {
+	Address  string // Algorand Address, base32-encoded string with checksum
+	Balance  uint64
+	AuthAddr string // Algorand Address, base32-encoded string with checksum
+	Assets   []holdingDesc
+	Locals   []localsDesc
+}
+
+type holdingDesc struct {
+	Asset  uint64
+	Amount uint64
+	Frozen bool
+}
+
+type localsDesc struct {
+	App   uint64
+	State map[string]tealValueDesc
+}
+
+// tealValueDesc is either {"Uint": 1} or {"Bytes": "base64-encoded"}
+type tealValueDesc struct {
+	Uint  *uint64
+	Bytes *string
+}
+
+type appDesc struct {
+	ID                 uint64
+	Creator            string // Algorand Address, base32-encoded string with checksum
+	Balance            uint64 // balance of the application account
+	ApprovalProgram    string // base64-encoded
+	ClearStateProgram  string // base64-encoded
+	GlobalState        map[string]tealValueDesc
+	GlobalNumUint      uint64
+	GlobalNumByteSlice uint64
+	LocalNumUint       uint64
+	LocalNumByteSlice  uint64
+	ExtraProgramPages  uint32
+}
+
+type assetDesc struct {
+	ID            uint64
+	Creator       string // Algorand Address, base32-encoded string with checksum
+	Total         uint64
+	Decimals      uint32
+	DefaultFrozen bool
+	UnitName      string
+	AssetName     string
+	URL           string
+	MetadataHash  string // base64-encoded
+	Manager       string // Algorand Address, base32-encoded string with checksum
+	Reserve       string // Algorand Address, base32-encoded string with checksum
+	Freeze        string // Algorand Address, base32-encoded string with checksum
+	Clawback      string // Algorand Address, base32-encoded string with checksum
+}
+
+type accountRecord struct {
+	balance  uint64
+	auth     basics.Address
+	holdings map[basics.AssetIndex]basics.AssetHolding
+	locals   map[basics.AppIndex]basics.TealKeyValue
+}
+
+type appRecord struct {
+	params  basics.AppParams
+	creator basics.Address
+}
+
+type assetRecord struct {
+	params  basics.AssetParams
+	creator basics.Address
+}
+
+// Ledger is an in-memory ledger implementing logic.LedgerForLogic.
+// State changes made by programs and inner transactions are applied in place.
+type Ledger struct {
+	round     basics.Round
+	timestamp int64
+	accounts  map[basics.Address]*accountRecord
+	apps      map[basics.AppIndex]*appRecord
+	assets    map[basics.AssetIndex]*assetRecord
+}
+
+// firstCreatableID is an index of the first app or asset created by inner transactions
+const firstCreatableID = 1000
+
+func newLedger() *Ledger {
+	return &Ledger{
+		accounts: make(map[basics.Address]*accountRecord),
+		apps:     make(map[basics.AppIndex]*appRecord),
+		assets:   make(map[basics.AssetIndex]*assetRecord),
+	}
+}
+
+// LoadLedger reads ledger state from JSON file. Empty file name gives an empty ledger.
+func LoadLedger(ledgerFile string) (*Ledger, error) {
+	l := newLedger()
+	if ledgerFile == "" {
+		return l, nil
+	}
+	data, err := ioutil.ReadFile(ledgerFile)
+	if err != nil {
+		return nil, err
+	}
+	var desc ledgerDesc
+	if err = json.Unmarshal(data, &desc); err != nil {
+		return nil, err
+	}
+	if err = l.load(desc); err != nil {
+		return nil, fmt.Errorf("%s: %s", ledgerFile, err.Error())
+	}
+	return l, nil
+}
+
+func (l *Ledger) load(desc ledgerDesc) (err error) {
+	l.round = basics.Round(desc.Round)
+	l.timestamp = desc.LatestTimestamp
+
+	for _, ad := range desc.Accounts {
+		var addr basics.Address
+		if addr, err = parseAddress(ad.Address); err != nil {
+			return
+		}
+		br := l.account(addr)
+		br.balance = ad.Balance
+		if br.auth, err = parseAddress(ad.AuthAddr); err != nil {
+			return
+		}
+		for _, hd := range ad.Assets {
+			br.holdings[basics.AssetIndex(hd.Asset)] = basics.AssetHolding{Amount: hd.Amount, Frozen: hd.Frozen}
+		}
+		for _, ld := range ad.Locals {
+			var kv basics.TealKeyValue
+			if kv, err = parseState(ld.State); err != nil {
+				return
+			}
+			br.locals[basics.AppIndex(ld.App)] = kv
+		}
+	}
+
+	for _, ad := range desc.Apps {
+		if ad.ID == 0 {
+			return errors.New("app ID must be non-zero")
+		}
+		app := &appRecord{}
+		if app.creator, err = parseAddress(ad.Creator); err != nil {
+			return
+		}
+		if app.params.ApprovalProgram, err = base64.StdEncoding.DecodeString(ad.ApprovalProgram); err != nil {
+			return
+		}
+		if app.params.ClearStateProgram, err = base64.StdEncoding.DecodeString(ad.ClearStateProgram); err != nil {
+			return
+		}
+		if app.params.GlobalState, err = parseState(ad.GlobalState); err != nil {
+			return
+		}
+		app.params.GlobalStateSchema = basics.StateSchema{NumUint: ad.GlobalNumUint, NumByteSlice: ad.GlobalNumByteSlice}
+		app.params.LocalStateSchema = basics.StateSchema{NumUint: ad.LocalNumUint, NumByteSlice: ad.LocalNumByteSlice}
+		app.params.ExtraProgramPages = ad.ExtraProgramPages
+		aidx := basics.AppIndex(ad.ID)
+		l.apps[aidx] = app
+		if ad.Balance != 0 {
+			l.account(aidx.Address()).balance = ad.Balance
+		}
+	}
+
+	for _, ad := range desc.Assets {
+		if ad.ID == 0 {
+			return errors.New("asset ID must be non-zero")
+		}
+		asset := &assetRecord{params: basics.AssetParams{
+			Total:         ad.Total,
+			Decimals:      ad.Decimals,
+			DefaultFrozen: ad.DefaultFrozen,
+			UnitName:      ad.UnitName,
+			AssetName:     ad.AssetName,
+			URL:           ad.URL,
+		}}
+		if asset.creator, err = parseAddress(ad.Creator); err != nil {
+			return
+		}
+		if err = decodeFixed(asset.params.MetadataHash[:], ad.MetadataHash); err != nil {
+			return
+		}
+		if asset.params.Manager, err = parseAddress(ad.Manager); err != nil {
+			return
+		}
+		if asset.params.Reserve, err = parseAddress(ad.Reserve); err != nil {
+			return
+		}
+		if asset.params.Freeze, err = parseAddress(ad.Freeze); err != nil {
+			return
+		}
+		if asset.params.Clawback, err = parseAddress(ad.Clawback); err != nil {
+			return
+		}
+		l.assets[basics.AssetIndex(ad.ID)] = asset
+	}
+	return nil
+}
+
+func parseAddress(addr string) (basics.Address, error) {
+	if addr == "" {
+		return basics.Address{}, nil
+	}
+	return basics.UnmarshalChecksumAddress(addr)
+}
+
+func parseState(state map[string]tealValueDesc) (basics.TealKeyValue, error) {
+	kv := make(basics.TealKeyValue, len(state))
+	for key, vd := range state {
+		switch {
+		case vd.Uint != nil && vd.Bytes == nil:
+			kv[key] = basics.TealValue{Type: basics.TealUintType, Uint: *vd.Uint}
+		case vd.Bytes != nil && vd.Uint == nil:
+			value, err := base64.StdEncoding.DecodeString(*vd.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			kv[key] = basics.TealValue{Type: basics.TealBytesType, Bytes: string(value)}
+		default:
+			return nil, fmt.Errorf("value of key '%s' must have either Uint or Bytes", key)
+		}
+	}
+	return kv, nil
+}
+
+// account returns account record creating an empty one if needed
+func (l *Ledger) account(addr basics.Address) *accountRecord {
+	br, ok := l.accounts[addr]
+	if !ok {
+		br = &accountRecord{
+			holdings: make(map[basics.AssetIndex]basics.AssetHolding),
+			locals:   make(map[basics.AppIndex]basics.TealKeyValue),
+		}
+		l.accounts[addr] = br
+	}
+	return br
+}
+
+// ensureApp makes sure the app exists and runs the program provided
+func (l *Ledger) ensureApp(aidx basics.AppIndex, creator basics.Address, program []byte) {
+	app, ok := l.apps[aidx]
+	if !ok {
+		app = &appRecord{creator: creator, params: basics.AppParams{GlobalState: make(basics.TealKeyValue)}}
+		l.apps[aidx] = app
+	}
+	app.params.ApprovalProgram = program
+}
+
+// Round implements logic.LedgerForLogic
+func (l *Ledger) Round() basics.Round {
+	return l.round
+}
+
+// LatestTimestamp implements logic.LedgerForLogic
+func (l *Ledger) LatestTimestamp() int64 {
+	return l.timestamp
+}
+
+// Counter implements logic.LedgerForLogic, returns the next free app or asset index
+func (l *Ledger) Counter() uint64 {
+	for idx := uint64(firstCreatableID); ; idx++ {
+		if _, ok := l.apps[basics.AppIndex(idx)]; ok {
+			continue
+		}
+		if _, ok := l.assets[basics.AssetIndex(idx)]; ok {
+			continue
+		}
+		return idx
+	}
+}
+
+// AccountData implements logic.LedgerForLogic
+func (l *Ledger) AccountData(addr basics.Address) (basics.AccountData, error) {
+	ad := basics.AccountData{
+		AssetParams:    make(map[basics.AssetIndex]basics.AssetParams),
+		Assets:         make(map[basics.AssetIndex]basics.AssetHolding),
+		AppLocalStates: make(map[basics.AppIndex]basics.AppLocalState),
+		AppParams:      make(map[basics.AppIndex]basics.AppParams),
+	}
+	if br, ok := l.accounts[addr]; ok {
+		ad.MicroAlgos = basics.MicroAlgos{Raw: br.balance}
+		ad.AuthAddr = br.auth
+		for aidx, holding := range br.holdings {
+			ad.Assets[aidx] = holding
+		}
+		for aidx, kv := range br.locals {
+			ls := basics.AppLocalState{KeyValue: kv}
+			if app, ok := l.apps[aidx]; ok {
+				ls.Schema = app.params.LocalStateSchema
+				ad.TotalAppSchema = ad.TotalAppSchema.AddSchema(ls.Schema)
+			}
+			ad.AppLocalStates[aidx] = ls
+		}
+	}
+	for aidx, asset := range l.assets {
+		if asset.creator == addr {
+			ad.AssetParams[aidx] = asset.params
+		}
+	}
+	for aidx, app := range l.apps {
+		if app.creator == addr {
+			ad.AppParams[aidx] = app.params
+			ad.TotalAppSchema = ad.TotalAppSchema.AddSchema(app.params.GlobalStateSchema)
+			ad.TotalExtraAppPages += app.params.ExtraProgramPages
+		}
+	}
+	return ad, nil
+}
+
+// Authorizer implements logic.LedgerForLogic
+func (l *Ledger) Authorizer(addr basics.Address) (basics.Address, error) {
+	if br, ok := l.accounts[addr]; ok && !br.auth.IsZero() {
+		return br.auth, nil
+	}
+	return addr, nil
+}
+
+// AssetHolding implements logic.LedgerForLogic
+func (l *Ledger) AssetHolding(addr basics.Address, assetIdx basics.AssetIndex) (basics.AssetHolding, error) {
+	if br, ok := l.accounts[addr]; ok {
+		if holding, ok := br.holdings[assetIdx]; ok {
+			return holding, nil
+		}
+	}
+	return basics.AssetHolding{}, fmt.Errorf("account %s has not opted in to asset %d", addr, assetIdx)
+}
+
+// AssetParams implements logic.LedgerForLogic
+func (l *Ledger) AssetParams(assetIdx basics.AssetIndex) (basics.AssetParams, basics.Address, error) {
+	if asset, ok := l.assets[assetIdx]; ok {
+		return asset.params, asset.creator, nil
+	}
+	return basics.AssetParams{}, basics.Address{}, fmt.Errorf("no such asset %d", assetIdx)
+}
+
+// AppParams implements logic.LedgerForLogic
+func (l *Ledger) AppParams(appIdx basics.AppIndex) (basics.AppParams, basics.Address, error) {
+	if app, ok := l.apps[appIdx]; ok {
+		return app.params, app.creator, nil
+	}
+	return basics.AppParams{}, basics.Address{}, fmt.Errorf("no such app %d", appIdx)
+}
+
+// OptedIn implements logic.LedgerForLogic
+func (l *Ledger) OptedIn(addr basics.Address, appIdx basics.AppIndex) (bool, error) {
+	if br, ok := l.accounts[addr]; ok {
+		_, ok = br.locals[appIdx]
+		return ok, nil
+	}
+	return false, nil
+}
+
+func (l *Ledger) locals(addr basics.Address, appIdx basics.AppIndex) (basics.TealKeyValue, error) {
+	if br, ok := l.accounts[addr]; ok {
+		if kv, ok := br.locals[appIdx]; ok {
+			return kv, nil
+		}
+	}
+	return nil, fmt.Errorf("account %s has not opted in to app %d", addr, appIdx)
+}
+
+// GetLocal implements logic.LedgerForLogic
+func (l *Ledger) GetLocal(addr basics.Address, appIdx basics.AppIndex, key string, accountIdx uint64) (basics.TealValue, bool, error) {
+	kv, err := l.locals(addr, appIdx)
+	if err != nil {
+		return basics.TealValue{}, false, err
+	}
+	value, ok := kv[key]
+	return value, ok, nil
+}
+
+// SetLocal implements logic.LedgerForLogic
+func (l *Ledger) SetLocal(addr basics.Address, appIdx basics.AppIndex, key string, value basics.TealValue, accountIdx uint64) error {
+	kv, err := l.locals(addr, appIdx)
+	if err != nil {
+		return err
+	}
+	kv[key] = value
+	return nil
+}
+
+// DelLocal implements logic.LedgerForLogic
+func (l *Ledger) DelLocal(addr basics.Address, appIdx basics.AppIndex, key string, accountIdx uint64) error {
+	kv, err := l.locals(addr, appIdx)
+	if err != nil {
+		return err
+	}
+	delete(kv, key)
+	return nil
+}
+
+func (l *Ledger) globals(appIdx basics.AppIndex) (basics.TealKeyValue, error) {
+	app, ok := l.apps[appIdx]
+	if !ok {
+		return nil, fmt.Errorf("no such app %d", appIdx)
+	}
+	if app.params.GlobalState == nil {
+		app.params.GlobalState = make(basics.TealKeyValue)
+	}
+	return app.params.GlobalState, nil
+}
+
+// GetGlobal implements logic.LedgerForLogic
+func (l *Ledger) GetGlobal(appIdx basics.AppIndex, key string) (basics.TealValue, bool, error) {
+	kv, err := l.globals(appIdx)
+	if err != nil {
+		return basics.TealValue{}, false, err
+	}
+	value, ok := kv[key]
+	return value, ok, nil
+}
+
+// SetGlobal implements logic.LedgerForLogic
+func (l *Ledger) SetGlobal(appIdx basics.AppIndex, key string, value basics.TealValue) error {
+	kv, err := l.globals(appIdx)
+	if err != nil {
+		return err
+	}
+	kv[key] = value
+	return nil
+}
+
+// DelGlobal implements logic.LedgerForLogic
+func (l *Ledger) DelGlobal(appIdx basics.AppIndex, key string) error {
+	kv, err := l.globals(appIdx)
+	if err != nil {
+		return err
+	}
+	delete(kv, key)
+	return nil
+}
+
+// rejectedError is returned when approval program of an application call rejects
+type rejectedError struct {
+	aidx basics.AppIndex
+}
+
+func (e rejectedError) Error() string {
+	return fmt.Sprintf("app %d rejected", e.aidx)
+}
+
+// Perform implements logic.LedgerForLogic by applying an inner transaction to the ledger
+func (l *Ledger) Perform(gi int, ep *logic.EvalParams) error {
+	txn := &ep.TxnGroup[gi]
+	if err := l.move(txn.Txn.Sender, basics.Address{}, txn.Txn.Fee.Raw); err != nil {
+		return err
+	}
+	return l.apply(gi, ep)
+}
+
+// apply applies gi transaction of the group to the ledger, fees are not charged
+func (l *Ledger) apply(gi int, ep *logic.EvalParams) error {
+	txn := &ep.TxnGroup[gi]
+	from := txn.Txn.Sender
+	if !txn.Txn.RekeyTo.IsZero() {
+		br := l.account(from)
+		br.auth = txn.Txn.RekeyTo
+		if br.auth == from {
+			br.auth = basics.Address{}
+		}
+	}
+
+	switch txn.Txn.Type {
+	case protocol.PaymentTx:
+		return l.pay(from, txn.Txn.PaymentTxnFields)
+	case protocol.AssetTransferTx:
+		return l.axfer(from, txn.Txn.AssetTransferTxnFields)
+	case protocol.AssetConfigTx:
+		return l.acfg(from, txn.Txn.AssetConfigTxnFields, &txn.ApplyData)
+	case protocol.AssetFreezeTx:
+		return l.afrz(from, txn.Txn.AssetFreezeTxnFields)
+	case protocol.ApplicationCallTx:
+		return l.appl(from, txn.Txn.ApplicationCallTxnFields, &txn.ApplyData, gi, ep)
+	case protocol.KeyRegistrationTx:
+		return nil
+	default:
+		return fmt.Errorf("%s transaction is not supported", txn.Txn.Type)
+	}
+}
+
+// move transfers algos, zero receiver burns them
+func (l *Ledger) move(from basics.Address, to basics.Address, amount uint64) error {
+	fbr := l.account(from)
+	if fbr.balance < amount {
+		return fmt.Errorf("account %s balance %d is below %d", from, fbr.balance, amount)
+	}
+	fbr.balance -= amount
+	if !to.IsZero() {
+		l.account(to).balance += amount
+	}
+	return nil
+}
+
+func (l *Ledger) pay(from basics.Address, pay transactions.PaymentTxnFields) error {
+	if err := l.move(from, pay.Receiver, pay.Amount.Raw); err != nil {
+		return err
+	}
+	if !pay.CloseRemainderTo.IsZero() {
+		return l.move(from, pay.CloseRemainderTo, l.account(from).balance)
+	}
+	return nil
+}
+
+func (l *Ledger) axfer(from basics.Address, xfer transactions.AssetTransferTxnFields) error {
+	aidx := xfer.XferAsset
+	asset, ok := l.assets[aidx]
+	if !ok {
+		return fmt.Errorf("no such asset %d", aidx)
+	}
+	sender := from
+	if !xfer.AssetSender.IsZero() {
+		sender = xfer.AssetSender
+	}
+	sbr := l.account(sender)
+	rbr := l.account(xfer.AssetReceiver)
+
+	if sender == xfer.AssetReceiver && xfer.AssetAmount == 0 {
+		// opt in
+		if _, ok := sbr.holdings[aidx]; !ok {
+			sbr.holdings[aidx] = basics.AssetHolding{Frozen: asset.params.DefaultFrozen}
+		}
+		return nil
+	}
+
+	sholding, ok := sbr.holdings[aidx]
+	if !ok {
+		return fmt.Errorf("account %s has not opted in to asset %d", sender, aidx)
+	}
+	rholding, ok := rbr.holdings[aidx]
+	if !ok {
+		return fmt.Errorf("account %s has not opted in to asset %d", xfer.AssetReceiver, aidx)
+	}
+	if sholding.Amount < xfer.AssetAmount {
+		return fmt.Errorf("account %s asset %d balance %d is below %d", sender, aidx, sholding.Amount, xfer.AssetAmount)
+	}
+	sholding.Amount -= xfer.AssetAmount
+	rholding.Amount += xfer.AssetAmount
+	sbr.holdings[aidx] = sholding
+	rbr.holdings[aidx] = rholding
+
+	if !xfer.AssetCloseTo.IsZero() {
+		cbr := l.account(xfer.AssetCloseTo)
+		cholding, ok := cbr.holdings[aidx]
+		if !ok {
+			return fmt.Errorf("account %s has not opted in to asset %d", xfer.AssetCloseTo, aidx)
+		}
+		cholding.Amount += sbr.holdings[aidx].Amount
+		cbr.holdings[aidx] = cholding
+		delete(sbr.holdings, aidx)
+	}
+	return nil
+}
+
+func (l *Ledger) acfg(from basics.Address, cfg transactions.AssetConfigTxnFields, ad *transactions.ApplyData) error {
+	aidx := cfg.ConfigAsset
+	if aidx == 0 {
+		aidx = basics.AssetIndex(l.Counter())
+		l.assets[aidx] = &assetRecord{params: cfg.AssetParams, creator: from}
+		l.account(from).holdings[aidx] = basics.AssetHolding{Amount: cfg.AssetParams.Total}
+		ad.ConfigAsset = aidx
+		return nil
+	}
+	asset, ok := l.assets[aidx]
+	if !ok {
+		return fmt.Errorf("no such asset %d", aidx)
+	}
+	if asset.params.Manager != from {
+		return fmt.Errorf("asset %d can not be configured by %s", aidx, from)
+	}
+	if (cfg.AssetParams == basics.AssetParams{}) {
+		delete(l.assets, aidx)
+		delete(l.account(asset.creator).holdings, aidx)
+		return nil
+	}
+	asset.params.Manager = cfg.AssetParams.Manager
+	asset.params.Reserve = cfg.AssetParams.Reserve
+	asset.params.Freeze = cfg.AssetParams.Freeze
+	asset.params.Clawback = cfg.AssetParams.Clawback
+	return nil
+}
+
+func (l *Ledger) afrz(from basics.Address, frz transactions.AssetFreezeTxnFields) error {
+	aidx := frz.FreezeAsset
+	asset, ok := l.assets[aidx]
+	if !ok {
+		return fmt.Errorf("no such asset %d", aidx)
+	}
+	if asset.params.Freeze != from {
+		return fmt.Errorf("asset %d can not be frozen by %s", aidx, from)
+	}
+	br := l.account(frz.FreezeAccount)
+	holding, ok := br.holdings[aidx]
+	if !ok {
+		return fmt.Errorf("account %s has not opted in to asset %d", frz.FreezeAccount, aidx)
+	}
+	holding.Frozen = frz.AssetFrozen
+	br.holdings[aidx] = holding
+	return nil
+}
+
+func (l *Ledger) appl(from basics.Address, appl transactions.ApplicationCallTxnFields, ad *transactions.ApplyData, gi int, ep *logic.EvalParams) error {
+	aidx := appl.ApplicationID
+	if aidx == 0 {
+		aidx = basics.AppIndex(l.Counter())
+		l.apps[aidx] = &appRecord{creator: from, params: basics.AppParams{
+			ApprovalProgram:   appl.ApprovalProgram,
+			ClearStateProgram: appl.ClearStateProgram,
+			GlobalState:       make(basics.TealKeyValue),
+			StateSchemas: basics.StateSchemas{
+				LocalStateSchema:  appl.LocalStateSchema,
+				GlobalStateSchema: appl.GlobalStateSchema,
+			},
+			ExtraProgramPages: appl.ExtraProgramPages,
+		}}
+		ad.ApplicationID = aidx
+	}
+	app, ok := l.apps[aidx]
+	if !ok {
+		return fmt.Errorf("no such app %d", aidx)
+	}
+
+	br := l.account(from)
+	if appl.OnCompletion == transactions.OptInOC {
+		br.locals[aidx] = make(basics.TealKeyValue)
+	}
+
+	program := app.params.ApprovalProgram
+	if appl.OnCompletion == transactions.ClearStateOC {
+		program = app.params.ClearStateProgram
+	}
+	pass, cx, err := logic.EvalContract(program, gi, aidx, ep)
+	if appl.OnCompletion == transactions.ClearStateOC {
+		// clear state program can not prevent opting out
+		delete(br.locals, aidx)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !pass {
+		return rejectedError{aidx}
+	}
+	ad.EvalDelta = cx.Txn.EvalDelta
+
+	switch appl.OnCompletion {
+	case transactions.CloseOutOC:
+		delete(br.locals, aidx)
+	case transactions.DeleteApplicationOC:
+		delete(l.apps, aidx)
+	case transactions.UpdateApplicationOC:
+		app.params.ApprovalProgram = appl.ApprovalProgram
+		app.params.ClearStateProgram = appl.ClearStateProgram
+	}
+	return nil
+}
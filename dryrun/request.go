@@ -0,0 +1,293 @@
+package dryrun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/algorand/go-algorand/config"
+	"github.com/algorand/go-algorand/data/basics"
+	"github.com/algorand/go-algorand/data/transactions"
+	"github.com/algorand/go-algorand/protocol"
+	"github.com/algorand/go-codec/codec"
+)
+
+// dryrunRequest is algod DryrunRequest as written by goal clerk dryrun --dryrun-dump.
+// Only fields needed to replay the request are decoded, sources are ignored.
+type dryrunRequest struct {
+	Txns            []transactions.SignedTxn `codec:"txns" json:"-"`
+	Accounts        []requestAccount         `json:"accounts"`
+	Apps            []requestApp             `json:"apps"`
+	ProtocolVersion string                   `json:"protocol-version"`
+	Round           uint64                   `json:"round"`
+	LatestTimestamp int64                    `json:"latest-timestamp"`
+}
+
+type requestAccount struct {
+	Address        string              `json:"address"`
+	Amount         uint64              `json:"amount"`
+	AuthAddr       string              `json:"auth-addr"`
+	Assets         []requestHolding    `json:"assets"`
+	AppsLocalState []requestLocalState `json:"apps-local-state"`
+	CreatedApps    []requestApp        `json:"created-apps"`
+	CreatedAssets  []requestAsset      `json:"created-assets"`
+}
+
+type requestHolding struct {
+	Amount   uint64 `json:"amount"`
+	AssetID  uint64 `json:"asset-id"`
+	IsFrozen bool   `json:"is-frozen"`
+}
+
+type requestLocalState struct {
+	ID       uint64            `json:"id"`
+	KeyValue []requestKeyValue `json:"key-value"`
+	Schema   requestSchema     `json:"schema"`
+}
+
+type requestKeyValue struct {
+	Key   string `json:"key"` // base64-encoded
+	Value struct {
+		Bytes string `json:"bytes"` // base64-encoded
+		Type  uint64 `json:"type"`
+		Uint  uint64 `json:"uint"`
+	} `json:"value"`
+}
+
+type requestSchema struct {
+	NumByteSlice uint64 `json:"num-byte-slice"`
+	NumUint      uint64 `json:"num-uint"`
+}
+
+type requestApp struct {
+	ID     uint64 `json:"id"`
+	Params struct {
+		ApprovalProgram   []byte            `json:"approval-program"`
+		ClearStateProgram []byte            `json:"clear-state-program"`
+		Creator           string            `json:"creator"`
+		ExtraProgramPages uint64            `json:"extra-program-pages"`
+		GlobalState       []requestKeyValue `json:"global-state"`
+		GlobalStateSchema requestSchema     `json:"global-state-schema"`
+		LocalStateSchema  requestSchema     `json:"local-state-schema"`
+	} `json:"params"`
+}
+
+type requestAsset struct {
+	Index  uint64 `json:"index"`
+	Params struct {
+		Clawback      string `json:"clawback"`
+		Creator       string `json:"creator"`
+		Decimals      uint64 `json:"decimals"`
+		DefaultFrozen bool   `json:"default-frozen"`
+		Freeze        string `json:"freeze"`
+		Manager       string `json:"manager"`
+		MetadataHash  []byte `json:"metadata-hash"`
+		Name          string `json:"name"`
+		Reserve       string `json:"reserve"`
+		Total         uint64 `json:"total"`
+		UnitName      string `json:"unit-name"`
+		URL           string `json:"url"`
+	} `json:"params"`
+}
+
+// requestHandle decodes msgpack requests ignoring fields not needed for replay
+var requestHandle = &codec.MsgpackHandle{}
+
+// loadRequest reads DryrunRequest in JSON or msgpack format.
+// It returns nil if the data is not a DryrunRequest.
+func loadRequest(data []byte) (*dryrunRequest, error) {
+	var req dryrunRequest
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var envelope struct {
+			dryrunRequest
+			Txns []json.RawMessage `json:"txns"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil || len(envelope.Txns) == 0 {
+			return nil, nil
+		}
+		req = envelope.dryrunRequest
+		req.Txns = make([]transactions.SignedTxn, len(envelope.Txns))
+		for i, raw := range envelope.Txns {
+			if err := protocol.DecodeJSON(raw, &req.Txns[i]); err != nil {
+				return nil, fmt.Errorf("txn %d: %s", i, err.Error())
+			}
+		}
+		return &req, nil
+	}
+
+	dec := codec.NewDecoderBytes(data, requestHandle)
+	if err := dec.Decode(&req); err != nil || len(req.Txns) == 0 {
+		return nil, nil
+	}
+	return &req, nil
+}
+
+// IsRequest reports whether the file holds algod DryrunRequest
+func IsRequest(requestFile string) bool {
+	data, err := ioutil.ReadFile(requestFile)
+	if err != nil {
+		return false
+	}
+	req, err := loadRequest(data)
+	return req != nil || err != nil
+}
+
+// Replay runs bytecode against transactions and ledger state of algod DryrunRequest from requestFile.
+// Non-zero appID replaces approval program of the app and runs the first transaction calling it,
+// otherwise bytecode replaces LogicSig of groupIndex transaction.
+func Replay(bytecode []byte, requestFile string, groupIndex int, appID uint64, trace *strings.Builder) (result AppResult, err error) {
+	data, err := ioutil.ReadFile(requestFile)
+	if err != nil {
+		return
+	}
+	req, err := loadRequest(data)
+	if err != nil {
+		return
+	}
+	if req == nil {
+		return result, fmt.Errorf("%s is not a dryrun request", requestFile)
+	}
+
+	proto := config.Consensus[protocol.ConsensusCurrentVersion]
+	if req.ProtocolVersion != "" {
+		var ok bool
+		if proto, ok = config.Consensus[protocol.ConsensusVersion(req.ProtocolVersion)]; !ok {
+			return result, fmt.Errorf("unknown protocol version %s", req.ProtocolVersion)
+		}
+	}
+
+	if appID == 0 {
+		result.Pass, err = runSignature(bytecode, req.Txns, groupIndex, &proto, trace, nil)
+		return
+	}
+
+	ledger := newLedger()
+	if err = ledger.loadRequest(req); err != nil {
+		return
+	}
+	groupIndex = -1
+	for i, stxn := range req.Txns {
+		if stxn.Txn.Type == protocol.ApplicationCallTx && stxn.Txn.ApplicationID == basics.AppIndex(appID) {
+			groupIndex = i
+			break
+		}
+	}
+	if groupIndex == -1 {
+		return result, fmt.Errorf("no transaction calls app %d", appID)
+	}
+	return runApp(bytecode, req.Txns, ledger, groupIndex, appID, &proto, trace, nil)
+}
+
+func (l *Ledger) loadRequest(req *dryrunRequest) (err error) {
+	l.round = basics.Round(req.Round)
+	l.timestamp = req.LatestTimestamp
+
+	for _, ra := range req.Accounts {
+		var addr basics.Address
+		if addr, err = parseAddress(ra.Address); err != nil {
+			return
+		}
+		br := l.account(addr)
+		br.balance = ra.Amount
+		if br.auth, err = parseAddress(ra.AuthAddr); err != nil {
+			return
+		}
+		for _, holding := range ra.Assets {
+			br.holdings[basics.AssetIndex(holding.AssetID)] = basics.AssetHolding{Amount: holding.Amount, Frozen: holding.IsFrozen}
+		}
+		for _, ls := range ra.AppsLocalState {
+			if br.locals[basics.AppIndex(ls.ID)], err = parseKeyValues(ls.KeyValue); err != nil {
+				return
+			}
+		}
+		for _, app := range ra.CreatedApps {
+			if err = l.loadRequestApp(app); err != nil {
+				return
+			}
+		}
+		for _, asset := range ra.CreatedAssets {
+			if err = l.loadRequestAsset(asset); err != nil {
+				return
+			}
+		}
+	}
+	for _, app := range req.Apps {
+		if err = l.loadRequestApp(app); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (l *Ledger) loadRequestApp(ra requestApp) (err error) {
+	app := &appRecord{}
+	if app.creator, err = parseAddress(ra.Params.Creator); err != nil {
+		return
+	}
+	app.params.ApprovalProgram = ra.Params.ApprovalProgram
+	app.params.ClearStateProgram = ra.Params.ClearStateProgram
+	if app.params.GlobalState, err = parseKeyValues(ra.Params.GlobalState); err != nil {
+		return
+	}
+	app.params.GlobalStateSchema = basics.StateSchema{NumUint: ra.Params.GlobalStateSchema.NumUint, NumByteSlice: ra.Params.GlobalStateSchema.NumByteSlice}
+	app.params.LocalStateSchema = basics.StateSchema{NumUint: ra.Params.LocalStateSchema.NumUint, NumByteSlice: ra.Params.LocalStateSchema.NumByteSlice}
+	app.params.ExtraProgramPages = uint32(ra.Params.ExtraProgramPages)
+	l.apps[basics.AppIndex(ra.ID)] = app
+	return nil
+}
+
+func (l *Ledger) loadRequestAsset(ra requestAsset) (err error) {
+	asset := &assetRecord{params: basics.AssetParams{
+		Total:         ra.Params.Total,
+		Decimals:      uint32(ra.Params.Decimals),
+		DefaultFrozen: ra.Params.DefaultFrozen,
+		UnitName:      ra.Params.UnitName,
+		AssetName:     ra.Params.Name,
+		URL:           ra.Params.URL,
+	}}
+	copy(asset.params.MetadataHash[:], ra.Params.MetadataHash)
+	if asset.creator, err = parseAddress(ra.Params.Creator); err != nil {
+		return
+	}
+	if asset.params.Manager, err = parseAddress(ra.Params.Manager); err != nil {
+		return
+	}
+	if asset.params.Reserve, err = parseAddress(ra.Params.Reserve); err != nil {
+		return
+	}
+	if asset.params.Freeze, err = parseAddress(ra.Params.Freeze); err != nil {
+		return
+	}
+	if asset.params.Clawback, err = parseAddress(ra.Params.Clawback); err != nil {
+		return
+	}
+	l.assets[basics.AssetIndex(ra.Index)] = asset
+	return nil
+}
+
+func parseKeyValues(kvs []requestKeyValue) (basics.TealKeyValue, error) {
+	result := make(basics.TealKeyValue, len(kvs))
+	for _, kv := range kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		switch basics.TealType(kv.Value.Type) {
+		case basics.TealBytesType:
+			value, err := base64.StdEncoding.DecodeString(kv.Value.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			result[string(key)] = basics.TealValue{Type: basics.TealBytesType, Bytes: string(value)}
+		case basics.TealUintType:
+			result[string(key)] = basics.TealValue{Type: basics.TealUintType, Uint: kv.Value.Uint}
+		default:
+			return nil, fmt.Errorf("unknown type %d of key '%s'", kv.Value.Type, string(key))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package dryrun
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/algorand/go-algorand/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	a := require.New(t)
+
+	// as written by goal clerk dryrun --dryrun-dump -o request.json
+	request := `{
+	"accounts": [{
+		"address": "` + sender + `",
+		"amount": 1000000,
+		"amount-without-pending-rewards": 1000000,
+		"apps-local-state": [{"id": 5, "key-value": [{"key": "dmlzaXRz", "value": {"bytes": "", "type": 2, "uint": 1}}],
+		                      "schema": {"num-byte-slice": 0, "num-uint": 1}}],
+		"status": "Offline"
+	}],
+	"apps": [{
+		"id": 5,
+		"params": {
+			"approval-program": "BYEB",
+			"clear-state-program": "BYEB",
+			"creator": "` + receiver + `",
+			"global-state": [{"key": "b3duZXI=", "value": {"bytes": "AQI=", "type": 1, "uint": 0}}],
+			"global-state-schema": {"num-byte-slice": 1, "num-uint": 1},
+			"local-state-schema": {"num-byte-slice": 0, "num-uint": 1}
+		}
+	}],
+	"latest-timestamp": 1600000000,
+	"protocol-version": "",
+	"round": 10,
+	"sources": null,
+	"txns": [
+		{"lsig": {"l": "BYEB"}, "txn": {"amt": 5, "fee": 1000, "fv": 1, "lv": 100,
+		 "rcv": "` + receiver + `", "snd": "` + sender + `", "type": "pay"}},
+		{"txn": {"apid": 5, "fee": 1000, "fv": 1, "lv": 100, "snd": "` + sender + `", "type": "appl"}}
+	]
+}`
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	a.NoError(ioutil.WriteFile(requestFile, []byte(request), 0644))
+	a.True(IsRequest(requestFile))
+
+	approval, err := logic.AssembleString(`#pragma version 5
+byte "owner"
+app_global_get
+byte 0x0102
+==
+txn Sender
+byte "visits"
+app_local_get
+int 1
+==
+&&
+global Round
+int 10
+==
+&&
+gtxn 0 Amount
+int 5
+==
+&&
+assert
+txn Sender
+byte "visits"
+int 2
+app_local_put
+int 1
+`)
+	a.NoError(err)
+
+	var trace strings.Builder
+	result, err := Replay(approval.Program, requestFile, 0, 5, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass)
+	a.Equal("local delta:\n  "+sender+":\n    \"visits\": 2\n", result.String())
+
+	_, err = Replay(approval.Program, requestFile, 0, 6, &trace)
+	a.EqualError(err, "no transaction calls app 6")
+
+	// LogicSig of the first transaction
+	lsig, err := logic.AssembleString(`#pragma version 5
+txn Amount
+int 5
+==
+`)
+	a.NoError(err)
+	result, err = Replay(lsig.Program, requestFile, 0, 0, &trace)
+	a.NoError(err)
+	a.True(result.Pass)
+
+	// msgpack as written by goal clerk dryrun --dryrun-dump
+	req, err := loadRequest([]byte(request))
+	a.NoError(err)
+	a.Equal(2, len(req.Txns))
+	a.Equal(int64(1600000000), req.LatestTimestamp)
+	dump := struct {
+		dryrunRequest
+		Sources []string `json:"sources"`
+	}{*req, []string{}}
+	requestFile = filepath.Join(t.TempDir(), "request.msgp")
+	a.NoError(ioutil.WriteFile(requestFile, protocol.EncodeReflect(&dump), 0644))
+	a.True(IsRequest(requestFile))
+	result, err = Replay(approval.Program, requestFile, 0, 5, &trace)
+	a.NoError(err, trace.String())
+	a.True(result.Pass)
+
+	// transaction group files are not requests
+	a.False(IsRequest(""))
+	a.NoError(ioutil.WriteFile(requestFile, []byte(`[{"Sender": "`+sender+`"}]`), 0644))
+	a.False(IsRequest(requestFile))
+}
@@ -0,0 +1,64 @@
+package dryrun
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+// traceStep matches trace lines starting with a program counter
+var traceStep = regexp.MustCompile(`^\s*(\d+) `)
+
+// traceOp matches executed opcodes, error lines have no stack after =>
+var traceOp = regexp.MustCompile(`^\s*\d+ (\S+).* => `)
+
+// AnnotateTrace appends file, line and text of the originating source line to every trace step.
+// It also returns description of the last executed source line, or an empty string if unknown.
+func AnnotateTrace(trace string, sm *compiler.SourceMap) (annotated string, last string) {
+	if sm == nil {
+		return trace, ""
+	}
+	var sb strings.Builder
+	lines := strings.Split(trace, "\n")
+	for idx, line := range lines {
+		sb.WriteString(line)
+		if match := traceStep.FindStringSubmatch(line); match != nil {
+			pc, _ := strconv.Atoi(match[1])
+			if loc, ok := sm.PCs[pc]; ok {
+				last = loc.String()
+				if text := sm.SourceText(loc); len(text) > 0 {
+					last = fmt.Sprintf("%s: %s", last, text)
+				}
+				sb.WriteString("\t// ")
+				sb.WriteString(last)
+			}
+		}
+		if idx != len(lines)-1 {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String(), last
+}
+
+// TraceCost sums opcode costs of all steps of the trace of the program.
+// Costs are taken for the version from the program header.
+func TraceCost(trace string, program []byte) (cost int) {
+	version, n := binary.Uvarint(program)
+	if n <= 0 || version > logic.LogicVersion {
+		version = logic.LogicVersion
+	}
+	for _, line := range strings.Split(trace, "\n") {
+		if match := traceOp.FindStringSubmatch(line); match != nil {
+			if spec, ok := logic.OpsByName[version][match[1]]; ok {
+				cost += spec.Details.Cost
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package dryrun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+func TestAnnotateTrace(t *testing.T) {
+	a := require.New(t)
+
+	sm := &compiler.SourceMap{PCs: map[int]compiler.SourceLocation{
+		4: {File: "a.tl", Line: 3, Column: 9},
+		6: {File: "a.tl", Line: 4, Column: 1},
+	}}
+	trace := `  1 intcblock 0 1 => <empty stack>
+  4 intc_1 => (1 0x1) 
+  6 err => (1 0x1) 
+  6 err opcode executed
+`
+	expected := `  1 intcblock 0 1 => <empty stack>
+  4 intc_1 => (1 0x1) 	// a.tl:3
+  6 err => (1 0x1) 	// a.tl:4
+  6 err opcode executed	// a.tl:4
+`
+	annotated, last := AnnotateTrace(trace, sm)
+	a.Equal(expected, annotated)
+	a.Equal("a.tl:4", last)
+
+	annotated, last = AnnotateTrace("end stack:\n[0] 1\n", sm)
+	a.Equal("end stack:\n[0] 1\n", annotated)
+	a.Empty(last)
+}
+
+func TestTraceCost(t *testing.T) {
+	a := require.New(t)
+
+	trace := `  1 intcblock 0 1 => <empty stack>
+  4 pushbytes 0x01 => (0x01) 
+  7 sha256 => (0x4bf5...) 
+  8 intc_1 => (1 0x1) 
+  9 err => (1 0x1) 
+  9 err opcode executed
+`
+	a.Equal(1+1+35+1+1, TraceCost(trace, []byte{0x06, 0x20}))
+	a.Equal(0, TraceCost("", []byte{0x06}))
+
+	// TEAL 1 has cheaper sha256 and no pushbytes
+	a.Equal(1+7+1+1, TraceCost(trace, []byte{0x01, 0x20}))
+}
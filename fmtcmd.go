@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+var fmtWrite bool
+var fmtDiff bool
+var fmtCheck bool
+
+const diffContext = 3
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [flags] [path ...]",
+	Short: "Format tealang sources",
+	Long: `Format *.tl files found in the paths provided, or stdin if no paths given, and print the result to stdout.
+Formatting uses 4 spaces indentation, single spaces around operators, one statement per line
+and keeps comments and at most one blank line between statements.`,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		if len(args) == 0 {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			if !formatSource(string(data), "<stdin>", "") {
+				failed = true
+			}
+		} else {
+			files, err := findSources(args)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			for _, file := range files {
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+				if !formatSource(string(data), file, file) {
+					failed = true
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// formatSource formats and reports a single source, path is empty for stdin.
+// Returns false on parse errors or when --check finds unformatted source.
+func formatSource(source string, name string, path string) bool {
+	formatted, errors := compiler.Format(source, filepath.Base(name))
+	if len(errors) > 0 {
+		printErrors(errors)
+		return false
+	}
+	if !fmtWrite && !fmtDiff && !fmtCheck {
+		fmt.Print(formatted)
+		return true
+	}
+	if formatted == source {
+		return true
+	}
+	if fmtCheck {
+		fmt.Println(name)
+	}
+	if fmtDiff {
+		fmt.Print(unifiedDiff(name, source, formatted))
+	}
+	if fmtWrite && len(path) > 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(path, []byte(formatted), info.Mode().Perm()); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	return !fmtCheck
+}
+
+// findSources returns files from paths and *.tl files from directories recursively
+func findSources(paths []string) (files []string, err error) {
+	for _, path := range paths {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(info.Name(), ".tl") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+	a, b int // lines of old and new texts before this one
+}
+
+// unifiedDiff returns line diff of two texts in unified format
+func unifiedDiff(name string, old string, updated string) string {
+	a := strings.SplitAfter(old, "\n")
+	b := strings.SplitAfter(updated, "\n")
+	if a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+	if b[len(b)-1] == "" {
+		b = b[:len(b)-1]
+	}
+
+	// longest common subsequence lengths of suffixes
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s (formatted)\n", name, name)
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// merge changes separated by less than two contexts
+		end := k + 1
+		for n := k; n < len(lines) && n-end < 2*diffContext; n++ {
+			if lines[n].op != ' ' {
+				end = n + 1
+			}
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		oldCount, newCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := lines[start].a, lines[start].b
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[start:end] {
+			sb.WriteByte(line.op)
+			sb.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+func setFmtCmdFlags() {
+	fmtCmd.Flags().BoolVarP(&fmtWrite, "write", "w", false, "write result to the source file instead of stdout")
+	fmtCmd.Flags().BoolVarP(&fmtDiff, "diff", "d", false, "print diffs instead of formatted sources")
+	fmtCmd.Flags().BoolVar(&fmtCheck, "check", false, "list files whose formatting differs and exit with non-zero status if any")
+	rootCmd.AddCommand(fmtCmd)
+}
@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/algorand/go-algorand v0.0.0-20220301160620-54c3c39718e6
+	github.com/algorand/go-codec/codec v0.0.0-20190507210007-269d70b6135d
 	github.com/antlr/antlr4/runtime/Go/antlr v0.0.0-20220314183648-97c793e446ba
 	github.com/spf13/cobra v0.0.3
 	github.com/stretchr/testify v1.7.0
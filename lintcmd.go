@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+var lintMode string
+var lintDisable []string
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [flags] source-file ...",
+	Short: "Check tealang programs for common smart contract security pitfalls",
+	Long: `Analyze every path of the program that approves the transaction and report missing checks:
+  rekey-to, close-remainder-to, asset-close-to: txn.RekeyTo, txn.CloseRemainderTo or txn.AssetCloseTo not compared to global.ZeroAddress
+  fee: txn.Fee not bounded
+  on-completion: application update or deletion allowed without txn.OnCompletion or txn.Sender checks
+  group-size: gtxn[N] accessed without validating N against global.GroupSize
+Checks are collected from assert calls, if conditions, returned conditions and called functions.
+LogicSig rules are rekey-to, close-remainder-to, asset-close-to, fee and group-size,
+application rules are on-completion and group-size. The mode follows the main function: logicsig for logic, app for approval and clearstate, unless set.`,
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := lintConfig()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		workDir, err := os.Getwd()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		var findings []compiler.ParserError
+		for _, file := range args {
+			fullPath, err := filepath.Abs(file)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			srcBytes, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			input := compiler.InputDesc{
+				Source:     string(srcBytes),
+				SourceFile: filepath.Base(fullPath),
+				SourceDir:  filepath.Dir(fullPath),
+				CurrentDir: workDir,
+			}
+			prog, parseErrors := compiler.ParseProgram(input)
+			if len(parseErrors) > 0 {
+				printErrors(parseErrors)
+				os.Exit(1)
+			}
+			findings = append(findings, compiler.Lint(prog, config)...)
+		}
+		if len(findings) > 0 {
+			printErrors(findings)
+			os.Exit(1)
+		}
+	},
+}
+
+// lintConfig validates --mode and --disable options
+func lintConfig() (config compiler.LintConfig, err error) {
+	if len(lintMode) > 0 && lintMode != compiler.LintModeLogicSig && lintMode != compiler.LintModeApp {
+		return config, fmt.Errorf("unknown lint mode %s, expected %s or %s", lintMode, compiler.LintModeLogicSig, compiler.LintModeApp)
+	}
+	config.Mode = lintMode
+	config.Disabled = make(map[string]bool)
+	known := make(map[string]bool, len(compiler.LintRules))
+	for _, rule := range compiler.LintRules {
+		known[rule] = true
+	}
+	for _, rule := range lintDisable {
+		if !known[rule] {
+			return config, fmt.Errorf("unknown lint rule %s, expected one of: %s", rule, strings.Join(compiler.LintRules, ", "))
+		}
+		config.Disabled[rule] = true
+	}
+	return config, nil
+}
+
+func setLintCmdFlags() {
+	lintCmd.Flags().StringVar(&lintMode, "mode", "", "program mode selecting the rules: logicsig or app, derived from the main function if not set")
+	lintCmd.Flags().StringSliceVar(&lintDisable, "disable", nil, "comma-separated rules not to check: "+strings.Join(compiler.LintRules, ", "))
+	rootCmd.AddCommand(lintCmd)
+}
@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+// fieldAccessRe matches builtin object followed by a dot and an optional field name prefix
+var fieldAccessRe = regexp.MustCompile(`\b(txn|gtxn\[[^\]]*\]|global|assets\[[^\]]*\])\.(\w*)$`)
+
+func objectFields(object string) fieldSet {
+	switch {
+	case object == "global":
+		return globalFields
+	case strings.HasPrefix(object, "assets"):
+		return assetParamsFields
+	}
+	return txnFields
+}
+
+func (s *Server) completion(params textDocumentPositionParams) []completionItem {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	line := doc.lineAt(params.Position.Line)
+	if params.Position.Character < len(line) {
+		line = line[:params.Position.Character]
+	}
+
+	items := make([]completionItem, 0, 64)
+	if m := fieldAccessRe.FindStringSubmatch(line); m != nil {
+		fields := objectFields(m[1])
+		for _, name := range fields.names {
+			item := completionItem{Label: name, Kind: completionField}
+			item.Detail, _ = compiler.FieldType(fields.opcode, name)
+			items = append(items, item)
+		}
+		return items
+	}
+
+	if doc.symbols != nil {
+		for _, sym := range doc.symbols.Visible(filepath.Base(doc.path), params.Position.Line+1) {
+			kind := completionVariable
+			switch sym.Kind {
+			case compiler.FunctionSymbol:
+				kind = completionFunction
+			case compiler.ConstantSymbol:
+				kind = completionConstant
+			case compiler.StructSymbol:
+				kind = completionStruct
+			}
+			items = append(items, completionItem{Label: sym.Name, Kind: kind, Detail: sym.Detail})
+		}
+	}
+	for _, name := range builtinFuncs {
+		item := completionItem{Label: name, Kind: completionFunction, Detail: "builtin"}
+		if doc, ok := compiler.BuiltinDoc(name); ok {
+			item.Documentation = &markupContent{"plaintext", doc}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// wordAt returns identifier at the column and its start column
+func wordAt(line string, column int) (string, int) {
+	if column > len(line) {
+		column = len(line)
+	}
+	start := column
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	end := column
+	for end < len(line) && isIdentChar(line[end]) {
+		end++
+	}
+	return line[start:end], start
+}
+
+func (s *Server) hover(params textDocumentPositionParams) interface{} {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	line := doc.lineAt(params.Position.Line)
+	word, start := wordAt(line, params.Position.Character)
+	if len(word) == 0 {
+		return nil
+	}
+	wordRange := &textRange{
+		position{params.Position.Line, start},
+		position{params.Position.Line, start + len(word)},
+	}
+	code := func(text string) string {
+		return fmt.Sprintf("```tealang\n%s\n```", text)
+	}
+
+	if doc.symbols != nil {
+		sym := doc.symbols.Lookup(filepath.Base(doc.path), params.Position.Line+1, params.Position.Character)
+		if sym != nil {
+			value := code(sym.Detail)
+			if sym.Kind == compiler.ConstantSymbol {
+				value += fmt.Sprintf("\n\ntype: %s", sym.Type)
+			}
+			return hover{markupContent{"markdown", value}, wordRange}
+		}
+	}
+
+	if m := fieldAccessRe.FindStringSubmatch(line[:start+len(word)]); m != nil && m[2] == word {
+		fields := objectFields(m[1])
+		if theType, ok := compiler.FieldType(fields.opcode, word); ok {
+			return hover{markupContent{"markdown", code(fmt.Sprintf("%s.%s: %s", m[1], word, theType))}, wordRange}
+		}
+		return nil
+	}
+
+	if text, ok := compiler.BuiltinDoc(word); ok {
+		return hover{markupContent{"markdown", code(word) + "\n\n" + text}, wordRange}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+
+	gen "github.com/pzbitskiy/tealang/gen/go"
+)
+
+// token sets mirror GLOBALFIELD, TXNFIELD, TXNARRAYFIELD, ASSETPARAMSFIELDS and BUILTINFUNC lexer rules
+
+var globalFieldTokens = []int{
+	gen.TealangLexerMINTXNFEE,
+	gen.TealangLexerMINBALANCE,
+	gen.TealangLexerMAXTXNLIFE,
+	gen.TealangLexerZEROADDRESS,
+	gen.TealangLexerGROUPSIZE,
+	gen.TealangLexerLOGICSIGVERSION,
+	gen.TealangLexerROUND,
+	gen.TealangLexerLATESTTIMESTAMP,
+	gen.TealangLexerCURRENTAPPID,
+	gen.TealangLexerCREATORADDRESS,
+	gen.TealangLexerCURRENTAPPADDRESS,
+	gen.TealangLexerGROUPID,
+	gen.TealangLexerOPCODEBUDGET,
+	gen.TealangLexerCALLERAPPID,
+	gen.TealangLexerCALLERAPPADDR,
+}
+
+var txnFieldTokens = []int{
+	gen.TealangLexerSENDER,
+	gen.TealangLexerFEE,
+	gen.TealangLexerFIRSTVALID,
+	gen.TealangLexerLASTVALID,
+	gen.TealangLexerNOTE,
+	gen.TealangLexerLEASE,
+	gen.TealangLexerRECEIVER,
+	gen.TealangLexerAMOUNT,
+	gen.TealangLexerCLOSEREMINDERTO,
+	gen.TealangLexerVOTEPK,
+	gen.TealangLexerSELECTIONPK,
+	gen.TealangLexerVOTEFIRST,
+	gen.TealangLexerVOTELAST,
+	gen.TealangLexerVOTEKD,
+	gen.TealangLexerTYPE,
+	gen.TealangLexerTYPEENUM,
+	gen.TealangLexerXFERASSET,
+	gen.TealangLexerAAMOUNT,
+	gen.TealangLexerASENDER,
+	gen.TealangLexerARECEIVER,
+	gen.TealangLexerACLOSETO,
+	gen.TealangLexerGROUPINDEX,
+	gen.TealangLexerTXID,
+	gen.TealangLexerAPPLICATIONID,
+	gen.TealangLexerONCOMPLETION,
+	gen.TealangLexerNUMARGS,
+	gen.TealangLexerAPPROVALPROGRAM,
+	gen.TealangLexerCLEARSTATEPROGRAM,
+	gen.TealangLexerREKEYTO,
+	gen.TealangLexerCONFIGASSET,
+	gen.TealangLexerCONFIGASSETTOTAL,
+	gen.TealangLexerCONFIGASSETDEC,
+	gen.TealangLexerCONFIGASSETDEFFROZEN,
+	gen.TealangLexerCONFIGASSETUNITNAM,
+	gen.TealangLexerCONFIGASSETNAME,
+	gen.TealangLexerCONFIGASSETURL,
+	gen.TealangLexerCONFIGASSETMETAHASH,
+	gen.TealangLexerCONFIGASSETMANAGER,
+	gen.TealangLexerCONFIGASSETRESERVE,
+	gen.TealangLexerCONFIGASSETFREEZE,
+	gen.TealangLexerCONFIGASSETCLAWBACK,
+	gen.TealangLexerFREEZEASSET,
+	gen.TealangLexerFREEZEASSETACCOUNT,
+	gen.TealangLexerFREEZEAZZETFROZEN,
+	gen.TealangLexerNUMASSETS,
+	gen.TealangLexerNUMAPPLICATIONS,
+	gen.TealangLexerNUMGLOBALINTS,
+	gen.TealangLexerNUMGLOBALBYTESLICES,
+	gen.TealangLexerNUMLOCALINTS,
+	gen.TealangLexerNUMLOCALBYTESLICES,
+	gen.TealangLexerEXTRAPROGRAMPAGES,
+	gen.TealangLexerNONPARTICIPATION,
+	gen.TealangLexerNUMLOGS,
+	gen.TealangLexerCREATEDASSETID,
+	gen.TealangLexerCREATEDAPPID,
+	gen.TealangLexerLASTLOG,
+	gen.TealangLexerSTATEPROOFPK,
+}
+
+var txnArrayFieldTokens = []int{
+	gen.TealangLexerTXNACCOUNTS,
+	gen.TealangLexerAPPLICATIONARGS,
+	gen.TealangLexerTXNASSETS,
+	gen.TealangLexerAPPLICATIONS,
+	gen.TealangLexerLOGS,
+}
+
+var assetParamsFieldTokens = []int{
+	gen.TealangLexerASSETTOTAL,
+	gen.TealangLexerASSETDECIMALS,
+	gen.TealangLexerASSETDEFAULTFROZEN,
+	gen.TealangLexerASSETUNITNAME,
+	gen.TealangLexerASSETNAME,
+	gen.TealangLexerASSETURL,
+	gen.TealangLexerASSETMETADATAHASH,
+	gen.TealangLexerASSETMANAGER,
+	gen.TealangLexerASSETRESERVE,
+	gen.TealangLexerASSETFREEZE,
+	gen.TealangLexerASSETCLAWBACK,
+}
+
+var builtinFuncTokens = []int{
+	gen.TealangLexerSHA256,
+	gen.TealangLexerKECCAK256,
+	gen.TealangLexerSHA512,
+	gen.TealangLexerED25519,
+	gen.TealangLexerLEN,
+	gen.TealangLexerITOB,
+	gen.TealangLexerBTOI,
+	gen.TealangLexerSUBSTRING,
+	gen.TealangLexerCONCAT,
+	gen.TealangLexerGETBIT,
+	gen.TealangLexerGETBYTE,
+	gen.TealangLexerSETBIT,
+	gen.TealangLexerSETBYTE,
+	gen.TealangLexerEXP,
+	gen.TealangLexerSHL,
+	gen.TealangLexerSHR,
+	gen.TealangLexerSQRT,
+	gen.TealangLexerBITLEN,
+	gen.TealangLexerBZERO,
+	gen.TealangLexerBADD,
+	gen.TealangLexerBSUB,
+	gen.TealangLexerBDIV,
+	gen.TealangLexerBMUL,
+	gen.TealangLexerBLT,
+	gen.TealangLexerBGT,
+	gen.TealangLexerBLE,
+	gen.TealangLexerBGE,
+	gen.TealangLexerBEQ,
+	gen.TealangLexerBNE,
+	gen.TealangLexerBMOD,
+	gen.TealangLexerBYTEOR,
+	gen.TealangLexerBYTEAND,
+	gen.TealangLexerBYTEXOR,
+	gen.TealangLexerBYTENOT,
+	gen.TealangLexerBSQRL,
+	gen.TealangLexerGAID,
+	gen.TealangLexerDIVW,
+	gen.TealangLexerASSERT,
+	gen.TealangLexerLOG,
+	gen.TealangLexerEXTRACT,
+	gen.TealangLexerMULW,
+	gen.TealangLexerADDW,
+	gen.TealangLexerDIVMODW,
+	gen.TealangLexerEXPW,
+}
+
+// fieldSet is a list of fields accessible with a dot after a builtin object
+type fieldSet struct {
+	// opcode is TEAL opcode the field types are looked up for in the language spec
+	opcode string
+	names  []string
+}
+
+var globalFields, txnFields, assetParamsFields fieldSet
+var builtinFuncs []string
+
+func init() {
+	literals := gen.NewTealangLexer(antlr.NewInputStream("")).LiteralNames
+	names := func(tokens ...[]int) (result []string) {
+		for _, set := range tokens {
+			for _, token := range set {
+				if token < len(literals) && len(literals[token]) > 0 {
+					result = append(result, strings.Trim(literals[token], "'"))
+				}
+			}
+		}
+		return
+	}
+	globalFields = fieldSet{"global", names(globalFieldTokens)}
+	txnFields = fieldSet{"txn", names(txnFieldTokens, txnArrayFieldTokens)}
+	assetParamsFields = fieldSet{"asset_params_get", names(assetParamsFieldTokens)}
+	builtinFuncs = names(builtinFuncTokens)
+}
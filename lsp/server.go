@@ -0,0 +1,232 @@
+// Package lsp implements Language Server Protocol server for tealang sources
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pzbitskiy/tealang/compiler"
+)
+
+// document is an opened source file and symbols of its last successful parse
+type document struct {
+	text    string
+	path    string
+	symbols *compiler.Symbols
+}
+
+// Server serves LSP requests from a single client
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+
+	shutdown bool
+}
+
+// NewServer creates a server reading requests from in and writing responses to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until exit notification or the input end
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		result, rpcErr := s.handle(msg)
+		if msg.ID == nil {
+			// notification, no response
+			continue
+		}
+		if rpcErr != nil {
+			err = writeMessage(s.out, errorResponse{"2.0", msg.ID, *rpcErr})
+		} else {
+			err = writeMessage(s.out, response{"2.0", msg.ID, result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg message) (interface{}, *responseError) {
+	decode := func(params interface{}) *responseError {
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return &responseError{invalidParams, err.Error()}
+		}
+		return nil
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full text on every change
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"."}},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]string{"name": "tealang"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		s.docs[params.TextDocument.URI] = &document{path: uriToPath(params.TextDocument.URI)}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		if _, ok := s.docs[params.TextDocument.URI]; !ok || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// full sync, the last change has the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, nil)
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.completion(params), nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	}
+	if msg.ID != nil {
+		return nil, &responseError{methodNotFound, fmt.Sprintf("method %s is not supported", msg.Method)}
+	}
+	return nil, nil
+}
+
+// programs have a main function or a contract
+var mainFuncRe = regexp.MustCompile(`(?m)^\s*(function\s+(logic|approval|clearstate)\s*\(|contract\s+\w+\s*\{)`)
+
+// update parses the document text and publishes diagnostics
+func (s *Server) update(uri string, text string) *responseError {
+	doc := s.docs[uri]
+	doc.text = text
+	input := compiler.InputDesc{
+		Source:     text,
+		SourceFile: filepath.Base(doc.path),
+		SourceDir:  filepath.Dir(doc.path),
+		CurrentDir: filepath.Dir(doc.path),
+	}
+	var symbols *compiler.Symbols
+	var errors []compiler.ParserError
+	if mainFuncRe.MatchString(text) {
+		_, symbols, errors = compiler.ParseProgramWithSymbols(input)
+	} else {
+		_, symbols, errors = compiler.ParseModuleWithSymbols(input)
+	}
+	// keep symbols of the last parse for completion while the text is being typed
+	if symbols != nil {
+		doc.symbols = symbols
+	}
+
+	diagnostics := make([]diagnostic, 0, len(errors))
+	for _, e := range errors {
+		d := diagnostic{Severity: severityError, Source: "tealang", Message: e.Message()}
+		if e.Filename() == input.SourceFile || e.Filename() == "" {
+			start := position{e.Line() - 1, e.Column()}
+			if start.Line < 0 {
+				start.Line = 0
+			}
+			d.Range = textRange{start, position{start.Line, start.Character + e.Length()}}
+		} else {
+			// errors in imported modules are reported at the document start
+			d.Message = fmt.Sprintf("%s:%d:%d: %s", e.Filename(), e.Line(), e.Column(), e.Message())
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return s.publish(uri, diagnostics)
+}
+
+func (s *Server) publish(uri string, diagnostics []diagnostic) *responseError {
+	if diagnostics == nil {
+		diagnostics = []diagnostic{}
+	}
+	params := publishDiagnosticsParams{uri, diagnostics}
+	if err := writeMessage(s.out, notification{"2.0", "textDocument/publishDiagnostics", params}); err != nil {
+		return &responseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// lineAt returns text of the document line
+func (doc *document) lineAt(line int) string {
+	lines := strings.Split(doc.text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
+
+func (s *Server) definition(params textDocumentPositionParams) interface{} {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || doc.symbols == nil {
+		return nil
+	}
+	file := filepath.Base(doc.path)
+	sym := doc.symbols.Lookup(file, params.Position.Line+1, params.Position.Character)
+	if sym == nil {
+		return nil
+	}
+	uri := params.TextDocument.URI
+	if sym.Location.File != file {
+		path, ok := doc.symbols.Paths[sym.Location.File]
+		if !ok {
+			// embedded stdlib module
+			return nil
+		}
+		uri = pathToURI(path)
+	}
+	return location{uri, symbolRange(sym)}
+}
+
+func symbolRange(sym *compiler.Symbol) textRange {
+	start := position{sym.Location.Line - 1, sym.Location.Column}
+	return textRange{start, position{start.Line, start.Character + len(sym.Name)}}
+}
@@ -0,0 +1,199 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testURI = "file:///tmp/test.tl"
+
+func TestReadWriteMessage(t *testing.T) {
+	a := require.New(t)
+
+	var buf bytes.Buffer
+	a.NoError(writeMessage(&buf, notification{"2.0", "test", map[string]int{"a": 1}}))
+	a.Equal("Content-Length: 50\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"test\",\"params\":{\"a\":1}}", buf.String())
+
+	msg, err := readMessage(bufio.NewReader(&buf))
+	a.NoError(err)
+	a.Equal("test", msg.Method)
+	a.Nil(msg.ID)
+	a.JSONEq(`{"a":1}`, string(msg.Params))
+}
+
+func TestServerLifecycle(t *testing.T) {
+	a := require.New(t)
+
+	var out bytes.Buffer
+	in := bytes.NewBufferString("")
+	for _, r := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"workspace/symbol","params":{}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(in, "Content-Length: %d\r\n\r\n%s", len(r), r)
+	}
+	a.NoError(NewServer(in, &out).Serve())
+
+	r := bufio.NewReader(&out)
+	var responses []map[string]interface{}
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		a.NoError(err)
+		var length int
+		_, err = fmt.Sscanf(header, "Content-Length: %d\r\n", &length)
+		a.NoError(err)
+		_, err = r.ReadString('\n')
+		a.NoError(err)
+		body := make([]byte, length)
+		_, err = io.ReadFull(r, body)
+		a.NoError(err)
+		var resp map[string]interface{}
+		a.NoError(json.Unmarshal(body, &resp))
+		responses = append(responses, resp)
+	}
+	a.Equal(3, len(responses))
+
+	a.Equal(float64(1), responses[0]["id"])
+	caps := responses[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	a.Equal(true, caps["definitionProvider"])
+	a.Equal(true, caps["hoverProvider"])
+
+	a.Equal(float64(2), responses[1]["id"])
+	a.Equal(float64(methodNotFound), responses[1]["error"].(map[string]interface{})["code"])
+
+	a.Equal(float64(3), responses[2]["id"])
+	result, ok := responses[2]["result"]
+	a.True(ok)
+	a.Nil(result)
+}
+
+func TestWordAt(t *testing.T) {
+	a := require.New(t)
+
+	word, start := wordAt("\tlet x = txn.Fee", 14)
+	a.Equal("Fee", word)
+	a.Equal(13, start)
+
+	word, start = wordAt("\treturn check(x)", 8)
+	a.Equal("check", word)
+	a.Equal(8, start)
+
+	word, _ = wordAt("a + b", 2)
+	a.Equal("", word)
+}
+
+const testProgram = `const fee = 1000
+function check(a) {
+	return a > fee
+}
+function logic() {
+	let x = txn.Fee
+	return check(x)
+}
+`
+
+func TestDiagnostics(t *testing.T) {
+	a := require.New(t)
+
+	out := &bytes.Buffer{}
+	s := NewServer(nil, out)
+	s.docs[testURI] = &document{path: "/tmp/test.tl"}
+	a.Nil(s.update(testURI, "function logic() {\n\treturn y\n}\n"))
+
+	msg, err := readMessage(bufio.NewReader(out))
+	a.NoError(err)
+	a.Equal("textDocument/publishDiagnostics", msg.Method)
+	var params publishDiagnosticsParams
+	a.NoError(json.Unmarshal(msg.Params, &params))
+	a.Equal(testURI, params.URI)
+	a.NotEmpty(params.Diagnostics)
+	a.Equal(textRange{position{1, 8}, position{1, 9}}, params.Diagnostics[0].Range)
+	a.Equal("ident not found", params.Diagnostics[0].Message)
+
+	out.Reset()
+	a.Nil(s.update(testURI, testProgram))
+	msg, err = readMessage(bufio.NewReader(out))
+	a.NoError(err)
+	a.NoError(json.Unmarshal(msg.Params, &params))
+	a.Empty(params.Diagnostics)
+}
+
+func TestDefinitionAndHover(t *testing.T) {
+	a := require.New(t)
+
+	s := NewServer(nil, &bytes.Buffer{})
+	s.docs[testURI] = &document{path: "/tmp/test.tl"}
+	a.Nil(s.update(testURI, testProgram))
+
+	at := func(line, character int) textDocumentPositionParams {
+		return textDocumentPositionParams{textDocumentIdentifier{testURI}, position{line, character}}
+	}
+
+	// check(x) call
+	a.Equal(location{testURI, textRange{position{1, 9}, position{1, 14}}}, s.definition(at(6, 9)))
+	// fee constant used in check
+	a.Equal(location{testURI, textRange{position{0, 6}, position{0, 9}}}, s.definition(at(2, 13)))
+	// return keyword
+	a.Nil(s.definition(at(6, 3)))
+
+	h := s.hover(at(6, 14)).(hover)
+	a.Equal("```tealang\nlet x: uint64\n```", h.Contents.Value)
+
+	h = s.hover(at(2, 13)).(hover)
+	a.Equal("```tealang\nconst fee = 1000\n```\n\ntype: uint64", h.Contents.Value)
+
+	h = s.hover(at(5, 14)).(hover)
+	a.Equal("```tealang\ntxn.Fee: uint64\n```", h.Contents.Value)
+	a.Equal(&textRange{position{5, 13}, position{5, 16}}, h.Range)
+}
+
+func TestCompletion(t *testing.T) {
+	a := require.New(t)
+
+	s := NewServer(nil, &bytes.Buffer{})
+	s.docs[testURI] = &document{path: "/tmp/test.tl"}
+	a.Nil(s.update(testURI, testProgram))
+
+	labels := func(items []completionItem) map[string]completionItem {
+		result := make(map[string]completionItem, len(items))
+		for _, item := range items {
+			result[item.Label] = item
+		}
+		return result
+	}
+
+	items := labels(s.completion(textDocumentPositionParams{textDocumentIdentifier{testURI}, position{6, 8}}))
+	a.Equal(completionItem{Label: "check", Kind: completionFunction, Detail: "function check(a)"}, items["check"])
+	a.Equal(completionItem{Label: "fee", Kind: completionConstant, Detail: "const fee = 1000"}, items["fee"])
+	a.Equal(completionItem{Label: "x", Kind: completionVariable, Detail: "let x: uint64"}, items["x"])
+	a.Contains(items, "sha256")
+	a.NotNil(items["sha256"].Documentation)
+
+	// fields are completed while the line does not parse yet
+	a.Nil(s.update(testURI, "function logic() {\n\tlet s = gtxn[1].\n}\n"))
+	items = labels(s.completion(textDocumentPositionParams{textDocumentIdentifier{testURI}, position{1, 17}}))
+	a.Equal(completionItem{Label: "Sender", Kind: completionField, Detail: "byte[]"}, items["Sender"])
+	a.Contains(items, "ApplicationArgs")
+	a.NotContains(items, "check")
+
+	a.Nil(s.update(testURI, "function logic() {\n\treturn global.Gr\n}\n"))
+	items = labels(s.completion(textDocumentPositionParams{textDocumentIdentifier{testURI}, position{1, 17}}))
+	a.Equal(completionItem{Label: "GroupSize", Kind: completionField, Detail: "uint64"}, items["GroupSize"])
+	a.NotContains(items, "Sender")
+
+	a.Nil(s.update(testURI, "function logic() {\n\treturn assets[0].\n}\n"))
+	items = labels(s.completion(textDocumentPositionParams{textDocumentIdentifier{testURI}, position{1, 18}}))
+	a.Contains(items, "AssetTotal")
+}
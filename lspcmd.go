@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pzbitskiy/tealang/lsp"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Run Language Server Protocol server over stdio",
+	Long: `Run Language Server Protocol server over stdin and stdout for editor integration.
+Provides diagnostics, completion of builtin object fields and declared names,
+go to definition of functions, constants and variables, and hover with types and builtin docs.`,
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout is used by the protocol, compiler diagnostics printed go to stderr
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		if err := lsp.NewServer(os.Stdin, out).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func setLspCmdFlags() {
+	rootCmd.AddCommand(lspCmd)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -25,6 +26,19 @@ var oneliner string
 var stdout bool
 var raw bool
 var dryrun string
+var optimize bool
+var showCost bool
+var writeSourceMap bool
+var assertTypes bool
+var targetVersion int
+var ledgerFile string
+var appID uint64
+var groupIndex int
+var coverageFile string
+var errorFormat string
+var warnFlags []string
+var warnError bool
+var warnDisabled map[string]bool
 
 var currentDir string
 var sourceDir string
@@ -39,6 +53,14 @@ var rootCmd = &cobra.Command{
 Documentation: https://github.com/pzbitskiy/tealang
 Syntax highlighter for vscode: https://github.com/pzbitskiy/tealang-syntax-highlighter`,
 	DisableFlagsInUseLine: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		for _, format := range compiler.DiagnosticFormats {
+			if errorFormat == format {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown errors format %s, expected one of: %s", errorFormat, strings.Join(compiler.DiagnosticFormats, ", "))
+	},
 	Args: func(cmd *cobra.Command, args []string) (err error) {
 		if len(oneliner) > 0 {
 			source = oneliner
@@ -86,6 +108,14 @@ Syntax highlighter for vscode: https://github.com/pzbitskiy/tealang-syntax-highl
 			fmt.Printf("[--raw] might be only used with [--stdout]")
 			os.Exit(1)
 		}
+		if err := parseWarnFlags(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := checkTargetFlags(cmd.Flags().Changed("dryrun")); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
 
 		var prog compiler.TreeNodeIf
 		var parseErrors []compiler.ParserError
@@ -96,9 +126,7 @@ Syntax highlighter for vscode: https://github.com/pzbitskiy/tealang-syntax-highl
 		if len(oneliner) > 0 {
 			prog, parseErrors = compiler.ParseOneLineCond(source)
 			if len(parseErrors) > 0 {
-				for _, e := range parseErrors {
-					fmt.Printf("%s\n", e.String())
-				}
+				printErrors(parseErrors)
 				os.Exit(1)
 			}
 		} else {
@@ -108,15 +136,43 @@ Syntax highlighter for vscode: https://github.com/pzbitskiy/tealang-syntax-highl
 				SourceDir:  sourceDir,
 				CurrentDir: currentDir,
 			}
-			prog, parseErrors = compiler.ParseProgram(input)
+			var warnings []compiler.ParserError
+			prog, warnings, parseErrors = compiler.ParseProgramWithWarnings(input)
 			if len(parseErrors) > 0 {
-				for _, e := range parseErrors {
-					fmt.Printf("%s\n", e.String())
-				}
+				printErrors(parseErrors)
 				os.Exit(1)
 			}
+			reportWarnings(warnings)
+		}
+		optErrors := compiler.Optimize(prog)
+		if len(optErrors) > 0 {
+			printErrors(optErrors)
+			os.Exit(1)
+		}
+		if assertTypes {
+			compiler.AssertTypes(prog)
+		}
+		if targetVersion != 0 {
+			if err := compiler.SetTargetVersion(prog, targetVersion); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		// source map is also used to annotate dryrun trace
+		runDryrun := cmd.Flags().Changed("dryrun")
+		var sourceMap *compiler.SourceMap
+		if writeSourceMap || runDryrun {
+			teal, sourceMap = compiler.CodegenWithSourceMap(prog)
+		} else {
+			teal = compiler.Codegen(prog)
+		}
+		if optimize {
+			if sourceMap != nil {
+				teal = compiler.OptimizeTEALWithSourceMap(teal, sourceMap, compiler.ReservedSlots(prog))
+			} else {
+				teal = compiler.OptimizeTEAL(teal, compiler.ReservedSlots(prog))
+			}
 		}
-		teal = compiler.Codegen(prog)
 
 		if !compileOnly {
 			op, err = logic.AssembleString(teal)
@@ -160,31 +216,165 @@ Syntax highlighter for vscode: https://github.com/pzbitskiy/tealang-syntax-highl
 			ioutil.WriteFile(outFile, output, 0644)
 		}
 
-		if cmd.Flags().Changed("dryrun") {
-			if bytecode == nil {
+		if sourceMap != nil {
+			if op == nil {
 				op, err = logic.AssembleString(teal)
 				if err != nil {
 					fmt.Println(err.Error())
 					os.Exit(1)
 				}
+			}
+			sourceMap.SetOffsets(op.OffsetToLine)
+		}
+
+		if writeSourceMap {
+			data, err := json.MarshalIndent(sourceMap, "", "  ")
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			mapFile := outFile + ".map"
+			if outFile == "" {
+				mapFile = inFile[0:len(inFile)-len(path.Ext(inFile))] + ".map"
+			}
+			if verbose {
+				fmt.Printf("Writing source map to %s\n", mapFile)
+			}
+			ioutil.WriteFile(mapFile, data, 0644)
+		}
+
+		if showCost {
+			report := compiler.EstimateCost(prog, teal)
+			fmt.Printf("cost:\n%s", report.String())
+			for _, warning := range report.Warnings() {
+				fmt.Printf("WARNING: %s\n", warning)
+			}
+		}
+
+		if runDryrun {
+			if bytecode == nil {
 				bytecode = op.Program
 			}
 			sb := strings.Builder{}
-			pass, err := dr.Run(bytecode, dryrun, &sb)
-			fmt.Printf("trace:\n%s\n", sb.String())
+			var pass bool
+			var result dr.AppResult
+			appMode := cmd.Flags().Changed("ledger")
+			if dr.IsRequest(dryrun) {
+				appMode = appID != 0
+				result, err = dr.Replay(bytecode, dryrun, groupIndex, appID, &sb)
+				pass = result.Pass
+			} else if appMode {
+				result, err = dr.RunApp(bytecode, dryrun, ledgerFile, groupIndex, appID, &sb)
+				pass = result.Pass
+			} else {
+				pass, err = dr.Run(bytecode, dryrun, groupIndex, &sb)
+			}
+			trace, last := dr.AnnotateTrace(sb.String(), sourceMap)
+			fmt.Printf("trace:\n%s\n", trace)
 			if pass {
 				fmt.Printf(" - pass -\n")
 			} else {
 				fmt.Printf("REJECT\n")
 			}
+			if appMode {
+				fmt.Print(result.String())
+			}
 			if err != nil {
 				fmt.Printf("ERROR: %s\n", err.Error())
 			}
+			if (!pass || err != nil) && len(last) > 0 {
+				fmt.Printf("last executed line: %s\n", last)
+			}
+			if len(coverageFile) > 0 {
+				cov := dr.NewCoverage()
+				cov.Add(teal, op.OffsetToLine, sourceMap, sb.String())
+				if err := writeCoverage(coverageFile, cov); err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+			}
 
 		}
 	},
 }
 
+// writeCoverage writes lcov report to the file and prints annotated sources with coverage summary
+func writeCoverage(lcovFile string, cov *dr.Coverage) error {
+	f, err := os.Create(lcovFile)
+	if err != nil {
+		return err
+	}
+	cov.WriteLcov(f)
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("coverage:\n")
+	cov.WriteListing(os.Stdout)
+	fmt.Printf("%s\n", cov.Summary())
+	return nil
+}
+
+// printErrors prints compiler errors in the format set by --format
+func printErrors(errors []compiler.ParserError) {
+	if err := compiler.WriteDiagnostics(os.Stdout, errors, errorFormat); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// parseWarnFlags validates -W options: error or no-<warning name>
+func parseWarnFlags() error {
+	warnError = false
+	warnDisabled = make(map[string]bool)
+	known := make(map[string]bool, len(compiler.WarningNames))
+	for _, name := range compiler.WarningNames {
+		known[name] = true
+	}
+	for _, flag := range warnFlags {
+		if flag == "error" {
+			warnError = true
+			continue
+		}
+		name := strings.TrimPrefix(flag, "no-")
+		if name == flag || !known[name] {
+			return fmt.Errorf("unknown warning option -W%s, expected -Werror or -Wno-<name> with one of: %s", flag, strings.Join(compiler.WarningNames, ", "))
+		}
+		warnDisabled[name] = true
+	}
+	return nil
+}
+
+// checkTargetFlags validates --target is supported by the assembler unless only TEAL is generated
+func checkTargetFlags(runDryrun bool) error {
+	if targetVersion <= int(logic.LogicVersion) {
+		return nil
+	}
+	if !compileOnly || runDryrun || writeSourceMap {
+		return fmt.Errorf("[--target] %d is above TEAL %d supported by the assembler and requires [--compile] without [--dryrun] and [--sourcemap]", targetVersion, logic.LogicVersion)
+	}
+	return nil
+}
+
+// reportWarnings prints enabled warnings to stderr.
+// With -Werror they are printed as errors to stdout and compilation stops.
+func reportWarnings(warnings []compiler.ParserError) {
+	var enabled []compiler.ParserError
+	for _, w := range warnings {
+		if !warnDisabled[w.Warning()] {
+			enabled = append(enabled, w)
+		}
+	}
+	if len(enabled) == 0 {
+		return
+	}
+	if warnError {
+		printErrors(enabled)
+		os.Exit(1)
+	}
+	if err := compiler.WriteDiagnostics(os.Stderr, enabled, errorFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+}
+
 func setRootCmdFlags() {
 	rootCmd.Flags().StringVarP(&outFile, "output", "o", "", "write output to this file")
 	rootCmd.Flags().BoolVarP(&compileOnly, "compile", "c", false, "compile to TEAL assembler, do not produce bytecode")
@@ -192,11 +382,28 @@ func setRootCmdFlags() {
 	rootCmd.Flags().StringVarP(&oneliner, "oneliner", "l", "", "compile logic one-liner like '(txn.Sender == \"abc\") && (1+2) >= 3'")
 	rootCmd.Flags().BoolVarP(&stdout, "stdout", "s", false, "write output to stdout instead of a file")
 	rootCmd.Flags().BoolVarP(&raw, "raw", "r", false, "do not hex-encode bytecode when outputting to stdout")
-	rootCmd.Flags().StringVarP(&dryrun, "dryrun", "d", "", "dry run program with transaction data from the file provided")
+	rootCmd.Flags().StringVarP(&dryrun, "dryrun", "d", "", "dry run program with transaction group or algod dryrun request from the JSON or msgpack file provided")
+	rootCmd.Flags().StringVar(&ledgerFile, "ledger", "", "dry run as application call against ledger state from the JSON file provided")
+	rootCmd.Flags().Uint64Var(&appID, "app-id", 0, "application ID to dry run the program as, overrides ApplicationID of the transaction, the call creates a new app if both are zero, used with [--ledger] or selects the app call of a dryrun request")
+	rootCmd.Flags().IntVar(&groupIndex, "group-index", 0, "index of the transaction in the dry run group the program is evaluated for")
+	rootCmd.Flags().StringVar(&coverageFile, "coverage", "", "write lcov coverage report of the dry run to this file and print annotated source, used with [--dryrun]")
+	rootCmd.Flags().BoolVarP(&optimize, "optimize", "O", false, "apply peephole optimizations to generated TEAL")
+	rootCmd.Flags().BoolVar(&writeSourceMap, "sourcemap", false, "write JSON map from TEAL lines and bytecode offsets to source lines next to the output file")
+	rootCmd.Flags().BoolVar(&assertTypes, "assert-types", false, "check types of annotated values of unknown type at runtime")
+	rootCmd.Flags().IntVar(&targetVersion, "target", 0, "TEAL version to generate code for, defaults to the language spec version, TEAL 8 enables switch and match opcodes and requires [--compile]")
+	rootCmd.Flags().BoolVar(&showCost, "cost", false, "print static opcode cost per function and source line, and program size")
+	rootCmd.Flags().StringSliceVarP(&warnFlags, "warn", "W", nil, "warnings options: -Werror treats warnings as errors, -Wno-<name> disables a warning: "+strings.Join(compiler.WarningNames, ", "))
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "format", "text", "compiler errors format: text, json or sarif")
 }
 
 func main() {
 	setRootCmdFlags()
+	setTestCmdFlags()
+	setDebugCmdFlags()
+	setLspCmdFlags()
+	setFmtCmdFlags()
+	setLintCmdFlags()
+	setDecompileCmdFlags()
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/algorand/go-algorand/data/transactions/logic"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,3 +29,68 @@ func TestMainBasic(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(out), "end_main")
 }
+
+func TestCheckTargetFlags(t *testing.T) {
+	a := require.New(t)
+	defer func() {
+		targetVersion, compileOnly, writeSourceMap = 0, false, false
+	}()
+
+	targetVersion = int(logic.LogicVersion)
+	a.NoError(checkTargetFlags(true))
+
+	targetVersion = int(logic.LogicVersion) + 2
+	err := checkTargetFlags(false)
+	a.Error(err)
+	a.Contains(err.Error(), "requires [--compile]")
+
+	compileOnly = true
+	a.NoError(checkTargetFlags(false))
+	a.Error(checkTargetFlags(true))
+
+	writeSourceMap = true
+	a.Error(checkTargetFlags(false))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := require.New(t)
+
+	a.Equal("--- a.tl\n+++ a.tl (formatted)\n", unifiedDiff("a.tl", "x\n", "x\n"))
+
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	updated := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n"
+	expected := `--- a.tl
++++ a.tl (formatted)
+@@ -2,9 +2,10 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
++11
+`
+	a.Equal(expected, unifiedDiff("a.tl", old, updated))
+
+	old = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n"
+	updated = "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	expected = `--- a.tl
++++ a.tl (formatted)
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -11,4 +11,3 @@
+ 11
+ 12
+ 13
+-14
+`
+	a.Equal(expected, unifiedDiff("a.tl", old, updated))
+}
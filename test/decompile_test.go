@@ -0,0 +1,115 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pzbitskiy/tealang/compiler"
+	"github.com/pzbitskiy/tealang/dryrun"
+)
+
+// TestDecompileBehaviour runs a program and its decompiled and recompiled version on the same transaction
+func TestDecompileBehaviour(t *testing.T) {
+	a := require.New(t)
+
+	programs := []string{`#pragma version 5
+txn Fee
+int 1000000
+<=
+bz fail
+txn TypeEnum
+int pay
+==
+bnz pay
+int 1
+store 0
+b done
+pay:
+txn Amount
+store 0
+done:
+load 0
+int 10
+>
+return
+fail:
+err
+`, `#pragma version 5
+int 0
+store 1
+int 0
+store 2
+loop:
+load 1
+int 10
+<
+bz end
+load 2
+load 1
+callsub double
++
+store 2
+load 1
+int 1
++
+store 1
+b loop
+end:
+load 2
+int 90
+==
+return
+double:
+dup
++
+retsub
+`, `#pragma version 5
+int 0
+store 0
+loop:
+load 0
+int 1
++
+store 0
+load 0
+int 5
+<
+bnz loop
+load 0
+int 5
+==
+return
+`, `#pragma version 5
+byte "hello"
+byte "abc"
+concat
+len
+pushint 8
+==
+txna Accounts 0
+global ZeroAddress
+!=
+&&
+return
+`}
+
+	for _, teal := range programs {
+		original, err := logic.AssembleString(teal)
+		a.NoError(err, teal)
+
+		source, err := compiler.Decompile(teal)
+		a.NoError(err, teal)
+		prog, parserErrors := compiler.Parse(source)
+		a.Empty(parserErrors, source)
+		a.NotNil(prog, source)
+		recompiled, err := logic.AssembleString(compiler.Codegen(prog))
+		a.NoError(err, source)
+
+		expectedPass, expectedErr := dryrun.Run(original.Program, "", 0, nil)
+		pass, err := dryrun.Run(recompiled.Program, "", 0, nil)
+		a.Equal(expectedPass, pass, source)
+		a.Equal(expectedErr != nil, err != nil, source)
+	}
+}
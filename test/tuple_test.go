@@ -23,7 +23,7 @@ func performTest(t *testing.T, source string) {
 	a.NoError(err)
 
 	sb := strings.Builder{}
-	pass, err := dryrun.Run(op.Program, "", &sb)
+	pass, err := dryrun.Run(op.Program, "", 0, &sb)
 	fmt.Printf("trace:\n%s\n", sb.String())
 
 	a.NoError(err)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	dr "github.com/pzbitskiy/tealang/dryrun"
+	"github.com/pzbitskiy/tealang/tester"
+)
+
+var testJUnitFile string
+var testFilter string
+var testVerbose bool
+var testCoverageFile string
+
+var testCmd = &cobra.Command{
+	Use:   "test [flags] [path ...]",
+	Short: "Run tealang unit tests",
+	Long: `Run test_xxx() functions from *_test.tl files found in the paths provided or in the current directory.
+Every test function is compiled as a program entry point and evaluated in dryrun,
+the test passes if it returns non-zero.
+A module with the test file name without _test suffix is imported into the test program.
+Fixtures are read from JSON file with the test file name and .json extension:
+  {"test_xxx": {"Txns": "group.json", "Ledger": "ledger.json", "AppID": 5, "GroupIndex": 0}}`,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		var filter *regexp.Regexp
+		if len(testFilter) > 0 {
+			var err error
+			if filter, err = regexp.Compile(testFilter); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		files, err := tester.Discover(args)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var cov *dr.Coverage
+		if len(testCoverageFile) > 0 {
+			cov = dr.NewCoverage()
+		}
+		var results []tester.Result
+		for _, file := range files {
+			fileResults, err := tester.RunFile(file, filter, cov)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			results = append(results, fileResults...)
+		}
+
+		failed := tester.WriteText(os.Stdout, results, testVerbose)
+
+		if len(testJUnitFile) > 0 {
+			f, err := os.Create(testJUnitFile)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			err = tester.WriteJUnit(f, results)
+			f.Close()
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if cov != nil {
+			if err := writeCoverage(testCoverageFile, cov); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func setTestCmdFlags() {
+	testCmd.Flags().StringVar(&testJUnitFile, "junit", "", "write JUnit XML report to this file")
+	testCmd.Flags().StringVar(&testFilter, "run", "", "run only tests matching the regular expression")
+	testCmd.Flags().BoolVarP(&testVerbose, "verbose", "v", false, "print dryrun trace of failed tests")
+	testCmd.Flags().StringVar(&testCoverageFile, "coverage", "", "write lcov coverage report of all tests to this file and print annotated sources")
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,127 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteText writes human-readable results, verbose adds traces of failed tests
+func WriteText(w io.Writer, results []Result, verbose bool) (failed int) {
+	for _, r := range results {
+		status := "PASS"
+		if !r.Pass {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "--- %s: %s %s (cost %d, %s)\n", status, r.File, r.Name, r.Cost, seconds(r.Duration))
+		if r.Pass {
+			continue
+		}
+		if len(r.Line) > 0 {
+			fmt.Fprintf(w, "    %s\n", r.Line)
+		}
+		for _, line := range strings.Split(r.Failure, "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		if verbose && len(r.Trace) > 0 {
+			fmt.Fprintf(w, "    trace:\n")
+			for _, line := range strings.Split(strings.TrimRight(r.Trace, "\n"), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d of %d tests failed\n", failed, len(results))
+	} else {
+		fmt.Fprintf(w, "ok: %d tests passed\n", len(results))
+	}
+	return
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as JUnit XML report with a test suite per test file
+func WriteJUnit(w io.Writer, results []Result) error {
+	var report junitTestSuites
+	suites := make(map[string]int)
+	var durations []time.Duration
+	for _, r := range results {
+		idx, ok := suites[r.File]
+		if !ok {
+			idx = len(report.Suites)
+			suites[r.File] = idx
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.File})
+			durations = append(durations, 0)
+		}
+		suite := &report.Suites[idx]
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: r.File,
+			Time:      junitTime(r.Duration),
+			SystemOut: fmt.Sprintf("cost: %d", r.Cost),
+		}
+		if !r.Pass {
+			text := r.Failure
+			if len(r.Line) > 0 {
+				text = r.Line + "\n" + text
+			}
+			if len(r.Trace) > 0 {
+				text += "\n" + r.Trace
+			}
+			tc.Failure = &junitFailure{Message: strings.SplitN(r.Failure, "\n", 2)[0], Text: text}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+		durations[idx] += r.Duration
+	}
+	for idx := range report.Suites {
+		report.Suites[idx].Time = junitTime(durations[idx])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
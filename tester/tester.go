@@ -0,0 +1,239 @@
+// Package tester runs unit tests written in tealang.
+//
+// A test file is named *_test.tl and holds declarations only.
+// Every test_xxx() function is compiled as an entry point of its own program
+// and evaluated in dryrun, it passes if it returns non-zero and does not fail.
+// If a module next to the test file has the same name without the _test suffix,
+// it is imported into the test program.
+// Optional fixtures are read from JSON file next to the test file with the same name and .json extension.
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/algorand/go-algorand/data/transactions/logic"
+
+	"github.com/pzbitskiy/tealang/compiler"
+	"github.com/pzbitskiy/tealang/dryrun"
+)
+
+// TestFileSuffix is a file name suffix of tealang test files
+const TestFileSuffix = "_test.tl"
+
+// testFunc matches test function declarations
+var testFunc = regexp.MustCompile(`(?m)^\s*(?:inline\s+)?function\s+(test_[a-zA-Z0-9_]*)\s*\(\s*\)`)
+
+// mainFunc matches main function declaration of a program that can not be imported
+var mainFunc = regexp.MustCompile(`(?m)^\s*function\s+(?:logic|approval|clearstate)\s*\(`)
+
+// Fixture describes dryrun inputs of a test.
+// Txns and Ledger are paths relative to the fixture file.
+// Ledger or AppID run the test as application call, otherwise it is LogicSig.
+type Fixture struct {
+	Txns       string
+	Ledger     string
+	AppID      uint64
+	GroupIndex int
+}
+
+// Result is an outcome of a single test
+type Result struct {
+	File string
+	Name string
+	Pass bool
+	// Failure describes why the test failed
+	Failure string
+	// Line is the last executed source line of a failed test
+	Line string
+	// Cost is opcode cost of the test execution
+	Cost     int
+	Duration time.Duration
+	Trace    string
+}
+
+// Discover returns test files in the paths provided, directories are searched recursively
+func Discover(paths []string) (files []string, err error) {
+	for _, path := range paths {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(info.Name(), TestFileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FindTests returns names of test functions declared in the source
+func FindTests(source string) (names []string) {
+	for _, match := range testFunc.FindAllStringSubmatch(source, -1) {
+		names = append(names, match[1])
+	}
+	return
+}
+
+// RunFile runs tests from the test file which names match the filter.
+// Nil filter runs all tests. Coverage of the test runs is added to cov if it is not nil.
+func RunFile(file string, filter *regexp.Regexp, cov *dryrun.Coverage) ([]Result, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	source := string(data)
+
+	fixtures, err := loadFixtures(file)
+	if err != nil {
+		return nil, err
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	fullPath, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	sourceDir := filepath.Dir(fullPath)
+
+	// import the module under test unless the test file does it itself
+	moduleName := strings.TrimSuffix(filepath.Base(file), TestFileSuffix)
+	moduleImport := ""
+	if moduleData, err := ioutil.ReadFile(filepath.Join(sourceDir, moduleName+".tl")); err == nil {
+		imported := regexp.MustCompile(`(?m)^\s*import\s+` + regexp.QuoteMeta(moduleName) + `\s*$`)
+		if !mainFunc.Match(moduleData) && !imported.MatchString(source) {
+			moduleImport = fmt.Sprintf("import %s\n", moduleName)
+		}
+	}
+
+	if cov != nil {
+		// test programs have main appended, track the test file lines only
+		cov.SetSource(file, source)
+	}
+
+	var results []Result
+	for _, name := range FindTests(source) {
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+		// main goes after the test file source so that line numbers are preserved
+		input := compiler.InputDesc{
+			Source:     fmt.Sprintf("%s\n%sfunction logic() {\n\treturn %s()\n}\n", source, moduleImport, name),
+			SourceFile: file,
+			SourceDir:  sourceDir,
+			CurrentDir: currentDir,
+		}
+		start := time.Now()
+		result := runTest(input, fixtures[name], cov)
+		result.File = file
+		result.Name = name
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// loadFixtures reads fixtures keyed by test name from file.json for file_test.tl test file
+func loadFixtures(file string) (fixtures map[string]Fixture, err error) {
+	fixtureFile := strings.TrimSuffix(file, filepath.Ext(file)) + ".json"
+	data, err := ioutil.ReadFile(fixtureFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %s", fixtureFile, err.Error())
+	}
+	dir := filepath.Dir(fixtureFile)
+	for name, fixture := range fixtures {
+		if fixture.Txns != "" {
+			fixture.Txns = filepath.Join(dir, fixture.Txns)
+		}
+		if fixture.Ledger != "" {
+			fixture.Ledger = filepath.Join(dir, fixture.Ledger)
+		}
+		fixtures[name] = fixture
+	}
+	return fixtures, nil
+}
+
+func runTest(input compiler.InputDesc, fixture Fixture, cov *dryrun.Coverage) (result Result) {
+	prog, parseErrors := compiler.ParseProgram(input)
+	if len(parseErrors) == 0 {
+		parseErrors = compiler.Optimize(prog)
+	}
+	if len(parseErrors) > 0 {
+		messages := make([]string, len(parseErrors))
+		for i, e := range parseErrors {
+			messages[i] = e.String()
+		}
+		result.Failure = strings.Join(messages, "\n")
+		return
+	}
+
+	teal, sourceMap := compiler.CodegenWithSourceMap(prog)
+	op, err := logic.AssembleString(teal)
+	if err != nil {
+		result.Failure = err.Error()
+		return
+	}
+	sourceMap.SetOffsets(op.OffsetToLine)
+
+	var sb strings.Builder
+	var pass bool
+	switch {
+	case fixture.Txns != "" && dryrun.IsRequest(fixture.Txns):
+		var appResult dryrun.AppResult
+		appResult, err = dryrun.Replay(op.Program, fixture.Txns, fixture.GroupIndex, fixture.AppID, &sb)
+		pass = appResult.Pass
+	case fixture.Ledger != "" || fixture.AppID != 0:
+		var appResult dryrun.AppResult
+		appResult, err = dryrun.RunApp(op.Program, fixture.Txns, fixture.Ledger, fixture.GroupIndex, fixture.AppID, &sb)
+		pass = appResult.Pass
+	default:
+		pass, err = dryrun.Run(op.Program, fixture.Txns, fixture.GroupIndex, &sb)
+	}
+
+	if cov != nil {
+		cov.Add(teal, op.OffsetToLine, sourceMap, sb.String())
+	}
+
+	var last string
+	result.Trace, last = dryrun.AnnotateTrace(sb.String(), sourceMap)
+	result.Cost = dryrun.TraceCost(sb.String(), op.Program)
+	result.Pass = pass && err == nil
+	if !result.Pass {
+		result.Line = last
+		if err != nil {
+			result.Failure = err.Error()
+		} else {
+			result.Failure = "rejected"
+		}
+	}
+	return
+}
@@ -0,0 +1,182 @@
+package tester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pzbitskiy/tealang/dryrun"
+)
+
+func TestFindTests(t *testing.T) {
+	a := require.New(t)
+
+	source := `
+const x = 1
+function test_one() {
+	return 1
+}
+inline function test_two () {
+	return 1
+}
+function helper_test_three() {
+	return 1
+}
+// function test_commented() {
+function test_args(a) {
+	return a
+}
+`
+	a.Equal([]string{"test_one", "test_two"}, FindTests(source))
+	a.Empty(FindTests(""))
+}
+
+func TestDiscover(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "a_test.tl"), []byte(""), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "a.tl"), []byte(""), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "a_test.json"), []byte(""), 0644))
+	sub := filepath.Join(dir, "sub")
+	a.NoError(os.Mkdir(sub, 0755))
+	a.NoError(ioutil.WriteFile(filepath.Join(sub, "b_test.tl"), []byte(""), 0644))
+
+	files, err := Discover([]string{dir})
+	a.NoError(err)
+	a.Equal([]string{filepath.Join(dir, "a_test.tl"), filepath.Join(sub, "b_test.tl")}, files)
+
+	// explicit files are taken as is
+	files, err = Discover([]string{filepath.Join(dir, "a.tl")})
+	a.NoError(err)
+	a.Equal([]string{filepath.Join(dir, "a.tl")}, files)
+
+	_, err = Discover([]string{filepath.Join(dir, "missing")})
+	a.Error(err)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a_test.tl")
+	fixtures, err := loadFixtures(file)
+	a.NoError(err)
+	a.Empty(fixtures)
+
+	data := `{"test_app": {"Txns": "group.json", "Ledger": "ledger.json", "AppID": 5, "GroupIndex": 1}}`
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "a_test.json"), []byte(data), 0644))
+	fixtures, err = loadFixtures(file)
+	a.NoError(err)
+	a.Equal(Fixture{filepath.Join(dir, "group.json"), filepath.Join(dir, "ledger.json"), 5, 1}, fixtures["test_app"])
+	a.Equal(Fixture{}, fixtures["test_other"])
+}
+
+func TestRunFile(t *testing.T) {
+	a := require.New(t)
+
+	dir := t.TempDir()
+	module := `
+function add(a, b) {
+	return a + b
+}
+`
+	tests := `
+function test_add() {
+	assert(add(1, 2) == 3)
+	return 1
+}
+
+function test_fail() {
+	let x = add(1, 1)
+	assert(x == 3)
+	return 1
+}
+
+function test_app() {
+	return txn.ApplicationID == 5
+}
+`
+	fixtures := `{"test_app": {"AppID": 5}}`
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "mymath.tl"), []byte(module), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "mymath_test.tl"), []byte(tests), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "mymath_test.json"), []byte(fixtures), 0644))
+
+	file := filepath.Join(dir, "mymath_test.tl")
+	cov := dryrun.NewCoverage()
+	results, err := RunFile(file, nil, cov)
+	a.NoError(err)
+	a.Equal(3, len(results))
+
+	a.Equal("test_add", results[0].Name)
+	a.True(results[0].Pass, results[0].Failure)
+	a.Greater(results[0].Cost, 0)
+
+	a.Equal("test_fail", results[1].Name)
+	a.False(results[1].Pass)
+	a.Contains(results[1].Line, "mymath_test.tl:9")
+	a.NotEmpty(results[1].Failure)
+
+	a.Equal("test_app", results[2].Name)
+	a.True(results[2].Pass, results[2].Failure)
+
+	var sb strings.Builder
+	cov.WriteLcov(&sb)
+	a.Contains(sb.String(), "SF:"+file+"\n")
+	a.Contains(sb.String(), "SF:mymath.tl\n")
+
+	results, err = RunFile(file, regexp.MustCompile("add"), nil)
+	a.NoError(err)
+	a.Equal(1, len(results))
+}
+
+func TestWriteReport(t *testing.T) {
+	a := require.New(t)
+
+	results := []Result{
+		{File: "a_test.tl", Name: "test_one", Pass: true, Cost: 10, Duration: time.Millisecond},
+		{File: "a_test.tl", Name: "test_two", Failure: "assert failed pc=9", Line: "a_test.tl:7: assert(x == 3)", Cost: 12, Trace: "  9 assert => <empty stack>\n"},
+		{File: "b_test.tl", Name: "test_three", Pass: true, Cost: 1},
+	}
+
+	var buf bytes.Buffer
+	failed := WriteText(&buf, results, false)
+	a.Equal(1, failed)
+	expected := `--- PASS: a_test.tl test_one (cost 10, 0.001s)
+--- FAIL: a_test.tl test_two (cost 12, 0.000s)
+    a_test.tl:7: assert(x == 3)
+    assert failed pc=9
+--- PASS: b_test.tl test_three (cost 1, 0.000s)
+FAIL: 1 of 3 tests failed
+`
+	a.Equal(expected, buf.String())
+
+	buf.Reset()
+	a.NoError(WriteJUnit(&buf, results))
+	expected = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="a_test.tl" tests="2" failures="1" time="0.001">
+    <testcase name="test_one" classname="a_test.tl" time="0.001">
+      <system-out>cost: 10</system-out>
+    </testcase>
+    <testcase name="test_two" classname="a_test.tl" time="0.000">
+      <failure message="assert failed pc=9">a_test.tl:7: assert(x == 3)&#xA;assert failed pc=9&#xA;  9 assert =&gt; &lt;empty stack&gt;&#xA;</failure>
+      <system-out>cost: 12</system-out>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.tl" tests="1" failures="0" time="0.000">
+    <testcase name="test_three" classname="b_test.tl" time="0.000">
+      <system-out>cost: 1</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	a.Equal(expected, buf.String())
+}